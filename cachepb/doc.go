@@ -0,0 +1,6 @@
+// Package cachepb holds the gRPC services of the fastcache servers,
+// generated from proto/ with buf, protoc-gen-go and protoc-gen-go-grpc.
+// Package grpcserver implements them and package client wraps their clients.
+package cachepb
+
+//go:generate sh -c "cd ../proto && buf generate"
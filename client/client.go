@@ -0,0 +1,95 @@
+// Package client is a Go client for the fastcache cache server
+// (src.CacheServer) and the vector ingestion server (src.VectorIngestServer).
+package client
+
+import (
+	"fmt"
+	"net/rpc"
+	"strings"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// Client is a connection to a cache server. It is safe for concurrent use.
+type Client struct {
+	// Token is sent with each call, for a server with an access policy. Set
+	// it before use.
+	Token string
+
+	rpc *rpc.Client
+}
+
+// Dial connects to a cache server at the TCP address addr.
+func Dial(addr string) (*Client, error) {
+	c, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: c}, nil
+}
+
+func (c *Client) call(method string, args, reply any) error {
+	err := c.rpc.Call(src.CacheServiceName+"."+method, args, reply)
+	// Errors cross the wire as text; restore the ones callers test for.
+	if serr, ok := err.(rpc.ServerError); ok {
+		switch msg := string(serr); {
+		case msg == src.ErrReadOnlyReplica.Error():
+			return src.ErrReadOnlyReplica
+		case msg == src.ErrUnauthenticated.Error():
+			return src.ErrUnauthenticated
+		case strings.HasPrefix(msg, src.ErrForbidden.Error()):
+			return forbidden(msg)
+		}
+	}
+	return err
+}
+
+// forbidden restores an error wrapping src.ErrForbidden from its text.
+func forbidden(msg string) error {
+	return fmt.Errorf("%w%s", src.ErrForbidden, strings.TrimPrefix(msg, src.ErrForbidden.Error()))
+}
+
+// Set stores a value with the given TTL (0 means no expiration).
+// It reports whether the server accepted the value.
+func (c *Client) Set(key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.SetWithCost(key, value, 0, ttl)
+}
+
+// SetWithCost stores a value with an explicit cost.
+func (c *Client) SetWithCost(key string, value []byte, cost int64, ttl time.Duration) (bool, error) {
+	var reply src.RPCSetReply
+	err := c.call("Set", &src.RPCSetArgs{Token: c.Token, Key: key, Value: value, Cost: cost, TTL: ttl}, &reply)
+	return reply.Stored, err
+}
+
+// Get returns the value of key.
+func (c *Client) Get(key string) ([]byte, bool, error) {
+	var reply src.RPCGetReply
+	err := c.call("Get", &src.RPCGetArgs{Token: c.Token, Key: key}, &reply)
+	return reply.Value, reply.Found, err
+}
+
+// Del deletes key.
+func (c *Client) Del(key string) error {
+	return c.call("Del", &src.RPCDelArgs{Token: c.Token, Key: key}, &src.RPCDelReply{})
+}
+
+// MGet returns the values of the keys that exist.
+func (c *Client) MGet(keys ...string) (map[string][]byte, error) {
+	var reply src.RPCMGetReply
+	err := c.call("MGet", &src.RPCMGetArgs{Token: c.Token, Keys: keys}, &reply)
+	return reply.Values, err
+}
+
+// Stats returns server cache statistics.
+func (c *Client) Stats() (src.RPCStatsReply, error) {
+	var reply src.RPCStatsReply
+	err := c.call("Stats", &src.RPCStatsArgs{Token: c.Token}, &reply)
+	return reply, err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
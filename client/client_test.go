@@ -0,0 +1,103 @@
+package client_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/atoncooper/fastcache/client"
+	"github.com/atoncooper/fastcache/src"
+)
+
+// listen returns a listener on a local port
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln
+}
+
+func TestClientAccessPolicy(t *testing.T) {
+	cache, err := src.NewShardedCacheV2(4, &src.Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	server := src.NewCacheServer(cache)
+	defer server.Close()
+	server.Service().Policy = src.NewAccessPolicy()
+	server.Service().Policy.Grant("team-a", "a/*", src.PermRead|src.PermWrite)
+	ln := listen(t)
+	go server.Serve(ln)
+
+	c, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Set("a/k", []byte("1"), 0); !errors.Is(err, src.ErrUnauthenticated) {
+		t.Fatalf("Set without a token = %v, want ErrUnauthenticated", err)
+	}
+	c.Token = "team-a"
+	if stored, err := c.Set("a/k", []byte("1"), 0); err != nil || !stored {
+		t.Fatalf("Set(a/k) = %v, %v", stored, err)
+	}
+	if _, _, err := c.Get("b/k"); !errors.Is(err, src.ErrForbidden) {
+		t.Fatalf("Get(b/k) = %v, want ErrForbidden", err)
+	}
+	if err := c.Del("b/k"); !errors.Is(err, src.ErrForbidden) {
+		t.Fatalf("Del(b/k) = %v, want ErrForbidden", err)
+	}
+}
+
+func TestIngestVectorsAccessPolicy(t *testing.T) {
+	config := src.DefaultVectorStoreConfig()
+	config.Dimension = 2
+	store, err := src.NewVectorStore(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ingest := src.NewVectorIngestServer(store)
+	defer ingest.Close()
+	ingest.Policy = src.NewAccessPolicy()
+	ingest.Policy.Grant("writer", "products", src.PermWrite)
+	ingest.Policy.Grant("reader", "products", src.PermRead)
+	ingest.Collection = "products"
+	ln := listen(t)
+	go ingest.Serve(ln)
+	addr := ln.Addr().String()
+
+	if _, err := client.IngestVectorsWithToken(addr, "wrong"); !errors.Is(err, src.ErrUnauthenticated) {
+		t.Fatalf("IngestVectorsWithToken(wrong) = %v, want ErrUnauthenticated", err)
+	}
+	if _, err := client.IngestVectorsWithToken(addr, "reader"); !errors.Is(err, src.ErrForbidden) {
+		t.Fatalf("IngestVectorsWithToken(reader) = %v, want ErrForbidden", err)
+	}
+	// Without an AUTH line the stream is refused
+	stream, err := client.IngestVectors(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(src.ExportItem{ID: "x", Vector: []float32{1, 2}})
+	if _, err := stream.Close(); err == nil {
+		t.Fatal("ingest without a token succeeded")
+	}
+
+	stream, err = client.IngestVectorsWithToken(addr, "writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(src.ExportItem{ID: "a", Vector: []float32{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := stream.Close(); err != nil || result.Added != 1 {
+		t.Fatalf("Close = %+v, %v", result, err)
+	}
+	if n := store.Len(); n != 1 {
+		t.Fatalf("store holds %d vectors, want 1", n)
+	}
+}
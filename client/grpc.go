@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/atoncooper/fastcache/cachepb"
+	"github.com/atoncooper/fastcache/src"
+)
+
+// GRPCClient is a connection to a server of package grpcserver. It offers
+// the calls of Client with a context, and vector ingestion streams; the
+// generated clients are available as Cache and Ingest. It is safe for
+// concurrent use.
+type GRPCClient struct {
+	Cache  cachepb.CacheServiceClient
+	Ingest cachepb.VectorIngestServiceClient
+
+	conn *grpc.ClientConn
+}
+
+// DialGRPC connects to a gRPC server at addr. Without options the
+// connection is unencrypted.
+func DialGRPC(addr string, opts ...grpc.DialOption) (*GRPCClient, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{
+		Cache:  cachepb.NewCacheServiceClient(conn),
+		Ingest: cachepb.NewVectorIngestServiceClient(conn),
+		conn:   conn,
+	}, nil
+}
+
+// WithToken returns a dial option sending token with each call, for a server
+// with an access policy. As an option of DialGRPC it replaces the default
+// ones, so pass transport credentials along with it.
+func WithToken(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(tokenCredentials(token))
+}
+
+// tokenCredentials sends a bearer token in the "authorization" metadata.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity allows tokens over insecure connections, like the
+// net/rpc client; use TLS where the network is not trusted.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// grpcError restores the errors callers test for from a gRPC status.
+func grpcError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch {
+	case s.Code() == codes.FailedPrecondition && s.Message() == src.ErrReadOnlyReplica.Error():
+		return src.ErrReadOnlyReplica
+	case s.Code() == codes.Unauthenticated && s.Message() == src.ErrUnauthenticated.Error():
+		return src.ErrUnauthenticated
+	case s.Code() == codes.PermissionDenied && strings.HasPrefix(s.Message(), src.ErrForbidden.Error()):
+		return forbidden(s.Message())
+	}
+	return err
+}
+
+// Set stores a value with the given TTL (0 means no expiration).
+// It reports whether the server accepted the value.
+func (c *GRPCClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.SetWithCost(ctx, key, value, 0, ttl)
+}
+
+// SetWithCost stores a value with an explicit cost.
+func (c *GRPCClient) SetWithCost(ctx context.Context, key string, value []byte, cost int64, ttl time.Duration) (bool, error) {
+	req := &cachepb.SetRequest{Key: key, Value: value, Cost: cost}
+	if ttl > 0 {
+		req.Ttl = durationpb.New(ttl)
+	}
+	resp, err := c.Cache.Set(ctx, req)
+	if err != nil {
+		return false, grpcError(err)
+	}
+	return resp.Stored, nil
+}
+
+// Get returns the value of key.
+func (c *GRPCClient) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	resp, err := c.Cache.Get(ctx, &cachepb.GetRequest{Key: key})
+	if err != nil {
+		return nil, false, grpcError(err)
+	}
+	return resp.Value, resp.Found, nil
+}
+
+// Del deletes key.
+func (c *GRPCClient) Del(ctx context.Context, key string) error {
+	_, err := c.Cache.Del(ctx, &cachepb.DelRequest{Key: key})
+	return grpcError(err)
+}
+
+// MGet returns the values of the keys that exist.
+func (c *GRPCClient) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	resp, err := c.Cache.MGet(ctx, &cachepb.MGetRequest{Keys: keys})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return resp.Values, nil
+}
+
+// Stats returns server cache statistics.
+func (c *GRPCClient) Stats(ctx context.Context) (src.RPCStatsReply, error) {
+	resp, err := c.Cache.Stats(ctx, &cachepb.StatsRequest{})
+	if err != nil {
+		return src.RPCStatsReply{}, grpcError(err)
+	}
+	return src.RPCStatsReply{
+		Len:         int(resp.Len),
+		Cost:        resp.Cost,
+		Hits:        resp.Hits,
+		Misses:      resp.Misses,
+		KeysAdded:   resp.KeysAdded,
+		KeysEvicted: resp.KeysEvicted,
+		Role:        resp.Role,
+	}, nil
+}
+
+// Close closes the connection.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
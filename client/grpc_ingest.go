@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/atoncooper/fastcache/cachepb"
+	"github.com/atoncooper/fastcache/src"
+)
+
+// GRPCVectorStream streams vectors to a gRPC VectorIngestService. Vectors
+// are buffered into batches, one message each; Send blocks when the server
+// falls behind, through the stream's flow control. It is not safe for
+// concurrent use.
+type GRPCVectorStream struct {
+	// BatchSize is the number of vectors per batch (src.DefaultIngestBatchSize if 0).
+	BatchSize int
+
+	stream cachepb.VectorIngestService_IngestClient
+	batch  []*cachepb.VectorItem
+}
+
+// IngestVectors opens an ingestion stream. Cancelling ctx aborts it; vectors
+// the server received before are kept.
+func (c *GRPCClient) IngestVectors(ctx context.Context) (*GRPCVectorStream, error) {
+	stream, err := c.Ingest.Ingest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCVectorStream{stream: stream}, nil
+}
+
+// Send queues vectors, sending full batches to the server. Metadata must
+// hold JSON-like values, as accepted by structpb.NewStruct.
+func (s *GRPCVectorStream) Send(items ...src.ExportItem) error {
+	size := s.BatchSize
+	if size <= 0 {
+		size = src.DefaultIngestBatchSize
+	}
+	for _, item := range items {
+		pb := &cachepb.VectorItem{Id: item.ID, Vector: item.Vector}
+		if item.Metadata != nil {
+			metadata, err := structpb.NewStruct(item.Metadata)
+			if err != nil {
+				return err
+			}
+			pb.Metadata = metadata
+		}
+		s.batch = append(s.batch, pb)
+		if len(s.batch) >= size {
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *GRPCVectorStream) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	// gRPC may still read a sent message, so batches are not reused
+	err := s.stream.Send(&cachepb.IngestRequest{Items: s.batch})
+	s.batch = nil
+	if err == io.EOF {
+		// The server ended the stream; its status says why
+		if _, rerr := s.stream.CloseAndRecv(); rerr != nil {
+			err = grpcError(rerr)
+		}
+	}
+	return err
+}
+
+// Close sends the remaining vectors, ends the stream and waits for the
+// server to apply it.
+func (s *GRPCVectorStream) Close() (src.IngestResult, error) {
+	var result src.IngestResult
+	if err := s.flush(); err != nil {
+		return result, err
+	}
+	resp, err := s.stream.CloseAndRecv()
+	if err != nil {
+		return result, grpcError(err)
+	}
+	result = src.IngestResult{Added: resp.Added, Failed: resp.Failed, Error: resp.Error}
+	if result.Error != "" {
+		return result, errors.New(result.Error)
+	}
+	return result, nil
+}
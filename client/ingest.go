@@ -0,0 +1,131 @@
+package client
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// VectorStream streams vectors to a src.VectorIngestServer.
+// Vectors are buffered into batches and gzip-compressed; Send blocks when the
+// server falls behind. It is not safe for concurrent use.
+type VectorStream struct {
+	// BatchSize is the number of vectors per batch (src.DefaultIngestBatchSize if 0).
+	BatchSize int
+
+	conn  *net.TCPConn
+	bw    *bufio.Writer
+	zw    *gzip.Writer
+	enc   *json.Encoder
+	dec   *json.Decoder
+	batch []src.ExportItem
+}
+
+// IngestVectors opens an ingestion stream to the server at the TCP address addr.
+func IngestVectors(addr string) (*VectorStream, error) {
+	return IngestVectorsWithToken(addr, "")
+}
+
+// IngestVectorsWithToken opens an ingestion stream to a server with an
+// access policy, authenticating with token. It fails with an error wrapping
+// src.ErrUnauthenticated or src.ErrForbidden if the server refuses it.
+func IngestVectorsWithToken(addr, token string) (*VectorStream, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("ingestion requires a TCP connection")
+	}
+	dec := json.NewDecoder(tcp)
+	if token != "" {
+		if _, err := fmt.Fprintf(tcp, "AUTH %s\n", token); err != nil {
+			tcp.Close()
+			return nil, err
+		}
+		var result src.IngestResult
+		if err := dec.Decode(&result); err != nil {
+			tcp.Close()
+			return nil, err
+		}
+		if result.Error != "" {
+			tcp.Close()
+			return nil, ingestError(result.Error)
+		}
+	}
+	bw := bufio.NewWriter(tcp)
+	zw := gzip.NewWriter(bw)
+	return &VectorStream{conn: tcp, bw: bw, zw: zw, enc: json.NewEncoder(zw), dec: dec}, nil
+}
+
+// ingestError restores the errors callers test for from a reply's text.
+func ingestError(msg string) error {
+	switch {
+	case msg == src.ErrUnauthenticated.Error():
+		return src.ErrUnauthenticated
+	case strings.HasPrefix(msg, src.ErrForbidden.Error()):
+		return forbidden(msg)
+	}
+	return errors.New(msg)
+}
+
+// Send queues vectors, flushing full batches to the server.
+func (s *VectorStream) Send(items ...src.ExportItem) error {
+	size := s.BatchSize
+	if size <= 0 {
+		size = src.DefaultIngestBatchSize
+	}
+	for _, item := range items {
+		s.batch = append(s.batch, item)
+		if len(s.batch) >= size {
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *VectorStream) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	err := s.enc.Encode(s.batch)
+	s.batch = s.batch[:0]
+	return err
+}
+
+// Close sends the remaining vectors, ends the stream and waits for the
+// server to apply it.
+func (s *VectorStream) Close() (src.IngestResult, error) {
+	defer s.conn.Close()
+
+	var result src.IngestResult
+	if err := s.flush(); err != nil {
+		return result, err
+	}
+	if err := s.zw.Close(); err != nil {
+		return result, err
+	}
+	if err := s.bw.Flush(); err != nil {
+		return result, err
+	}
+	if err := s.conn.CloseWrite(); err != nil {
+		return result, err
+	}
+	if err := s.dec.Decode(&result); err != nil {
+		return result, err
+	}
+	if result.Error != "" {
+		return result, errors.New(result.Error)
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// ErrNotStored is returned by a Remote Set the server did not accept, e.g.
+// because the value exceeds its MaxCost.
+var ErrNotStored = errors.New("value not stored")
+
+// Node is a Client or a Ring: something that stores byte values on cache
+// servers.
+type Node interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) (bool, error)
+	Del(key string) error
+}
+
+// Remote adapts a Client or Ring to src.RemoteCache, so cache servers can be
+// the L2 of a src.TieredCache near-cache:
+//
+//	tc := src.NewTieredCache(local, client.Remote(ring), src.TieredCacheOptions{L1TTL: 10 * time.Second})
+//
+// Calls are not interrupted by ctx; a context that is already done fails
+// the call before it is sent.
+func Remote(n Node) src.RemoteCache {
+	return remote{n}
+}
+
+type remote struct {
+	node Node
+}
+
+func (r remote) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	return r.node.Get(key)
+}
+
+func (r remote) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stored, err := r.node.Set(key, value, ttl)
+	if err == nil && !stored {
+		err = ErrNotStored
+	}
+	return err
+}
+
+func (r remote) Del(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.node.Del(key)
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// DefaultVirtualNodes is the number of points each server has on the ring.
+const DefaultVirtualNodes = 160
+
+var (
+	// ErrNoNodes is returned when the ring has no servers.
+	ErrNoNodes = errors.New("ring has no nodes")
+	// ErrNodeExists is returned by AddNode for a server already on the ring.
+	ErrNodeExists = errors.New("node already on the ring")
+	// ErrUnknownNode is returned by RemoveNode for a server not on the ring.
+	ErrUnknownNode = errors.New("node not on the ring")
+)
+
+// ringPoint is a virtual node: a hash on the ring owned by a server.
+type ringPoint struct {
+	hash uint64
+	addr string
+}
+
+// Ring spreads keys over several cache servers with a consistent hash ring.
+// Each server owns VirtualNodes points on the ring and a key belongs to the
+// server owning the first point at or after the key's hash, so adding or
+// removing a server moves only the keys of the points it gains or loses,
+// about 1/n of them. It is safe for concurrent use.
+type Ring struct {
+	mu     sync.RWMutex
+	vnodes int
+	nodes  map[string]*Client
+	points []ringPoint // sorted by hash
+	dial   func(addr string) (*Client, error)
+}
+
+// NewRing dials the servers at addrs and places them on a ring with
+// vnodes virtual nodes each (DefaultVirtualNodes if 0).
+func NewRing(addrs []string, vnodes int) (*Ring, error) {
+	return newRing(addrs, vnodes, Dial)
+}
+
+// NewRingWithToken is NewRing for servers with an access policy; every
+// connection, including those of later AddNode calls, sends token.
+func NewRingWithToken(addrs []string, vnodes int, token string) (*Ring, error) {
+	return newRing(addrs, vnodes, func(addr string) (*Client, error) {
+		c, err := Dial(addr)
+		if err == nil {
+			c.Token = token
+		}
+		return c, err
+	})
+}
+
+func newRing(addrs []string, vnodes int, dial func(addr string) (*Client, error)) (*Ring, error) {
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+	r := &Ring{vnodes: vnodes, nodes: make(map[string]*Client), dial: dial}
+	for _, addr := range addrs {
+		if err := r.AddNode(addr); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// ringHash hashes a key or virtual node name onto the ring. FNV alone
+// clusters similar names such as host:port#i, so the hash is mixed with the
+// splitmix64 finalizer to spread the points evenly.
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// AddNode dials the server at addr and adds it to the ring.
+func (r *Ring) AddNode(addr string) error {
+	r.mu.RLock()
+	_, exists := r.nodes[addr]
+	r.mu.RUnlock()
+	if exists {
+		return ErrNodeExists
+	}
+
+	c, err := r.dial(addr)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.nodes[addr]; ok {
+		c.Close()
+		return ErrNodeExists
+	}
+	r.nodes[addr] = c
+	for i := 0; i < r.vnodes; i++ {
+		r.points = append(r.points, ringPoint{hash: ringHash(addr + "#" + strconv.Itoa(i)), addr: addr})
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i].hash < r.points[j].hash })
+	return nil
+}
+
+// RemoveNode removes the server at addr from the ring and closes its
+// connection. Its keys move to the next servers on the ring.
+func (r *Ring) RemoveNode(addr string) error {
+	r.mu.Lock()
+	c, ok := r.nodes[addr]
+	if !ok {
+		r.mu.Unlock()
+		return ErrUnknownNode
+	}
+	delete(r.nodes, addr)
+	points := r.points[:0]
+	for _, p := range r.points {
+		if p.addr != addr {
+			points = append(points, p)
+		}
+	}
+	r.points = points
+	r.mu.Unlock()
+	return c.Close()
+}
+
+// Sync makes the servers on the ring exactly addrs, adding the new ones and
+// removing the others. It returns the first error of the servers it could
+// not add, which stay off the ring.
+func (r *Ring) Sync(addrs []string) error {
+	want := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		want[addr] = true
+	}
+	var firstErr error
+	for _, addr := range r.Nodes() {
+		if !want[addr] {
+			if err := r.RemoveNode(addr); err != nil && err != ErrUnknownNode && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	for addr := range want {
+		if err := r.AddNode(addr); err != nil && err != ErrNodeExists && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Follow keeps the ring in sync with the cache servers of a gossip
+// membership until the returned stop is called. Servers that cannot be
+// dialed are retried on the next membership change.
+func (r *Ring) Follow(m *src.Membership) (stop func()) {
+	changes := make(chan []string, 1)
+	done := make(chan struct{})
+	cancel := m.Watch(func(members []src.Member) {
+		var addrs []string
+		for _, member := range members {
+			if member.CacheAddr != "" {
+				addrs = append(addrs, member.CacheAddr)
+			}
+		}
+		// Keep only the latest view; Watch callbacks must not block.
+		select {
+		case <-changes:
+		default:
+		}
+		changes <- addrs
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case addrs := <-changes:
+				r.Sync(addrs)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Nodes returns the addresses of the servers on the ring, sorted.
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	addrs := make([]string, 0, len(r.nodes))
+	for addr := range r.nodes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// NodeFor returns the address of the server that owns key.
+func (r *Ring) NodeFor(key string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	addr, _, err := r.owner(key)
+	return addr, err
+}
+
+// owner returns the server that owns key (caller must hold lock).
+func (r *Ring) owner(key string) (string, *Client, error) {
+	if len(r.points) == 0 {
+		return "", nil, ErrNoNodes
+	}
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	addr := r.points[i].addr
+	return addr, r.nodes[addr], nil
+}
+
+// client returns the connection to the server that owns key.
+func (r *Ring) client(key string) (*Client, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, c, err := r.owner(key)
+	return c, err
+}
+
+// Set stores a value on the server that owns key.
+func (r *Ring) Set(key string, value []byte, ttl time.Duration) (bool, error) {
+	return r.SetWithCost(key, value, 0, ttl)
+}
+
+// SetWithCost stores a value with an explicit cost on the server that owns key.
+func (r *Ring) SetWithCost(key string, value []byte, cost int64, ttl time.Duration) (bool, error) {
+	c, err := r.client(key)
+	if err != nil {
+		return false, err
+	}
+	return c.SetWithCost(key, value, cost, ttl)
+}
+
+// Get returns the value of key from the server that owns it.
+func (r *Ring) Get(key string) ([]byte, bool, error) {
+	c, err := r.client(key)
+	if err != nil {
+		return nil, false, err
+	}
+	return c.Get(key)
+}
+
+// Del deletes key from the server that owns it.
+func (r *Ring) Del(key string) error {
+	c, err := r.client(key)
+	if err != nil {
+		return err
+	}
+	return c.Del(key)
+}
+
+// MGet returns the values of the keys that exist, with one request per
+// server. It returns the first error of any server along with the values
+// the others returned.
+func (r *Ring) MGet(keys ...string) (map[string][]byte, error) {
+	byNode := make(map[*Client][]string)
+	r.mu.RLock()
+	for _, key := range keys {
+		_, c, err := r.owner(key)
+		if err != nil {
+			r.mu.RUnlock()
+			return nil, err
+		}
+		byNode[c] = append(byNode[c], key)
+	}
+	r.mu.RUnlock()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	values := make(map[string][]byte, len(keys))
+	for c, nodeKeys := range byNode {
+		wg.Add(1)
+		go func(c *Client, nodeKeys []string) {
+			defer wg.Done()
+			vals, err := c.MGet(nodeKeys...)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for k, v := range vals {
+				values[k] = v
+			}
+		}(c, nodeKeys)
+	}
+	wg.Wait()
+	return values, firstErr
+}
+
+// Close closes the connections to all servers.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var firstErr error
+	for addr, c := range r.nodes {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.nodes, addr)
+	}
+	r.points = nil
+	return firstErr
+}
@@ -0,0 +1,141 @@
+// Command httpcache serves a slow backend through an HTTP response cache
+// built on src.RistrettoCache.
+//
+// Successful GET responses are cached by URL for -ttl and served with an
+// X-Cache: HIT header; requests with Cache-Control: no-store bypass the
+// cache. Responses are costed by their size through src.Sizer, so -max
+// bounds the bytes held.
+//
+//	go run ./examples/httpcache -addr :8080
+//	curl -i localhost:8080/report?id=1
+//
+// Its scenarios run in-process against a fake backend as tests:
+//
+//	go test ./examples/httpcache
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// response is a cached HTTP response
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// CacheCost costs a response by its size, so MaxCost is in bytes
+func (r *response) CacheCost() int64 {
+	n := int64(len(r.body)) + 64
+	for k, vs := range r.header {
+		n += int64(len(k))
+		for _, v := range vs {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
+
+// recorder captures a response while passing it through
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// responseCache is HTTP middleware caching GET responses
+type responseCache struct {
+	cache *src.RistrettoCache
+	ttl   time.Duration
+	next  http.Handler
+}
+
+func (rc *responseCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || strings.Contains(r.Header.Get("Cache-Control"), "no-store") {
+		w.Header().Set("X-Cache", "BYPASS")
+		rc.next.ServeHTTP(w, r)
+		return
+	}
+
+	key := r.URL.RequestURI()
+	if v, ok := rc.cache.Get(key); ok {
+		cached := v.(*response)
+		for k, vs := range cached.header {
+			w.Header()[k] = vs
+		}
+		w.Header().Set("X-Cache", "HIT")
+		w.WriteHeader(cached.status)
+		w.Write(cached.body)
+		return
+	}
+
+	w.Header().Set("X-Cache", "MISS")
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	rc.next.ServeHTTP(rec, r)
+	if rec.status == http.StatusOK {
+		header := w.Header().Clone()
+		header.Del("X-Cache")
+		rc.cache.SetWithTTL(key, &response{status: rec.status, header: header, body: rec.body.Bytes()}, 0, rc.ttl)
+	}
+}
+
+// backend is a slow origin that counts its calls
+type backend struct {
+	calls atomic.Int64
+	delay time.Duration
+}
+
+func (b *backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.calls.Add(1)
+	time.Sleep(b.delay)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "report %s generated at %s\n", r.URL.Query().Get("id"), time.Now().Format(time.RFC3339Nano))
+}
+
+func newResponseCache(maxBytes int64, ttl time.Duration, next http.Handler) (*responseCache, error) {
+	cache, err := src.NewRistrettoCache(&src.Config{
+		NumCounters: 100_000,
+		MaxCost:     maxBytes,
+		BufferItems: 64,
+		Metrics:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &responseCache{cache: cache, ttl: ttl, next: next}, nil
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	ttl := flag.Duration("ttl", 30*time.Second, "response TTL")
+	maxBytes := flag.Int64("max", 64<<20, "bytes of responses to cache")
+	flag.Parse()
+
+	rc, err := newResponseCache(*maxBytes, *ttl, &backend{delay: 200 * time.Millisecond})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rc.cache.Close()
+	log.Printf("serving on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, rc))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cacheTest serves a fake backend through a response cache of 4KB
+type cacheTest struct {
+	rc     *responseCache
+	origin *backend
+	server *httptest.Server
+}
+
+func newCacheTest(t *testing.T, ttl time.Duration) *cacheTest {
+	t.Helper()
+	origin := &backend{}
+	rc, err := newResponseCache(4<<10, ttl, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := &cacheTest{rc: rc, origin: origin, server: httptest.NewServer(rc)}
+	t.Cleanup(func() {
+		ct.server.Close()
+		rc.cache.Close()
+	})
+	return ct
+}
+
+// get requests path with the given header pairs and returns its X-Cache
+// header and body
+func (ct *cacheTest) get(t *testing.T, path string, header ...string) (string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ct.server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct.rc.cache.Wait()
+	return resp.Header.Get("X-Cache"), string(body)
+}
+
+// expect requests path and fails unless its X-Cache header is want
+func (ct *cacheTest) expect(t *testing.T, path, want string, header ...string) string {
+	t.Helper()
+	got, body := ct.get(t, path, header...)
+	if got != want {
+		t.Fatalf("GET %s: X-Cache %s, want %s", path, got, want)
+	}
+	return body
+}
+
+func TestResponseCacheHitsAndBypasses(t *testing.T) {
+	ct := newCacheTest(t, time.Minute)
+	first := ct.expect(t, "/report?id=1", "MISS")
+	if second := ct.expect(t, "/report?id=1", "HIT"); second != first {
+		t.Fatalf("cached body %q differs from %q", second, first)
+	}
+	ct.expect(t, "/report?id=2", "MISS")
+	ct.expect(t, "/report?id=1", "BYPASS", "Cache-Control", "no-store")
+	if calls := ct.origin.calls.Load(); calls != 3 {
+		t.Fatalf("backend called %d times, want 3", calls)
+	}
+}
+
+func TestResponseCacheExpires(t *testing.T) {
+	ct := newCacheTest(t, 100*time.Millisecond)
+	ct.expect(t, "/report?id=1", "MISS")
+	ct.expect(t, "/report?id=1", "HIT")
+	time.Sleep(150 * time.Millisecond)
+	ct.expect(t, "/report?id=1", "MISS")
+}
+
+func TestResponseCacheBoundsBytes(t *testing.T) {
+	ct := newCacheTest(t, time.Minute)
+	for i := 0; i < 200; i++ {
+		ct.get(t, fmt.Sprintf("/report?id=%d", 100+i))
+	}
+	if cost := ct.rc.cache.Cost(); cost > 4<<10 {
+		t.Fatalf("cache holds %d bytes, over its 4KB bound", cost)
+	}
+}
@@ -0,0 +1,175 @@
+// Command ragsearch is a small semantic search service of the kind used for
+// retrieval-augmented generation, built on src.VectorCache.
+//
+// Documents are embedded with a toy hashed bag-of-words model (a real
+// service would call an embedding model), stored with a TTL and found by
+// cosine similarity, optionally filtered by source:
+//
+//	go run ./examples/ragsearch -addr :8081
+//	curl -d '{"id":"d1","text":"evict the least frequent keys","source":"docs"}' localhost:8081/docs
+//	curl 'localhost:8081/search?q=eviction+of+keys&k=3'
+//
+// Its search, TTL expiry and eviction scenarios run in-process as tests:
+//
+//	go test ./examples/ragsearch
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// dimension is the size of the toy embeddings
+const dimension = 64
+
+// stopWords are left out of embeddings
+var stopWords = map[string]bool{
+	"a": true, "about": true, "after": true, "and": true, "are": true, "before": true, "by": true,
+	"did": true, "how": true, "is": true, "it": true, "its": true, "my": true, "of": true,
+	"the": true, "their": true, "when": true, "why": true,
+}
+
+// embed hashes the words of text into a normalized vector
+func embed(text string) src.Vector {
+	v := make(src.Vector, dimension)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	}) {
+		if stopWords[word] {
+			continue
+		}
+		// A crude stemmer, so "evicted", "evicts" and "eviction" meet
+		for _, suffix := range []string{"ion", "ing", "ed", "s"} {
+			if len(word) > len(suffix)+2 && strings.HasSuffix(word, suffix) {
+				word = strings.TrimSuffix(word, suffix)
+				break
+			}
+		}
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		v[h.Sum32()%dimension]++
+	}
+	var norm float64
+	for _, x := range v {
+		norm += float64(x * x)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range v {
+			v[i] *= scale
+		}
+	}
+	return v
+}
+
+// document is the JSON body of POST /docs
+type document struct {
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Source string `json:"source"`
+}
+
+// hit is an entry of the GET /search response
+type hit struct {
+	ID    string  `json:"id"`
+	Text  string  `json:"text"`
+	Score float32 `json:"score"`
+}
+
+// service serves documents and searches over a vector store
+type service struct {
+	store *src.VectorCache
+}
+
+func newService(maxCost int64, ttl time.Duration) (*service, error) {
+	config := src.DefaultVectorStoreConfig()
+	config.Metric = src.MetricCosine
+	config.Dimension = dimension
+	config.MaxCost = maxCost
+	config.TTL = ttl
+	store, err := src.NewVectorStore(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &service{store: store}, nil
+}
+
+func (s *service) add(doc document) error {
+	return s.store.Add(doc.ID, embed(doc.Text), map[string]any{"text": doc.Text, "source": doc.Source})
+}
+
+func (s *service) search(query, source string, k int) ([]hit, error) {
+	var results []src.SearchResult
+	var err error
+	if source == "" {
+		results, err = s.store.Search(embed(query), k)
+	} else {
+		results, err = s.store.SearchWithFilter(embed(query), k, func(metadata map[string]any) bool {
+			return metadata["source"] == source
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]hit, 0, len(results))
+	for _, r := range results {
+		text, _ := r.Metadata["text"].(string)
+		hits = append(hits, hit{ID: r.ID, Text: text, Score: r.Score})
+	}
+	return hits, nil
+}
+
+func (s *service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/docs" && r.Method == http.MethodPost:
+		var doc document
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc.ID == "" {
+			http.Error(w, "want {\"id\",\"text\",\"source\"}", http.StatusBadRequest)
+			return
+		}
+		if err := s.add(doc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+
+	case r.URL.Path == "/search" && r.Method == http.MethodGet:
+		k, _ := strconv.Atoi(r.URL.Query().Get("k"))
+		if k <= 0 {
+			k = 5
+		}
+		hits, err := s.search(r.URL.Query().Get("q"), r.URL.Query().Get("source"), k)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hits)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func main() {
+	addr := flag.String("addr", ":8081", "listen address")
+	ttl := flag.Duration("ttl", time.Hour, "document TTL")
+	flag.Parse()
+
+	s, err := newService(256<<20, *ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.store.Close()
+	log.Printf("serving on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// corpus is the document set of the search tests
+var corpus = []document{
+	{ID: "eviction", Text: "The cache evicts the least frequent keys when it is full", Source: "docs"},
+	{ID: "ttl", Text: "Entries expire after their TTL and are removed by a cleaner", Source: "docs"},
+	{ID: "vectors", Text: "Vector search finds the nearest embeddings by cosine similarity", Source: "docs"},
+	{ID: "faq-ttl", Text: "Why did my entry expire before its TTL?", Source: "faq"},
+}
+
+// serveCorpus posts the corpus to a service whose documents live for ttl and
+// returns its server
+func serveCorpus(t *testing.T, ttl time.Duration) *httptest.Server {
+	t.Helper()
+	s, err := newService(1<<20, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(func() {
+		server.Close()
+		s.store.Close()
+	})
+
+	for _, doc := range corpus {
+		body, _ := json.Marshal(doc)
+		resp, err := http.Post(server.URL+"/docs", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /docs %s: %s", doc.ID, resp.Status)
+		}
+	}
+	s.store.Wait()
+	return server
+}
+
+// search queries GET /search for the top 2 documents
+func search(t *testing.T, server *httptest.Server, query, source string) []hit {
+	t.Helper()
+	u := server.URL + "/search?k=2&q=" + url.QueryEscape(query) + "&source=" + url.QueryEscape(source)
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var hits []hit
+	if err := json.NewDecoder(resp.Body).Decode(&hits); err != nil {
+		t.Fatal(err)
+	}
+	return hits
+}
+
+func TestSearchRanksRelevantDocument(t *testing.T) {
+	server := serveCorpus(t, time.Minute)
+	tests := []struct {
+		query, source, want string
+	}{
+		{"how are keys evicted", "", "eviction"},
+		{"cosine similarity of embeddings", "", "vectors"},
+		{"entry expire TTL", "faq", "faq-ttl"},
+	}
+	for _, tt := range tests {
+		hits := search(t, server, tt.query, tt.source)
+		if len(hits) == 0 || hits[0].ID != tt.want {
+			t.Errorf("search %q (source %q): got %v, want %s first", tt.query, tt.source, hits, tt.want)
+		}
+	}
+}
+
+// Expired documents must disappear from results, not only from Get
+func TestSearchDropsExpiredDocuments(t *testing.T) {
+	server := serveCorpus(t, 200*time.Millisecond)
+	if hits := search(t, server, "how are keys evicted", ""); len(hits) == 0 {
+		t.Fatal("no results before the TTL")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if hits := search(t, server, "how are keys evicted", ""); len(hits) != 0 {
+		t.Fatalf("after TTL: got %v, want no results", hits)
+	}
+}
+
+// Under a small MaxCost, eviction must keep the index and the store in step:
+// every result can still be fetched
+func TestSearchAfterEviction(t *testing.T) {
+	s, err := newService(32<<10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	for i := 0; i < 500; i++ {
+		if err := s.add(document{ID: fmt.Sprintf("doc-%d", i), Text: fmt.Sprintf("note %d about topic %d", i, i%7)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.store.Wait()
+	if n := s.store.Len(); n == 0 || n >= 500 {
+		t.Fatalf("bounded store holds %d of 500 documents", n)
+	}
+	hits, err := s.search("note about topic 3", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hits {
+		if _, ok := s.store.Get(h.ID); !ok {
+			t.Errorf("search returned evicted document %s", h.ID)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Command ratelimit limits requests per client with fixed windows counted
+// in a src.RistrettoCache.
+//
+// Each request increments the counter of its client for the current window
+// with IncrBy; once it passes -limit the request is answered with 429 Too
+// Many Requests until the next window. Counters of past windows are never
+// read again, so the cache uses AdmissionOff and they age out in LRU order
+// within -max counters:
+//
+//	go run ./examples/ratelimit -addr :8082 -limit 5 -window 10s
+//	for i in 1 2 3 4 5 6; do curl -s -o /dev/null -w '%{http_code}\n' localhost:8082/; done
+//
+// Its scenarios run in-process as tests:
+//
+//	go test ./examples/ratelimit
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// limiter allows limit requests per client in every window
+type limiter struct {
+	counters *src.RistrettoCache
+	limit    int64
+	window   time.Duration
+	now      func() time.Time
+}
+
+func newLimiter(limit int64, window time.Duration, maxCounters int64) (*limiter, error) {
+	counters, err := src.NewRistrettoCache(&src.Config{
+		NumCounters:     maxCounters * 10,
+		MaxCost:         maxCounters,
+		BufferItems:     64,
+		AdmissionPolicy: src.AdmissionOff,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &limiter{counters: counters, limit: limit, window: window, now: time.Now}, nil
+}
+
+// allow counts a request of client and reports whether it is within the
+// limit, and how long until the current window ends
+func (l *limiter) allow(client string) (bool, time.Duration, error) {
+	now := l.now()
+	window := now.UnixNano() / int64(l.window)
+	n, err := l.counters.IncrBy(client+":"+strconv.FormatInt(window, 10), 1)
+	if err != nil {
+		return false, 0, err
+	}
+	reset := time.Duration((window+1)*int64(l.window) - now.UnixNano())
+	return n <= l.limit, reset, nil
+}
+
+// middleware answers requests over the limit with 429
+func (l *limiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if id := r.Header.Get("X-Client-ID"); id != "" {
+			client = id
+		}
+		ok, reset, err := l.allow(client)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int((reset+time.Second-1)/time.Second)))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func main() {
+	addr := flag.String("addr", ":8082", "listen address")
+	limit := flag.Int64("limit", 100, "requests per client and window")
+	window := flag.Duration("window", time.Minute, "window length")
+	maxCounters := flag.Int64("max", 100_000, "counters to keep")
+	flag.Parse()
+
+	l, err := newLimiter(*limit, *window, *maxCounters)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.counters.Close()
+	hello := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "hello")
+	})
+	log.Printf("serving on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, l.middleware(hello)))
+}
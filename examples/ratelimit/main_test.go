@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// limiterTest serves a limiter of 5 requests per minute on a fake clock
+type limiterTest struct {
+	l      *limiter
+	clock  atomic.Int64
+	served atomic.Int64
+	server *httptest.Server
+}
+
+func newLimiterTest(t *testing.T) *limiterTest {
+	t.Helper()
+	l, err := newLimiter(5, time.Minute, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt := &limiterTest{l: l}
+	lt.clock.Store(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	l.now = func() time.Time { return time.Unix(0, lt.clock.Load()) }
+	lt.server = httptest.NewServer(l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lt.served.Add(1)
+	})))
+	t.Cleanup(func() {
+		lt.server.Close()
+		l.counters.Close()
+	})
+	return lt
+}
+
+// get sends a request of client and returns its status. It reports errors
+// with t.Error, so it can run in other goroutines
+func (lt *limiterTest) get(t *testing.T, client string) int {
+	req, err := http.NewRequest(http.MethodGet, lt.server.URL, nil)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	req.Header.Set("X-Client-ID", client)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+	return resp.StatusCode
+}
+
+func TestLimiterLimitsEachClient(t *testing.T) {
+	lt := newLimiterTest(t)
+	for i := 1; i <= 7; i++ {
+		want := http.StatusOK
+		if i > 5 {
+			want = http.StatusTooManyRequests
+		}
+		if status := lt.get(t, "alice"); status != want {
+			t.Fatalf("request %d of alice: status %d, want %d", i, status, want)
+		}
+	}
+	if status := lt.get(t, "bob"); status != http.StatusOK {
+		t.Fatalf("bob limited by alice: status %d", status)
+	}
+}
+
+// Concurrent requests of one client must not exceed the limit: IncrBy is
+// atomic
+func TestLimiterConcurrentRequests(t *testing.T) {
+	lt := newLimiterTest(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lt.get(t, "carol")
+		}()
+	}
+	wg.Wait()
+	if n := lt.served.Load(); n != 5 {
+		t.Fatalf("served %d concurrent requests of carol, want 5", n)
+	}
+}
+
+func TestLimiterWindowRollover(t *testing.T) {
+	lt := newLimiterTest(t)
+	for i := 0; i < 6; i++ {
+		lt.get(t, "alice")
+	}
+	if status := lt.get(t, "alice"); status != http.StatusTooManyRequests {
+		t.Fatalf("alice over the limit: status %d", status)
+	}
+	lt.clock.Add(int64(time.Minute))
+	if status := lt.get(t, "alice"); status != http.StatusOK {
+		t.Fatalf("alice in the next window: status %d", status)
+	}
+}
+
+func TestLimiterBoundsCounters(t *testing.T) {
+	lt := newLimiterTest(t)
+	for i := 0; i < 1000; i++ {
+		if _, _, err := lt.l.allow(fmt.Sprintf("client-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lt.l.counters.Wait()
+	if n := lt.l.counters.Len(); n > 100 {
+		t.Fatalf("limiter holds %d counters, over its bound of 100", n)
+	}
+}
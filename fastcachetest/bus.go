@@ -0,0 +1,62 @@
+package fastcachetest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// Bus is an in-memory src.Invalidator. Published messages are delivered
+// synchronously to every subscriber, so several caches in one test can
+// share it as if they were a fleet.
+type Bus struct {
+	mu       sync.Mutex
+	next     int
+	handlers map[int]func(src.Invalidation)
+	sent     []src.Invalidation
+}
+
+// NewBus creates a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[int]func(src.Invalidation))}
+}
+
+// Publish delivers inv to every subscriber, including the publisher.
+func (b *Bus) Publish(_ context.Context, inv src.Invalidation) error {
+	b.mu.Lock()
+	b.sent = append(b.sent, inv)
+	handlers := make([]func(src.Invalidation), 0, len(b.handlers))
+	for _, h := range b.handlers {
+		handlers = append(handlers, h)
+	}
+	b.mu.Unlock()
+
+	for _, h := range handlers {
+		h(inv)
+	}
+	return nil
+}
+
+// Subscribe registers handler until unsubscribe is called.
+func (b *Bus) Subscribe(handler func(src.Invalidation)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}, nil
+}
+
+// Sent returns the messages published so far.
+func (b *Bus) Sent() []src.Invalidation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]src.Invalidation(nil), b.sent...)
+}
+
+var _ src.Invalidator = (*Bus)(nil)
@@ -0,0 +1,265 @@
+// Package fastcachetest provides deterministic in-memory fakes of the
+// fastcache interfaces for unit tests. Writes are applied synchronously,
+// nothing runs in the background and expiration follows a fake Clock, so
+// tests need neither Wait calls nor sleeps.
+package fastcachetest
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// entry is a stored value. expiration is 0 for entries without a TTL.
+type entry struct {
+	key        string
+	value      any
+	cost       int64
+	expiration time.Time
+}
+
+// Cache is a synchronous fake of src.Cache. It evicts least recently used
+// entries once MaxCost is exceeded and expires entries against its Clock.
+type Cache struct {
+	mu      sync.Mutex
+	clock   *Clock
+	maxCost int64
+	cost    int64
+	items   map[string]*list.Element
+	lru     *list.List // front is most recently used
+
+	// OnEvict is called for every entry evicted to stay within MaxCost.
+	OnEvict func(key string, value any, cost int64)
+}
+
+var _ src.Cache = (*Cache)(nil)
+
+// NewCache creates a cache holding up to maxCost (unlimited if 0) whose TTLs
+// follow clock. A nil clock starts at the Unix epoch.
+func NewCache(maxCost int64, clock *Clock) *Cache {
+	if clock == nil {
+		clock = NewClock(time.Unix(0, 0))
+	}
+	return &Cache{
+		clock:   clock,
+		maxCost: maxCost,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Clock returns the clock the cache expires entries against.
+func (c *Cache) Clock() *Clock {
+	return c.clock
+}
+
+// Set sets a value. A cost of 0 or less counts as 1. It returns false if the
+// cost exceeds MaxCost.
+func (c *Cache) Set(key string, value any, cost int64) bool {
+	return c.SetWithTTL(key, value, cost, 0)
+}
+
+// SetWithTTL sets a value that expires after ttl (0 means no expiration).
+func (c *Cache) SetWithTTL(key string, value any, cost int64, ttl time.Duration) bool {
+	if cost <= 0 {
+		cost = 1
+	}
+	if c.maxCost > 0 && cost > c.maxCost {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiration time.Time
+	if ttl > 0 {
+		expiration = c.clock.Now().Add(ttl)
+	}
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry)
+		c.cost += cost - e.cost
+		e.value, e.cost, e.expiration = value, cost, expiration
+		c.lru.MoveToFront(elem)
+	} else {
+		c.items[key] = c.lru.PushFront(&entry{key: key, value: value, cost: cost, expiration: expiration})
+		c.cost += cost
+	}
+
+	for c.maxCost > 0 && c.cost > c.maxCost {
+		e := c.lru.Back().Value.(*entry)
+		c.remove(e.key)
+		if c.OnEvict != nil {
+			c.OnEvict(e.key, e.value, e.cost)
+		}
+	}
+	return true
+}
+
+// lookup returns the live entry of key, removing it if it expired
+// (caller must hold the lock).
+func (c *Cache) lookup(key string) (*list.Element, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !e.expiration.IsZero() && !c.clock.Now().Before(e.expiration) {
+		c.remove(key)
+		return nil, false
+	}
+	return elem, true
+}
+
+// remove deletes key (caller must hold the lock).
+func (c *Cache) remove(key string) {
+	if elem, ok := c.items[key]; ok {
+		c.cost -= elem.Value.(*entry).cost
+		c.lru.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// ttl returns the remaining TTL of e, 0 if it has none.
+func (c *Cache) ttl(e *entry) time.Duration {
+	if e.expiration.IsZero() {
+		return 0
+	}
+	return e.expiration.Sub(c.clock.Now())
+}
+
+// Get gets a value and marks it as recently used.
+func (c *Cache) Get(key string) (any, bool) {
+	value, ok, _ := c.GetWithTTL(key)
+	return value, ok
+}
+
+// GetWithTTL gets a value and its remaining TTL (0 if it has none).
+func (c *Cache) GetWithTTL(key string) (any, bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return nil, false, 0
+	}
+	c.lru.MoveToFront(elem)
+	e := elem.Value.(*entry)
+	return e.value, true, c.ttl(e)
+}
+
+// GetTTL returns the remaining TTL of key. It returns false if the key is
+// missing or has no TTL.
+func (c *Cache) GetTTL(key string) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	e := elem.Value.(*entry)
+	if e.expiration.IsZero() {
+		return 0, false
+	}
+	return c.ttl(e), true
+}
+
+// Exists reports whether key is present, without marking it as used.
+func (c *Cache) Exists(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.lookup(key)
+	return ok
+}
+
+// Expire sets the TTL of key. A ttl of zero or less deletes the key.
+// It returns false if the key is missing.
+func (c *Cache) Expire(key string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+	if ttl <= 0 {
+		c.remove(key)
+		return true
+	}
+	elem.Value.(*entry).expiration = c.clock.Now().Add(ttl)
+	return true
+}
+
+// Persist removes the TTL of key. It returns false if the key is missing.
+func (c *Cache) Persist(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+	elem.Value.(*entry).expiration = time.Time{}
+	return true
+}
+
+// Touch marks key as recently used. It returns false if the key is missing.
+func (c *Cache) Touch(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.lookup(key)
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	return ok
+}
+
+// Del deletes key.
+func (c *Cache) Del(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+}
+
+// expire removes all expired entries (caller must hold the lock).
+func (c *Cache) expire() {
+	for key := range c.items {
+		c.lookup(key)
+	}
+}
+
+// Len returns the number of unexpired entries.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+	return len(c.items)
+}
+
+// Cost returns the total cost of the unexpired entries.
+func (c *Cache) Cost() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+	return c.cost
+}
+
+// Clear removes all entries.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.cost = 0
+}
+
+// Wait returns immediately: writes are applied synchronously.
+func (c *Cache) Wait() {}
+
+// Close does nothing; the cache stays usable.
+func (c *Cache) Close() error {
+	return nil
+}
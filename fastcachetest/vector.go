@@ -0,0 +1,115 @@
+package fastcachetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// VectorStore is a synchronous fake of src.VectorStore backed by an exact
+// flat index, so search results are deterministic. Vectors added with a TTL
+// expire against its Clock.
+type VectorStore struct {
+	mu          sync.Mutex
+	clock       *Clock
+	ttl         time.Duration
+	index       *src.FlatSearch
+	expirations map[string]time.Time
+}
+
+var _ src.VectorStore = (*VectorStore)(nil)
+
+// NewVectorStore creates a store searching with metric whose vectors expire
+// ttl after they are added (0 means no expiration). A nil clock starts at the
+// Unix epoch.
+func NewVectorStore(metric src.MetricType, ttl time.Duration, clock *Clock) *VectorStore {
+	if clock == nil {
+		clock = NewClock(time.Unix(0, 0))
+	}
+	return &VectorStore{
+		clock:       clock,
+		ttl:         ttl,
+		index:       src.NewFlatSearch(metric),
+		expirations: make(map[string]time.Time),
+	}
+}
+
+// Clock returns the clock the store expires vectors against.
+func (s *VectorStore) Clock() *Clock {
+	return s.clock
+}
+
+// expire deletes the vectors whose TTL has passed (caller must hold the lock).
+func (s *VectorStore) expire() {
+	now := s.clock.Now()
+	for id, expiration := range s.expirations {
+		if !now.Before(expiration) {
+			s.index.Delete(id)
+			delete(s.expirations, id)
+		}
+	}
+}
+
+// Add adds or replaces a vector.
+func (s *VectorStore) Add(id string, vector src.Vector, metadata map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	if err := s.index.Add(id, vector, metadata); err != nil {
+		return err
+	}
+	if s.ttl > 0 {
+		s.expirations[id] = s.clock.Now().Add(s.ttl)
+	}
+	return nil
+}
+
+// Get retrieves a vector.
+func (s *VectorStore) Get(id string) (*src.VectorItem, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	return s.index.Get(id)
+}
+
+// Delete deletes a vector.
+func (s *VectorStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expirations, id)
+	return s.index.Delete(id)
+}
+
+// Search returns the k nearest vectors.
+func (s *VectorStore) Search(query src.Vector, k int) ([]src.SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	return s.index.Search(query, k)
+}
+
+// SearchWithFilter returns the k nearest vectors whose metadata passes filter.
+func (s *VectorStore) SearchWithFilter(query src.Vector, k int, filter src.FilterFunc) ([]src.SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	return s.index.SearchWithFilter(query, k, filter)
+}
+
+// Len returns the number of unexpired vectors.
+func (s *VectorStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	return s.index.Len()
+}
+
+// Clear removes all vectors.
+func (s *VectorStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index.Clear()
+	s.expirations = make(map[string]time.Time)
+}
@@ -0,0 +1,116 @@
+// Package grpcserver serves the fastcache services over gRPC, as defined in
+// proto/ and generated into package cachepb. It adapts the services of
+// package src, so a cache served over both net/rpc and gRPC behaves the same.
+//
+// Services with an src.AccessPolicy read the caller's token from the
+// "authorization" metadata as "Bearer <token>"; client.WithToken sends it.
+// Refused calls fail with codes.Unauthenticated or codes.PermissionDenied.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/atoncooper/fastcache/cachepb"
+	"github.com/atoncooper/fastcache/src"
+)
+
+// CacheService implements cachepb.CacheServiceServer on a src.CacheService.
+type CacheService struct {
+	cachepb.UnimplementedCacheServiceServer
+	svc *src.CacheService
+}
+
+// NewCacheService creates a gRPC service for svc, e.g.
+// src.NewCacheService(cache) or CacheServer.Service().
+func NewCacheService(svc *src.CacheService) *CacheService {
+	return &CacheService{svc: svc}
+}
+
+// RegisterCacheService registers a gRPC service for svc on s.
+func RegisterCacheService(s grpc.ServiceRegistrar, svc *src.CacheService) {
+	cachepb.RegisterCacheServiceServer(s, NewCacheService(svc))
+}
+
+// Set stores a value.
+func (s *CacheService) Set(ctx context.Context, req *cachepb.SetRequest) (*cachepb.SetResponse, error) {
+	var reply src.RPCSetReply
+	args := &src.RPCSetArgs{Token: token(ctx), Key: req.Key, Value: req.Value, Cost: req.Cost, TTL: req.Ttl.AsDuration()}
+	if err := s.svc.Set(args, &reply); err != nil {
+		return nil, statusError(err)
+	}
+	return &cachepb.SetResponse{Stored: reply.Stored}, nil
+}
+
+// Get returns a value.
+func (s *CacheService) Get(ctx context.Context, req *cachepb.GetRequest) (*cachepb.GetResponse, error) {
+	var reply src.RPCGetReply
+	if err := s.svc.Get(&src.RPCGetArgs{Token: token(ctx), Key: req.Key}, &reply); err != nil {
+		return nil, statusError(err)
+	}
+	return &cachepb.GetResponse{Value: reply.Value, Found: reply.Found}, nil
+}
+
+// Del deletes a key.
+func (s *CacheService) Del(ctx context.Context, req *cachepb.DelRequest) (*cachepb.DelResponse, error) {
+	if err := s.svc.Del(&src.RPCDelArgs{Token: token(ctx), Key: req.Key}, &src.RPCDelReply{}); err != nil {
+		return nil, statusError(err)
+	}
+	return &cachepb.DelResponse{}, nil
+}
+
+// MGet returns the values of several keys.
+func (s *CacheService) MGet(ctx context.Context, req *cachepb.MGetRequest) (*cachepb.MGetResponse, error) {
+	var reply src.RPCMGetReply
+	if err := s.svc.MGet(&src.RPCMGetArgs{Token: token(ctx), Keys: req.Keys}, &reply); err != nil {
+		return nil, statusError(err)
+	}
+	return &cachepb.MGetResponse{Values: reply.Values}, nil
+}
+
+// Stats returns cache statistics.
+func (s *CacheService) Stats(ctx context.Context, req *cachepb.StatsRequest) (*cachepb.StatsResponse, error) {
+	var reply src.RPCStatsReply
+	if err := s.svc.Stats(&src.RPCStatsArgs{Token: token(ctx)}, &reply); err != nil {
+		return nil, statusError(err)
+	}
+	return &cachepb.StatsResponse{
+		Len:         int64(reply.Len),
+		Cost:        reply.Cost,
+		Hits:        reply.Hits,
+		Misses:      reply.Misses,
+		KeysAdded:   reply.KeysAdded,
+		KeysEvicted: reply.KeysEvicted,
+		Role:        reply.Role,
+	}, nil
+}
+
+// token returns the bearer token of the call's "authorization" metadata.
+func token(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if t := src.BearerToken(v); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// statusError converts a service error to a gRPC status. Writes to a replica
+// fail with FailedPrecondition, so clients can tell them from other errors.
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, src.ErrReadOnlyReplica):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, src.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, src.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,165 @@
+package grpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/atoncooper/fastcache/client"
+	"github.com/atoncooper/fastcache/grpcserver"
+	"github.com/atoncooper/fastcache/src"
+)
+
+// serveCache serves svc over gRPC on a local port and returns a client
+// dialed with opts
+func serveCache(t *testing.T, svc *src.CacheService, opts ...grpc.DialOption) *client.GRPCClient {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	grpcserver.RegisterCacheService(s, svc)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+
+	c, err := client.DialGRPC(ln.Addr().String(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func newCache(t *testing.T) *src.ShardedCacheV2 {
+	t.Helper()
+	cache, err := src.NewShardedCacheV2(4, &src.Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64, Metrics: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestCacheServiceRoundTrip(t *testing.T) {
+	c := serveCache(t, src.NewCacheService(newCache(t)))
+	ctx := context.Background()
+
+	if stored, err := c.Set(ctx, "a", []byte("1"), 0); err != nil || !stored {
+		t.Fatalf("Set = %v, %v", stored, err)
+	}
+	if _, err := c.SetWithCost(ctx, "b", []byte("2"), 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, found, err := c.Get(ctx, "a"); err != nil || !found || string(v) != "1" {
+		t.Fatalf("Get(a) = %q, %v, %v", v, found, err)
+	}
+	values, err := c.MGet(ctx, "a", "b", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || string(values["a"]) != "1" || string(values["b"]) != "2" {
+		t.Fatalf("MGet = %q", values)
+	}
+	if err := c.Del(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := c.Get(ctx, "a"); err != nil || found {
+		t.Fatalf("Get(a) after Del: found %v, %v", found, err)
+	}
+
+	stats, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Len != 1 || stats.Role != src.RolePrimary || stats.Hits == 0 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func TestCacheServiceReplicaRejectsWrites(t *testing.T) {
+	server := src.NewCacheServer(newCache(t))
+	defer server.Close()
+	if _, err := server.ReplicateFrom("127.0.0.1:1", src.ReplicaOptions{RetryInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	c := serveCache(t, server.Service())
+	ctx := context.Background()
+
+	if _, err := c.Set(ctx, "a", []byte("1"), 0); !errors.Is(err, src.ErrReadOnlyReplica) {
+		t.Fatalf("Set on a replica = %v, want ErrReadOnlyReplica", err)
+	}
+	if err := c.Del(ctx, "a"); !errors.Is(err, src.ErrReadOnlyReplica) {
+		t.Fatalf("Del on a replica = %v, want ErrReadOnlyReplica", err)
+	}
+	if stats, err := c.Stats(ctx); err != nil || stats.Role != src.RoleReplica {
+		t.Fatalf("Stats = %+v, %v", stats, err)
+	}
+}
+
+func TestCacheServiceAccessPolicy(t *testing.T) {
+	svc := src.NewCacheService(newCache(t))
+	svc.Policy = src.NewAccessPolicy()
+	svc.Policy.Grant("team-a", "a/*", src.PermRead|src.PermWrite)
+	dial := func(token string) *client.GRPCClient {
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		if token != "" {
+			opts = append(opts, client.WithToken(token))
+		}
+		return serveCache(t, svc, opts...)
+	}
+	ctx := context.Background()
+
+	for _, token := range []string{"", "wrong"} {
+		if _, err := dial(token).Set(ctx, "a/k", []byte("1"), 0); !errors.Is(err, src.ErrUnauthenticated) {
+			t.Fatalf("Set with token %q = %v, want ErrUnauthenticated", token, err)
+		}
+	}
+
+	c := dial("team-a")
+	if stored, err := c.Set(ctx, "a/k", []byte("1"), 0); err != nil || !stored {
+		t.Fatalf("Set(a/k) = %v, %v", stored, err)
+	}
+	if v, found, err := c.Get(ctx, "a/k"); err != nil || !found || string(v) != "1" {
+		t.Fatalf("Get(a/k) = %q, %v, %v", v, found, err)
+	}
+	if _, err := c.Set(ctx, "b/k", []byte("1"), 0); !errors.Is(err, src.ErrForbidden) {
+		t.Fatalf("Set(b/k) = %v, want ErrForbidden", err)
+	}
+	if _, err := c.MGet(ctx, "a/k", "b/k"); !errors.Is(err, src.ErrForbidden) {
+		t.Fatalf("MGet(a/k, b/k) = %v, want ErrForbidden", err)
+	}
+	if _, err := c.Stats(ctx); !errors.Is(err, src.ErrForbidden) {
+		t.Fatalf("Stats = %v, want ErrForbidden", err)
+	}
+}
+
+func TestCacheServiceAudit(t *testing.T) {
+	audit := src.NewAuditLog(src.AuditConfig{})
+	cache, err := src.NewShardedCacheV2(4, &src.Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64, Audit: audit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	svc := src.NewCacheService(cache)
+	svc.Policy = src.NewAccessPolicy()
+	svc.Policy.Grant("team-a", "a/*", src.PermRead|src.PermWrite)
+	c := serveCache(t, svc, grpc.WithTransportCredentials(insecure.NewCredentials()), client.WithToken("team-a"))
+	ctx := context.Background()
+
+	if err := c.Del(ctx, "a/k"); err != nil {
+		t.Fatal(err)
+	}
+	events := audit.Events()
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events, want 1: %+v", len(events), events)
+	}
+	if e := events[0]; e.Op != src.AuditDel || e.Key != "a/k" || e.Actor != src.TokenActor("team-a") || !e.Applied {
+		t.Fatalf("event = %+v", e)
+	}
+}
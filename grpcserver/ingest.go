@@ -0,0 +1,66 @@
+package grpcserver
+
+import (
+	"io"
+
+	"google.golang.org/grpc"
+
+	"github.com/atoncooper/fastcache/cachepb"
+	"github.com/atoncooper/fastcache/src"
+)
+
+// VectorIngestService implements cachepb.VectorIngestServiceServer on a
+// src.VectorIngestServer, whose Workers and QueueSize it uses.
+type VectorIngestService struct {
+	cachepb.UnimplementedVectorIngestServiceServer
+	ingest *src.VectorIngestServer
+}
+
+// NewVectorIngestService creates a gRPC service for ingest.
+func NewVectorIngestService(ingest *src.VectorIngestServer) *VectorIngestService {
+	return &VectorIngestService{ingest: ingest}
+}
+
+// RegisterVectorIngestService registers a gRPC service for ingest on s.
+func RegisterVectorIngestService(s grpc.ServiceRegistrar, ingest *src.VectorIngestServer) {
+	cachepb.RegisterVectorIngestServiceServer(s, NewVectorIngestService(ingest))
+}
+
+// Ingest applies the batches of a client stream. A batch is received only
+// when the ingestion queue has room for it, so a client sending faster than
+// the store adds is held back by the stream's flow control window. With a
+// Policy on the ingestion server, the stream's token needs PermWrite on its
+// Collection.
+func (s *VectorIngestService) Ingest(stream cachepb.VectorIngestService_IngestServer) error {
+	if err := s.ingest.Authorize(token(stream.Context())); err != nil {
+		return statusError(err)
+	}
+	var recvErr error
+	result := s.ingest.IngestBatches(func() ([]src.ExportItem, error) {
+		req, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				recvErr = err
+			}
+			return nil, err
+		}
+		return exportItems(req.Items), nil
+	})
+	// The client is gone; what was received has been applied
+	if recvErr != nil {
+		return recvErr
+	}
+	return stream.SendAndClose(&cachepb.IngestResponse{Added: result.Added, Failed: result.Failed, Error: result.Error})
+}
+
+// exportItems converts a received batch.
+func exportItems(items []*cachepb.VectorItem) []src.ExportItem {
+	batch := make([]src.ExportItem, len(items))
+	for i, item := range items {
+		batch[i] = src.ExportItem{ID: item.Id, Vector: item.Vector}
+		if item.Metadata != nil {
+			batch[i].Metadata = item.Metadata.AsMap()
+		}
+	}
+	return batch
+}
@@ -0,0 +1,180 @@
+package grpcserver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/atoncooper/fastcache/client"
+	"github.com/atoncooper/fastcache/grpcserver"
+	"github.com/atoncooper/fastcache/src"
+)
+
+// serveIngest serves ingestion into store over gRPC with fixed 64KB flow
+// control windows and returns a client dialed with opts
+func serveIngest(t *testing.T, ingest *src.VectorIngestServer, opts ...grpc.DialOption) *client.GRPCClient {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.InitialWindowSize(64<<10), grpc.InitialConnWindowSize(64<<10))
+	grpcserver.RegisterVectorIngestService(s, ingest)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+
+	c, err := client.DialGRPC(ln.Addr().String(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func newVectorStore(t *testing.T, config src.VectorStoreConfig) *src.VectorCache {
+	t.Helper()
+	store, err := src.NewVectorStore(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestVectorIngestServiceAddsEveryVector(t *testing.T) {
+	config := src.DefaultVectorStoreConfig()
+	config.Dimension = 4
+	store := newVectorStore(t, config)
+	c := serveIngest(t, src.NewVectorIngestServer(store))
+
+	stream, err := c.IngestVectors(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.BatchSize = 100
+	for i := 0; i < 2000; i++ {
+		item := src.ExportItem{ID: fmt.Sprint(i), Vector: []float32{float32(i), 1, 2, 3}, Metadata: map[string]any{"n": i}}
+		if err := stream.Send(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A vector of the wrong dimension is reported, not fatal to the stream
+	if err := stream.Send(src.ExportItem{ID: "bad", Vector: []float32{1}}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := stream.Close()
+	if err == nil {
+		t.Fatal("Close reported no error for the bad vector")
+	}
+	if result.Added != 2000 || result.Failed != 1 {
+		t.Fatalf("result %+v, want 2000 added and 1 failed", result)
+	}
+	if n := store.Len(); n != 2000 {
+		t.Fatalf("store holds %d vectors, want 2000", n)
+	}
+	item, ok := store.Get("42")
+	if !ok || item.Metadata["n"] != float64(42) {
+		t.Fatalf("Get(42) = %+v, %v", item, ok)
+	}
+}
+
+// While the store is stalled, the server stops receiving and the client's
+// sends block once the flow control window is full
+func TestVectorIngestServiceAppliesBackpressure(t *testing.T) {
+	gate := make(chan struct{})
+	config := src.DefaultVectorStoreConfig()
+	config.ShardCount = 2
+	config.Router = src.RouterFunc(func(key string, shards int) int {
+		<-gate
+		return len(key) % shards
+	})
+	store := newVectorStore(t, config)
+	ingest := src.NewVectorIngestServer(store)
+	ingest.Workers, ingest.QueueSize = 1, 1
+	c := serveIngest(t, ingest)
+
+	stream, err := c.IngestVectors(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.BatchSize = 100
+	const batches = 100
+	var sent atomic.Int64
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < batches; i++ {
+			batch := make([]src.ExportItem, 100)
+			for j := range batch {
+				batch[j] = src.ExportItem{ID: fmt.Sprintf("%d-%d", i, j), Vector: make([]float32, 64)}
+			}
+			if err := stream.Send(batch...); err != nil {
+				done <- err
+				return
+			}
+			sent.Add(1)
+		}
+		_, err := stream.Close()
+		done <- err
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	if n := sent.Load(); n >= batches/2 {
+		t.Fatalf("sent %d of %d batches to a stalled server", n, batches)
+	}
+	close(gate)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("ingestion did not finish after the store resumed")
+	}
+	if n := store.Len(); n != batches*100 {
+		t.Fatalf("store holds %d vectors, want %d", n, batches*100)
+	}
+}
+
+func TestVectorIngestServiceAccessPolicy(t *testing.T) {
+	config := src.DefaultVectorStoreConfig()
+	config.Dimension = 4
+	store := newVectorStore(t, config)
+	ingest := src.NewVectorIngestServer(store)
+	ingest.Policy = src.NewAccessPolicy()
+	ingest.Policy.Grant("writer", "products", src.PermWrite)
+	ingest.Policy.Grant("reader", "products", src.PermRead)
+	ingest.Collection = "products"
+
+	send := func(token string) error {
+		c := serveIngest(t, ingest, grpc.WithTransportCredentials(insecure.NewCredentials()), client.WithToken(token))
+		stream, err := c.IngestVectors(context.Background())
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(src.ExportItem{ID: token, Vector: []float32{1, 2, 3, 4}}); err != nil {
+			return err
+		}
+		_, err = stream.Close()
+		return err
+	}
+
+	if err := send("wrong"); !errors.Is(err, src.ErrUnauthenticated) {
+		t.Fatalf("ingest with an unknown token = %v, want ErrUnauthenticated", err)
+	}
+	if err := send("reader"); !errors.Is(err, src.ErrForbidden) {
+		t.Fatalf("ingest without PermWrite = %v, want ErrForbidden", err)
+	}
+	if err := send("writer"); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.Len(); n != 1 {
+		t.Fatalf("store holds %d vectors, want 1", n)
+	}
+}
@@ -0,0 +1,65 @@
+// Package redisbus carries cache invalidations over a Redis pub/sub
+// channel, so the in-process caches of a fleet stay coherent.
+package redisbus
+
+import (
+	"context"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+// Bus is a src.Invalidator on a Redis pub/sub channel. Every instance of a
+// fleet uses the same channel. Redis pub/sub delivers at most once: messages
+// published while a subscriber reconnects are lost, so entries should still
+// have a TTL that bounds how long a peer can keep a stale value.
+type Bus struct {
+	client  redis.UniversalClient
+	channel string
+}
+
+// New creates a bus publishing on channel with client.
+func New(client redis.UniversalClient, channel string) *Bus {
+	return &Bus{client: client, channel: channel}
+}
+
+// Publish sends inv to every subscriber of the channel.
+func (b *Bus) Publish(ctx context.Context, inv src.Invalidation) error {
+	data, err := inv.Marshal()
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+// Subscribe calls handler with every invalidation published on the channel
+// until unsubscribe is called. It returns once the subscription is active.
+func (b *Bus) Subscribe(handler func(src.Invalidation)) (func(), error) {
+	ctx := context.Background()
+	sub := b.client.Subscribe(ctx, b.channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range sub.Channel() {
+			inv, err := src.UnmarshalInvalidation([]byte(msg.Payload))
+			if err != nil {
+				log.Printf("redisbus: decoding invalidation: %v", err)
+				continue
+			}
+			handler(inv)
+		}
+	}()
+	return func() {
+		sub.Close()
+		<-done
+	}, nil
+}
+
+var _ src.Invalidator = (*Bus)(nil)
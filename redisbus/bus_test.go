@@ -0,0 +1,76 @@
+package redisbus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/atoncooper/fastcache/src"
+)
+
+func newClient(t *testing.T) *redis.Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestBusDeliversToSubscribers(t *testing.T) {
+	client := newClient(t)
+	bus := New(client, "fastcache")
+
+	got := make(chan src.Invalidation, 1)
+	unsubscribe, err := bus.Subscribe(func(inv src.Invalidation) { got <- inv })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	want := src.Invalidation{Origin: "a", Keys: []string{"k1", "k2"}}
+	if err := bus.Publish(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case inv := <-got:
+		if !reflect.DeepEqual(inv, want) {
+			t.Fatalf("received %+v, want %+v", inv, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("invalidation not delivered")
+	}
+}
+
+// A Del on one cache drops the key from a peer sharing the channel
+func TestBusKeepsCachesCoherent(t *testing.T) {
+	client := newClient(t)
+	newPeer := func() *src.ShardedCacheV2 {
+		sc, err := src.NewShardedCacheV2(4, &src.Config{
+			NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64,
+			Invalidator: New(client, "fastcache"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sc.Close() })
+		return sc
+	}
+	a, b := newPeer(), newPeer()
+	for _, sc := range []*src.ShardedCacheV2{a, b} {
+		sc.Set("user:1", "alice", 1)
+		sc.Wait()
+	}
+
+	a.Del("user:1")
+	deadline := time.Now().Add(time.Second)
+	for b.Exists("user:1") {
+		if time.Now().After(deadline) {
+			t.Fatal("peer still holds the deleted key")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
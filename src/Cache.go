@@ -20,6 +20,11 @@ type FastCache struct {
 	// closed is the flag indicating if the cache is closed
 	closed bool
 	closeCh chan struct{}
+
+	// compaction state: orphans are unreferenced values found by the last sweep
+	compactMu  sync.Mutex
+	orphans    map[string]struct{}
+	compaction compactionCounters
 }
 
 func NewFastCache() *FastCache {
@@ -34,6 +39,7 @@ func NewFastCacheWithMaxKeys(maxKeys int64) *FastCache {
 		closeCh:  make(chan struct{}),
 	}
 	fc.KeyMap.StartGC(10 * time.Second)
+	fc.startCompaction(DefaultCompactionInterval)
 	return fc
 }
 
@@ -50,7 +56,23 @@ func (fc *FastCache) Close() error {
 	return nil
 }
 
+// expireAt converts a TTL to an absolute expiration time.
+// Zero or negative TTLs never expire and map to 0.
+func expireAt(exp time.Duration) int64 {
+	if exp <= 0 {
+		return 0
+	}
+	return time.Now().UnixNano() + int64(exp)
+}
+
+// Set stores a value. An exp of zero or less means the key never expires.
 func (fc *FastCache) Set(key string, value any, exp time.Duration) {
+	fc.SetWithTTL(key, value, exp)
+}
+
+// SetWithTTL stores a value that expires after ttl.
+// A ttl of zero or less means the key never expires.
+func (fc *FastCache) SetWithTTL(key string, value any, exp time.Duration) {
 	// Check for empty key
 	if key == "" {
 		return
@@ -61,11 +83,6 @@ func (fc *FastCache) Set(key string, value any, exp time.Duration) {
 		return
 	}
 
-	// Expiration time cannot be negative
-	if exp < 0 {
-		exp = 0
-	}
-
 	fc.mu.Lock()
 	defer fc.mu.Unlock()
 
@@ -92,8 +109,7 @@ func (fc *FastCache) Set(key string, value any, exp time.Duration) {
 
 	// Store new value
 	keyValue := fc.ValueMap.SetValue(value)
-	expTime := time.Now().UnixNano() + int64(exp)
-	fc.KeyMap.Set(key, keyValue, expTime)
+	fc.KeyMap.Set(key, keyValue, expireAt(exp))
 }
 
 // Get retrieves a value, returns (value, exists).
@@ -141,13 +157,8 @@ func (fc *FastCache) SetM2One(key []string, value any, exp time.Duration) {
 		return
 	}
 
-	// Expiration time cannot be negative
-	if exp < 0 {
-		exp = 0
-	}
-
 	keyValue := fc.ValueMap.SetValue(value)
-	expTime := time.Now().UnixNano() + int64(exp)
+	expTime := expireAt(exp)
 	// Map multiple keys to the same value, each key increments reference count
 	for _, k := range key {
 		// Skip empty key
@@ -163,3 +174,29 @@ func (fc *FastCache) SetM2One(key []string, value any, exp time.Duration) {
 		fc.ValueMap.IncrRefCount(keyValue)
 	}
 }
+
+// GetTTL returns the remaining TTL of a key.
+// It returns false if the key is missing, expired or never expires.
+func (fc *FastCache) GetTTL(key string) (time.Duration, bool) {
+	if key == "" {
+		return 0, false
+	}
+	exp, ok := fc.KeyMap.GetExpire(key)
+	if !ok || exp == 0 {
+		return 0, false
+	}
+	ttl := time.Duration(exp - time.Now().UnixNano())
+	if ttl <= 0 {
+		return 0, false
+	}
+	return ttl, true
+}
+
+// Persist removes the expiration of a key, so it never expires.
+// It returns false if the key is missing or already expired.
+func (fc *FastCache) Persist(key string) bool {
+	if key == "" {
+		return false
+	}
+	return fc.KeyMap.SetExpire(key, 0)
+}
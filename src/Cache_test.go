@@ -0,0 +1,75 @@
+package src
+
+import (
+	"testing"
+	"time"
+)
+
+// sweepKeys runs the GC sweep of every shard of a FastCache key map at now
+func sweepKeys(sc *ShardedCache, now int64) {
+	for _, shard := range sc.shards {
+		shard.sweep(now)
+	}
+}
+
+func TestExpireAtNonPositive(t *testing.T) {
+	for _, exp := range []time.Duration{0, -1, -time.Hour} {
+		if got := expireAt(exp); got != 0 {
+			t.Errorf("expireAt(%v) = %d, want 0", exp, got)
+		}
+	}
+	if got := expireAt(time.Hour); got <= time.Now().UnixNano() {
+		t.Errorf("expireAt(1h) = %d, not in the future", got)
+	}
+}
+
+func TestFastCacheNonPositiveTTLNeverExpires(t *testing.T) {
+	for _, exp := range []time.Duration{0, -time.Second} {
+		t.Run(exp.String(), func(t *testing.T) {
+			fc := NewFastCacheWithMaxKeys(0)
+			defer fc.Close()
+			fc.Set("forever", "v", exp)
+			fc.Set("short", "v", time.Minute)
+
+			if v, ok := fc.Get("forever"); !ok || v != "v" {
+				t.Fatalf("Get = %v, %v, want the value", v, ok)
+			}
+			if ttl, ok := fc.GetTTL("forever"); ok {
+				t.Fatalf("GetTTL = %v, want no expiration", ttl)
+			}
+
+			sweepKeys(fc.KeyMap, time.Now().Add(time.Hour).UnixNano())
+			if _, ok := fc.Get("forever"); !ok {
+				t.Fatal("GC sweep removed a key that never expires")
+			}
+			if n := fc.KeyMap.Count(); n != 1 {
+				t.Fatalf("%d keys after sweep, want 1", n)
+			}
+		})
+	}
+}
+
+func TestFastCacheNonPositiveTTLIsEvictable(t *testing.T) {
+	for _, exp := range []time.Duration{0, -time.Second} {
+		t.Run(exp.String(), func(t *testing.T) {
+			fc := NewFastCacheWithMaxKeys(2)
+			defer fc.Close()
+			fc.Set("a", "va", exp)
+			fc.Set("b", "vb", exp)
+			// At capacity, evictOne must treat them as live keys and make room
+			fc.Set("c", "vc", exp)
+
+			if n := fc.KeyMap.Count(); n != 2 {
+				t.Fatalf("%d keys, want 2", n)
+			}
+			if _, ok := fc.Get("c"); !ok {
+				t.Fatal("new key missing")
+			}
+			_, okA := fc.Get("a")
+			_, okB := fc.Get("b")
+			if okA == okB {
+				t.Fatalf("a found %v, b found %v, want exactly one evicted", okA, okB)
+			}
+		})
+	}
+}
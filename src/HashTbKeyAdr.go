@@ -12,12 +12,17 @@ const LoadFactor = 0.75
 type KeyLink struct {
 	Key      string
 	value    string
-	ExpireAt int64
+	ExpireAt int64 // Expiration time in nanoseconds, 0 means no expiration
 	Start    int64
 	LastAccess int64  // Last access time, used for LRU
 	Next     *KeyLink
 }
 
+// expired reports whether the key has expired at now.
+func (k *KeyLink) expired(now int64) bool {
+	return k.ExpireAt > 0 && now > k.ExpireAt
+}
+
 type KeyLinkList struct {
 	Head *KeyLink
 }
@@ -44,7 +49,7 @@ func (k *KeyLinkList) find(key string) (string, bool) {
 	for c != nil {
 		if c.Key == key {
 			// Check if expired
-			if time.Now().UnixNano() > c.ExpireAt {
+			if c.expired(time.Now().UnixNano()) {
 				return "", false
 			}
 			return c.value, true
@@ -122,7 +127,7 @@ func (h *HashMapAkBucket) get(key string) (string, bool) {
 	now := time.Now().UnixNano()
 	for node != nil {
 		if node.Key == key {
-			if now > node.ExpireAt {
+			if node.expired(now) {
 				// Mark for deletion, don't call delete under read lock
 				return "", false
 			}
@@ -137,6 +142,41 @@ func (h *HashMapAkBucket) get(key string) (string, bool) {
 	return value, ok
 }
 
+// getExpire returns the expiration time of a live key.
+func (h *HashMapAkBucket) getExpire(key string) (int64, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	index := HashKey(key, h.size)
+	for node := h.table[index].Head; node != nil; node = node.Next {
+		if node.Key == key {
+			if node.expired(time.Now().UnixNano()) {
+				return 0, false
+			}
+			return node.ExpireAt, true
+		}
+	}
+	return 0, false
+}
+
+// setExpire changes the expiration time of a live key.
+func (h *HashMapAkBucket) setExpire(key string, exp int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	index := HashKey(key, h.size)
+	for node := h.table[index].Head; node != nil; node = node.Next {
+		if node.Key == key {
+			if node.expired(time.Now().UnixNano()) {
+				return false
+			}
+			node.ExpireAt = exp
+			return true
+		}
+	}
+	return false
+}
+
 // deleteExpired deletes expired keys (internal use, requires write lock).
 func (h *HashMapAkBucket) deleteExpired(key string) {
 	index := HashKey(key, h.size)
@@ -203,55 +243,44 @@ func (h *HashMapAkBucket) startGC(interval time.Duration) {
 		defer ticker.Stop()
 
 		for range ticker.C {
-			h.mu.Lock()
-			now := time.Now().UnixNano()
-
-			for i := 0; i < len(h.table); i++ {
-				prev := (*KeyLink)(nil)
-				curr := h.table[i].Head
-				for curr != nil {
-					if now > curr.ExpireAt {
-						if prev == nil {
-							h.table[i].Head = curr.Next
-							curr = h.table[i].Head
-						} else {
-							prev.Next = curr.Next
-							curr = prev.Next
-						}
-						h.count--
-					} else {
-						prev = curr
-						curr = curr.Next
-					}
-				}
-			}
+			h.sweep(time.Now().UnixNano())
+		}
+	}()
+}
+
+// sweep deletes the keys expired at now.
+func (h *HashMapAkBucket) sweep(now int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sweepTable(h.table, now)
+	// Clean up oldTable (if expanding)
+	if h.oldTable != nil {
+		h.sweepTable(h.oldTable, now)
+	}
+}
 
-			// Clean up oldTable (if expanding)
-			if h.oldTable != nil {
-				for i := 0; i < len(h.oldTable); i++ {
-					prev := (*KeyLink)(nil)
-					curr := h.oldTable[i].Head
-					for curr != nil {
-						if now > curr.ExpireAt {
-							if prev == nil {
-								h.oldTable[i].Head = curr.Next
-								curr = h.oldTable[i].Head
-							} else {
-								prev.Next = curr.Next
-								curr = prev.Next
-							}
-							h.count--
-						} else {
-							prev = curr
-							curr = curr.Next
-						}
-					}
+// sweepTable deletes the keys of table expired at now (requires write lock).
+func (h *HashMapAkBucket) sweepTable(table []KeyLinkList, now int64) {
+	for i := 0; i < len(table); i++ {
+		prev := (*KeyLink)(nil)
+		curr := table[i].Head
+		for curr != nil {
+			if curr.expired(now) {
+				if prev == nil {
+					table[i].Head = curr.Next
+					curr = table[i].Head
+				} else {
+					prev.Next = curr.Next
+					curr = prev.Next
 				}
+				h.count--
+			} else {
+				prev = curr
+				curr = curr.Next
 			}
-
-			h.mu.Unlock()
 		}
-	}()
+	}
 }
 
 type ShardedCache struct {
@@ -287,6 +316,16 @@ func (sc *ShardedCache) Delete(key string) {
 	shard := sc.getShard(key)
 	shard.delete(key)
 }
+// GetExpire returns the expiration time of a key, 0 if it never expires.
+func (sc *ShardedCache) GetExpire(key string) (int64, bool) {
+	return sc.getShard(key).getExpire(key)
+}
+
+// SetExpire changes the expiration time of a key, 0 for no expiration.
+func (sc *ShardedCache) SetExpire(key string, exp int64) bool {
+	return sc.getShard(key).setExpire(key, exp)
+}
+
 func (sc *ShardedCache) StartGC(interval time.Duration) {
 	for _, shard := range sc.shards {
 		shard.startGC(interval)
@@ -319,7 +358,7 @@ func (h *HashMapAkBucket) evictOne() string {
 	for i := 0; i < len(h.table); i++ {
 		node := h.table[i].Head
 		for node != nil {
-			if node.ExpireAt > now && node.LastAccess < oldestTime {
+			if !node.expired(now) && node.LastAccess < oldestTime {
 				oldestTime = node.LastAccess
 				oldestKey = node.Key
 			}
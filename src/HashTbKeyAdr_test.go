@@ -0,0 +1,65 @@
+package src
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestKeyLinkExpired(t *testing.T) {
+	now := time.Now().UnixNano()
+	tests := []struct {
+		expireAt int64
+		want     bool
+	}{
+		{0, false},
+		{-1, false},
+		{math.MinInt64, false},
+		{now + 1, false},
+		{now, false},
+		{now - 1, true},
+	}
+	for _, tt := range tests {
+		k := &KeyLink{ExpireAt: tt.expireAt}
+		if got := k.expired(now); got != tt.want {
+			t.Errorf("expired with ExpireAt %d = %v, want %v", tt.expireAt, got, tt.want)
+		}
+	}
+}
+
+func TestHashMapAkBucketNonPositiveExpiration(t *testing.T) {
+	for _, exp := range []int64{0, -1} {
+		h := NewHashMapAKBucket()
+		past := time.Now().Add(-time.Second).UnixNano()
+		h.set("live", "v", exp)
+		h.set("past", "v", past)
+
+		if v, ok := h.get("live"); !ok || v != "v" {
+			t.Fatalf("exp %d: get = %q, %v, want a live key", exp, v, ok)
+		}
+		if _, ok := h.get("past"); ok {
+			t.Fatalf("exp %d: expired key found", exp)
+		}
+		if got, ok := h.getExpire("live"); !ok || got != exp {
+			t.Fatalf("exp %d: getExpire = %d, %v", exp, got, ok)
+		}
+
+		// The GC sweep removes expired keys only, however far ahead it runs
+		h.sweep(time.Now().Add(24 * time.Hour).UnixNano())
+		if h.count != 1 {
+			t.Fatalf("exp %d: %d keys after sweep, want 1", exp, h.count)
+		}
+		if _, ok := h.get("live"); !ok {
+			t.Fatalf("exp %d: sweep removed a key that never expires", exp)
+		}
+
+		// evictOne takes the live key and skips expired ones
+		h.set("past", "v", past)
+		if got := h.evictOne(); got != "live" {
+			t.Fatalf("exp %d: evictOne = %q, want live", exp, got)
+		}
+		if got := h.evictOne(); got != "" {
+			t.Fatalf("exp %d: evictOne = %q, want no live key", exp, got)
+		}
+	}
+}
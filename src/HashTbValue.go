@@ -132,8 +132,18 @@ func (h *HashMapValueBucket) setValue(key string, value any) {
 // key: The stored key
 // return: The actual value
 func (h *HashMapValueBucket) getValue(key string) any {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	index := HashKey(key, h.size)
-	return h.table[index].find(key)
+	if value := h.table[index].find(key); value != nil {
+		return value
+	}
+	// Not yet migrated during an expansion
+	if h.oldTable != nil {
+		return h.oldTable[HashKey(key, len(h.oldTable))].find(key)
+	}
+	return nil
 }
 
 // DeleteValue deletes the value.
@@ -0,0 +1,236 @@
+package src
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// AOF operations
+const (
+	AOFSet      = "SET"
+	AOFDel      = "DEL"
+	AOFFlushAll = "FLUSHALL"
+	AOFPing     = "PING"
+)
+
+// maxAOFBulk bounds the length of a single key or value in an AOF stream
+const maxAOFBulk = 512 << 20
+
+// ErrBadAOF is returned when reading a malformed AOF stream
+var ErrBadAOF = errors.New("malformed AOF record")
+
+// AOFRecord is one command of an append-only file. Records are written as
+// RESP arrays, like a Redis AOF:
+//
+//	SET key value [PX ttl-ms] [COST cost]
+//	DEL key
+//	FLUSHALL
+//	PING
+//
+// The TTL is relative, so a stream replayed on a host with a skewed clock
+// neither expires entries early nor late
+type AOFRecord struct {
+	Op    string
+	Key   string
+	Value []byte
+	Cost  int64         // 0 uses the value length
+	TTL   time.Duration // 0 means no expiration
+}
+
+// AOFWriter writes AOF records to a buffered stream
+type AOFWriter struct {
+	w *bufio.Writer
+}
+
+// NewAOFWriter creates an AOFWriter on w
+func NewAOFWriter(w io.Writer) *AOFWriter {
+	return &AOFWriter{w: bufio.NewWriter(w)}
+}
+
+// Write buffers rec; call Flush to write the buffer to the stream
+func (a *AOFWriter) Write(rec AOFRecord) error {
+	args := [][]byte{[]byte(rec.Op)}
+	switch rec.Op {
+	case AOFSet:
+		args = append(args, []byte(rec.Key), rec.Value)
+		if rec.TTL > 0 {
+			ms := rec.TTL.Milliseconds()
+			if ms < 1 {
+				ms = 1
+			}
+			args = append(args, []byte("PX"), strconv.AppendInt(nil, ms, 10))
+		}
+		if rec.Cost > 0 {
+			args = append(args, []byte("COST"), strconv.AppendInt(nil, rec.Cost, 10))
+		}
+	case AOFDel:
+		args = append(args, []byte(rec.Key))
+	case AOFFlushAll, AOFPing:
+	default:
+		return fmt.Errorf("unknown AOF operation %q", rec.Op)
+	}
+
+	a.w.WriteByte('*')
+	a.w.WriteString(strconv.Itoa(len(args)))
+	a.w.WriteString("\r\n")
+	for _, arg := range args {
+		a.w.WriteByte('$')
+		a.w.WriteString(strconv.Itoa(len(arg)))
+		a.w.WriteString("\r\n")
+		a.w.Write(arg)
+		if _, err := a.w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered records to the stream
+func (a *AOFWriter) Flush() error {
+	return a.w.Flush()
+}
+
+// Buffered returns the number of bytes waiting to be flushed
+func (a *AOFWriter) Buffered() int {
+	return a.w.Buffered()
+}
+
+// AOFReader reads AOF records written by an AOFWriter
+type AOFReader struct {
+	r *bufio.Reader
+}
+
+// NewAOFReader creates an AOFReader on r
+func NewAOFReader(r io.Reader) *AOFReader {
+	return &AOFReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF at the end of the stream
+func (a *AOFReader) Read() (AOFRecord, error) {
+	n, err := a.readLength('*')
+	if err != nil {
+		return AOFRecord{}, err
+	}
+	if n < 1 || n > 7 {
+		return AOFRecord{}, ErrBadAOF
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		if args[i], err = a.readBulk(); err != nil {
+			return AOFRecord{}, unexpectedEOF(err)
+		}
+	}
+	return parseAOFRecord(args)
+}
+
+// parseAOFRecord builds a record from the arguments of a command
+func parseAOFRecord(args [][]byte) (AOFRecord, error) {
+	rec := AOFRecord{Op: string(args[0])}
+	switch rec.Op {
+	case AOFSet:
+		if len(args) < 3 || len(args)%2 == 0 {
+			return rec, ErrBadAOF
+		}
+		rec.Key, rec.Value = string(args[1]), args[2]
+		for i := 3; i < len(args); i += 2 {
+			v, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || v < 0 {
+				return rec, ErrBadAOF
+			}
+			switch string(args[i]) {
+			case "PX":
+				rec.TTL = time.Duration(v) * time.Millisecond
+			case "COST":
+				rec.Cost = v
+			default:
+				return rec, ErrBadAOF
+			}
+		}
+	case AOFDel:
+		if len(args) != 2 {
+			return rec, ErrBadAOF
+		}
+		rec.Key = string(args[1])
+	case AOFFlushAll, AOFPing:
+		if len(args) != 1 {
+			return rec, ErrBadAOF
+		}
+	default:
+		return rec, ErrBadAOF
+	}
+	return rec, nil
+}
+
+// readLength reads a "<prefix><n>\r\n" line
+func (a *AOFReader) readLength(prefix byte) (int, error) {
+	line, err := a.r.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err == bufio.ErrBufferFull {
+			return 0, ErrBadAOF
+		}
+		return 0, err
+	}
+	if len(line) < 4 || line[0] != prefix || line[len(line)-2] != '\r' {
+		return 0, ErrBadAOF
+	}
+	n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+	if err != nil || n < 0 || n > maxAOFBulk {
+		return 0, ErrBadAOF
+	}
+	return n, nil
+}
+
+// readBulk reads a "$<n>\r\n<n bytes>\r\n" bulk string
+func (a *AOFReader) readBulk() ([]byte, error) {
+	n, err := a.readLength('$')
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(a.r, buf); err != nil {
+		return nil, err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, ErrBadAOF
+	}
+	return buf[:n], nil
+}
+
+// unexpectedEOF turns an EOF inside a record into io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// applyAOF applies a replicated record to the cache without publishing
+// invalidations. It returns false if a SET was rejected
+func (sc *ShardedCacheV2) applyAOF(rec AOFRecord) bool {
+	switch rec.Op {
+	case AOFSet:
+		cost := rec.Cost
+		if cost == 0 {
+			cost = int64(len(rec.Key) + len(rec.Value))
+		}
+		var expiration int64
+		if rec.TTL > 0 {
+			expiration = time.Now().Add(rec.TTL).UnixNano()
+		}
+		return sc.getShard(rec.Key).setItemSync(&setItem{key: rec.Key, value: rec.Value, cost: cost, expiration: expiration, internal: true})
+	case AOFDel:
+		sc.getShard(rec.Key).delLocal(rec.Key)
+	case AOFFlushAll:
+		for _, shard := range sc.shards {
+			shard.Clear()
+		}
+	}
+	return true
+}
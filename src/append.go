@@ -0,0 +1,158 @@
+package src
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNotBytes is returned by Append when the stored value is not a []byte or string
+	ErrNotBytes = errors.New("value is not a byte slice or string")
+	// ErrCostTooLarge is returned by GetSet and Append when the cost exceeds MaxCost
+	ErrCostTooLarge = errors.New("cost exceeds MaxCost")
+)
+
+// appendValue returns value with suffix appended, without modifying value
+func appendValue(value any, suffix []byte) (any, int, error) {
+	switch v := value.(type) {
+	case []byte:
+		out := make([]byte, len(v)+len(suffix))
+		copy(out, v)
+		copy(out[len(v):], suffix)
+		return out, len(out), nil
+	case string:
+		out := v + string(suffix)
+		return out, len(out), nil
+	}
+	return nil, 0, ErrNotBytes
+}
+
+// Append atomically appends suffix to a []byte or string value and returns
+// the new length. A missing key is created with a copy of suffix and no TTL.
+// The cost grows by len(suffix), or is recomputed with Config.Cost if set;
+// the TTL and LRU position are kept. Like Set, an append that would make the
+// cost exceed MaxCost is rejected, with ErrCostTooLarge, and other entries
+// are evicted to make room for one that fits
+func (c *RistrettoCache) Append(key string, suffix []byte) (int, error) {
+	var length int
+	var appendErr error
+	err := c.applySync(key, func() {
+		c.recordAccess(key)
+		for {
+			old, found := c.cache.snapshotItem(key)
+			if !found {
+				value := append([]byte(nil), suffix...)
+				cost := int64(len(value))
+				if c.config.Cost != nil {
+					cost = 0
+				}
+				cost = c.itemCost(value, cost)
+				if cost > c.maxCost.Load() {
+					c.reject(key, value, cost)
+					appendErr = ErrCostTooLarge
+					return
+				}
+				c.addNew(key, value, cost)
+				length = len(value)
+				return
+			}
+
+			value, n, err := appendValue(old.Value, suffix)
+			if err != nil {
+				appendErr = err
+				return
+			}
+			cost := old.Cost + int64(len(suffix))
+			if c.config.Cost != nil {
+				cost = c.itemCost(value, 0)
+			}
+			if cost > c.maxCost.Load() {
+				c.reject(key, value, cost)
+				appendErr = ErrCostTooLarge
+				return
+			}
+			// Retry if a concurrent Del or expiry got in between
+			if c.cache.replaceIf(key, old.stamp, value, cost) {
+				c.metrics.costAdded.Add(cost - old.Cost)
+				c.evictOverLimit()
+				length = n
+				return
+			}
+		}
+	})
+	if err == nil {
+		err = appendErr
+	}
+	c.config.Audit.Record(context.Background(), AuditAppend, key, suffix, err == nil)
+	if err != nil {
+		return 0, err
+	}
+	return length, nil
+}
+
+// GetSet atomically stores value and returns the previous value, or false if
+// the key was missing. Like Set with no TTL, it clears any TTL of the key
+func (c *RistrettoCache) GetSet(key string, value any, cost int64) (any, bool, error) {
+	var old any
+	var found bool
+	cost = c.itemCost(value, cost)
+	if cost > c.maxCost.Load() {
+		c.config.Audit.Record(context.Background(), AuditSet, key, value, false)
+		return nil, false, ErrCostTooLarge
+	}
+	err := c.applySync(key, func() {
+		c.recordAccess(key)
+		_, live := c.cache.snapshotItem(key)
+		if old, found = c.cache.replace(key, value, cost, 0, 0); found {
+			c.metrics.costAdded.Add(cost)
+			c.evictOverLimit()
+			if !live {
+				// The replaced value had expired
+				old, found = nil, false
+			}
+			return
+		}
+		c.addNew(key, value, cost)
+	})
+	c.config.Audit.Record(context.Background(), AuditSet, key, value, err == nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return old, found, nil
+}
+
+// Append atomically appends suffix to a []byte or string value
+func (sc *ShardedCacheV2) Append(key string, suffix []byte) (int, error) {
+	length, err := sc.getShard(key).Append(key, suffix)
+	sc.audit.Record(context.Background(), AuditAppend, key, suffix, err == nil)
+	return length, err
+}
+
+// GetSet atomically stores value and returns the previous value
+func (sc *ShardedCacheV2) GetSet(key string, value any, cost int64) (any, bool, error) {
+	old, found, err := sc.getShard(key).GetSet(key, value, cost)
+	sc.audit.Record(context.Background(), AuditSet, key, value, err == nil)
+	return old, found, err
+}
+
+// GetTo appends the []byte or string value of key to dst and returns the
+// extended buffer, so hot paths can read into a reused buffer instead of
+// sharing the stored slice. Values of other types are reported as misses
+func (c *RistrettoCache) GetTo(key string, dst []byte) ([]byte, bool) {
+	value, found := c.Get(key)
+	if !found {
+		return dst, false
+	}
+	switch v := value.(type) {
+	case []byte:
+		return append(dst, v...), true
+	case string:
+		return append(dst, v...), true
+	}
+	return dst, false
+}
+
+// GetTo appends the []byte or string value of key to dst
+func (sc *ShardedCacheV2) GetTo(key string, dst []byte) ([]byte, bool) {
+	return sc.getShard(key).GetTo(key, dst)
+}
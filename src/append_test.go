@@ -0,0 +1,64 @@
+package src
+
+import "testing"
+
+// Appending past MaxCost evicts through OnEvict like a Set would
+func TestAppendEvictsThroughCallbacks(t *testing.T) {
+	var evicted []string
+	c, err := NewRistrettoCache(&Config{
+		NumCounters: 1e4, MaxCost: 10, BufferItems: 64,
+		OnEvict: func(key string, value any, cost int64) { evicted = append(evicted, key) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Set("a", []byte("aaaa"), 4)
+	c.Set("b", []byte("bbbb"), 4)
+	c.Wait()
+
+	if _, err := c.Append("b", []byte("bbbb")); err != nil {
+		t.Fatal(err)
+	}
+	if c.Cost() > c.MaxCost() {
+		t.Fatalf("cost %d over MaxCost %d after Append", c.Cost(), c.MaxCost())
+	}
+	if len(evicted) != 1 || evicted[0] != "a" {
+		t.Fatalf("OnEvict calls = %v, want [a]", evicted)
+	}
+}
+
+// An append that would grow an entry past MaxCost is rejected like a Set
+func TestAppendRejectsPastMaxCost(t *testing.T) {
+	var rejected []string
+	c, err := NewRistrettoCache(&Config{
+		NumCounters: 1e4, MaxCost: 10, BufferItems: 64,
+		OnReject: func(key string, value any, cost int64) { rejected = append(rejected, key) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Append("log", []byte("aaaa")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Append("log", []byte("aaaa")); err != ErrCostTooLarge {
+		t.Fatalf("Append past MaxCost = %v, want ErrCostTooLarge", err)
+	}
+	if _, err := c.Append("big", make([]byte, 11)); err != ErrCostTooLarge {
+		t.Fatalf("Append of a new key past MaxCost = %v, want ErrCostTooLarge", err)
+	}
+	if v, _ := c.Get("log"); string(v.([]byte)) != "aaaaaaaa" {
+		t.Fatalf("log = %q after a rejected append", v)
+	}
+	if c.Cost() > c.MaxCost() {
+		t.Fatalf("cost %d over MaxCost %d", c.Cost(), c.MaxCost())
+	}
+	if len(rejected) != 2 || c.Metrics().SetsRejected() != 2 {
+		t.Fatalf("OnReject calls = %v, SetsRejected = %d, want 2", rejected, c.Metrics().SetsRejected())
+	}
+}
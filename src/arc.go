@@ -0,0 +1,161 @@
+package src
+
+import "container/list"
+
+// arcState is the Adaptive Replacement Cache state of an LRUCache.
+// Items seen once live in recent (T1), items seen again in the main list
+// (T2). Keys evicted from either list are remembered, without values, in a
+// ghost list; a miss that hits a ghost shifts the target share of recent
+// toward the list that would have kept the key. All sizes are costs
+type arcState struct {
+	recent     *list.List
+	recentCost int64
+	target     int64 // target cost of recent (p)
+
+	ghostRecent   ghostList // B1, evicted from recent
+	ghostFrequent ghostList // B2, evicted from the main list
+}
+
+// ghostList remembers the keys and costs of evicted items, most recent first
+type ghostList struct {
+	list *list.List
+	keys map[string]*list.Element
+	cost int64
+}
+
+type ghostEntry struct {
+	key  string
+	cost int64
+}
+
+func newGhostList() ghostList {
+	return ghostList{list: list.New(), keys: make(map[string]*list.Element)}
+}
+
+// push remembers key at the front
+func (g *ghostList) push(key string, cost int64) {
+	g.keys[key] = g.list.PushFront(&ghostEntry{key: key, cost: cost})
+	g.cost += cost
+}
+
+// remove forgets key and reports whether it was remembered
+func (g *ghostList) remove(key string) bool {
+	elem, ok := g.keys[key]
+	if !ok {
+		return false
+	}
+	g.list.Remove(elem)
+	delete(g.keys, key)
+	g.cost -= elem.Value.(*ghostEntry).cost
+	return true
+}
+
+// dropOldest forgets the least recently evicted key
+func (g *ghostList) dropOldest() {
+	if elem := g.list.Back(); elem != nil {
+		g.remove(elem.Value.(*ghostEntry).key)
+	}
+}
+
+func (g *ghostList) reset() {
+	g.list.Init()
+	g.keys = make(map[string]*list.Element)
+	g.cost = 0
+}
+
+// enableARC switches the cache from LRU to ARC replacement
+func (c *LRUCache) enableARC() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.arc = &arcState{
+		recent:        list.New(),
+		ghostRecent:   newGhostList(),
+		ghostFrequent: newGhostList(),
+	}
+}
+
+// arcInsert links a new item into recent, or into the main list when its key
+// is a ghost, adapting the target (caller must hold lock)
+func (c *LRUCache) arcInsert(item *CacheItem) {
+	a := c.arc
+	switch {
+	case a.ghostRecent.remove(item.Key):
+		// recent was too small to keep the key
+		a.target = min(c.maxCost, a.target+arcDelta(item.Cost, a.ghostFrequent.cost, a.ghostRecent.cost+item.Cost))
+	case a.ghostFrequent.remove(item.Key):
+		// the main list was too small to keep the key
+		a.target = max(0, a.target-arcDelta(item.Cost, a.ghostRecent.cost, a.ghostFrequent.cost+item.Cost))
+	default:
+		item.inRecent = true
+		item.element = a.recent.PushFront(item)
+		a.recentCost += item.Cost
+		return
+	}
+	c.pushMain(item)
+}
+
+// arcDelta scales the target adjustment for a ghost hit of cost by the ratio
+// of the other ghost list to the one that was hit, as in ARC
+func arcDelta(cost, other, hit int64) int64 {
+	if hit <= 0 || other <= hit {
+		return cost
+	}
+	return cost * (other / hit)
+}
+
+// arcTouch moves an item that was accessed again to the front of the main
+// list (caller must hold lock)
+func (c *LRUCache) arcTouch(item *CacheItem) {
+	if !item.inRecent {
+		c.list.MoveToFront(item.element)
+		return
+	}
+	c.arc.recent.Remove(item.element)
+	c.arc.recentCost -= item.Cost
+	item.inRecent = false
+	c.pushMain(item)
+}
+
+// arcVictim returns the item ARC replaces next: the least recently used
+// item of recent while recent exceeds its target, of the main list otherwise
+// (caller must hold lock)
+func (c *LRUCache) arcVictim() *CacheItem {
+	a := c.arc
+	fromRecent := a.recent.Len() > 0 && (a.recentCost > a.target || c.list.Len() == 0)
+	if fromRecent {
+		return a.recent.Back().Value.(*CacheItem)
+	}
+	if elem := c.list.Back(); elem != nil {
+		return elem.Value.(*CacheItem)
+	}
+	return nil
+}
+
+// arcRemember records an evicted item in the ghost list of the segment it
+// was evicted from and trims the ghost lists to their budgets (caller must
+// hold lock)
+func (c *LRUCache) arcRemember(key string, cost int64, recent bool) {
+	a := c.arc
+	if recent {
+		a.ghostRecent.push(key, cost)
+	} else {
+		a.ghostFrequent.push(key, cost)
+	}
+
+	// recent and its ghosts fit MaxCost; everything fits twice MaxCost
+	for a.recentCost+a.ghostRecent.cost > c.maxCost && a.ghostRecent.list.Len() > 0 {
+		a.ghostRecent.dropOldest()
+	}
+	for c.cost+a.ghostRecent.cost+a.ghostFrequent.cost > 2*c.maxCost && a.ghostFrequent.list.Len() > 0 {
+		a.ghostFrequent.dropOldest()
+	}
+}
+
+// arcReset empties the ARC state (caller must hold lock)
+func (c *LRUCache) arcReset() {
+	c.arc.recent.Init()
+	c.arc.recentCost = 0
+	c.arc.target = 0
+	c.arc.ghostRecent.reset()
+	c.arc.ghostFrequent.reset()
+}
@@ -0,0 +1,242 @@
+package src
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Audit operations
+const (
+	// AuditSet is a Set, SetWithTTL, GetSet or front-end set
+	AuditSet = "set"
+	// AuditDel is a Del, or one key deleted by DelPrefix, DelPattern or Expire
+	AuditDel = "del"
+	// AuditClear is a Clear; its key is empty
+	AuditClear = "clear"
+	// AuditIncr is an IncrBy or DecrBy; its value is the new value
+	AuditIncr = "incr"
+	// AuditAppend is an Append; its value is the suffix
+	AuditAppend = "append"
+	// AuditExpire is an Expire with a positive TTL or a Persist; its value
+	// is the TTL, 0 for Persist
+	AuditExpire = "expire"
+	// AuditMigrate is one entry rewritten by Migrate
+	AuditMigrate = "migrate"
+)
+
+// DefaultAuditMaxEvents is the default number of events an AuditLog retains
+const DefaultAuditMaxEvents = 10_000
+
+// AuditEvent is one mutating operation in an AuditLog
+type AuditEvent struct {
+	Time time.Time
+	// Op is one of the Audit operations, e.g. AuditSet
+	Op string
+	// Key after AuditConfig.RedactKey
+	Key string
+	// Value, if the operation carries one, after AuditConfig.RedactValue;
+	// nil without it
+	Value any
+	// Actor and Fields are the values attached to the caller's context with
+	// WithAuditActor and WithAuditField
+	Actor  string
+	Fields map[string]string
+	// Applied is false if the operation was dropped, rejected or failed
+	Applied bool
+}
+
+// AuditConfig configures an AuditLog
+type AuditConfig struct {
+	// MaxEvents number of events retained, oldest dropped first (default DefaultAuditMaxEvents)
+	MaxEvents int
+	// MaxAge drops events older than this (0 keeps them until MaxEvents is reached)
+	MaxAge time.Duration
+	// RedactKey rewrites keys before they are recorded, e.g. HashAuditKey (nil records keys as is)
+	RedactKey func(key string) string
+	// RedactValue returns what is recorded of a set's value (nil records no values)
+	RedactValue func(key string, value any) any
+	// Sink receives every event as it is recorded, e.g. to ship it to durable storage; it must not block
+	Sink func(AuditEvent)
+}
+
+// AuditLog records who changed which keys and when, for caches holding
+// regulated data. Set Config.Audit to record every mutation of the cache:
+// Set, Del, Clear, IncrBy, DecrBy, Append, GetSet, Expire, Persist,
+// DelPrefix, DelPattern and Migrate, and the writes of HTTPServer,
+// MemcachedServer and CacheService. The actor comes from the caller's
+// context, so only SetContext, DelContext and MigrateWithOptions attribute
+// direct calls; the servers attribute writes to the caller's token, see
+// TokenActor. Events are kept in memory within MaxEvents and MaxAge. A nil
+// *AuditLog records nothing. It is safe for concurrent use
+type AuditLog struct {
+	config AuditConfig
+
+	mu     sync.Mutex
+	events []AuditEvent // ring buffer
+	start  int          // index of the oldest event
+	count  int
+}
+
+// NewAuditLog creates an audit log
+func NewAuditLog(config AuditConfig) *AuditLog {
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = DefaultAuditMaxEvents
+	}
+	return &AuditLog{config: config}
+}
+
+type auditActorKey struct{}
+
+type auditFieldsKey struct{}
+
+// WithAuditActor returns a context whose audited operations are attributed
+// to actor, e.g. a user or service name
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// WithAuditField returns a context whose audited operations carry the field
+// key=value, e.g. a request ID or tenant
+func WithAuditField(ctx context.Context, key, value string) context.Context {
+	parent, _ := ctx.Value(auditFieldsKey{}).(map[string]string)
+	fields := make(map[string]string, len(parent)+1)
+	for k, v := range parent {
+		fields[k] = v
+	}
+	fields[key] = value
+	return context.WithValue(ctx, auditFieldsKey{}, fields)
+}
+
+// AuditActor returns the actor attached to ctx with WithAuditActor
+func AuditActor(ctx context.Context) string {
+	actor, _ := ctx.Value(auditActorKey{}).(string)
+	return actor
+}
+
+// TokenActor returns the actor the servers attribute writes to when a
+// caller authenticates with token: a prefix of its SHA-256 digest, so the
+// token itself is not recorded
+func TokenActor(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:8])
+}
+
+// auditContext returns ctx attributed to the token a server authenticated
+// with policy, unless ctx already has an actor or there is no policy
+func auditContext(ctx context.Context, policy *AccessPolicy, token string) context.Context {
+	if policy == nil || AuditActor(ctx) != "" {
+		return ctx
+	}
+	return WithAuditActor(ctx, TokenActor(token))
+}
+
+// HashAuditKey is an AuditConfig.RedactKey that replaces keys by a prefix of
+// their SHA-256 digest, so events of one key can be correlated without
+// recording it
+func HashAuditKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// Record adds an event for op on key by the actor of ctx
+func (a *AuditLog) Record(ctx context.Context, op, key string, value any, applied bool) {
+	if a == nil {
+		return
+	}
+	event := AuditEvent{
+		Time:    time.Now(),
+		Op:      op,
+		Key:     key,
+		Applied: applied,
+	}
+	if a.config.RedactValue != nil && value != nil {
+		event.Value = a.config.RedactValue(key, value)
+	}
+	if a.config.RedactKey != nil {
+		event.Key = a.config.RedactKey(key)
+	}
+	if ctx != nil {
+		event.Actor = AuditActor(ctx)
+		event.Fields, _ = ctx.Value(auditFieldsKey{}).(map[string]string)
+	}
+
+	a.mu.Lock()
+	if a.events == nil {
+		a.events = make([]AuditEvent, a.config.MaxEvents)
+	}
+	if a.count == len(a.events) {
+		a.events[a.start] = AuditEvent{}
+		a.start = (a.start + 1) % len(a.events)
+		a.count--
+	}
+	a.events[(a.start+a.count)%len(a.events)] = event
+	a.count++
+	a.mu.Unlock()
+
+	if a.config.Sink != nil {
+		a.config.Sink(event)
+	}
+}
+
+// Events returns the retained events, oldest first
+func (a *AuditLog) Events() []AuditEvent {
+	return a.Since(time.Time{})
+}
+
+// Since returns the retained events recorded after t, oldest first
+func (a *AuditLog) Since(t time.Time) []AuditEvent {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+	events := make([]AuditEvent, 0, a.count)
+	for i := 0; i < a.count; i++ {
+		event := a.events[(a.start+i)%len(a.events)]
+		if event.Time.After(t) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Len returns the number of retained events
+func (a *AuditLog) Len() int {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+	return a.count
+}
+
+// Clear drops all retained events
+func (a *AuditLog) Clear() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := range a.events {
+		a.events[i] = AuditEvent{}
+	}
+	a.start, a.count = 0, 0
+}
+
+// expire drops the events older than MaxAge (caller must hold lock)
+func (a *AuditLog) expire(now time.Time) {
+	if a.config.MaxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-a.config.MaxAge)
+	for a.count > 0 && a.events[a.start].Time.Before(cutoff) {
+		a.events[a.start] = AuditEvent{}
+		a.start = (a.start + 1) % len(a.events)
+		a.count--
+	}
+}
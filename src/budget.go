@@ -0,0 +1,72 @@
+package src
+
+import "sync"
+
+// costBudget is a MaxCost shared by several caches. When a set would take
+// the caches together over the budget, the member holding the most cost
+// evicts, so an idle cache cannot keep memory a busy one needs
+type costBudget struct {
+	max int64
+
+	mu      sync.RWMutex
+	members []*RistrettoCache
+}
+
+func newCostBudget(max int64) *costBudget {
+	return &costBudget{max: max}
+}
+
+// join adds c to the budget
+func (b *costBudget) join(c *RistrettoCache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.budget = b
+	b.members = append(b.members, c)
+}
+
+// leave removes c from the budget, releasing its cost
+func (b *costBudget) leave(c *RistrettoCache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, m := range b.members {
+		if m == c {
+			b.members = append(b.members[:i], b.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// used returns the cost held by all members
+func (b *costBudget) used() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var total int64
+	for _, m := range b.members {
+		total += m.cache.Cost()
+	}
+	return total
+}
+
+// makeRoom evicts from the largest members until an item of cost fits
+func (b *costBudget) makeRoom(cost int64) {
+	for b.used()+cost > b.max {
+		victim := b.largest()
+		if victim == nil || victim.evictOne() == nil {
+			return
+		}
+	}
+}
+
+// largest returns the member holding the most cost, nil if all are empty
+func (b *costBudget) largest() *RistrettoCache {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var largest *RistrettoCache
+	var most int64
+	for _, m := range b.members {
+		if cost := m.cache.Cost(); cost > most {
+			largest, most = m, cost
+		}
+	}
+	return largest
+}
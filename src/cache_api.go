@@ -0,0 +1,29 @@
+package src
+
+import "time"
+
+// Cache is the key-value API of RistrettoCache and ShardedCacheV2.
+// Code that accepts a Cache can be unit-tested with fastcachetest.Cache.
+type Cache interface {
+	Set(key string, value any, cost int64) bool
+	SetWithTTL(key string, value any, cost int64, ttl time.Duration) bool
+	Get(key string) (any, bool)
+	GetWithTTL(key string) (any, bool, time.Duration)
+	GetTTL(key string) (time.Duration, bool)
+	Exists(key string) bool
+	Expire(key string, ttl time.Duration) bool
+	Persist(key string) bool
+	Touch(key string) bool
+	Del(key string)
+	Len() int
+	Cost() int64
+	Clear()
+	Wait()
+	Close() error
+}
+
+var (
+	_ Cache       = (*RistrettoCache)(nil)
+	_ Cache       = (*ShardedCacheV2)(nil)
+	_ VectorStore = (*VectorCache)(nil)
+)
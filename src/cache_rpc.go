@@ -0,0 +1,305 @@
+package src
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// CacheServiceName is the name the cache service is registered under.
+const CacheServiceName = "FastCache"
+
+// RPCSetArgs are the arguments of CacheService.Set.
+type RPCSetArgs struct {
+	Token string // access token, for a service with a Policy
+	Key   string
+	Value []byte
+	Cost  int64         // 0 uses the value length
+	TTL   time.Duration // 0 means no expiration
+}
+
+// RPCSetReply is the reply of CacheService.Set.
+type RPCSetReply struct {
+	Stored bool
+}
+
+// RPCGetArgs are the arguments of CacheService.Get.
+type RPCGetArgs struct {
+	Token string
+	Key   string
+}
+
+// RPCGetReply is the reply of CacheService.Get.
+type RPCGetReply struct {
+	Value []byte
+	Found bool
+}
+
+// RPCDelArgs are the arguments of CacheService.Del.
+type RPCDelArgs struct {
+	Token string
+	Key   string
+}
+
+// RPCDelReply is the reply of CacheService.Del.
+type RPCDelReply struct{}
+
+// RPCMGetArgs are the arguments of CacheService.MGet.
+type RPCMGetArgs struct {
+	Token string
+	Keys  []string
+}
+
+// RPCMGetReply is the reply of CacheService.MGet; missing keys are omitted.
+type RPCMGetReply struct {
+	Values map[string][]byte
+}
+
+// RPCStatsArgs are the arguments of CacheService.Stats.
+type RPCStatsArgs struct {
+	Token string
+}
+
+// RPCStatsReply is the reply of CacheService.Stats.
+type RPCStatsReply struct {
+	Len         int
+	Cost        int64
+	Hits        int64
+	Misses      int64
+	KeysAdded   int64
+	KeysEvicted int64
+	Role        string // RolePrimary or RoleReplica
+}
+
+// CacheService exposes a ShardedCacheV2 as an RPC service storing byte values.
+// Its methods follow the net/rpc conventions; package grpcserver serves them
+// over gRPC.
+//
+// With a Policy, calls carry a token in their arguments. Get and MGet need
+// PermRead and Set and Del PermWrite on every key, and Stats PermRead on
+// ScopeAll; other calls fail with ErrUnauthenticated or ErrForbidden. Sets and
+// deletes are then recorded to the cache's Config.Audit with the caller's
+// TokenActor.
+type CacheService struct {
+	// Policy authorizes calls, nil to allow all of them. Set it before
+	// serving.
+	Policy *AccessPolicy
+
+	cache *ShardedCacheV2
+	repl  *replication
+}
+
+// NewCacheService creates a service for cache, for serving it without a
+// CacheServer. Use CacheServer.Service to share the server's replication role.
+func NewCacheService(cache *ShardedCacheV2) *CacheService {
+	return &CacheService{cache: cache, repl: newReplication()}
+}
+
+// Set stores a value. The write is applied before the call returns.
+// Replicas reject it with ErrReadOnlyReplica.
+func (s *CacheService) Set(args *RPCSetArgs, reply *RPCSetReply) error {
+	if err := s.Policy.Authorize(args.Token, args.Key, PermWrite); err != nil {
+		return err
+	}
+	if s.repl.readOnly.Load() {
+		return ErrReadOnlyReplica
+	}
+	cost := args.Cost
+	if cost == 0 {
+		cost = int64(len(args.Key) + len(args.Value))
+	}
+	var expiration int64
+	if args.TTL > 0 {
+		expiration = time.Now().Add(args.TTL).UnixNano()
+	}
+	unlock := s.repl.lock(args.Key)
+	defer unlock()
+	ctx := auditContext(context.Background(), s.Policy, args.Token)
+	reply.Stored = s.cache.setSync(ctx, args.Key, args.Value, cost, expiration)
+	if reply.Stored {
+		s.repl.record(AOFRecord{Op: AOFSet, Key: args.Key, Value: args.Value, Cost: args.Cost, TTL: args.TTL})
+	}
+	return nil
+}
+
+// Get returns a value. Values that are not []byte or string are reported as missing.
+func (s *CacheService) Get(args *RPCGetArgs, reply *RPCGetReply) error {
+	if err := s.Policy.Authorize(args.Token, args.Key, PermRead); err != nil {
+		return err
+	}
+	value, found := s.cache.Get(args.Key)
+	reply.Value, reply.Found = rpcBytes(value, found)
+	return nil
+}
+
+// Del deletes a key. Replicas reject it with ErrReadOnlyReplica.
+func (s *CacheService) Del(args *RPCDelArgs, reply *RPCDelReply) error {
+	if err := s.Policy.Authorize(args.Token, args.Key, PermWrite); err != nil {
+		return err
+	}
+	if s.repl.readOnly.Load() {
+		return ErrReadOnlyReplica
+	}
+	unlock := s.repl.lock(args.Key)
+	defer unlock()
+	s.cache.del(auditContext(context.Background(), s.Policy, args.Token), args.Key)
+	s.repl.record(AOFRecord{Op: AOFDel, Key: args.Key})
+	return nil
+}
+
+// MGet returns the values of several keys.
+func (s *CacheService) MGet(args *RPCMGetArgs, reply *RPCMGetReply) error {
+	for _, key := range args.Keys {
+		if err := s.Policy.Authorize(args.Token, key, PermRead); err != nil {
+			return err
+		}
+	}
+	reply.Values = make(map[string][]byte, len(args.Keys))
+	for key, value := range s.cache.MGet(args.Keys...) {
+		if b, ok := rpcBytes(value, true); ok {
+			reply.Values[key] = b
+		}
+	}
+	return nil
+}
+
+// Stats returns cache statistics.
+func (s *CacheService) Stats(args *RPCStatsArgs, reply *RPCStatsReply) error {
+	if err := s.Policy.Authorize(args.Token, ScopeAll, PermRead); err != nil {
+		return err
+	}
+	m := s.cache.Metrics()
+	*reply = RPCStatsReply{
+		Len:         s.cache.Len(),
+		Cost:        s.cache.Cost(),
+		Hits:        m.Hits(),
+		Misses:      m.Misses(),
+		KeysAdded:   m.KeysAdded(),
+		KeysEvicted: m.KeysEvicted(),
+		Role:        s.repl.role(),
+	}
+	return nil
+}
+
+// rpcBytes converts a cached value to bytes.
+func rpcBytes(value any, found bool) ([]byte, bool) {
+	if !found {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	}
+	return nil, false
+}
+
+// CacheServer serves CacheService over TCP so that several processes can
+// share one cache. Use the client package to connect.
+type CacheServer struct {
+	rpc     *rpc.Server
+	service *CacheService
+	cache   *ShardedCacheV2
+	repl    *replication
+
+	mu           sync.Mutex
+	listener     net.Listener
+	replListener net.Listener
+	conns        map[net.Conn]struct{}
+	closed       bool
+	wg           sync.WaitGroup
+}
+
+// NewCacheServer creates a server for cache.
+func NewCacheServer(cache *ShardedCacheV2) *CacheServer {
+	service := NewCacheService(cache)
+	server := rpc.NewServer()
+	server.RegisterName(CacheServiceName, service)
+	return &CacheServer{
+		rpc:     server,
+		service: service,
+		cache:   cache,
+		repl:    service.repl,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Service returns the service the server exposes, e.g. to serve it over gRPC
+// as well. Writes through it follow the server's replication role.
+func (s *CacheServer) Service() *CacheService {
+	return s.service
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *CacheServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until Close is called.
+func (s *CacheServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				s.wg.Done()
+			}()
+			s.rpc.ServeConn(conn)
+		}()
+	}
+}
+
+// Close stops the listeners, closes open connections and replication
+// streams and waits for them to finish.
+func (s *CacheServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.replListener != nil {
+		s.replListener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.closeReplication()
+
+	s.wg.Wait()
+	return nil
+}
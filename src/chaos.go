@@ -0,0 +1,176 @@
+//go:build fastcache_chaos
+
+package src
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// chaosEnabled reports whether fault injection is built in
+const chaosEnabled = true
+
+// Chaos configures faults injected into a cache, so tests can check how an
+// application copes with a misbehaving cache. It only exists in builds with
+// the fastcache_chaos tag:
+//
+//	go test -tags fastcache_chaos ./...
+type Chaos struct {
+	// DropWrites is the probability that an accepted set is discarded
+	// instead of applied, as if it had been dropped from a full buffer
+	DropWrites float64
+	// ProcessorDelay stalls the write goroutine before every buffered write
+	ProcessorDelay time.Duration
+	// Seed makes the dropped writes reproducible (0 seeds from the clock)
+	Seed int64
+}
+
+// chaosState is an active Chaos with its random source
+type chaosState struct {
+	Chaos
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// chaosHooks holds the active faults of a cache, nil when none are injected
+type chaosHooks struct {
+	state atomic.Pointer[chaosState]
+}
+
+// delay stalls the write goroutine by ProcessorDelay
+func (h *chaosHooks) delay() {
+	if s := h.state.Load(); s != nil && s.ProcessorDelay > 0 {
+		time.Sleep(s.ProcessorDelay)
+	}
+}
+
+// dropWrite reports whether the next write is discarded
+func (h *chaosHooks) dropWrite() bool {
+	s := h.state.Load()
+	if s == nil || s.DropWrites <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < s.DropWrites
+}
+
+// set activates chaos
+func (h *chaosHooks) set(chaos Chaos) {
+	seed := chaos.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	h.state.Store(&chaosState{Chaos: chaos, rng: rand.New(rand.NewSource(seed))})
+}
+
+// InjectChaos starts injecting the faults of chaos, replacing earlier ones
+func (c *RistrettoCache) InjectChaos(chaos Chaos) {
+	c.chaos.set(chaos)
+}
+
+// ClearChaos stops injecting faults
+func (c *RistrettoCache) ClearChaos() {
+	c.chaos.state.Store(nil)
+}
+
+// ForceEvict evicts up to n entries through the normal eviction path,
+// running OnEvict and OnExit, and returns how many were evicted
+func (c *RistrettoCache) ForceEvict(n int) int {
+	evicted := 0
+	c.applySync("", func() {
+		for evicted < n && c.evictOne() != nil {
+			evicted++
+		}
+	})
+	return evicted
+}
+
+// Corrupt replaces every live value with corrupt(key, value) and returns
+// how many were replaced. A nil corrupt flips a byte of []byte and string
+// values and replaces other values with a CorruptedValue, so type
+// assertions on them fail
+func (c *RistrettoCache) Corrupt(corrupt func(key string, value any) any) int {
+	if corrupt == nil {
+		corrupt = corruptValue
+	}
+	n := 0
+	for _, key := range c.cache.allKeys() {
+		item, ok := c.cache.snapshotItem(key)
+		if !ok {
+			continue
+		}
+		if c.replaceIfSync(key, item.stamp, corrupt(key, item.Value), item.Cost) {
+			n++
+		}
+	}
+	return n
+}
+
+// CorruptedValue replaces values of other types that Corrupt corrupts
+type CorruptedValue struct {
+	Original any
+}
+
+// corruptValue garbles a value, see Corrupt
+func corruptValue(_ string, value any) any {
+	switch v := value.(type) {
+	case []byte:
+		out := append([]byte(nil), v...)
+		if len(out) > 0 {
+			out[len(out)/2] ^= 0xFF
+		}
+		return out
+	case string:
+		return string(corruptValue("", []byte(v)).([]byte))
+	}
+	return CorruptedValue{Original: value}
+}
+
+// InjectChaos starts injecting the faults of chaos into every shard, each
+// shard drawing from its own random source
+func (sc *ShardedCacheV2) InjectChaos(chaos Chaos) {
+	for i, shard := range sc.shards {
+		shardChaos := chaos
+		if chaos.Seed != 0 {
+			shardChaos.Seed = chaos.Seed + int64(i)
+		}
+		shard.InjectChaos(shardChaos)
+	}
+}
+
+// ClearChaos stops injecting faults into every shard
+func (sc *ShardedCacheV2) ClearChaos() {
+	for _, shard := range sc.shards {
+		shard.ClearChaos()
+	}
+}
+
+// ForceEvict evicts up to n entries, taking them from the shards in turn,
+// and returns how many were evicted
+func (sc *ShardedCacheV2) ForceEvict(n int) int {
+	evicted := 0
+	for evicted < n {
+		round := 0
+		for _, shard := range sc.shards {
+			if evicted+round < n {
+				round += shard.ForceEvict(1)
+			}
+		}
+		if round == 0 {
+			break
+		}
+		evicted += round
+	}
+	return evicted
+}
+
+// CorruptShard corrupts every value of shard i, see RistrettoCache.Corrupt
+func (sc *ShardedCacheV2) CorruptShard(i int, corrupt func(key string, value any) any) (int, error) {
+	if i < 0 || i >= len(sc.shards) {
+		return 0, ErrShardOutOfRange
+	}
+	return sc.shards[i].Corrupt(corrupt), nil
+}
@@ -0,0 +1,16 @@
+//go:build !fastcache_chaos
+
+package src
+
+// chaosEnabled reports whether fault injection is built in
+const chaosEnabled = false
+
+// chaosHooks injects faults in builds with the fastcache_chaos tag, see
+// chaos.go. Without it the hooks do nothing and compile away
+type chaosHooks struct{}
+
+// delay does nothing without the fastcache_chaos tag
+func (chaosHooks) delay() {}
+
+// dropWrite reports false without the fastcache_chaos tag
+func (chaosHooks) dropWrite() bool { return false }
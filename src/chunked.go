@@ -0,0 +1,348 @@
+package src
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// ChunkedCache is a storage engine for []byte values that keeps entries in
+// large pre-allocated byte chunks addressed by offset, in the style of
+// VictoriaMetrics fastcache. Chunks and indexes contain no pointers, so the
+// GC does not scan them however many entries are cached.
+//
+// Each bucket is a ring of chunks written sequentially; when the ring is
+// full, writing wraps around and overwrites the oldest entries, so eviction
+// is FIFO by write time and costs nothing. Entries, key and value together,
+// must fit in a chunk (ChunkedMaxEntrySize)
+
+const (
+	// chunkedBuckets is the number of independently locked buckets
+	chunkedBuckets = 512
+	// chunkedChunkSize is the size of a chunk
+	chunkedChunkSize = 64 * 1024
+	// chunkedHeaderSize is the size of an entry header: key length (2),
+	// value length (2) and expiration in Unix nanoseconds (8)
+	chunkedHeaderSize = 12
+
+	// Index values pack the ring generation above the ring offset
+	chunkedOffsetBits = 40
+	chunkedGenBits    = 64 - chunkedOffsetBits
+	chunkedMaxGen     = 1<<chunkedGenBits - 1
+)
+
+// ChunkedMaxEntrySize is the maximum size of a key and value stored together
+const ChunkedMaxEntrySize = chunkedChunkSize - chunkedHeaderSize - 1
+
+// ChunkedCache stores []byte values by string key
+type ChunkedCache struct {
+	buckets [chunkedBuckets]chunkedBucket
+	ttl     time.Duration
+
+	// storage is the memory-mapped data file, nil for heap chunks
+	storage *chunkedStorage
+	// mapped reports whether storage was opened, see MappedStorage
+	mapped bool
+}
+
+// chunkedBucket is a ring of chunks and the index of its live entries
+type chunkedBucket struct {
+	mu sync.RWMutex
+
+	// chunks is the ring; chunks are allocated on first write
+	chunks [][]byte
+
+	// m maps key hashes to gen<<chunkedOffsetBits | ring offset
+	m map[uint64]uint64
+
+	// offset is the ring offset of the next write
+	offset uint64
+
+	// gen is incremented each time writing wraps around the ring
+	gen uint64
+}
+
+// NewChunkedCache creates a chunked cache using config.MaxCost bytes (1GB
+// if 0) and config.TTL as the default TTL. Chunks are allocated on the heap
+// as they are first written, or mapped from a file in config.StorageDir,
+// restoring the entries saved by the last Close. Where the file cannot be
+// mapped, see PlatformCapabilities, the chunks stay on the heap
+func NewChunkedCache(config *Config) (*ChunkedCache, error) {
+	if config == nil {
+		config = defaultConfig()
+	}
+	maxBytes := config.MaxCost
+	if maxBytes <= 0 {
+		maxBytes = 1 << 30
+	}
+
+	c := &ChunkedCache{ttl: config.TTL}
+	bucketBytes := (uint64(maxBytes) + chunkedBuckets - 1) / chunkedBuckets
+	chunks := int((bucketBytes + chunkedChunkSize - 1) / chunkedChunkSize)
+	for i := range c.buckets {
+		c.buckets[i].init(chunks)
+	}
+	if config.StorageDir != "" && canMap(int64(chunkedBuckets)*int64(chunks)*chunkedChunkSize) {
+		if err := c.openStorage(config.StorageDir, chunks); err != nil {
+			return nil, err
+		}
+		c.mapped = true
+	}
+	return c, nil
+}
+
+// MappedStorage reports whether the chunks are mapped from Config.StorageDir
+// and survive Close, false when they are on the heap
+func (c *ChunkedCache) MappedStorage() bool {
+	return c.mapped
+}
+
+func (b *chunkedBucket) init(chunks int) {
+	b.chunks = make([][]byte, chunks)
+	b.m = make(map[uint64]uint64)
+	b.offset = 0
+	b.gen = 1
+}
+
+// chunkedHash is FNV-1a over the key, without allocating
+func chunkedHash[T string | []byte](key T) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (c *ChunkedCache) bucket(h uint64) *chunkedBucket {
+	return &c.buckets[h%chunkedBuckets]
+}
+
+// Set stores value under key with the default TTL. It returns false if the
+// entry is larger than ChunkedMaxEntrySize or the cache is closed. The value
+// is copied
+func (c *ChunkedCache) Set(key string, value []byte) bool {
+	return c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores value under key, expiring after ttl (0 means no expiration)
+func (c *ChunkedCache) SetWithTTL(key string, value []byte, ttl time.Duration) bool {
+	if len(key)+len(value) > ChunkedMaxEntrySize {
+		return false
+	}
+	var exp int64
+	if ttl > 0 {
+		exp = time.Now().Add(ttl).UnixNano()
+	}
+	h := chunkedHash(key)
+	return c.bucket(h).set(h, key, value, exp)
+}
+
+func (b *chunkedBucket) set(h uint64, key string, value []byte, exp int64) bool {
+	var header [chunkedHeaderSize]byte
+	binary.LittleEndian.PutUint16(header[0:], uint16(len(key)))
+	binary.LittleEndian.PutUint16(header[2:], uint16(len(value)))
+	binary.LittleEndian.PutUint64(header[4:], uint64(exp))
+	size := uint64(chunkedHeaderSize + len(key) + len(value))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.chunks) == 0 {
+		return false
+	}
+	offset := b.offset
+	chunkIdx := offset / chunkedChunkSize
+	wrapped := false
+	if next := (offset + size) / chunkedChunkSize; next > chunkIdx {
+		// The entry does not fit in the current chunk: start the next one,
+		// or wrap around to the first and begin a new generation.
+		if next >= uint64(len(b.chunks)) {
+			chunkIdx = 0
+			b.gen++
+			if b.gen&chunkedMaxGen == 0 {
+				b.gen++
+			}
+			wrapped = true
+		} else {
+			chunkIdx = next
+		}
+		offset = chunkIdx * chunkedChunkSize
+		b.chunks[chunkIdx] = b.chunks[chunkIdx][:0]
+	}
+
+	chunk := b.chunks[chunkIdx]
+	if chunk == nil {
+		chunk = make([]byte, 0, chunkedChunkSize)
+	}
+	chunk = append(chunk, header[:]...)
+	chunk = append(chunk, key...)
+	chunk = append(chunk, value...)
+	b.chunks[chunkIdx] = chunk
+	b.m[h] = offset | (b.gen&chunkedMaxGen)<<chunkedOffsetBits
+	b.offset = offset + size
+	if wrapped {
+		b.cleanLocked()
+	}
+	return true
+}
+
+// liveLocked reports whether an index value points to an entry that has not
+// been overwritten: one written in the current generation before the write
+// offset, or in the previous generation past the chunk being written, which
+// was reset when writing entered it
+func (b *chunkedBucket) liveLocked(v uint64) bool {
+	gen := v >> chunkedOffsetBits
+	offset := v & (1<<chunkedOffsetBits - 1)
+	bGen := b.gen & chunkedMaxGen
+	if gen == bGen {
+		return offset < b.offset
+	}
+	chunkEnd := (b.offset/chunkedChunkSize + 1) * chunkedChunkSize
+	return (gen+1 == bGen || gen == chunkedMaxGen && bGen == 1) && offset >= chunkEnd
+}
+
+// cleanLocked drops the index entries overwritten by the last generation,
+// called when writing wraps around
+func (b *chunkedBucket) cleanLocked() {
+	for h, v := range b.m {
+		if !b.liveLocked(v) {
+			delete(b.m, h)
+		}
+	}
+}
+
+// Get returns a copy of the value stored under key
+func (c *ChunkedCache) Get(key string) ([]byte, bool) {
+	return c.GetTo(key, nil)
+}
+
+// GetTo appends the value stored under key to dst and returns the extended
+// buffer. Reading into a reused buffer does not allocate
+func (c *ChunkedCache) GetTo(key string, dst []byte) ([]byte, bool) {
+	h := chunkedHash(key)
+	return c.bucket(h).get(h, key, dst)
+}
+
+// Has reports whether a live value is stored under key
+func (c *ChunkedCache) Has(key string) bool {
+	_, found := c.Get(key)
+	return found
+}
+
+func (b *chunkedBucket) get(h uint64, key string, dst []byte) ([]byte, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	v, ok := b.m[h]
+	if !ok || !b.liveLocked(v) {
+		return dst, false
+	}
+	offset := v & (1<<chunkedOffsetBits - 1)
+	chunkIdx := offset / chunkedChunkSize
+	if chunkIdx >= uint64(len(b.chunks)) {
+		return dst, false
+	}
+	chunk := b.chunks[chunkIdx]
+	start := offset % chunkedChunkSize
+	if start+chunkedHeaderSize > uint64(len(chunk)) {
+		return dst, false
+	}
+	header := chunk[start : start+chunkedHeaderSize]
+	keyLen := uint64(binary.LittleEndian.Uint16(header[0:]))
+	valueLen := uint64(binary.LittleEndian.Uint16(header[2:]))
+	exp := int64(binary.LittleEndian.Uint64(header[4:]))
+	start += chunkedHeaderSize
+	if start+keyLen+valueLen > uint64(len(chunk)) {
+		return dst, false
+	}
+	// Different keys can share a hash; the stored key settles it.
+	if string(chunk[start:start+keyLen]) != key {
+		return dst, false
+	}
+	if exp > 0 && time.Now().UnixNano() > exp {
+		return dst, false
+	}
+	start += keyLen
+	return append(dst, chunk[start:start+valueLen]...), true
+}
+
+// Del removes key. The space it used is reclaimed when the ring wraps
+func (c *ChunkedCache) Del(key string) {
+	h := chunkedHash(key)
+	b := c.bucket(h)
+	b.mu.Lock()
+	delete(b.m, h)
+	b.mu.Unlock()
+}
+
+// Len returns the number of entries that have not been overwritten or
+// deleted. Expired entries are counted until they are overwritten. It walks
+// every index, so it is O(n)
+func (c *ChunkedCache) Len() int {
+	n := 0
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		b.mu.RLock()
+		for _, v := range b.m {
+			if b.liveLocked(v) {
+				n++
+			}
+		}
+		b.mu.RUnlock()
+	}
+	return n
+}
+
+// Cost returns the number of bytes allocated for chunks
+func (c *ChunkedCache) Cost() int64 {
+	var n int64
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		b.mu.RLock()
+		for _, chunk := range b.chunks {
+			n += int64(cap(chunk))
+		}
+		b.mu.RUnlock()
+	}
+	return n
+}
+
+// Clear removes all entries. Allocated chunks are kept for reuse
+func (c *ChunkedCache) Clear() {
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		b.mu.Lock()
+		for j := range b.chunks {
+			b.chunks[j] = b.chunks[j][:0]
+		}
+		b.m = make(map[uint64]uint64)
+		b.offset = 0
+		b.gen = 1
+		b.mu.Unlock()
+	}
+}
+
+// Close releases the chunks. With Config.StorageDir the data file is synced
+// and the index saved next to it, so the entries survive a restart. Later
+// sets fail and gets miss
+func (c *ChunkedCache) Close() error {
+	for i := range c.buckets {
+		c.buckets[i].mu.Lock()
+	}
+	defer func() {
+		for i := range c.buckets {
+			c.buckets[i].mu.Unlock()
+		}
+	}()
+
+	var err error
+	if c.storage != nil {
+		err = c.closeStorage()
+	}
+	for i := range c.buckets {
+		c.buckets[i].chunks = nil
+		c.buckets[i].m = nil
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package src
+
+import "encoding/binary"
+
+// SetBig splits a value that does not fit in a chunk into subvalues, each
+// stored under a 16-byte subkey made of the value hash and the subvalue
+// index, and stores a manifest of the value hash and length under the key
+// itself. GetBig reassembles the subvalues and checks the hash, so a value
+// with a subvalue that was already overwritten reads as a miss
+
+const (
+	// chunkedBigKeySize is the size of a subkey and of a manifest
+	chunkedBigKeySize = 16
+	// chunkedMaxSubvalueSize is the largest subvalue that fits in a chunk
+	// next to its subkey
+	chunkedMaxSubvalueSize = ChunkedMaxEntrySize - chunkedBigKeySize
+)
+
+// SetBig stores value under key with the default TTL, splitting it across
+// chunks so it may be larger than ChunkedMaxEntrySize. It returns false if
+// any part could not be stored. Read the value back with GetBig; Get returns
+// the manifest
+func (c *ChunkedCache) SetBig(key string, value []byte) bool {
+	if len(key)+chunkedBigKeySize > ChunkedMaxEntrySize {
+		return false
+	}
+	valueHash := chunkedHash(value)
+	var subkey [chunkedBigKeySize]byte
+	binary.LittleEndian.PutUint64(subkey[:], valueHash)
+	for n, rest := uint64(0), value; len(rest) > 0; n++ {
+		sub := rest
+		if len(sub) > chunkedMaxSubvalueSize {
+			sub = sub[:chunkedMaxSubvalueSize]
+		}
+		rest = rest[len(sub):]
+		binary.LittleEndian.PutUint64(subkey[8:], n)
+		if !c.Set(string(subkey[:]), sub) {
+			return false
+		}
+	}
+
+	// The manifest goes last, so it is never older than its subvalues.
+	var manifest [chunkedBigKeySize]byte
+	binary.LittleEndian.PutUint64(manifest[:], valueHash)
+	binary.LittleEndian.PutUint64(manifest[8:], uint64(len(value)))
+	return c.Set(key, manifest[:])
+}
+
+// GetBig returns a copy of the value stored under key by SetBig
+func (c *ChunkedCache) GetBig(key string) ([]byte, bool) {
+	return c.GetBigTo(key, nil)
+}
+
+// GetBigTo appends the value stored under key by SetBig to dst and returns
+// the extended buffer. It misses if any subvalue has been overwritten
+func (c *ChunkedCache) GetBigTo(key string, dst []byte) ([]byte, bool) {
+	var buf [chunkedBigKeySize]byte
+	manifest, found := c.GetTo(key, buf[:0])
+	if !found || len(manifest) != chunkedBigKeySize {
+		return dst, false
+	}
+	valueHash := binary.LittleEndian.Uint64(manifest)
+	valueLen := binary.LittleEndian.Uint64(manifest[8:])
+
+	start := len(dst)
+	var subkey [chunkedBigKeySize]byte
+	binary.LittleEndian.PutUint64(subkey[:], valueHash)
+	for n := uint64(0); uint64(len(dst)-start) < valueLen; n++ {
+		binary.LittleEndian.PutUint64(subkey[8:], n)
+		if dst, found = c.GetTo(string(subkey[:]), dst); !found {
+			return dst[:start], false
+		}
+	}
+	if uint64(len(dst)-start) != valueLen || chunkedHash(dst[start:]) != valueHash {
+		return dst[:start], false
+	}
+	return dst, true
+}
@@ -0,0 +1,194 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// With Config.StorageDir, the chunks of a ChunkedCache are slices of one
+// memory-mapped data file, so the kernel pages them in and out and the cache
+// can exceed RAM. The bucket indexes stay on the heap and are saved to an
+// index file by Close. Open loads and then removes the index file, so after
+// a crash the cache starts empty instead of trusting a stale index
+
+const (
+	chunkedDataFile  = "chunks.dat"
+	chunkedIndexFile = "index.dat"
+
+	// chunkedIndexMagic identifies an index file ("fcchunk1")
+	chunkedIndexMagic = 0x316b6e7568636366
+)
+
+// errBadChunkedIndex is returned for an index file that does not match the
+// data file
+var errBadChunkedIndex = errors.New("chunked cache index does not match storage")
+
+// chunkedStorage is the memory-mapped data file of a ChunkedCache
+type chunkedStorage struct {
+	dir  string
+	file *os.File
+	data []byte
+}
+
+// openStorage maps the data file in dir over the chunks of every bucket and
+// restores the saved index if the file geometry is unchanged
+func (c *ChunkedCache) openStorage(dir string, chunks int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, chunkedDataFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	size := int64(chunkedBuckets) * int64(chunks) * chunkedChunkSize
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	reuse := info.Size() == size
+	if !reuse {
+		// The file is sparse, so only written chunks take disk space.
+		if err := f.Truncate(size); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	data, err := mmapFile(f, int(size))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.storage = &chunkedStorage{dir: dir, file: f, data: data}
+
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		for j := range b.chunks {
+			start := (i*chunks + j) * chunkedChunkSize
+			b.chunks[j] = data[start : start : start+chunkedChunkSize]
+		}
+	}
+
+	indexPath := filepath.Join(dir, chunkedIndexFile)
+	if reuse {
+		// A missing or mismatched index leaves the cache empty.
+		_, _ = loadFile(indexPath, func(r io.Reader) (int, error) {
+			return 0, c.readIndex(r, chunks)
+		})
+	}
+	if err := os.Remove(indexPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// closeStorage unmaps and syncs the data file, then saves the index. The
+// bucket locks must be held
+func (c *ChunkedCache) closeStorage() error {
+	var index bytes.Buffer
+	c.writeIndex(&index)
+	for i := range c.buckets {
+		c.buckets[i].chunks = nil
+	}
+
+	s := c.storage
+	c.storage = nil
+	err := munmap(s.data)
+	if syncErr := s.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return saveFile(filepath.Join(s.dir, chunkedIndexFile), func(w io.Writer) error {
+		_, err := index.WriteTo(w)
+		return err
+	})
+}
+
+// writeIndex writes the geometry, then for every bucket its write offset,
+// generation, chunk lengths and index entries
+func (c *ChunkedCache) writeIndex(w io.Writer) {
+	chunks := len(c.buckets[0].chunks)
+	binary.Write(w, binary.LittleEndian, []uint64{chunkedIndexMagic, chunkedBuckets, uint64(chunks), chunkedChunkSize})
+	lens := make([]uint32, chunks)
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		for j, chunk := range b.chunks {
+			lens[j] = uint32(len(chunk))
+		}
+		entries := make([]uint64, 0, 2*len(b.m))
+		for h, v := range b.m {
+			if b.liveLocked(v) {
+				entries = append(entries, h, v)
+			}
+		}
+		binary.Write(w, binary.LittleEndian, []uint64{b.offset, b.gen, uint64(len(entries) / 2)})
+		binary.Write(w, binary.LittleEndian, lens)
+		binary.Write(w, binary.LittleEndian, entries)
+	}
+}
+
+// readIndex restores the bucket state written by writeIndex. Buckets are
+// only updated once the whole index has been read
+func (c *ChunkedCache) readIndex(r io.Reader, chunks int) error {
+	r = bufio.NewReader(r)
+	header := make([]uint64, 4)
+	if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if header[0] != chunkedIndexMagic || header[1] != chunkedBuckets || header[2] != uint64(chunks) || header[3] != chunkedChunkSize {
+		return errBadChunkedIndex
+	}
+
+	type bucketState struct {
+		offset, gen uint64
+		lens        []uint32
+		m           map[uint64]uint64
+	}
+	states := make([]bucketState, chunkedBuckets)
+	for i := range states {
+		head := make([]uint64, 3)
+		if err := binary.Read(r, binary.LittleEndian, head); err != nil {
+			return err
+		}
+		lens := make([]uint32, chunks)
+		if err := binary.Read(r, binary.LittleEndian, lens); err != nil {
+			return err
+		}
+		for _, n := range lens {
+			if n > chunkedChunkSize {
+				return errBadChunkedIndex
+			}
+		}
+		if head[0] > uint64(chunks)*chunkedChunkSize || head[2] > uint64(chunks)*chunkedChunkSize {
+			return errBadChunkedIndex
+		}
+		entries := make([]uint64, 2*head[2])
+		if err := binary.Read(r, binary.LittleEndian, entries); err != nil {
+			return err
+		}
+		m := make(map[uint64]uint64, head[2])
+		for j := 0; j < len(entries); j += 2 {
+			m[entries[j]] = entries[j+1]
+		}
+		states[i] = bucketState{offset: head[0], gen: head[1], lens: lens, m: m}
+	}
+
+	for i, s := range states {
+		b := &c.buckets[i]
+		for j, n := range s.lens {
+			b.chunks[j] = b.chunks[j][:n]
+		}
+		b.offset, b.gen, b.m = s.offset, s.gen, s.m
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package src
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// Codec converts values to and from bytes. Codecs are the single
+// serialization path for values that leave the process or are stored as
+// bytes
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// GobCodec encodes values with encoding/gob. Concrete types stored in
+// interface fields must be registered with gob.Register
+type GobCodec struct{}
+
+// Marshal encodes v with gob
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes gob data into the value v points to
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// JSONCodec encodes values with encoding/json
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into the value v points to
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgpackCodec encodes values as MessagePack, see msgpack.go
+type MsgpackCodec struct{}
+
+// Marshal encodes v as MessagePack
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return marshalMsgpack(v)
+}
+
+// Unmarshal decodes MessagePack data into the value v points to
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	return unmarshalMsgpack(data, v)
+}
+
+// SetEncoded encodes value with codec and stores the bytes, with their
+// length as cost. ttl <= 0 means no expiration
+func (c *RistrettoCache) SetEncoded(key string, value any, codec Codec, ttl time.Duration) (bool, error) {
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	if ttl > 0 {
+		return c.SetWithTTL(key, data, int64(len(data)), ttl), nil
+	}
+	return c.Set(key, data, int64(len(data))), nil
+}
+
+// GetDecoded decodes the bytes stored under key with codec into the value
+// out points to. It returns ErrNotBytes if the value is not a []byte or
+// string
+func (c *RistrettoCache) GetDecoded(key string, codec Codec, out any) (bool, error) {
+	value, found := c.Get(key)
+	if !found {
+		return false, nil
+	}
+	switch data := value.(type) {
+	case []byte:
+		return true, codec.Unmarshal(data, out)
+	case string:
+		return true, codec.Unmarshal([]byte(data), out)
+	}
+	return true, ErrNotBytes
+}
+
+// SetEncoded encodes value with codec and stores the bytes
+func (sc *ShardedCacheV2) SetEncoded(key string, value any, codec Codec, ttl time.Duration) (bool, error) {
+	return sc.getShard(key).SetEncoded(key, value, codec, ttl)
+}
+
+// GetDecoded decodes the bytes stored under key with codec into out
+func (sc *ShardedCacheV2) GetDecoded(key string, codec Codec, out any) (bool, error) {
+	return sc.getShard(key).GetDecoded(key, codec, out)
+}
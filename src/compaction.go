@@ -0,0 +1,194 @@
+package src
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCompactionInterval is the interval of the background value map sweeper.
+const DefaultCompactionInterval = 30 * time.Second
+
+// CompactionStats reports the work done by value map compaction.
+type CompactionStats struct {
+	Runs            int64 // Completed sweeps.
+	ValuesReclaimed int64 // Orphaned values removed.
+	BytesReclaimed  int64 // Approximate size of the removed values.
+	BucketsShrunk   int64 // Value tables shrunk after removals.
+}
+
+// compactionCounters accumulates CompactionStats.
+type compactionCounters struct {
+	runs            atomic.Int64
+	valuesReclaimed atomic.Int64
+	bytesReclaimed  atomic.Int64
+	bucketsShrunk   atomic.Int64
+}
+
+// approxValueSize returns a shallow size estimate of a value in bytes.
+func approxValueSize(v any) int64 {
+	switch val := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(val)) + 16
+	case []byte:
+		return int64(len(val)) + 24
+	default:
+		return int64(reflect.TypeOf(v).Size())
+	}
+}
+
+// collectLive adds the value IDs referenced by unexpired keys to live.
+func (h *HashMapAkBucket) collectLive(now int64, live map[string]struct{}) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, table := range [][]KeyLinkList{h.table, h.oldTable} {
+		for i := range table {
+			for node := table[i].Head; node != nil; node = node.Next {
+				if !node.expired(now) {
+					live[node.value] = struct{}{}
+				}
+			}
+		}
+	}
+}
+
+// finishRehash moves all entries left in oldTable into table (caller must hold lock).
+func (h *HashMapValueBucket) finishRehash() {
+	if h.oldTable == nil {
+		return
+	}
+	for i := h.rehashIndex; i < len(h.oldTable); i++ {
+		for c := h.oldTable[i].Head; c != nil; {
+			next := c.Next
+			index := HashKey(c.Key, h.size)
+			c.Next = h.table[index].Head
+			h.table[index].Head = c
+			c = next
+		}
+	}
+	h.oldTable = nil
+	h.rehashIndex = 0
+}
+
+// compact removes values that are neither live nor seen as orphans for the
+// first time, records new orphans in next, and shrinks the table when it has
+// become sparse. An orphan is only removed on the sweep after the one that
+// found it, which leaves writers time to link a freshly stored value to its key.
+func (h *HashMapValueBucket) compact(live, orphans, next map[string]struct{}) (reclaimed, bytes int64, shrunk bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.finishRehash()
+
+	for i := range h.table {
+		var prev *ValueLink
+		for c := h.table[i].Head; c != nil; c = c.Next {
+			_, isLive := live[c.Key]
+			_, isOrphan := orphans[c.Key]
+			if isLive || !isOrphan {
+				if !isLive {
+					next[c.Key] = struct{}{}
+				}
+				prev = c
+				continue
+			}
+			if prev == nil {
+				h.table[i].Head = c.Next
+			} else {
+				prev.Next = c.Next
+			}
+			h.count--
+			reclaimed++
+			bytes += approxValueSize(c.value)
+		}
+	}
+
+	// Shrink while the table is less than a quarter of the load factor full.
+	size := h.size
+	for size > VDefaultSize && float64(h.count)/float64(size) < VLoadFactor/4 {
+		size /= 2
+	}
+	if size < h.size {
+		table := make([]RowValueLinkList, size)
+		for i := range h.table {
+			for c := h.table[i].Head; c != nil; {
+				next := c.Next
+				index := HashKey(c.Key, size)
+				c.Next = table[index].Head
+				table[index].Head = c
+				c = next
+			}
+		}
+		h.table = table
+		h.size = size
+		shrunk = true
+	}
+	return reclaimed, bytes, shrunk
+}
+
+// Compact runs one sweep of the value map: values no longer referenced by
+// any live key are reclaimed and sparse tables are shrunk. Orphans found by a
+// sweep are removed by the next one.
+func (fc *FastCache) Compact() CompactionStats {
+	fc.compactMu.Lock()
+	defer fc.compactMu.Unlock()
+
+	// Snapshot live references while no Set is between storing a value and
+	// linking its key.
+	live := make(map[string]struct{})
+	now := time.Now().UnixNano()
+	fc.mu.RLock()
+	for _, shard := range fc.KeyMap.shards {
+		shard.collectLive(now, live)
+	}
+	fc.mu.RUnlock()
+
+	var run CompactionStats
+	next := make(map[string]struct{})
+	for _, bucket := range fc.ValueMap.shards {
+		reclaimed, bytes, shrunk := bucket.compact(live, fc.orphans, next)
+		run.ValuesReclaimed += reclaimed
+		run.BytesReclaimed += bytes
+		if shrunk {
+			run.BucketsShrunk++
+		}
+	}
+	fc.orphans = next
+	run.Runs = 1
+
+	fc.compaction.runs.Add(1)
+	fc.compaction.valuesReclaimed.Add(run.ValuesReclaimed)
+	fc.compaction.bytesReclaimed.Add(run.BytesReclaimed)
+	fc.compaction.bucketsShrunk.Add(run.BucketsShrunk)
+	return run
+}
+
+// CompactionStats returns the totals of all compaction sweeps.
+func (fc *FastCache) CompactionStats() CompactionStats {
+	return CompactionStats{
+		Runs:            fc.compaction.runs.Load(),
+		ValuesReclaimed: fc.compaction.valuesReclaimed.Load(),
+		BytesReclaimed:  fc.compaction.bytesReclaimed.Load(),
+		BucketsShrunk:   fc.compaction.bucketsShrunk.Load(),
+	}
+}
+
+// startCompaction runs Compact every interval until the cache is closed.
+func (fc *FastCache) startCompaction(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fc.Compact()
+			case <-fc.closeCh:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,598 @@
+package src
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Dictionary compression defaults
+const (
+	// DefaultDictSize is the size of the content of a trained dictionary
+	DefaultDictSize = 64 << 10
+	// DefaultDictSamples is the number of values sampled per namespace
+	DefaultDictSamples = 512
+	// DefaultDictMinSamples is the number of samples needed to train
+	DefaultDictMinSamples = 64
+	// DefaultDictHistory is the number of dictionaries kept per namespace,
+	// so values compressed with an older one still decode
+	DefaultDictHistory = 4
+
+	// maxDictSize bounds the dictionary content, and so training time
+	maxDictSize = 1 << 20
+
+	// dmer is the length of the substrings counted by training, and
+	// dictSegment the length of the segments copied into the dictionary
+	dmer        = 8
+	dictSegment = 64
+)
+
+// Frame formats, the first byte of a compressed value
+const (
+	frameRaw  byte = 0 // stored as is, compression did not pay off
+	frameZstd byte = 2 // a zstd frame, naming its dictionary in the frame header
+)
+
+var (
+	// ErrUnknownDict is returned when a value was compressed with a
+	// dictionary that is no longer kept
+	ErrUnknownDict = errors.New("unknown compression dictionary")
+	// ErrBadFrame is returned for data that is not a compressed value
+	ErrBadFrame = errors.New("malformed compressed value")
+)
+
+// DictOptions configures CompressionDicts
+type DictOptions struct {
+	// DictSize is the size of the content of trained dictionaries (default DefaultDictSize, at most 1 MB)
+	DictSize int
+	// Samples is the number of values sampled per namespace (default DefaultDictSamples)
+	Samples int
+	// MinSamples is the number of new samples needed to train (default DefaultDictMinSamples)
+	MinSamples int
+	// History is the number of dictionaries kept per namespace (default DefaultDictHistory)
+	History int
+	// Level is the zstd compression level, 1 to 22 as for the zstd command
+	// (default 3)
+	Level int
+}
+
+// DictStats reports the compression of one namespace
+type DictStats struct {
+	DictID          uint32
+	DictSize        int
+	Samples         int
+	Trainings       int64
+	RawBytes        int64
+	CompressedBytes int64
+	Ratio           float64 // RawBytes / CompressedBytes
+}
+
+// compressionDict is a trained zstd dictionary with its codecs. Encoder
+// EncodeAll and Decoder DecodeAll are safe for concurrent use
+type compressionDict struct {
+	id   uint32
+	data []byte // in the zstd dictionary format
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+}
+
+// newCompressionDict loads a dictionary in the zstd dictionary format
+func newCompressionDict(data []byte, level zstd.EncoderLevel) (*compressionDict, error) {
+	info, err := zstd.InspectDictionary(data)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderCRC(false), zstd.WithEncoderDict(data))
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderDicts(data))
+	if err != nil {
+		return nil, err
+	}
+	return &compressionDict{id: info.ID(), data: data, enc: enc, dec: dec}, nil
+}
+
+// dictNamespace is the sampling and dictionary state of one namespace
+type dictNamespace struct {
+	samples    [][]byte
+	seen       int64 // values offered for sampling
+	newSamples int   // samples taken since the last training
+	current    *compressionDict
+	history    []*compressionDict // newest last, includes current
+
+	trainings       int64
+	rawBytes        int64
+	compressedBytes int64
+}
+
+// CompressionDicts compresses small values per entry with zstd and a
+// dictionary trained per namespace from sampled values. Many small similar
+// values (e.g. JSON documents of one type) compress poorly on their own;
+// with a dictionary of their common substrings and entropy tables fitted to
+// them they shrink several times over
+type CompressionDicts struct {
+	mu         sync.RWMutex
+	opts       DictOptions
+	level      zstd.EncoderLevel
+	plain      *compressionDict // no dictionary, for untrained namespaces
+	namespaces map[string]*dictNamespace
+	byID       map[uint32]*compressionDict
+	rng        *rand.Rand
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	restarts atomic.Int64
+}
+
+// NewCompressionDicts creates dictionaries with no namespaces
+func NewCompressionDicts(opts DictOptions) *CompressionDicts {
+	if opts.DictSize <= 0 {
+		opts.DictSize = DefaultDictSize
+	}
+	if opts.DictSize > maxDictSize {
+		opts.DictSize = maxDictSize
+	}
+	if opts.Samples <= 0 {
+		opts.Samples = DefaultDictSamples
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = DefaultDictMinSamples
+	}
+	if opts.History <= 0 {
+		opts.History = DefaultDictHistory
+	}
+	if opts.Level <= 0 {
+		opts.Level = 3
+	}
+	level := zstd.EncoderLevelFromZstd(opts.Level)
+	// Options without a dictionary cannot fail
+	enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderCRC(false))
+	dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	return &CompressionDicts{
+		opts:       opts,
+		level:      level,
+		plain:      &compressionDict{enc: enc, dec: dec},
+		namespaces: make(map[string]*dictNamespace),
+		byID:       make(map[uint32]*compressionDict),
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// namespace returns the state of ns, creating it (caller must hold write lock)
+func (d *CompressionDicts) namespace(ns string) *dictNamespace {
+	n, ok := d.namespaces[ns]
+	if !ok {
+		n = &dictNamespace{}
+		d.namespaces[ns] = n
+	}
+	return n
+}
+
+// sample offers value to the reservoir of ns
+func (d *CompressionDicts) sample(ns string, value []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := d.namespace(ns)
+	n.seen++
+	if len(n.samples) < d.opts.Samples {
+		n.samples = append(n.samples, bytes.Clone(value))
+		n.newSamples++
+		return
+	}
+	// Reservoir sampling keeps a uniform sample of everything seen
+	if i := d.rng.Int63n(n.seen); i < int64(len(n.samples)) {
+		n.samples[i] = bytes.Clone(value)
+		n.newSamples++
+	}
+}
+
+// Compress samples value for ns and compresses it with the current
+// dictionary of ns (without one until the namespace has been trained)
+func (d *CompressionDicts) Compress(ns string, value []byte) ([]byte, error) {
+	d.sample(ns, value)
+
+	d.mu.RLock()
+	dict := d.namespaces[ns].current
+	d.mu.RUnlock()
+
+	out := d.compress(dict, value)
+
+	d.mu.Lock()
+	n := d.namespace(ns)
+	n.rawBytes += int64(len(value))
+	n.compressedBytes += int64(len(out))
+	d.mu.Unlock()
+	return out, nil
+}
+
+// compress frames value compressed with dict (nil for no dictionary)
+func (d *CompressionDicts) compress(dict *compressionDict, value []byte) []byte {
+	if dict == nil {
+		dict = d.plain
+	}
+	out := dict.enc.EncodeAll(value, append(make([]byte, 0, len(value)/2+16), frameZstd))
+	if len(out) >= len(value)+1 {
+		// Compression did not pay off
+		return append([]byte{frameRaw}, value...)
+	}
+	return out
+}
+
+// Decompress decodes a value returned by Compress, with whichever kept
+// dictionary it was compressed with
+func (d *CompressionDicts) Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrBadFrame
+	}
+	switch data[0] {
+	case frameRaw:
+		return bytes.Clone(data[1:]), nil
+	case frameZstd:
+	default:
+		return nil, ErrBadFrame
+	}
+
+	var header zstd.Header
+	if err := header.Decode(data[1:]); err != nil {
+		return nil, ErrBadFrame
+	}
+	dict := d.plain
+	if header.DictionaryID != 0 {
+		d.mu.RLock()
+		dict = d.byID[header.DictionaryID]
+		d.mu.RUnlock()
+		if dict == nil {
+			return nil, ErrUnknownDict
+		}
+	}
+	return dict.dec.DecodeAll(data[1:], nil)
+}
+
+// Train builds a new dictionary for ns from its samples and adopts it if it
+// compresses the samples better than the current one. It reports whether
+// the dictionary changed
+func (d *CompressionDicts) Train(ns string) bool {
+	d.mu.Lock()
+	n, ok := d.namespaces[ns]
+	if !ok || len(n.samples) < d.opts.MinSamples {
+		d.mu.Unlock()
+		return false
+	}
+	samples := append([][]byte(nil), n.samples...)
+	current := n.current
+	n.newSamples = 0
+	d.mu.Unlock()
+
+	content := trainDict(samples, d.opts.DictSize)
+	if len(content) < 8 {
+		return false
+	}
+	id := dictID(content)
+	if current != nil && id == current.id {
+		return false
+	}
+	// BuildDict fits the entropy tables of the dictionary to the samples
+	data, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  content,
+		Offsets:  [3]int{1, 4, 8},
+		Level:    d.level,
+	})
+	if err != nil {
+		return false
+	}
+	candidate, err := newCompressionDict(data, d.level)
+	if err != nil {
+		return false
+	}
+	if current != nil && d.sampleSize(candidate, samples) >= d.sampleSize(current, samples) {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.adopt(ns, candidate)
+	n.trainings++
+	return true
+}
+
+// sampleSize returns the compressed size of samples with dict
+func (d *CompressionDicts) sampleSize(dict *compressionDict, samples [][]byte) int {
+	total := 0
+	for _, s := range samples {
+		total += len(d.compress(dict, s))
+	}
+	return total
+}
+
+// adopt makes dict the current dictionary of ns and drops the oldest one
+// beyond the history (caller must hold write lock)
+func (d *CompressionDicts) adopt(ns string, dict *compressionDict) {
+	n := d.namespace(ns)
+	n.current = dict
+	n.history = append(n.history, dict)
+	d.byID[dict.id] = dict
+	for len(n.history) > d.opts.History {
+		delete(d.byID, n.history[0].id)
+		n.history = n.history[1:]
+	}
+}
+
+// dictID returns the ID of a dictionary with the given content, never 0
+// (no dictionary)
+func dictID(content []byte) uint32 {
+	id := crc32.ChecksumIEEE(content)
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// StartRetraining retrains every namespace with at least MinSamples new
+// samples every interval, until Close
+func (d *CompressionDicts) StartRetraining(interval time.Duration) {
+	goWorker(&d.wg, "dictTrainer", &d.restarts, func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.retrainDue()
+			case <-d.stopCh:
+				return
+			}
+		}
+	})
+}
+
+// retrainDue trains the namespaces with enough new samples
+func (d *CompressionDicts) retrainDue() {
+	d.mu.RLock()
+	var due []string
+	for ns, n := range d.namespaces {
+		if n.newSamples >= d.opts.MinSamples {
+			due = append(due, ns)
+		}
+	}
+	d.mu.RUnlock()
+	for _, ns := range due {
+		d.Train(ns)
+	}
+}
+
+// Stats returns the compression statistics of every namespace
+func (d *CompressionDicts) Stats() map[string]DictStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	stats := make(map[string]DictStats, len(d.namespaces))
+	for ns, n := range d.namespaces {
+		st := DictStats{
+			Samples:         len(n.samples),
+			Trainings:       n.trainings,
+			RawBytes:        n.rawBytes,
+			CompressedBytes: n.compressedBytes,
+		}
+		if n.current != nil {
+			st.DictID = n.current.id
+			st.DictSize = len(n.current.data)
+		}
+		if n.compressedBytes > 0 {
+			st.Ratio = float64(n.rawBytes) / float64(n.compressedBytes)
+		}
+		stats[ns] = st
+	}
+	return stats
+}
+
+// savedDictsVersion is the version of savedDicts written by Save
+const savedDictsVersion = 2
+
+// savedDicts is the persisted form of the dictionaries, oldest first per
+// namespace, in the zstd dictionary format
+type savedDicts struct {
+	Version    int                 `json:"version"`
+	Namespaces map[string][][]byte `json:"namespaces"`
+}
+
+// Save writes the kept dictionaries of every namespace to w, so values
+// compressed before a restart still decode after Load
+func (d *CompressionDicts) Save(w io.Writer) error {
+	d.mu.RLock()
+	saved := savedDicts{Version: savedDictsVersion, Namespaces: make(map[string][][]byte, len(d.namespaces))}
+	for ns, n := range d.namespaces {
+		for _, dict := range n.history {
+			saved.Namespaces[ns] = append(saved.Namespaces[ns], dict.data)
+		}
+	}
+	d.mu.RUnlock()
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// Load reads dictionaries written by Save; the newest of each namespace
+// becomes its current dictionary
+func (d *CompressionDicts) Load(r io.Reader) error {
+	var saved savedDicts
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	if saved.Version != savedDictsVersion {
+		return fmt.Errorf("unsupported dictionary version %d", saved.Version)
+	}
+	loaded := make(map[string][]*compressionDict, len(saved.Namespaces))
+	for ns, dicts := range saved.Namespaces {
+		for _, data := range dicts {
+			dict, err := newCompressionDict(data, d.level)
+			if err != nil {
+				return fmt.Errorf("namespace %q: %w", ns, err)
+			}
+			loaded[ns] = append(loaded[ns], dict)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for ns, dicts := range loaded {
+		for _, dict := range dicts {
+			d.adopt(ns, dict)
+		}
+	}
+	return nil
+}
+
+// Close stops retraining
+func (d *CompressionDicts) Close() error {
+	d.stopOnce.Do(func() { close(d.stopCh) })
+	d.wg.Wait()
+	return nil
+}
+
+// Codec returns a Codec that encodes values with inner and compresses the
+// bytes with the dictionary of ns, for SetEncoded and GetDecoded
+func (d *CompressionDicts) Codec(ns string, inner Codec) Codec {
+	return dictCodec{dicts: d, ns: ns, inner: inner}
+}
+
+// dictCodec is the Codec returned by CompressionDicts.Codec
+type dictCodec struct {
+	dicts *CompressionDicts
+	ns    string
+	inner Codec
+}
+
+// Marshal encodes v with the inner codec and compresses it
+func (c dictCodec) Marshal(v any) ([]byte, error) {
+	data, err := c.inner.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.dicts.Compress(c.ns, data)
+}
+
+// Unmarshal decompresses data and decodes it with the inner codec
+func (c dictCodec) Unmarshal(data []byte, v any) error {
+	raw, err := c.dicts.Decompress(data)
+	if err != nil {
+		return err
+	}
+	return c.inner.Unmarshal(raw, v)
+}
+
+// trainDict builds a dictionary of at most size bytes from the segments of
+// samples that cover the most frequent substrings, in the manner of zstd's
+// COVER algorithm: substrings of dmer bytes are counted once per sample,
+// segments are scored by the counts of the substrings they contain that no
+// chosen segment covers yet, and the best segments are taken greedily
+func trainDict(samples [][]byte, size int) []byte {
+	freq := make(map[uint64]int)
+	for _, s := range samples {
+		seen := make(map[uint64]struct{})
+		for i := 0; i+dmer <= len(s); i++ {
+			h := dmerHash(s[i : i+dmer])
+			if _, ok := seen[h]; !ok {
+				seen[h] = struct{}{}
+				freq[h]++
+			}
+		}
+	}
+
+	// Candidate segments start every quarter segment
+	var candidates segmentHeap
+	for si, s := range samples {
+		for start := 0; start < len(s); start += dictSegment / 4 {
+			end := min(start+dictSegment, len(s))
+			if end-start < dmer {
+				break
+			}
+			seg := dictSegmentRef{sample: si, start: start, end: end}
+			seg.score = seg.scoreWith(samples, freq)
+			if seg.score > 0 {
+				candidates = append(candidates, seg)
+			}
+		}
+	}
+	heap.Init(&candidates)
+
+	var chosen []dictSegmentRef
+	total := 0
+	for candidates.Len() > 0 && total < size {
+		seg := heap.Pop(&candidates).(dictSegmentRef)
+		// Scores drop as segments are chosen, re-score lazily
+		if score := seg.scoreWith(samples, freq); score != seg.score {
+			if seg.score = score; score > 0 {
+				heap.Push(&candidates, seg)
+			}
+			continue
+		}
+		if seg.score <= 1 {
+			// Only substrings seen in a single sample are left
+			break
+		}
+		chosen = append(chosen, seg)
+		total += seg.end - seg.start
+		s := samples[seg.sample]
+		for i := seg.start; i+dmer <= seg.end; i++ {
+			delete(freq, dmerHash(s[i:i+dmer]))
+		}
+	}
+
+	// Matches close to the data are encoded cheaper, so the best segments go last
+	sort.SliceStable(chosen, func(i, j int) bool { return chosen[i].score < chosen[j].score })
+	dict := make([]byte, 0, total)
+	for _, seg := range chosen {
+		dict = append(dict, samples[seg.sample][seg.start:seg.end]...)
+	}
+	if len(dict) > size {
+		dict = dict[len(dict)-size:]
+	}
+	return dict
+}
+
+// dictSegmentRef is a candidate dictionary segment of a sample
+type dictSegmentRef struct {
+	sample, start, end int
+	score              int
+}
+
+// scoreWith returns the summed frequency of the substrings in the segment
+func (seg dictSegmentRef) scoreWith(samples [][]byte, freq map[uint64]int) int {
+	s := samples[seg.sample]
+	score := 0
+	for i := seg.start; i+dmer <= seg.end; i++ {
+		score += freq[dmerHash(s[i:i+dmer])]
+	}
+	return score
+}
+
+// dmerHash hashes a substring of dmer bytes
+func dmerHash(b []byte) uint64 {
+	return binary.LittleEndian.Uint64(b)
+}
+
+// segmentHeap is a max-heap of candidate segments by score
+type segmentHeap []dictSegmentRef
+
+func (h segmentHeap) Len() int           { return len(h) }
+func (h segmentHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h segmentHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x any)        { *h = append(*h, x.(dictSegmentRef)) }
+func (h *segmentHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,64 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func userJSON(i int) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"name":"user-%d","email":"user%d@example.com","role":"member","active":true,"created_at":"2024-01-%02dT10:00:00Z","settings":{"theme":"dark","language":"en-US","notifications":true}}`, i, i, i, i%28+1))
+}
+
+// A trained dictionary shrinks small similar values that barely compress alone
+func TestCompressionDictsTrainAndRoundTrip(t *testing.T) {
+	dicts := NewCompressionDicts(DictOptions{})
+	defer dicts.Close()
+
+	for i := 0; i < 200; i++ {
+		if _, err := dicts.Compress("users", userJSON(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value := userJSON(1000)
+	before, _ := dicts.Compress("users", value)
+
+	if !dicts.Train("users") {
+		t.Fatal("Train did not adopt a dictionary")
+	}
+	after, err := dicts.Compress("users", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after)*2 > len(before) {
+		t.Fatalf("compressed %d bytes to %d with a dictionary, %d without", len(value), len(after), len(before))
+	}
+
+	for _, data := range [][]byte{before, after} {
+		got, err := dicts.Decompress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, value) {
+			t.Fatalf("Decompress = %s, want %s", got, value)
+		}
+	}
+
+	// Values compressed before a restart decode after Load
+	var saved bytes.Buffer
+	if err := dicts.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewCompressionDicts(DictOptions{})
+	defer restored.Close()
+	if err := restored.Load(&saved); err != nil {
+		t.Fatal(err)
+	}
+	got, err := restored.Decompress(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Fatalf("Decompress after Load = %s, want %s", got, value)
+	}
+}
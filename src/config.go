@@ -22,6 +22,77 @@ type Config struct {
 	OnReject func(key string, value any, cost int64)
 	// OnExit exit callback (eviction + rejection)
 	OnExit func(value any)
+	// Loader loads missing keys for Load; concurrent misses share one call
+	Loader func(key string) (any, int64, error)
+	// Cost computes the cost of values set with cost 0 (default EstimateCost)
+	Cost func(value any) int64
+	// SampleSize number of random main-segment keys sampled to pick the eviction victim under AdmissionAlways (default DefaultSampleSize)
+	SampleSize int
+	// WindowRatio share of MaxCost for the W-TinyLFU window segment (default DefaultWindowRatio)
+	WindowRatio float64
+	// OrderedKeys keeps a sorted key index so ScanPrefix, Range and DelPrefix run in O(log n + k)
+	OrderedKeys bool
+	// Tracer starts spans in GetContext, SetContext and DelContext (nil disables tracing)
+	Tracer Tracer
+	// Audit records every mutation, with the actor of the caller's context or server token, see AuditLog (nil disables auditing)
+	Audit *AuditLog
+	// SlidingTTL renews the TTL of entries set with SetWithTTL on every Get
+	SlidingTTL bool
+	// Admit decides whether a set is applied; returning false rejects it (nil admits all)
+	Admit func(key string, cost int64, freq int64, stats AdmissionStats) bool
+	// Policy selects the eviction policy (default PolicyTinyLFU)
+	Policy EvictionPolicy
+	// AdmissionPolicy selects whether new keys must earn their place in the main segment (default AdmissionTinyLFU)
+	AdmissionPolicy AdmissionPolicy
+	// AdmissionThreshold share of MaxCost above which keys leaving the window compete for admission (default DefaultAdmissionThreshold)
+	AdmissionThreshold float64
+	// RefreshAhead share of an entry's TTL left at which a read queues a registered RefreshFunc (default DefaultRefreshAhead)
+	RefreshAhead float64
+	// RefreshWorkers number of goroutines running RefreshFuncs (default DefaultRefreshWorkers)
+	RefreshWorkers int
+	// InternKeys packs keys into shared slabs to save per-key memory, see KeyInternStats
+	InternKeys bool
+	// Invalidator broadcasts Del and Clear to the other instances of a fleet and applies theirs (nil keeps the cache local)
+	Invalidator Invalidator
+	// InstanceID identifies this instance on the Invalidator (random if empty)
+	InstanceID string
+	// InvalidateOnSet also broadcasts the key of every Set, so peers drop their old value
+	InvalidateOnSet bool
+	// Prefetch learns which keys are read after which and loads likely-next keys with Loader in the background
+	Prefetch bool
+	// PrefetchWorkers number of goroutines running prefetch loads (default DefaultPrefetchWorkers)
+	PrefetchWorkers int
+	// WriteLimit limits the sets of each caller before they enter the set buffer (zero Rate means unlimited)
+	WriteLimit WriteLimit
+	// WriteLimits overrides WriteLimit for the named callers
+	WriteLimits map[string]WriteLimit
+	// WriteCaller maps a key to the caller its sets count against (default KeyPrefixCaller)
+	WriteCaller func(key string) string
+	// DropPolicy decides whether a set that finds the set buffer full is dropped, drops the oldest queued set or blocks (nil drops the new set)
+	DropPolicy DropPolicy
+	// AutoDegrade enters degraded mode when the set buffer fills up, see Degrade
+	AutoDegrade bool
+	// DegradeCooldown how long the set buffer must stay nearly empty before degraded mode ends (default DefaultDegradeCooldown)
+	DegradeCooldown time.Duration
+	// PersistMetrics makes SaveToFile also write the cumulative metrics and hot keys to path+".metrics", and LoadFromFile restore them
+	PersistMetrics bool
+	// DeltaSnapshots tracks deletes so SaveDelta and SaveIncremental can write only the keys changed since the previous snapshot
+	DeltaSnapshots bool
+	// FullSnapshotEvery how many SaveIncremental calls write one full snapshot, the others write deltas (default DefaultFullSnapshotEvery)
+	FullSnapshotEvery int
+	// ValueCodec id of the registered codec GetAs decodes stored bytes with (default CodecGob)
+	ValueCodec string
+	// Router picks the shard of each key in ShardedCacheV2 (default HashRouter)
+	Router Router
+	// ShardWeights splits MaxCost between the shards of ShardedCacheV2 in proportion to these weights, one per shard (nil splits it evenly)
+	ShardWeights []float64
+	// RebalanceInterval how often ShardedCacheV2 moves cost limit from shards with spare room to shards that evict (0 disables rebalancing)
+	RebalanceInterval time.Duration
+	// StorageDir backs ChunkedCache with a memory-mapped file in this directory, so it can exceed RAM and survive restarts (empty, or a platform that cannot map the file, keeps chunks on the heap)
+	StorageDir string
+
+	// CloseTimeout how long Close waits for background workers before returning ErrWorkersStuck (default DefaultCloseTimeout)
+	CloseTimeout time.Duration
 
 	// GCInterval GC interval (0 = disabled)
 	GCInterval time.Duration
@@ -29,12 +100,56 @@ type Config struct {
 	GcMemThreshold int
 }
 
+// EvictionPolicy selects how RistrettoCache admits and evicts entries
+type EvictionPolicy string
+
+const (
+	// PolicyTinyLFU admits new keys through a window segment and evicts by
+	// sampled frequency (W-TinyLFU)
+	PolicyTinyLFU EvictionPolicy = ""
+	// PolicyARC admits every key and evicts with Adaptive Replacement Cache,
+	// which balances recency and frequency and resists scans
+	PolicyARC EvictionPolicy = "arc"
+)
+
+// AdmissionPolicy selects how PolicyTinyLFU admits keys leaving the window
+// into the main segment
+type AdmissionPolicy string
+
+const (
+	// AdmissionTinyLFU admits a key leaving the window only if it is more
+	// frequent than the main segment's victim; the loser is evicted
+	AdmissionTinyLFU AdmissionPolicy = ""
+	// AdmissionAlways admits every key and evicts the least frequent sampled
+	// key of the main segment to make room
+	AdmissionAlways AdmissionPolicy = "always"
+	// AdmissionOff admits every key and evicts in LRU order, ignoring
+	// frequencies
+	AdmissionOff AdmissionPolicy = "off"
+)
+
+// DefaultAdmissionThreshold is the default share of MaxCost above which keys
+// compete for admission: only a full cache filters writes
+const DefaultAdmissionThreshold = 1.0
+
+// DefaultSampleSize is the default number of keys sampled for eviction
+const DefaultSampleSize = 5
+
+// AdmissionStats is the cache state passed to Config.Admit
+// (per shard for ShardedCacheV2)
+type AdmissionStats struct {
+	Len     int
+	Cost    int64
+	MaxCost int64
+}
+
 // defaultConfig returns default configuration
 func defaultConfig() *Config {
 	return &Config{
 		NumCounters:    1e7, // 10M
 		MaxCost:        1 << 30, // 1GB
 		BufferItems:    64,
+		SampleSize:     DefaultSampleSize,
 		Metrics:        false,
 		TTL:            0,
 		GCInterval:     0,
@@ -0,0 +1,122 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotInteger is returned by IncrBy when the stored value is not an int or int64
+var ErrNotInteger = errors.New("value is not an integer")
+
+// incr adds delta to an int or int64 value and returns the result.
+// found is false if the key is missing. An expired key must be removed
+// first, see removeExpired
+func (c *LRUCache) incr(key string, delta int64) (value int64, found bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return 0, false, nil
+	}
+
+	switch v := item.Value.(type) {
+	case int64:
+		value = v + delta
+		item.Value = value
+	case int:
+		value = int64(v) + delta
+		item.Value = int(value)
+	default:
+		return 0, true, ErrNotInteger
+	}
+	item.stamp = nextItemStamp()
+	c.touch(item)
+	return value, true, nil
+}
+
+// applySync runs apply on the write goroutine, after the sets buffered
+// before it, and waits for it. Unlike Set it is never dropped when the
+// buffer is full
+func (c *RistrettoCache) applySync(key string, apply func()) error {
+	if c.closed.Load() {
+		return ErrCacheClosed
+	}
+
+	applied := make(chan struct{})
+	item := &setItem{key: key, apply: apply, waited: true, done: func() { close(applied) }}
+	select {
+	case c.setBuf <- item:
+	case <-c.stopCh:
+		return ErrCacheClosed
+	}
+	select {
+	case <-applied:
+		if item.dropped {
+			if c.closed.Load() {
+				return ErrCacheClosed
+			}
+			return ErrSetDropped
+		}
+		return nil
+	case <-c.stopCh:
+		return ErrCacheClosed
+	}
+}
+
+// addNew adds a key that is known to be missing (write goroutine only)
+func (c *RistrettoCache) addNew(key string, value any, cost int64) {
+	c.makeRoom(cost)
+	c.cache.Add(key, value, cost, 0)
+	c.admitOverflow()
+	c.metrics.keysAdded.Add(1)
+	c.metrics.costAdded.Add(cost)
+}
+
+// IncrBy atomically adds delta to an int or int64 value and returns the new
+// value. A missing key is created as an int64 holding delta, with cost 1 and
+// no TTL. The increment is ordered after earlier Sets of the same cache
+func (c *RistrettoCache) IncrBy(key string, delta int64) (int64, error) {
+	var value int64
+	var incrErr error
+	err := c.applySync(key, func() {
+		c.recordAccess(key)
+		if e, ok := c.cache.removeExpired(key, time.Now().UnixNano()); ok {
+			c.expired(e)
+		}
+		var found bool
+		value, found, incrErr = c.cache.incr(key, delta)
+		if !found {
+			c.addNew(key, delta, 1)
+			value = delta
+		}
+	})
+	if err != nil {
+		c.config.Audit.Record(context.Background(), AuditIncr, key, nil, false)
+		return 0, err
+	}
+	c.config.Audit.Record(context.Background(), AuditIncr, key, value, incrErr == nil)
+	return value, incrErr
+}
+
+// DecrBy atomically subtracts delta from an int or int64 value, see IncrBy
+func (c *RistrettoCache) DecrBy(key string, delta int64) (int64, error) {
+	return c.IncrBy(key, -delta)
+}
+
+// IncrBy atomically adds delta to an int or int64 value, see RistrettoCache.IncrBy
+func (sc *ShardedCacheV2) IncrBy(key string, delta int64) (int64, error) {
+	value, err := sc.getShard(key).IncrBy(key, delta)
+	if err != nil {
+		sc.audit.Record(context.Background(), AuditIncr, key, nil, false)
+		return value, err
+	}
+	sc.audit.Record(context.Background(), AuditIncr, key, value, true)
+	return value, nil
+}
+
+// DecrBy atomically subtracts delta from an int or int64 value
+func (sc *ShardedCacheV2) DecrBy(key string, delta int64) (int64, error) {
+	return sc.IncrBy(key, -delta)
+}
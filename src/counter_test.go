@@ -0,0 +1,63 @@
+package src
+
+import (
+	"testing"
+	"time"
+)
+
+// An increment is an access: it moves the counter like a read would
+func TestIncrTouchesItem(t *testing.T) {
+	t.Run("window", func(t *testing.T) {
+		c := NewLRUCache(100)
+		c.enableWindow(1)
+		c.Add("n", int64(1), 1, 0)
+		c.promote("n")
+		if _, _, err := c.incr("n", 1); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := c.GetItem("n"); !item.protected {
+			t.Fatal("incremented probation counter did not move to the protected list")
+		}
+		checkMainIndex(t, c)
+	})
+	t.Run("arc", func(t *testing.T) {
+		c := NewLRUCache(100)
+		c.enableARC()
+		c.Add("n", int64(1), 1, 0)
+		if _, _, err := c.incr("n", 1); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := c.GetItem("n"); item.inRecent {
+			t.Fatal("incremented counter stayed in the ARC recent list")
+		}
+		checkMainIndex(t, c)
+	})
+}
+
+// An expired counter leaves like any expired entry before it restarts
+func TestIncrExpiredCounterFiresOnEvict(t *testing.T) {
+	var evicted []string
+	c, err := NewRistrettoCache(&Config{
+		NumCounters: 1e4, MaxCost: 100, BufferItems: 64,
+		OnEvict: func(key string, value any, cost int64) { evicted = append(evicted, key) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetWithTTL("n", int64(5), 1, time.Millisecond)
+	c.Wait()
+	time.Sleep(5 * time.Millisecond)
+
+	v, err := c.IncrBy("n", 1)
+	if err != nil || v != 1 {
+		t.Fatalf("IncrBy on expired counter = %d, %v, want 1", v, err)
+	}
+	if len(evicted) != 1 || evicted[0] != "n" {
+		t.Fatalf("OnEvict calls = %v, want [n]", evicted)
+	}
+	if got := c.Metrics().KeysEvicted(); got != 1 {
+		t.Fatalf("KeysEvicted = %d, want 1", got)
+	}
+}
@@ -0,0 +1,160 @@
+package src
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDegradeCooldown is how long the load must stay low before a
+// degraded cache restores its full bookkeeping
+const DefaultDegradeCooldown = 5 * time.Second
+
+const (
+	// degradeHigh is the set buffer fill that enters degraded mode with AutoDegrade
+	degradeHigh = 0.8
+	// degradeLow is the set buffer fill below which the load counts as subsided
+	degradeLow = 0.2
+	// degradeCheckInterval spaces the load checks made on the set path
+	degradeCheckInterval = 50 * time.Millisecond
+)
+
+// degrader switches a cache into degraded mode, where it skips frequency
+// counting, sampled admission, hit/miss metrics and prefetch learning to
+// shed CPU while Get and Set keep working. Degraded mode is entered by an
+// operator, or by AutoDegrade when the set buffer fills up, and left once
+// the buffer has stayed nearly empty for the cooldown. A ShardedCacheV2
+// shares one degrader between its shards
+type degrader struct {
+	auto     bool
+	cooldown time.Duration
+	load     func() float64 // fill of the fullest set buffer, 0 to 1
+
+	on        atomic.Bool
+	calmSince atomic.Int64 // when the load dropped below degradeLow, 0 while high
+	lastCheck atomic.Int64
+	entered   atomic.Int64
+}
+
+func newDegrader(config *Config, load func() float64) *degrader {
+	d := &degrader{auto: config.AutoDegrade, cooldown: config.DegradeCooldown, load: load}
+	if d.cooldown <= 0 {
+		d.cooldown = DefaultDegradeCooldown
+	}
+	return d
+}
+
+// degraded reports whether the cache is in degraded mode
+func (d *degrader) degraded() bool {
+	return d.on.Load()
+}
+
+// enter switches to degraded mode
+func (d *degrader) enter() {
+	if !d.on.Swap(true) {
+		d.calmSince.Store(0)
+		d.entered.Add(1)
+	}
+}
+
+// exit restores full bookkeeping
+func (d *degrader) exit() {
+	d.on.Store(false)
+}
+
+// check samples the load at most every degradeCheckInterval, entering
+// degraded mode under overload with AutoDegrade and leaving it once the
+// load has stayed low for the cooldown. It runs on the set path, so a
+// cache without writes keeps its mode
+func (d *degrader) check() {
+	if !d.auto && !d.on.Load() {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := d.lastCheck.Load()
+	if now-last < int64(degradeCheckInterval) || !d.lastCheck.CompareAndSwap(last, now) {
+		return
+	}
+
+	fill := d.load()
+	switch {
+	case fill >= degradeHigh:
+		d.calmSince.Store(0)
+		if d.auto {
+			d.enter()
+		}
+	case fill <= degradeLow && d.on.Load():
+		calm := d.calmSince.Load()
+		if calm == 0 {
+			d.calmSince.Store(now)
+		} else if now-calm >= int64(d.cooldown) {
+			d.exit()
+		}
+	case fill > degradeLow:
+		d.calmSince.Store(0)
+	}
+}
+
+// bufferFill returns how full the set buffer is, 0 to 1
+func (c *RistrettoCache) bufferFill() float64 {
+	return float64(len(c.setBuf)) / float64(cap(c.setBuf))
+}
+
+// degraded reports whether the cache skips its optional bookkeeping
+func (c *RistrettoCache) degraded() bool {
+	return c.degrade.degraded()
+}
+
+// Degrade switches the cache into degraded mode: frequency counting,
+// sampled admission (eviction falls back to LRU), hit/miss metrics and
+// prefetch learning are skipped, while Get and Set keep working. The cache
+// returns to normal on its own once the set buffer has stayed nearly empty
+// for Config.DegradeCooldown, or at once with Restore
+func (c *RistrettoCache) Degrade() {
+	c.degrade.enter()
+}
+
+// Restore leaves degraded mode
+func (c *RistrettoCache) Restore() {
+	c.degrade.exit()
+}
+
+// Degraded reports whether the cache is in degraded mode
+func (c *RistrettoCache) Degraded() bool {
+	return c.degrade.degraded()
+}
+
+// Degradations returns how often the cache entered degraded mode
+func (c *RistrettoCache) Degradations() int64 {
+	return c.degrade.entered.Load()
+}
+
+// shardFill returns the fill of the fullest shard's set buffer
+func (sc *ShardedCacheV2) shardFill() float64 {
+	var fullest float64
+	for _, shard := range sc.shards {
+		if fill := shard.bufferFill(); fill > fullest {
+			fullest = fill
+		}
+	}
+	return fullest
+}
+
+// Degrade switches all shards into degraded mode
+func (sc *ShardedCacheV2) Degrade() {
+	sc.degrade.enter()
+}
+
+// Restore leaves degraded mode on all shards
+func (sc *ShardedCacheV2) Restore() {
+	sc.degrade.exit()
+}
+
+// Degraded reports whether the cache is in degraded mode
+func (sc *ShardedCacheV2) Degraded() bool {
+	return sc.degrade.degraded()
+}
+
+// Degradations returns how often the cache entered degraded mode
+func (sc *ShardedCacheV2) Degradations() int64 {
+	return sc.degrade.entered.Load()
+}
@@ -0,0 +1,97 @@
+package src
+
+import "errors"
+
+// ErrSetDropped is returned by a read-modify-write whose queued set was
+// dropped from a full set buffer by DropOldest
+var ErrSetDropped = errors.New("set dropped: set buffer full")
+
+// DropAction is what a set does when the set buffer is full
+type DropAction int
+
+const (
+	// DropNew drops the new set (the default)
+	DropNew DropAction = iota
+	// DropOldest drops the oldest queued set to make room for the new one
+	DropOldest
+	// Block waits until the buffer has room
+	Block
+)
+
+// PendingSet describes a set that found the set buffer full
+type PendingSet struct {
+	Key      string
+	Value    any
+	Cost     int64
+	Internal bool // written by the cache itself: a load, refresh or replicated write
+}
+
+// DropPolicy decides what a set does when the set buffer is full. It runs on
+// the writing goroutine and should be fast
+type DropPolicy func(set PendingSet) DropAction
+
+// overflow handles a set that found the buffer full according to
+// Config.DropPolicy and reports whether it was queued
+func (c *RistrettoCache) overflow(item *setItem) bool {
+	action := DropNew
+	if c.config.DropPolicy != nil {
+		action = c.config.DropPolicy(PendingSet{Key: item.key, Value: item.value, Cost: item.cost, Internal: item.internal})
+	}
+
+	switch action {
+	case Block:
+		select {
+		case c.setBuf <- item:
+			return true
+		case <-c.stopCh:
+			return false
+		}
+	case DropOldest:
+		if c.dropOldest(item) {
+			return true
+		}
+	}
+	c.metrics.setsDropped.Add(1)
+	return false
+}
+
+// dropOldest drops queued sets until item fits. Sets whose caller waits
+// for them (setSync and read-modify-writes like Append) are queued again
+// behind the others, which is safe because they were concurrent with every
+// set queued after them. Requeuing never blocks, since the caller may be the
+// write goroutine itself: if other writers took the slot, the waited set is
+// dropped and its caller told so. It gives up after a full buffer of
+// attempts, e.g. when only waited sets are queued
+func (c *RistrettoCache) dropOldest(item *setItem) bool {
+	for attempts := cap(c.setBuf); attempts > 0; attempts-- {
+		select {
+		case old := <-c.setBuf:
+			if old.waited {
+				select {
+				case c.setBuf <- old:
+				default:
+					c.releaseDropped(old)
+				}
+			} else {
+				c.releaseDropped(old)
+			}
+		default:
+		}
+
+		select {
+		case c.setBuf <- item:
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// releaseDropped counts a queued set as dropped and runs its completion
+func (c *RistrettoCache) releaseDropped(item *setItem) {
+	c.metrics.setsDropped.Add(1)
+	item.dropped = true
+	if item.done != nil {
+		item.done()
+	}
+}
@@ -0,0 +1,239 @@
+package src
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrStaleSchema is returned by GetVersioned for a value written with
+	// another schema version that the schema cannot upgrade
+	ErrStaleSchema = errors.New("value has a stale schema version")
+	// ErrUnknownCodec is returned for an envelope whose codec is not registered
+	ErrUnknownCodec = errors.New("unknown codec")
+	// ErrBadEnvelope is returned when decoding a malformed envelope
+	ErrBadEnvelope = errors.New("malformed value envelope")
+)
+
+// envelopeMagic starts the binary form of an Envelope
+const envelopeMagic = 0xFC
+
+// Codec ids of the built-in codecs
+const (
+	CodecGob     = "gob"
+	CodecJSON    = "json"
+	CodecMsgpack = "msgpack"
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		CodecGob:     GobCodec{},
+		CodecJSON:    JSONCodec{},
+		CodecMsgpack: MsgpackCodec{},
+	}
+)
+
+func init() {
+	// Envelopes are stored as cache values and must survive snapshots
+	gob.Register(Envelope{})
+}
+
+// RegisterCodec makes codec available to envelopes under id, replacing a
+// codec registered before
+func RegisterCodec(id string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[id] = codec
+}
+
+// codecByID returns the codec registered under id
+func codecByID(id string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if codec, ok := codecs[id]; ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownCodec, id)
+}
+
+// Envelope is an encoded value tagged with the schema version it was
+// written with and the id of the codec that encoded it, so a reader can
+// tell a stale format apart from the current one after a deploy
+type Envelope struct {
+	Version uint32
+	Codec   string
+	Data    []byte
+}
+
+// Decode decodes the data with the envelope's codec into the value out points to
+func (e Envelope) Decode(out any) error {
+	codec, err := codecByID(e.Codec)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(e.Data, out)
+}
+
+// MarshalBinary encodes the envelope as a magic byte, the version and the
+// codec id as uvarints and the data, so it can be stored where only bytes
+// are, e.g. on a CacheServer
+func (e Envelope) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen32+len(e.Codec)+len(e.Data))
+	buf = append(buf, envelopeMagic)
+	buf = binary.AppendUvarint(buf, uint64(e.Version))
+	buf = binary.AppendUvarint(buf, uint64(len(e.Codec)))
+	buf = append(buf, e.Codec...)
+	return append(buf, e.Data...), nil
+}
+
+// UnmarshalBinary decodes an envelope written by MarshalBinary
+func (e *Envelope) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != envelopeMagic {
+		return ErrBadEnvelope
+	}
+	data = data[1:]
+	version, n := binary.Uvarint(data)
+	if n <= 0 || version > 1<<32-1 {
+		return ErrBadEnvelope
+	}
+	data = data[n:]
+	codecLen, n := binary.Uvarint(data)
+	if n <= 0 || codecLen > uint64(len(data)-n) {
+		return ErrBadEnvelope
+	}
+	data = data[n:]
+	e.Version = uint32(version)
+	e.Codec = string(data[:codecLen])
+	e.Data = append([]byte(nil), data[codecLen:]...)
+	return nil
+}
+
+// Schema describes the current format of a family of values
+type Schema struct {
+	// Version is written into every envelope the schema seals
+	Version uint32
+	// Codec is the id of the registered codec that encodes values (default CodecGob)
+	Codec string
+	// Upgrade decodes an envelope of another version into the value out
+	// points to. Nil makes such values fail with ErrStaleSchema
+	Upgrade func(old Envelope, out any) error
+}
+
+// codec returns the codec id of the schema
+func (s Schema) codec() string {
+	if s.Codec == "" {
+		return CodecGob
+	}
+	return s.Codec
+}
+
+// Seal encodes value in an envelope of the current version
+func (s Schema) Seal(value any) (Envelope, error) {
+	codec, err := codecByID(s.codec())
+	if err != nil {
+		return Envelope{}, err
+	}
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Version: s.Version, Codec: s.codec(), Data: data}, nil
+}
+
+// Open decodes a stored value into the value out points to. Envelopes of
+// the current version are decoded directly, others through Upgrade, in
+// which case upgraded is true. Bytes written without an envelope, e.g. by
+// SetEncoded, count as version 0 in the schema's codec. Any other value
+// returns ErrStaleSchema
+func (s Schema) Open(value any, out any) (upgraded bool, err error) {
+	env, ok := envelopeOf(value, s.codec())
+	if !ok {
+		return false, ErrStaleSchema
+	}
+	if env.Version == s.Version && env.Codec == s.codec() {
+		return false, env.Decode(out)
+	}
+	if s.Upgrade == nil {
+		return false, fmt.Errorf("%w: version %d, codec %q", ErrStaleSchema, env.Version, env.Codec)
+	}
+	if err := s.Upgrade(env, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// envelopeOf returns the envelope of a stored value
+func envelopeOf(value any, codec string) (Envelope, bool) {
+	switch v := value.(type) {
+	case Envelope:
+		return v, true
+	case *Envelope:
+		if v == nil {
+			return Envelope{}, false
+		}
+		return *v, true
+	case []byte:
+		var env Envelope
+		if env.UnmarshalBinary(v) == nil {
+			return env, true
+		}
+		return Envelope{Codec: codec, Data: v}, true
+	case string:
+		return envelopeOf([]byte(v), codec)
+	}
+	return Envelope{}, false
+}
+
+// SetVersioned seals value with schema and stores the envelope, with the
+// length of the encoded data as cost. ttl <= 0 means no expiration
+func (c *RistrettoCache) SetVersioned(key string, value any, schema Schema, ttl time.Duration) (bool, error) {
+	env, err := schema.Seal(value)
+	if err != nil {
+		return false, err
+	}
+	if ttl > 0 {
+		return c.SetWithTTL(key, env, int64(len(env.Data)), ttl), nil
+	}
+	return c.Set(key, env, int64(len(env.Data))), nil
+}
+
+// GetVersioned decodes the value stored under key with schema into the
+// value out points to. A value of an older version is upgraded and written
+// back in the current version, keeping its expiration, unless the key was
+// written meanwhile. A value the schema cannot read returns found with
+// ErrStaleSchema, and callers usually reload it
+func (c *RistrettoCache) GetVersioned(key string, schema Schema, out any) (bool, error) {
+	// The stamp detects writes between the read and the write-back
+	before, _ := c.cache.snapshotItem(key)
+	value, found := c.Get(key)
+	if !found {
+		return false, nil
+	}
+	upgraded, err := schema.Open(value, out)
+	if err != nil || !upgraded {
+		return true, err
+	}
+	if env, err := schema.Seal(out); err == nil {
+		cost := int64(len(env.Data))
+		if c.replaceIfSync(key, before.stamp, env, cost) {
+			c.metrics.costAdded.Add(cost)
+		}
+	}
+	return true, nil
+}
+
+// SetVersioned seals value with schema and stores the envelope
+func (sc *ShardedCacheV2) SetVersioned(key string, value any, schema Schema, ttl time.Duration) (bool, error) {
+	return sc.getShard(key).SetVersioned(key, value, schema, ttl)
+}
+
+// GetVersioned decodes the value stored under key with schema into out,
+// upgrading stale versions, see RistrettoCache.GetVersioned
+func (sc *ShardedCacheV2) GetVersioned(key string, schema Schema, out any) (bool, error) {
+	return sc.getShard(key).GetVersioned(key, schema, out)
+}
@@ -0,0 +1,180 @@
+package src
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ExpiringMap is a small map whose entries expire after a TTL, bounded to a
+// maximum number of entries by evicting the least recently used. Unlike
+// RistrettoCache it starts no goroutines and has no admission or costs:
+// expired entries are dropped when they are read or when a write sweeps
+// them. It is safe for concurrent use
+type ExpiringMap[K comparable, V any] struct {
+	mu         sync.Mutex
+	items      map[K]*list.Element
+	order      *list.List // of *expiringEntry, most recently used first
+	maxEntries int
+	ttl        time.Duration
+
+	// nextExpiry is the earliest expiration of any entry (0 if none), so
+	// writes only sweep when something has expired
+	nextExpiry int64
+}
+
+// expiringEntry is an entry of an ExpiringMap
+type expiringEntry[K comparable, V any] struct {
+	key        K
+	value      V
+	expiration int64 // Unix nanoseconds, 0 means no expiration
+}
+
+// NewExpiringMap creates a map holding at most maxEntries entries (0 means
+// unbounded) that expire after ttl (0 means no expiration)
+func NewExpiringMap[K comparable, V any](maxEntries int, ttl time.Duration) *ExpiringMap[K, V] {
+	return &ExpiringMap[K, V]{
+		items:      make(map[K]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+		ttl:        ttl,
+	}
+}
+
+// Set stores value under key with the default TTL
+func (m *ExpiringMap[K, V]) Set(key K, value V) {
+	m.SetWithTTL(key, value, m.ttl)
+}
+
+// SetWithTTL stores value under key, expiring after ttl (0 means no
+// expiration). If the map is full, expired entries are dropped first, then
+// the least recently used
+func (m *ExpiringMap[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	now := time.Now().UnixNano()
+	var expiration int64
+	if ttl > 0 {
+		expiration = now + int64(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.items[key]; ok {
+		entry := elem.Value.(*expiringEntry[K, V])
+		entry.value, entry.expiration = value, expiration
+		m.order.MoveToFront(elem)
+	} else {
+		if m.maxEntries > 0 && len(m.items) >= m.maxEntries {
+			m.sweep(now)
+			for len(m.items) >= m.maxEntries {
+				m.remove(m.order.Back())
+			}
+		}
+		m.items[key] = m.order.PushFront(&expiringEntry[K, V]{key: key, value: value, expiration: expiration})
+	}
+	if expiration > 0 && (m.nextExpiry == 0 || expiration < m.nextExpiry) {
+		m.nextExpiry = expiration
+	}
+}
+
+// Get returns the value stored under key and marks it recently used
+func (m *ExpiringMap[K, V]) Get(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	entry := elem.Value.(*expiringEntry[K, V])
+	if entry.expired(time.Now().UnixNano()) {
+		m.remove(elem)
+		var zero V
+		return zero, false
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Has reports whether a live value is stored under key, without marking it
+// recently used
+func (m *ExpiringMap[K, V]) Has(key K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[key]
+	return ok && !elem.Value.(*expiringEntry[K, V]).expired(time.Now().UnixNano())
+}
+
+// Delete removes key and reports whether it held a live value
+func (m *ExpiringMap[K, V]) Delete(key K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[key]
+	if !ok {
+		return false
+	}
+	m.remove(elem)
+	return !elem.Value.(*expiringEntry[K, V]).expired(time.Now().UnixNano())
+}
+
+// Len returns the number of live entries
+func (m *ExpiringMap[K, V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(time.Now().UnixNano())
+	return len(m.items)
+}
+
+// Range calls fn for every live entry, most recently used first, until fn
+// returns false. fn must not call methods of the map
+func (m *ExpiringMap[K, V]) Range(fn func(key K, value V) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UnixNano()
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*expiringEntry[K, V])
+		if !entry.expired(now) && !fn(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// Clear removes all entries
+func (m *ExpiringMap[K, V]) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = make(map[K]*list.Element)
+	m.order.Init()
+	m.nextExpiry = 0
+}
+
+// sweep drops the expired entries if any entry has expired (caller must
+// hold lock)
+func (m *ExpiringMap[K, V]) sweep(now int64) {
+	if m.nextExpiry == 0 || now <= m.nextExpiry {
+		return
+	}
+	m.nextExpiry = 0
+	for elem := m.order.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*expiringEntry[K, V])
+		switch {
+		case entry.expired(now):
+			m.remove(elem)
+		case entry.expiration > 0 && (m.nextExpiry == 0 || entry.expiration < m.nextExpiry):
+			m.nextExpiry = entry.expiration
+		}
+		elem = next
+	}
+}
+
+// remove deletes the entry of elem (caller must hold lock)
+func (m *ExpiringMap[K, V]) remove(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.items, elem.Value.(*expiringEntry[K, V]).key)
+}
+
+func (e *expiringEntry[K, V]) expired(now int64) bool {
+	return e.expiration > 0 && now > e.expiration
+}
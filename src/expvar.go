@@ -0,0 +1,50 @@
+package src
+
+import (
+	"expvar"
+	"fmt"
+)
+
+// metricsMap returns the metrics as a map for expvar
+func (m *Metrics) metricsMap() map[string]any {
+	return map[string]any{
+		"hits":          m.Hits(),
+		"misses":        m.Misses(),
+		"hitRatio":      m.Ratio(),
+		"keysAdded":     m.KeysAdded(),
+		"keysEvicted":   m.KeysEvicted(),
+		"setsDropped":   m.SetsDropped(),
+		"setsRejected":  m.SetsRejected(),
+		"setsThrottled": m.SetsThrottled(),
+		"costAdded":     m.CostAdded(),
+		"costEvicted":   m.CostEvicted(),
+		"loads":         m.Loads(),
+		"loadsShared":   m.LoadsShared(),
+	}
+}
+
+// publishExpvar registers a live stats variable under name
+func publishExpvar(name string, metrics func() *Metrics, memStats func() map[string]interface{}) error {
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %q already published", name)
+	}
+	expvar.Publish(name, expvar.Func(func() any {
+		return map[string]any{
+			"metrics": metrics().metricsMap(),
+			"memory":  memStats(),
+		}
+	}))
+	return nil
+}
+
+// PublishExpvar publishes live Metrics and GetMemStats under name, so they
+// appear at /debug/vars. Names can be published once per process
+func (c *RistrettoCache) PublishExpvar(name string) error {
+	return publishExpvar(name, c.Metrics, c.GetMemStats)
+}
+
+// PublishExpvar publishes live aggregated Metrics and GetMemStats under name,
+// so they appear at /debug/vars. Names can be published once per process
+func (sc *ShardedCacheV2) PublishExpvar(name string) error {
+	return publishExpvar(name, sc.Metrics, sc.GetMemStats)
+}
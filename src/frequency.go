@@ -8,16 +8,19 @@ import (
 
 // Frequency frequency statistics for TinyLFU with sampling
 type Frequency struct {
+	// total hits in window, first so it is 64-bit aligned on 32-bit platforms
+	totalHits int64
+
 	mu       sync.RWMutex
 	counters map[string]*counter
 	// sliding window size
 	windowSize int64
 	// max counters
 	maxCounters int64
-	// total hits in window
-	totalHits int64
 	// decay counter
 	decayCounter int64
+	// onDecay is called after every decay, under the lock
+	onDecay func()
 }
 
 // counter stores frequency count with metadata
@@ -104,6 +107,9 @@ func (f *Frequency) decay() {
 	for _, c := range f.counters {
 		c.count = (c.count + 1) / 2
 	}
+	if f.onDecay != nil {
+		f.onDecay()
+	}
 }
 
 // Reset resets the frequency counts
@@ -116,6 +122,24 @@ func (f *Frequency) Reset() {
 	f.decayCounter = 0
 }
 
+// restore raises the count of key to at least count, e.g. from persisted
+// hot keys
+func (f *Frequency) restore(key string, count int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c, exists := f.counters[key]; exists {
+		if c.count < count {
+			c.count = count
+		}
+		return
+	}
+	if int64(len(f.counters)) >= f.maxCounters {
+		f.evictOne()
+	}
+	f.counters[key] = &counter{count: count}
+}
+
 // SampledLFU compares frequencies and returns true if new key should be admitted
 // newKeyFreq: frequency of new key
 // sampleSize: number of items to sample
@@ -0,0 +1,93 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrNotFound is returned by GetAs for a missing key
+	ErrNotFound = errors.New("key not found")
+	// ErrTypeMismatch is wrapped by the TypeError of GetAs
+	ErrTypeMismatch = errors.New("stored value has another type")
+)
+
+// TypeError reports a stored value GetAs cannot put into its destination
+type TypeError struct {
+	Key  string
+	Want reflect.Type // type dst points to
+	Got  reflect.Type // type of the stored value
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("key %q holds %v, want %v", e.Key, e.Got, e.Want)
+}
+
+// Unwrap returns ErrTypeMismatch
+func (e *TypeError) Unwrap() error {
+	return ErrTypeMismatch
+}
+
+// valueCodec returns the codec id GetAs decodes plain bytes with
+func valueCodec(config *Config) string {
+	if config.ValueCodec == "" {
+		return CodecGob
+	}
+	return config.ValueCodec
+}
+
+// getAs stores value in the variable dst points to: values of that type,
+// or pointers to one, are assigned; envelopes are decoded with their codec
+// and other bytes with codec
+func getAs(key string, value any, dst any, codec string) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("dst must be a non-nil pointer, got %T", dst)
+	}
+	target = target.Elem()
+
+	if value != nil {
+		v := reflect.ValueOf(value)
+		if v.Type().AssignableTo(target.Type()) {
+			target.Set(v)
+			return nil
+		}
+		if v.Kind() == reflect.Pointer && !v.IsNil() && v.Elem().Type().AssignableTo(target.Type()) {
+			target.Set(v.Elem())
+			return nil
+		}
+	}
+
+	switch value.(type) {
+	case Envelope, *Envelope, []byte, string:
+		env, ok := envelopeOf(value, codec)
+		if !ok {
+			break
+		}
+		if err := env.Decode(dst); err != nil {
+			return fmt.Errorf("decode %q as %v: %w", key, target.Type(), err)
+		}
+		return nil
+	}
+	return &TypeError{Key: key, Want: target.Type(), Got: reflect.TypeOf(value)}
+}
+
+// GetAs reads key into the variable dst points to, replacing the brittle
+// value.(*T) assertion. A stored value of dst's type, or a pointer to one,
+// is assigned; an Envelope is decoded with its codec, and other bytes or
+// strings with the registered codec Config.ValueCodec. It returns
+// ErrNotFound for a missing key and a *TypeError naming both types when the
+// value cannot be stored in dst
+func (c *RistrettoCache) GetAs(key string, dst any) error {
+	value, found := c.Get(key)
+	if !found {
+		return ErrNotFound
+	}
+	return getAs(key, value, dst, valueCodec(c.config))
+}
+
+// GetAs reads key into the variable dst points to, see RistrettoCache.GetAs
+func (sc *ShardedCacheV2) GetAs(key string, dst any) error {
+	return sc.getShard(key).GetAs(key, dst)
+}
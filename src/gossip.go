@@ -0,0 +1,467 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Gossip defaults
+const (
+	DefaultGossipInterval = 200 * time.Millisecond
+	DefaultFailTimeout    = 5 * time.Second
+)
+
+// maxGossipPacket is the largest UDP payload sent
+const maxGossipPacket = 60 << 10
+
+// ErrMembershipClosed is returned by Publish after the membership is closed
+var ErrMembershipClosed = errors.New("membership closed")
+
+// Member is a node of a gossip cluster
+type Member struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`                // gossip (UDP) address
+	CacheAddr string `json:"cacheAddr,omitempty"` // CacheServer address, empty for clients
+	Heartbeat int64  `json:"hb"`                  // increases while the member is alive
+	Left      bool   `json:"left,omitempty"`      // the member left gracefully
+}
+
+// MembershipConfig configures a Membership
+type MembershipConfig struct {
+	// Name identifies the node in the cluster (random if empty)
+	Name string
+	// BindAddr is the UDP address to listen on, e.g. ":7946"
+	BindAddr string
+	// AdvertiseAddr is the address peers reach this node at (default the bound address)
+	AdvertiseAddr string
+	// CacheAddr is the address of this node's CacheServer; leave it empty on
+	// clients that only watch the cluster
+	CacheAddr string
+	// Seeds are gossip addresses of existing members to join through
+	Seeds []string
+	// GossipInterval is how often the node gossips with a random peer (default DefaultGossipInterval)
+	GossipInterval time.Duration
+	// FailTimeout removes a member whose heartbeat has not advanced this long (default DefaultFailTimeout)
+	FailTimeout time.Duration
+}
+
+// gossipMessage is the UDP payload exchanged by members
+type gossipMessage struct {
+	Kind    string        `json:"kind"` // "sync", "ack" or "inval"
+	From    string        `json:"from"`
+	Members []Member      `json:"members,omitempty"`
+	Inv     *Invalidation `json:"inv,omitempty"`
+}
+
+// memberState is the local view of a peer
+type memberState struct {
+	Member
+	updated time.Time // when Heartbeat last advanced
+	dead    bool      // tombstone kept so stale gossip does not revive the member
+}
+
+// Membership discovers the nodes of a cache cluster with a gossip protocol,
+// so clients and invalidation do not need static node lists. Every node
+// advances its heartbeat and periodically exchanges its member table with a
+// random peer (push-pull); members whose heartbeat stops advancing for
+// FailTimeout are removed. Heartbeats start at the wall clock, so a
+// restarted node outranks its old entry
+type Membership struct {
+	cfg  MembershipConfig
+	conn net.PacketConn
+	self Member
+
+	mu       sync.Mutex
+	members  map[string]*memberState
+	watchers map[int]func([]Member)
+	nextID   int
+
+	subMu       sync.RWMutex
+	subscribers map[int]func(Invalidation)
+
+	closed   atomic.Bool
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	restarts atomic.Int64
+}
+
+// NewMembership starts a gossip node and joins the cluster through cfg.Seeds
+func NewMembership(cfg MembershipConfig) (*Membership, error) {
+	if cfg.Name == "" {
+		cfg.Name = newInstanceID()
+	}
+	if cfg.GossipInterval <= 0 {
+		cfg.GossipInterval = DefaultGossipInterval
+	}
+	if cfg.FailTimeout <= 0 {
+		cfg.FailTimeout = DefaultFailTimeout
+	}
+	conn, err := net.ListenPacket("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	addr := cfg.AdvertiseAddr
+	if addr == "" {
+		addr = conn.LocalAddr().String()
+	}
+
+	m := &Membership{
+		cfg:         cfg,
+		conn:        conn,
+		self:        Member{Name: cfg.Name, Addr: addr, CacheAddr: cfg.CacheAddr, Heartbeat: time.Now().UnixNano()},
+		members:     make(map[string]*memberState),
+		watchers:    make(map[int]func([]Member)),
+		subscribers: make(map[int]func(Invalidation)),
+		stopCh:      make(chan struct{}),
+	}
+	goWorker(&m.wg, "gossipReceiver", &m.restarts, m.receive)
+	goWorker(&m.wg, "gossip", &m.restarts, m.run)
+	m.gossipToSeeds()
+	return m, nil
+}
+
+// Self returns this node
+func (m *Membership) Self() Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.self
+}
+
+// Members returns the live members, including this node, sorted by name
+func (m *Membership) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.liveLocked()
+}
+
+// CacheAddrs returns the CacheServer addresses of the live members
+func (m *Membership) CacheAddrs() []string {
+	var addrs []string
+	for _, member := range m.Members() {
+		if member.CacheAddr != "" {
+			addrs = append(addrs, member.CacheAddr)
+		}
+	}
+	return addrs
+}
+
+func (m *Membership) liveLocked() []Member {
+	live := []Member{m.self}
+	for _, st := range m.members {
+		if !st.dead {
+			live = append(live, st.Member)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].Name < live[j].Name })
+	return live
+}
+
+// Watch calls fn with the live members now and after every join or
+// removal, until the returned cancel is called. fn must not block
+func (m *Membership) Watch(fn func(members []Member)) (cancel func()) {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.watchers[id] = fn
+	live := m.liveLocked()
+	m.mu.Unlock()
+
+	fn(live)
+	return func() {
+		m.mu.Lock()
+		delete(m.watchers, id)
+		m.mu.Unlock()
+	}
+}
+
+// notifyLocked passes the live members to the watchers (caller must hold
+// lock, watchers run under it so they see changes in order)
+func (m *Membership) notifyLocked() {
+	if len(m.watchers) == 0 {
+		return
+	}
+	live := m.liveLocked()
+	for _, fn := range m.watchers {
+		fn(live)
+	}
+}
+
+// run advances the heartbeat, gossips with a random peer and expires
+// silent members until the membership is closed
+func (m *Membership) run() {
+	ticker := time.NewTicker(m.cfg.GossipInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.tick()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+func (m *Membership) tick() {
+	m.mu.Lock()
+	m.self.Heartbeat++
+	now := time.Now()
+	changed := false
+	var peers []string
+	for name, st := range m.members {
+		switch {
+		case st.dead && now.Sub(st.updated) > 3*m.cfg.FailTimeout:
+			delete(m.members, name)
+		case !st.dead && now.Sub(st.updated) > m.cfg.FailTimeout:
+			log.Printf("fastcache: gossip member %s (%s) failed", name, st.Addr)
+			st.dead, st.updated = true, now
+			changed = true
+		case !st.dead:
+			peers = append(peers, st.Addr)
+		}
+	}
+	if changed {
+		m.notifyLocked()
+	}
+	m.mu.Unlock()
+
+	if len(peers) == 0 {
+		// Alone: keep trying the seeds, e.g. after a partition
+		m.gossipToSeeds()
+		return
+	}
+	m.send(peers[rand.Intn(len(peers))], gossipMessage{Kind: "sync", Members: m.table()})
+}
+
+// table returns the member entries to gossip: live members and tombstones
+func (m *Membership) table() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table := make([]Member, 0, len(m.members)+1)
+	table = append(table, m.self)
+	for _, st := range m.members {
+		if !st.dead {
+			table = append(table, st.Member)
+		}
+	}
+	return table
+}
+
+func (m *Membership) gossipToSeeds() {
+	table := m.table()
+	for _, seed := range m.cfg.Seeds {
+		if seed != m.self.Addr {
+			m.send(seed, gossipMessage{Kind: "sync", Members: table})
+		}
+	}
+}
+
+// merge applies a peer's member table to the local one
+func (m *Membership) merge(table []Member) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	changed := false
+	for _, in := range table {
+		if in.Name == m.self.Name {
+			continue
+		}
+		st, ok := m.members[in.Name]
+		if ok && in.Heartbeat <= st.Heartbeat {
+			continue
+		}
+		switch {
+		case in.Left:
+			if ok && !st.dead {
+				log.Printf("fastcache: gossip member %s (%s) left", in.Name, in.Addr)
+				changed = true
+			}
+			m.members[in.Name] = &memberState{Member: in, updated: now, dead: true}
+		case !ok || st.dead:
+			m.members[in.Name] = &memberState{Member: in, updated: now}
+			changed = true
+		default:
+			st.Member, st.updated = in, now
+		}
+	}
+	if changed {
+		m.notifyLocked()
+	}
+}
+
+// receive handles incoming packets until the connection is closed
+func (m *Membership) receive() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, from, err := m.conn.ReadFrom(buf)
+		if err != nil {
+			if m.closed.Load() {
+				return
+			}
+			continue
+		}
+		var msg gossipMessage
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			continue
+		}
+		switch msg.Kind {
+		case "sync":
+			m.merge(msg.Members)
+			m.sendTo(from, gossipMessage{Kind: "ack", Members: m.table()})
+		case "ack":
+			m.merge(msg.Members)
+		case "inval":
+			if msg.Inv != nil {
+				m.deliver(*msg.Inv)
+			}
+		}
+	}
+}
+
+func (m *Membership) send(addr string, msg gossipMessage) {
+	udp, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return
+	}
+	m.sendTo(udp, msg)
+}
+
+func (m *Membership) sendTo(addr net.Addr, msg gossipMessage) {
+	msg.From = m.cfg.Name
+	data, err := json.Marshal(msg)
+	if err != nil || len(data) > maxGossipPacket {
+		return
+	}
+	m.conn.WriteTo(data, addr)
+}
+
+// Leave announces that the node leaves, so peers remove it at once
+// instead of after FailTimeout, and closes the membership
+func (m *Membership) Leave() error {
+	m.mu.Lock()
+	m.self.Heartbeat++
+	m.self.Left = true
+	var peers []string
+	for _, st := range m.members {
+		if !st.dead {
+			peers = append(peers, st.Addr)
+		}
+	}
+	m.mu.Unlock()
+
+	msg := gossipMessage{Kind: "sync", Members: []Member{m.Self()}}
+	for _, addr := range peers {
+		m.send(addr, msg)
+	}
+	return m.Close()
+}
+
+// Close stops gossiping without announcing it; peers remove the node after FailTimeout
+func (m *Membership) Close() error {
+	if m.closed.Swap(true) {
+		return nil
+	}
+	close(m.stopCh)
+	err := m.conn.Close()
+	m.wg.Wait()
+	return err
+}
+
+// Invalidator returns an Invalidator that sends invalidations straight to
+// the live members over UDP, so a fleet needs no separate bus. Delivery is
+// best effort: a lost packet leaves a stale entry until it expires, so use
+// a TTL or a broker-backed Invalidator where that matters
+func (m *Membership) Invalidator() Invalidator {
+	return membershipInvalidator{m}
+}
+
+type membershipInvalidator struct {
+	m *Membership
+}
+
+// Publish sends inv to every live member, split into packets that fit a
+// UDP datagram, and delivers it to the local subscribers
+func (b membershipInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	m := b.m
+	if m.closed.Load() {
+		return ErrMembershipClosed
+	}
+	m.deliver(inv)
+
+	var peers []string
+	for _, member := range m.Members() {
+		if member.Name != m.cfg.Name {
+			peers = append(peers, member.Addr)
+		}
+	}
+	for _, part := range splitInvalidation(inv) {
+		part := part
+		msg := gossipMessage{Kind: "inval", Inv: &part}
+		for _, addr := range peers {
+			m.send(addr, msg)
+		}
+	}
+	return nil
+}
+
+// Subscribe registers handler for invalidations published by any member
+func (b membershipInvalidator) Subscribe(handler func(Invalidation)) (func(), error) {
+	m := b.m
+	m.subMu.Lock()
+	id := m.nextSubscriber()
+	m.subscribers[id] = handler
+	m.subMu.Unlock()
+	return func() {
+		m.subMu.Lock()
+		delete(m.subscribers, id)
+		m.subMu.Unlock()
+	}, nil
+}
+
+func (m *Membership) nextSubscriber() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.nextID
+	m.nextID++
+	return id
+}
+
+// deliver passes inv to the local subscribers
+func (m *Membership) deliver(inv Invalidation) {
+	m.subMu.RLock()
+	defer m.subMu.RUnlock()
+	for _, handler := range m.subscribers {
+		handler(inv)
+	}
+}
+
+// splitInvalidation splits the keys of inv into parts small enough for one
+// packet each
+func splitInvalidation(inv Invalidation) []Invalidation {
+	const budget = maxGossipPacket - 1024 // room for the envelope
+	var parts []Invalidation
+	cur := Invalidation{Origin: inv.Origin, Clear: inv.Clear}
+	size := 0
+	for _, key := range inv.Keys {
+		// Quoting can double a key's size in the worst case
+		n := 2*len(key) + 3
+		if size+n > budget && len(cur.Keys) > 0 {
+			parts = append(parts, cur)
+			cur = Invalidation{Origin: inv.Origin}
+			size = 0
+		}
+		if n > budget {
+			continue // a key this long cannot be sent; it expires on its own
+		}
+		cur.Keys = append(cur.Keys, key)
+		size += n
+	}
+	return append(parts, cur)
+}
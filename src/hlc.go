@@ -0,0 +1,102 @@
+package src
+
+import (
+	"sync"
+	"time"
+)
+
+// Timestamp is a hybrid logical clock reading: physical wall time in
+// nanoseconds plus a logical counter that orders events within the same
+// wall time
+type Timestamp struct {
+	Wall    int64
+	Logical uint32
+}
+
+// Before reports whether t happened before u
+func (t Timestamp) Before(u Timestamp) bool {
+	return t.Wall < u.Wall || (t.Wall == u.Wall && t.Logical < u.Logical)
+}
+
+// IsZero reports whether t is unset
+func (t Timestamp) IsZero() bool {
+	return t.Wall == 0 && t.Logical == 0
+}
+
+// ClockSkewStats reports the clock skew observed from remote timestamps.
+// Skew is remote wall time minus local wall time, so it includes transfer latency
+type ClockSkewStats struct {
+	Observations int64
+	Last         time.Duration
+	Max          time.Duration // largest absolute skew
+}
+
+// HybridClock is a hybrid logical clock. It never goes backwards and moves
+// past every remote timestamp it observes, so events stay ordered across
+// processes whose wall clocks disagree
+type HybridClock struct {
+	mu   sync.Mutex
+	last Timestamp
+	now  func() int64
+	skew ClockSkewStats
+}
+
+// NewHybridClock creates a clock based on the local wall clock
+func NewHybridClock() *HybridClock {
+	return &HybridClock{now: func() int64 { return time.Now().UnixNano() }}
+}
+
+// DefaultClock is the process clock used to stamp shard streams
+var DefaultClock = NewHybridClock()
+
+// Now returns a timestamp after every timestamp returned or observed so far
+func (c *HybridClock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := c.now()
+	if wall > c.last.Wall {
+		c.last = Timestamp{Wall: wall}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Observe merges a remote timestamp into the clock and records the skew
+func (c *HybridClock) Observe(remote Timestamp) {
+	if remote.IsZero() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := c.now()
+	skew := time.Duration(remote.Wall - wall)
+	c.skew.Observations++
+	c.skew.Last = skew
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > c.skew.Max {
+		c.skew.Max = skew
+	}
+
+	switch {
+	case wall > c.last.Wall && wall > remote.Wall:
+		c.last = Timestamp{Wall: wall}
+	case remote.Wall > c.last.Wall:
+		c.last = Timestamp{Wall: remote.Wall, Logical: remote.Logical + 1}
+	case remote.Wall == c.last.Wall && remote.Logical >= c.last.Logical:
+		c.last.Logical = remote.Logical + 1
+	default:
+		c.last.Logical++
+	}
+}
+
+// Skew returns the skew observed so far
+func (c *HybridClock) Skew() ClockSkewStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.skew
+}
@@ -3,8 +3,8 @@ package src
 import (
 	"math"
 	"math/rand"
+	"sort"
 	"sync"
-	"sync/atomic"
 )
 
 // HNSWConfig contains configuration parameters for the HNSW index.
@@ -13,8 +13,29 @@ type HNSWConfig struct {
 	EFConstruction int    // Size of the candidate list during index construction.
 	EFSearch       int    // Size of the candidate list during search.
 	LevelMult      float64 // Multiplier for determining node levels.
+
+	// Heuristic enables the diversity-preserving neighbor selection of the
+	// HNSW paper: a candidate is linked only if it is closer to the node than
+	// to every neighbor already selected, which avoids hub clusters. When
+	// false, the M closest candidates are kept.
+	Heuristic bool
+
+	// RepairEvery runs a connectivity repair (see HNSW.Repair) after every
+	// RepairEvery deletions. 0 disables automatic repair.
+	RepairEvery int
+
+	// MaxLevel caps node levels, and with them the adjacency lists per node
+	// (DefaultHNSWMaxLevel if 0).
+	MaxLevel int
+
+	// Seed seeds the random levels of new nodes, so tests and benchmarks can
+	// build the same graph shape from the same inserts. 0 picks a random seed.
+	Seed int64
 }
 
+// DefaultHNSWMaxLevel is the default cap on HNSW node levels.
+const DefaultHNSWMaxLevel = 32
+
 // DefaultHNSWConfig returns the default HNSW configuration.
 func DefaultHNSWConfig() HNSWConfig {
 	return HNSWConfig{
@@ -22,6 +43,7 @@ func DefaultHNSWConfig() HNSWConfig {
 		EFConstruction: 200,
 		EFSearch:       50,
 		LevelMult:      1 / math.Ln2,
+		MaxLevel:       DefaultHNSWMaxLevel,
 	}
 }
 
@@ -31,25 +53,28 @@ type HNSWNode struct {
 	Vector   Vector
 	Metadata map[string]any
 
-	// Neighbor nodes organized by level.
-	// neighbors[level] = map[string]*HNSWNode
-	neighbors []map[string]*HNSWNode
+	// Neighbor node IDs organized by level.
+	// neighbors[level] = dense IDs of the neighbors at that level
+	neighbors [][]uint32
 
 	// Flag indicating whether this node has been deleted.
 	deleted bool
+
+	// Precomputed L2 norm, 0 if not computed.
+	norm float32
+
+	// Dense internal ID: the node's index in HNSW.nodes, its entry in
+	// adjacency lists and its bit in visited sets.
+	seq uint32
 }
 
 // NewHNSWNode creates a new HNSW node with the specified level.
 func NewHNSWNode(id string, vector Vector, metadata map[string]any, level int) *HNSWNode {
-	neighbors := make([]map[string]*HNSWNode, level+1)
-	for i := 0; i <= level; i++ {
-		neighbors[i] = make(map[string]*HNSWNode)
-	}
 	return &HNSWNode{
-		ID:       id,
-		Vector:   vector,
-		Metadata: metadata,
-		neighbors: neighbors,
+		ID:        id,
+		Vector:    vector,
+		Metadata:  metadata,
+		neighbors: make([][]uint32, level+1),
 	}
 }
 
@@ -60,24 +85,45 @@ type HNSW struct {
 	metric   MetricType
 	distance DistanceFunc
 
-	// Node storage.
-	nodes map[string]*HNSWNode
+	// Node storage, indexed by dense node ID. Deleted nodes keep their slot
+	// so that IDs stay stable.
+	nodes []*HNSWNode
+
+	// ids maps string IDs to dense node IDs.
+	ids map[string]uint32
 
 	// Entry point (node at the highest level).
 	entryPoint *HNSWNode
 
+	// Standby entry points by level, promoted when the entry point is deleted.
+	entries [][]uint32
+
+	// deletesSinceRepair counts deletions toward HNSWConfig.RepairEvery.
+	deletesSinceRepair int
+
 	// Maximum level in the graph.
 	maxLevel int32
 
 	// Number of nodes in the index.
 	count int64
 
-	// Random number generator for level calculation.
-	rand *rand.Rand
+	// Random number generator for level calculation, guarded by randMu so
+	// that levels can be drawn outside the index lock.
+	rand   *rand.Rand
+	randMu sync.Mutex
 
-	// Memory tracking.
+	// Memory tracking. currentMem covers live nodes; deleted nodes keep only
+	// their ID and links, counted in tombstoneMem.
 	maxMemory int64
 	currentMem int64
+	tombstones int
+	tombstoneMem int64
+
+	// norms enables precomputed vector norms for per-query metric selection.
+	norms bool
+
+	// scratches pools search buffers across queries.
+	scratches sync.Pool
 }
 
 // nodeDist pairs a node with its distance to a query vector.
@@ -100,23 +146,77 @@ func NewHNSW(config HNSWConfig, metric MetricType) *HNSW {
 	if config.LevelMult <= 0 {
 		config.LevelMult = 1 / math.Ln2
 	}
+	if config.MaxLevel <= 0 {
+		config.MaxLevel = DefaultHNSWMaxLevel
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
 
 	return &HNSW{
 		config:    config,
 		metric:    metric,
 		distance:  GetDistanceFunc(metric),
-		nodes:     make(map[string]*HNSWNode),
+		ids:       make(map[string]uint32),
 		maxLevel:  -1,
-		rand:      rand.New(rand.NewSource(rand.Int63())),
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// NewHNSWFrom creates a new HNSW index with the specified configuration and
+// populates it from the live vectors of an existing index, without going
+// through the cache. The source index keeps serving searches while the new
+// graph is built, so this can be used to rebuild with new parameters online.
+func NewHNSWFrom(source *HNSW, config HNSWConfig) *HNSW {
+	h := NewHNSW(config, source.metric)
+	for _, item := range source.liveItems() {
+		h.Add(item.ID, item.Vector, item.Metadata)
 	}
+	return h
+}
+
+// liveItems returns the non-deleted vectors of the index.
+// Nodes on higher levels come first so that they seed the upper layers of a
+// rebuilt graph before the bulk of level-0 nodes is inserted.
+func (h *HNSW) liveItems() []*VectorItem {
+	h.mu.RLock()
+	nodes := make([]*HNSWNode, 0, len(h.nodes))
+	for _, node := range h.nodes {
+		if !node.deleted {
+			nodes = append(nodes, node)
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return len(nodes[i].neighbors) > len(nodes[j].neighbors)
+	})
+
+	items := make([]*VectorItem, len(nodes))
+	for i, node := range nodes {
+		items[i] = &VectorItem{
+			ID:       node.ID,
+			Vector:   node.Vector,
+			Metadata: node.Metadata,
+			Cost:     int64(len(node.Vector) * 4),
+		}
+	}
+	return items
 }
 
 // getLevel calculates a random level for a new node using exponential distribution.
 func (h *HNSW) getLevel() int {
 	// Exponential distribution: P(l) = exp(-l/levelMult)
 	// level = floor(-ln(random) * levelMult)
-	r := h.rand.Float64()
+	// 1 - Float64 is in (0, 1], so the logarithm is finite.
+	h.randMu.Lock()
+	r := 1 - h.rand.Float64()
+	h.randMu.Unlock()
 	level := int(-math.Log(r) * h.config.LevelMult)
+	if level > h.config.MaxLevel {
+		level = h.config.MaxLevel
+	}
 	return level
 }
 
@@ -125,32 +225,80 @@ func (h *HNSW) Add(id string, vector Vector, metadata map[string]any) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	// Check if the node already exists.
-	if _, exists := h.nodes[id]; exists {
-		// Update the existing node.
-		h.updateNode(id, vector, metadata)
-		return nil
+	scratch := h.getScratch()
+	defer h.putScratch(scratch)
+	return h.add(id, vector, metadata, h.getLevel(), scratch)
+}
+
+// AddBatch inserts vectors under a single lock acquisition. Levels are drawn
+// up front and higher-level nodes are inserted first, so they seed the upper
+// layers, and all layer searches share one set of scratch allocations.
+func (h *HNSW) AddBatch(items []VectorItem) error {
+	// Only the last occurrence of a repeated ID is inserted, as with Add.
+	last := make(map[string]int, len(items))
+	for i := range items {
+		last[items[i].ID] = i
+	}
+	levels := make([]int, len(items))
+	order := make([]int, 0, len(last))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range items {
+		if last[items[i].ID] == i {
+			levels[i] = h.getLevel()
+			order = append(order, i)
+		}
 	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return levels[order[a]] > levels[order[b]]
+	})
 
-	// Generate a random level for the new node.
-	level := h.getLevel()
-	if level > 32 {
-		level = 32 // Cap the maximum level.
+	scratch := h.getScratch()
+	defer h.putScratch(scratch)
+	for _, i := range order {
+		if err := h.add(items[i].ID, items[i].Vector, items[i].Metadata, levels[i], scratch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add inserts a vector at the given level (caller must hold the lock).
+func (h *HNSW) add(id string, vector Vector, metadata map[string]any, level int, scratch *layerScratch) error {
+	// Check if the node already exists.
+	if seq, exists := h.ids[id]; exists {
+		if !h.nodes[seq].deleted {
+			// Update the existing node.
+			h.updateNode(h.nodes[seq], vector, metadata)
+			return nil
+		}
+		// A deleted ID is inserted as a new node; the tombstone keeps its slot.
+		delete(h.ids, id)
 	}
 
 	// Create a new node.
 	node := NewHNSWNode(id, vector, metadata, level)
+	node.seq = uint32(len(h.nodes))
+	if h.norms {
+		node.norm = vectorNorm(vector)
+	}
 
 	// Update memory statistics.
 	nodeMem := int64(len(vector)*4 + len(id) + 64)
 	h.currentMem += nodeMem
 
+	// Register the node first: pruning resolves its dense ID.
+	h.nodes = append(h.nodes, node)
+	h.ids[id] = node.seq
+	h.count++
+	h.trackEntry(node)
+
 	// If this is the first node.
 	if h.entryPoint == nil {
 		h.entryPoint = node
 		h.maxLevel = int32(level)
-		h.nodes[id] = node
-		h.count++
 		return nil
 	}
 
@@ -159,7 +307,7 @@ func (h *HNSW) Add(id string, vector Vector, metadata map[string]any) error {
 
 	// Search from the highest level down to the new node's level.
 	for l := int(h.maxLevel); l > level; l-- {
-		res := h.searchLayer(ep, vector, 1, l)
+		res := h.searchLayer(scratch, ep, vector, 1, l)
 		if len(res) > 0 {
 			ep = res[0]
 		}
@@ -168,25 +316,26 @@ func (h *HNSW) Add(id string, vector Vector, metadata map[string]any) error {
 	// Insert the node at each level.
 	for l := min(int(level), int(h.maxLevel)); l >= 0; l-- {
 		// Search for nearest neighbors at this level.
-		candidates := h.searchLayer(ep, vector, h.config.EFConstruction, l)
+		candidates := h.searchLayer(scratch, ep, vector, h.config.EFConstruction, l)
 
-		// Connect to the nearest neighbors.
+		// Update the entry point.
+		if len(candidates) > 0 {
+			ep = candidates[0]
+		}
+
+		// Connect to the selected neighbors with bidirectional edges.
+		found := make([]nodeDist, 0, len(candidates))
 		for _, candidate := range candidates {
-			if candidate.ID == node.ID {
-				continue
+			if candidate != node {
+				found = append(found, nodeDist{node: candidate, dist: h.distance(vector, candidate.Vector)})
 			}
-			// Create bidirectional edges.
-			h.addEdge(node, candidate, l)
-			h.pruneNeighbors(node, l)
-
-			// Update reverse edges.
-			h.addEdge(candidate, node, l)
-			h.pruneNeighbors(candidate, l)
 		}
+		for _, neighbor := range h.selectNeighbors(found, h.config.M) {
+			h.addEdge(node, neighbor.node, l)
 
-		// Update the entry point.
-		if len(candidates) > 0 {
-			ep = candidates[0]
+			// Update reverse edges.
+			h.addEdge(neighbor.node, node, l)
+			h.pruneNeighbors(neighbor.node, l)
 		}
 	}
 
@@ -196,79 +345,84 @@ func (h *HNSW) Add(id string, vector Vector, metadata map[string]any) error {
 		h.maxLevel = int32(level)
 	}
 
-	h.nodes[id] = node
-	h.count++
-
 	return nil
 }
 
 // updateNode updates an existing node's vector and metadata.
-func (h *HNSW) updateNode(id string, vector Vector, metadata map[string]any) {
-	node := h.nodes[id]
+func (h *HNSW) updateNode(node *HNSWNode, vector Vector, metadata map[string]any) {
+	h.currentMem += int64(len(vector)-len(node.Vector)) * 4
 	node.Vector = vector
 	node.Metadata = metadata
+	if h.norms {
+		node.norm = vectorNorm(vector)
+	}
 }
 
-// searchLayer searches for nearest neighbors at a specific level.
-func (h *HNSW) searchLayer(entry *HNSWNode, query Vector, ef, level int) []*HNSWNode {
+// searchLayer searches for nearest neighbors at a specific level using the
+// buffers of scratch. The returned slice is owned by scratch and is valid
+// until its next search.
+func (h *HNSW) searchLayer(scratch *layerScratch, entry *HNSWNode, query Vector, ef, level int) []*HNSWNode {
 	if entry == nil {
 		return nil
 	}
+	scratch.reset()
 
 	// Set of visited nodes.
-	visited := make(map[string]bool)
-	visited[entry.ID] = true
+	visited := &scratch.visited
+	visited.visit(entry.seq)
 
+	entryDist := nodeDist{node: entry, dist: h.distance(entry.Vector, query)}
 	// Candidate priority queue (min-heap).
-	candidates := &nodeHeap{data: []nodeDist{{node: entry, dist: h.distance(entry.Vector, query)}}}
+	candidates := &scratch.candidates
+	candidates.push(entryDist)
 	// Results priority queue (max-heap for EF).
-	results := &nodeHeapDesc{data: []nodeDist{{node: entry, dist: h.distance(entry.Vector, query)}}}
+	results := &scratch.results
+	results.push(entryDist)
 
 	for candidates.Len() > 0 {
 		// Get the nearest candidate node.
-		c := candidates.Pop().(nodeDist)
-
-		// Get the farthest node in the results.
-		r := results.Top().(nodeDist)
+		c := candidates.pop()
 
 		// If the current node is farther than the farthest result, we can stop.
-		if c.dist > r.dist && results.Len() >= ef {
+		if c.dist > results.top().dist && results.Len() >= ef {
 			break
 		}
 
 		// Traverse neighbors of the current node.
-		for _, neighbor := range c.node.neighbors[level] {
+		for _, seq := range c.node.neighbors[level] {
+			neighbor := h.nodes[seq]
 			if neighbor.deleted {
 				continue
 			}
-			if visited[neighbor.ID] {
+			if !visited.visit(neighbor.seq) {
 				continue
 			}
-			visited[neighbor.ID] = true
 
 			dist := h.distance(neighbor.Vector, query)
 			neighborNode := nodeDist{node: neighbor, dist: dist}
 
-			// Add to candidate queue.
-			candidates.Push(neighborNode)
-
-			// Add to results queue.
+			// Add to results queue; only nodes that can improve the
+			// results are worth expanding.
 			if results.Len() < ef {
-				results.Push(neighborNode)
-			} else if dist < r.dist {
-				results.Pop()
-				results.Push(neighborNode)
+				results.push(neighborNode)
+				candidates.push(neighborNode)
+			} else if dist < results.top().dist {
+				results.pop()
+				results.push(neighborNode)
+				candidates.push(neighborNode)
 			}
 		}
 	}
 
-	// Extract results.
-	res := make([]*HNSWNode, results.Len())
-	for i := results.Len() - 1; i >= 0; i-- {
-		nd := results.Pop().(nodeDist)
-		res[i] = nd.node
+	// Extract results, nearest first.
+	res := scratch.out[:0]
+	for results.Len() > 0 {
+		res = append(res, results.pop().node)
 	}
-
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	scratch.out = res
 	return res
 }
 
@@ -277,7 +431,12 @@ func (h *HNSW) addEdge(from, to *HNSWNode, level int) {
 	if level >= len(from.neighbors) {
 		return
 	}
-	from.neighbors[level][to.ID] = to
+	for _, seq := range from.neighbors[level] {
+		if seq == to.seq {
+			return
+		}
+	}
+	from.neighbors[level] = append(from.neighbors[level], to.seq)
 }
 
 // pruneNeighbors removes distant neighbors to maintain the maximum connection limit M.
@@ -292,30 +451,65 @@ func (h *HNSW) pruneNeighbors(node *HNSWNode, level int) {
 	}
 
 	// Calculate distances to all neighbors.
-	type nd struct {
-		id   string
-		node *HNSWNode
-		dist float32
+	distList := make([]nodeDist, len(neighbors))
+	for i, seq := range neighbors {
+		n := h.nodes[seq]
+		distList[i] = nodeDist{node: n, dist: h.distance(node.Vector, n.Vector)}
 	}
 
-	distList := make([]nd, 0, len(neighbors))
-	for id, n := range neighbors {
-		distList = append(distList, nd{id: id, node: n, dist: h.distance(node.Vector, n.Vector)})
+	// Sort by distance.
+	sort.Slice(distList, func(i, j int) bool {
+		return distList[i].dist < distList[j].dist
+	})
+
+	// Keep M neighbors, reusing the adjacency list.
+	selected := h.selectNeighbors(distList, h.config.M)
+	neighbors = neighbors[:len(selected)]
+	for i, n := range selected {
+		neighbors[i] = n.node.seq
 	}
+	node.neighbors[level] = neighbors
+}
 
-	// Sort by distance.
-	for i := 0; i < len(distList)-1; i++ {
-		for j := i + 1; j < len(distList); j++ {
-			if distList[i].dist > distList[j].dist {
-				distList[i], distList[j] = distList[j], distList[i]
+// selectNeighbors picks up to m neighbors from candidates sorted by
+// ascending distance. With the heuristic enabled, a candidate that is closer
+// to an already selected neighbor than to the base node is skipped, so links
+// spread in different directions; skipped candidates then fill any remaining
+// slots, so well-connected nodes keep m links.
+func (h *HNSW) selectNeighbors(candidates []nodeDist, m int) []nodeDist {
+	if len(candidates) <= m {
+		return candidates
+	}
+	if !h.config.Heuristic {
+		return candidates[:m]
+	}
+
+	selected := make([]nodeDist, 0, m)
+	var skipped []nodeDist
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if h.distance(c.node.Vector, s.node.Vector) < c.dist {
+				diverse = false
+				break
 			}
 		}
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
 	}
-
-	// Keep only the closest M neighbors.
-	for i := h.config.M; i < len(distList); i++ {
-		delete(neighbors, distList[i].id)
+	for _, c := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
 	}
+	return selected
 }
 
 // Search finds the k nearest vectors to the query.
@@ -327,6 +521,9 @@ func (h *HNSW) Search(query Vector, k int) ([]SearchResult, error) {
 		return []SearchResult{}, nil
 	}
 
+	scratch := h.getScratch()
+	defer h.putScratch(scratch)
+
 	if k <= 0 {
 		k = 10
 	}
@@ -339,35 +536,40 @@ func (h *HNSW) Search(query Vector, k int) ([]SearchResult, error) {
 	// Search starting from the highest level.
 	ep := h.entryPoint
 	for l := int(h.maxLevel); l > 0; l-- {
-		results := h.searchLayer(ep, query, 1, l)
+		results := h.searchLayer(scratch, ep, query, 1, l)
 		if len(results) > 0 {
 			ep = results[0]
 		}
 	}
 
 	// Search at level 0.
-	results := h.searchLayer(ep, query, ef, 0)
+	results := h.searchLayer(scratch, ep, query, ef, 0)
 
 	// Convert to SearchResult.
-	topK := make([]SearchResult, 0, min(k, len(results)))
-	for i := 0; i < min(k, len(results)); i++ {
-		if results[i].deleted {
+	dists := scratch.distances(h.metric, query, results)
+	topK := make([]SearchResult, 0, len(results))
+	for i, node := range results {
+		if node.deleted {
 			continue
 		}
-		// Calculate distance.
-		dist := h.distance(query, results[i].Vector)
-		topK = append(topK, SearchResult{
-			ID:       results[i].ID,
-			Vector:   results[i].Vector,
-			Score:    dist,
-			Metadata: results[i].Metadata,
-		})
+		dist := dists[i]
 		// Correct score to positive value (inner product uses negative values).
 		if h.metric == MetricIP {
-			topK[len(topK)-1].Score = -topK[len(topK)-1].Score
+			dist = -dist
 		}
+		topK = append(topK, SearchResult{
+			ID:       node.ID,
+			Vector:   node.Vector,
+			Score:    dist,
+			Metadata: node.Metadata,
+		})
 	}
 
+	// Rank candidates by score, then ID, so ties are returned in a stable order.
+	sortResults(topK, h.metric)
+	if len(topK) > k {
+		topK = topK[:k]
+	}
 	return topK, nil
 }
 
@@ -380,6 +582,9 @@ func (h *HNSW) SearchWithFilter(query Vector, k int, filter FilterFunc) ([]Searc
 		return []SearchResult{}, nil
 	}
 
+	scratch := h.getScratch()
+	defer h.putScratch(scratch)
+
 	if k <= 0 {
 		k = 10
 	}
@@ -393,18 +598,19 @@ func (h *HNSW) SearchWithFilter(query Vector, k int, filter FilterFunc) ([]Searc
 	// Search starting from the highest level.
 	ep := h.entryPoint
 	for l := int(h.maxLevel); l > 0; l-- {
-		results := h.searchLayer(ep, query, 1, l)
+		results := h.searchLayer(scratch, ep, query, 1, l)
 		if len(results) > 0 {
 			ep = results[0]
 		}
 	}
 
 	// Search at level 0.
-	results := h.searchLayer(ep, query, ef, 0)
+	results := h.searchLayer(scratch, ep, query, ef, 0)
 
 	// Filter and convert results.
+	dists := scratch.distances(h.metric, query, results)
 	var filtered []SearchResult
-	for _, node := range results {
+	for i, node := range results {
 		if node.deleted {
 			continue
 		}
@@ -412,7 +618,7 @@ func (h *HNSW) SearchWithFilter(query Vector, k int, filter FilterFunc) ([]Searc
 		if filter != nil && !filter(node.Metadata) {
 			continue
 		}
-		dist := h.distance(query, node.Vector)
+		dist := dists[i]
 		result := SearchResult{
 			ID:       node.ID,
 			Vector:   node.Vector,
@@ -430,42 +636,85 @@ func (h *HNSW) SearchWithFilter(query Vector, k int, filter FilterFunc) ([]Searc
 	}
 
 	// Sort and take top K.
+	sortResults(filtered, h.metric)
 	if len(filtered) > k {
-		if h.metric == MetricIP {
-			// Inner product: higher is better.
-			for i := 0; i < len(filtered)-1; i++ {
-				for j := i + 1; j < len(filtered); j++ {
-					if filtered[i].Score < filtered[j].Score {
-						filtered[i], filtered[j] = filtered[j], filtered[i]
-					}
-				}
-			}
-		} else {
-			// Distance: lower is better.
-			for i := 0; i < len(filtered)-1; i++ {
-				for j := i + 1; j < len(filtered); j++ {
-					if filtered[i].Score > filtered[j].Score {
-						filtered[i], filtered[j] = filtered[j], filtered[i]
-					}
-				}
-			}
-		}
 		filtered = filtered[:k]
 	}
 
 	return filtered, nil
 }
 
+// searchWithMetric searches the graph with its native metric and re-ranks
+// an enlarged candidate set using the given metric. Precomputed norms make
+// switching between cosine and inner product a single dot product per candidate.
+func (h *HNSW) searchWithMetric(query Vector, k int, metric MetricType, filter FilterFunc) ([]SearchResult, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.entryPoint == nil {
+		return []SearchResult{}, nil
+	}
+
+	scratch := h.getScratch()
+	defer h.putScratch(scratch)
+
+	if k <= 0 {
+		k = 10
+	}
+
+	ef := k * DefaultBoostCandidates
+	if ef < h.config.EFSearch {
+		ef = h.config.EFSearch
+	}
+
+	ep := h.entryPoint
+	for l := int(h.maxLevel); l > 0; l-- {
+		results := h.searchLayer(scratch, ep, query, 1, l)
+		if len(results) > 0 {
+			ep = results[0]
+		}
+	}
+	candidates := h.searchLayer(scratch, ep, query, ef, 0)
+
+	queryNorm := vectorNorm(query)
+	results := make([]SearchResult, 0, len(candidates))
+	for _, node := range candidates {
+		if node.deleted || len(node.Vector) != len(query) {
+			continue
+		}
+		if filter != nil && !filter(node.Metadata) {
+			continue
+		}
+		norm := node.norm
+		if norm == 0 {
+			norm = vectorNorm(node.Vector)
+		}
+		results = append(results, SearchResult{
+			ID:       node.ID,
+			Vector:   node.Vector,
+			Score:    metricScore(metric, dotProduct(query, node.Vector), queryNorm, norm),
+			Metadata: node.Metadata,
+		})
+	}
+
+	sortResults(results, metric)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
 // Get retrieves a vector by its ID.
 func (h *HNSW) Get(id string) (*VectorItem, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	node, found := h.nodes[id]
-	if !found || node.deleted {
+	seq, found := h.ids[id]
+	if !found || h.nodes[seq].deleted {
 		return nil, false
 	}
 
+	node := h.nodes[seq]
 	return &VectorItem{
 		ID:       node.ID,
 		Vector:   node.Vector,
@@ -474,26 +723,62 @@ func (h *HNSW) Get(id string) (*VectorItem, bool) {
 	}, true
 }
 
-// Delete marks a vector as deleted (logical deletion).
+// Delete marks a vector as deleted (logical deletion). The node stays in the
+// graph until it is rebuilt, but its vector and metadata are released right
+// away: searches never compute distances to deleted nodes.
 func (h *HNSW) Delete(id string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	node, found := h.nodes[id]
-	if !found {
+	seq, found := h.ids[id]
+	if !found || h.nodes[seq].deleted {
 		return nil
 	}
 
+	node := h.nodes[seq]
 	node.deleted = true
 	h.count--
+	h.reclaim(node)
+	if node == h.entryPoint {
+		h.promoteEntry()
+	}
+	if h.config.RepairEvery > 0 {
+		h.deletesSinceRepair++
+		if h.deletesSinceRepair >= h.config.RepairEvery {
+			h.repair()
+		}
+	}
 	return nil
 }
 
+// reclaim releases the payload of a deleted node and moves the memory it
+// still holds to the tombstone accounting (caller must hold the lock).
+func (h *HNSW) reclaim(node *HNSWNode) {
+	h.currentMem -= int64(len(node.Vector)*4 + len(node.ID) + 64)
+	h.tombstones++
+	h.tombstoneMem += int64(len(node.ID) + 64)
+	node.Vector = nil
+	node.Metadata = nil
+	node.norm = 0
+}
+
+// Memory reports the memory held by live nodes and by deleted nodes that
+// are still part of the graph.
+func (h *HNSW) Memory() IndexMemory {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return IndexMemory{
+		LiveBytes:      h.currentMem,
+		Tombstones:     h.tombstones,
+		TombstoneBytes: h.tombstoneMem,
+	}
+}
+
 // Len returns the number of vectors in the index.
 func (h *HNSW) Len() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return int(atomic.LoadInt64(&h.count))
+	return int(h.count)
 }
 
 // Clear removes all vectors from the index.
@@ -501,45 +786,14 @@ func (h *HNSW) Clear() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	h.nodes = make(map[string]*HNSWNode)
+	h.nodes = nil
+	h.ids = make(map[string]uint32)
 	h.entryPoint = nil
+	h.entries = nil
+	h.deletesSinceRepair = 0
 	h.maxLevel = -1
 	h.count = 0
 	h.currentMem = 0
-}
-
-// nodeHeap is a min-heap for candidate priority queue.
-type nodeHeap struct {
-	data []nodeDist
-}
-
-func (h *nodeHeap) Len() int           { return len(h.data) }
-func (h *nodeHeap) Less(i, j int) bool { return h.data[i].dist < h.data[j].dist }
-func (h *nodeHeap) Swap(i, j int)      { h.data[i], h.data[j] = h.data[j], h.data[i] }
-func (h *nodeHeap) Push(x interface{})  { h.data = append(h.data, x.(nodeDist)) }
-func (h *nodeHeap) Pop() interface{} {
-	res := h.data[len(h.data)-1]
-	h.data = h.data[:len(h.data)-1]
-	return res
-}
-func (h *nodeHeap) Top() interface{} {
-	return h.data[0]
-}
-
-// nodeHeapDesc is a max-heap for results priority queue.
-type nodeHeapDesc struct {
-	data []nodeDist
-}
-
-func (h *nodeHeapDesc) Len() int           { return len(h.data) }
-func (h *nodeHeapDesc) Less(i, j int) bool { return h.data[i].dist > h.data[j].dist }
-func (h *nodeHeapDesc) Swap(i, j int)      { h.data[i], h.data[j] = h.data[j], h.data[i] }
-func (h *nodeHeapDesc) Push(x interface{})  { h.data = append(h.data, x.(nodeDist)) }
-func (h *nodeHeapDesc) Pop() interface{} {
-	res := h.data[len(h.data)-1]
-	h.data = h.data[:len(h.data)-1]
-	return res
-}
-func (h *nodeHeapDesc) Top() interface{} {
-	return h.data[0]
+	h.tombstones = 0
+	h.tombstoneMem = 0
 }
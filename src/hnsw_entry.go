@@ -0,0 +1,52 @@
+package src
+
+// entryRedundancy is the number of standby entry points kept per level.
+const entryRedundancy = 4
+
+// trackEntry records node as a standby entry point of its top level if that
+// level has room. A level with fewer than entryRedundancy standbys therefore
+// lists every node whose top level it is.
+func (h *HNSW) trackEntry(node *HNSWNode) {
+	level := len(node.neighbors) - 1
+	for len(h.entries) <= level {
+		h.entries = append(h.entries, nil)
+	}
+	if len(h.entries[level]) < entryRedundancy {
+		h.entries[level] = append(h.entries[level], node.seq)
+	}
+}
+
+// promoteEntry replaces a deleted entry point with a live node of the
+// highest level that has one, so searches keep starting from the top of the
+// graph. If a full standby list has no live node left, the standbys are
+// rebuilt from all nodes. With no live node at all the index becomes empty
+// for searches (caller must hold the lock).
+func (h *HNSW) promoteEntry() {
+	for level := len(h.entries) - 1; level >= 0; level-- {
+		for _, seq := range h.entries[level] {
+			if node := h.nodes[seq]; !node.deleted {
+				h.entryPoint = node
+				h.maxLevel = int32(level)
+				return
+			}
+		}
+		if len(h.entries[level]) == entryRedundancy {
+			// Other nodes of this level may be alive.
+			h.rescanEntries()
+			h.promoteEntry()
+			return
+		}
+	}
+	h.entryPoint = nil
+	h.maxLevel = -1
+}
+
+// rescanEntries rebuilds the standby lists from the live nodes.
+func (h *HNSW) rescanEntries() {
+	h.entries = h.entries[:0]
+	for _, node := range h.nodes {
+		if !node.deleted {
+			h.trackEntry(node)
+		}
+	}
+}
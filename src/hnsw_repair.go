@@ -0,0 +1,170 @@
+package src
+
+// ConnectivityReport describes how many live vectors of an HNSW graph
+// searches can reach at level 0, where every search ends.
+type ConnectivityReport struct {
+	Live        int // Live (non-deleted) nodes.
+	Unreachable int // Live nodes not reachable from the entry point.
+	Bridged     int // Bridging edges added by a repair.
+}
+
+// connectivityRepairer is implemented by indexes that can detect and repair
+// unreachable vectors.
+type connectivityRepairer interface {
+	CheckConnectivity() ConnectivityReport
+	Repair() ConnectivityReport
+}
+
+// CheckConnectivity reports the live nodes that cannot be reached from the
+// entry point by following level-0 edges through live nodes. Such nodes
+// never appear in search results. Deleted nodes are not expanded by
+// searches, so deletions can cut parts of the graph off, and pruning can
+// drop the only edge into a node.
+func (h *HNSW) CheckConnectivity() ConnectivityReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var report ConnectivityReport
+	var reached visitedSet
+	reached.grow(uint32(len(h.nodes)))
+	if h.entryPoint != nil {
+		h.reach(&reached, h.entryPoint, nil)
+	}
+	for _, node := range h.nodes {
+		if !node.deleted {
+			report.Live++
+			if !reached.has(node.seq) {
+				report.Unreachable++
+			}
+		}
+	}
+	return report
+}
+
+// Repair makes every live node reachable again. Each unreachable node is
+// linked from its nearest reachable node by a bridging edge, which is added
+// without pruning, and gets fresh outgoing edges to its nearest reachable
+// neighbors. The returned report counts the nodes that were unreachable.
+func (h *HNSW) Repair() ConnectivityReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.repair()
+}
+
+// repair is Repair with the lock held.
+func (h *HNSW) repair() ConnectivityReport {
+	h.deletesSinceRepair = 0
+
+	var report ConnectivityReport
+	if h.entryPoint == nil {
+		return report
+	}
+	var reached visitedSet
+	reached.grow(uint32(len(h.nodes)))
+	stack := h.reach(&reached, h.entryPoint, nil)
+
+	scratch := h.getScratch()
+	defer h.putScratch(scratch)
+	for _, node := range h.nodes {
+		if node.deleted {
+			continue
+		}
+		report.Live++
+		if reached.has(node.seq) {
+			continue
+		}
+		report.Unreachable++
+
+		found := h.reachableNeighbors(scratch, &reached, node)
+		if len(found) == 0 {
+			continue
+		}
+		h.addEdge(found[0].node, node, 0)
+		report.Bridged++
+		for _, neighbor := range h.selectNeighbors(found, h.config.M) {
+			h.addEdge(node, neighbor.node, 0)
+		}
+		h.pruneNeighbors(node, 0)
+
+		// The node and whatever it leads to are reachable now.
+		stack = h.reach(&reached, node, stack)
+	}
+	return report
+}
+
+// reachableNeighbors returns the reachable nodes nearest to node, nearest
+// first, found by a search from the entry point.
+func (h *HNSW) reachableNeighbors(scratch *layerScratch, reached *visitedSet, node *HNSWNode) []nodeDist {
+	ep := h.entryPoint
+	for l := int(h.maxLevel); l > 0; l-- {
+		res := h.searchLayer(scratch, ep, node.Vector, 1, l)
+		if len(res) > 0 {
+			ep = res[0]
+		}
+	}
+	// Upper levels can lead to a node that level 0 does not reach.
+	if !reached.has(ep.seq) {
+		ep = h.entryPoint
+	}
+
+	candidates := h.searchLayer(scratch, ep, node.Vector, h.config.EFConstruction, 0)
+	found := make([]nodeDist, 0, len(candidates))
+	for _, c := range candidates {
+		if c != node && !c.deleted && reached.has(c.seq) {
+			found = append(found, nodeDist{node: c, dist: h.distance(node.Vector, c.Vector)})
+		}
+	}
+	return found
+}
+
+// reach marks the live nodes reachable at level 0 from start, using stack
+// as the work list, and returns the stack for reuse.
+func (h *HNSW) reach(reached *visitedSet, start *HNSWNode, stack []uint32) []uint32 {
+	if !reached.visit(start.seq) {
+		return stack
+	}
+	stack = append(stack[:0], start.seq)
+	for len(stack) > 0 {
+		node := h.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		for _, seq := range node.neighbors[0] {
+			if !h.nodes[seq].deleted && reached.visit(seq) {
+				stack = append(stack, seq)
+			}
+		}
+	}
+	return stack
+}
+
+// CheckConnectivity reports the vectors that HNSW searches cannot reach,
+// summed over shards. Flat indexes always report zero unreachable vectors.
+func (vc *VectorCache) CheckConnectivity() ConnectivityReport {
+	return vc.connectivity(func(r connectivityRepairer) ConnectivityReport {
+		return r.CheckConnectivity()
+	})
+}
+
+// RepairIndex links unreachable vectors back into the HNSW graph of every
+// shard and reports what was repaired.
+func (vc *VectorCache) RepairIndex() ConnectivityReport {
+	return vc.connectivity(func(r connectivityRepairer) ConnectivityReport {
+		return r.Repair()
+	})
+}
+
+func (vc *VectorCache) connectivity(run func(r connectivityRepairer) ConnectivityReport) ConnectivityReport {
+	if vc.shardCount > 1 {
+		var total ConnectivityReport
+		for _, shard := range vc.shards {
+			r := shard.connectivity(run)
+			total.Live += r.Live
+			total.Unreachable += r.Unreachable
+			total.Bridged += r.Bridged
+		}
+		return total
+	}
+	if r, ok := vc.currentIndex().(connectivityRepairer); ok {
+		return run(r)
+	}
+	return ConnectivityReport{Live: vc.currentIndex().Len()}
+}
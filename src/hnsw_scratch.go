@@ -0,0 +1,169 @@
+package src
+
+// layerScratch holds the buffers of a layer search: the visited set, the
+// candidate and result queues and the output slice. Scratches are pooled per
+// index and reused across queries and across the inserts of a batch, so a
+// search allocates nothing once the pool is warm.
+type layerScratch struct {
+	visited    visitedSet
+	candidates distHeap
+	results    distHeap
+	out        []*HNSWNode
+
+	// targets and dists hold the vectors and distances of a re-ranking.
+	targets []Vector
+	dists   []float32
+}
+
+// getScratch returns a pooled scratch, sized for the current number of
+// nodes and the configured ef.
+func (h *HNSW) getScratch() *layerScratch {
+	s, _ := h.scratches.Get().(*layerScratch)
+	if s == nil {
+		s = &layerScratch{results: distHeap{max: true}}
+	}
+	s.visited.grow(uint32(len(h.nodes)))
+	ef := max(h.config.EFSearch, h.config.EFConstruction)
+	if cap(s.results.data) < ef+1 {
+		s.candidates.data = make([]nodeDist, 0, ef+1)
+		s.results.data = make([]nodeDist, 0, ef+1)
+		s.out = make([]*HNSWNode, 0, ef+1)
+	}
+	return s
+}
+
+// putScratch returns a scratch to the pool.
+func (h *HNSW) putScratch(s *layerScratch) {
+	s.reset()
+	// Drop node references so the pool does not keep deleted nodes alive.
+	clear(s.out[:cap(s.out)])
+	clear(s.targets[:cap(s.targets)])
+	h.scratches.Put(s)
+}
+
+// distances computes the distances from query to nodes with one
+// DistanceBatch call. The returned slice is owned by s.
+func (s *layerScratch) distances(metric MetricType, query Vector, nodes []*HNSWNode) []float32 {
+	s.targets = s.targets[:0]
+	for _, node := range nodes {
+		s.targets = append(s.targets, node.Vector)
+	}
+	if cap(s.dists) < len(nodes) {
+		s.dists = make([]float32, len(nodes))
+	}
+	s.dists = s.dists[:len(nodes)]
+	metric.DistanceBatch(query, s.targets, s.dists)
+	return s.dists
+}
+
+// reset empties the scratch, keeping its allocations.
+func (s *layerScratch) reset() {
+	s.visited.reset()
+	s.candidates.data = s.candidates.data[:0]
+	s.results.data = s.results.data[:0]
+}
+
+// visitedSet is a bitset indexed by node sequence number. It remembers which
+// words it has set so that reset only clears those.
+type visitedSet struct {
+	words   []uint64
+	touched []int
+}
+
+// grow makes room for n nodes.
+func (v *visitedSet) grow(n uint32) {
+	if words := int(n+63) / 64; words > len(v.words) {
+		grown := make([]uint64, words)
+		copy(grown, v.words)
+		v.words = grown
+	}
+}
+
+// visit marks seq as visited and reports whether it was not visited before.
+func (v *visitedSet) visit(seq uint32) bool {
+	w := int(seq / 64)
+	if w >= len(v.words) {
+		v.grow(seq + 1)
+	}
+	mask := uint64(1) << (seq % 64)
+	word := v.words[w]
+	if word&mask != 0 {
+		return false
+	}
+	if word == 0 {
+		v.touched = append(v.touched, w)
+	}
+	v.words[w] = word | mask
+	return true
+}
+
+// has reports whether seq is visited.
+func (v *visitedSet) has(seq uint32) bool {
+	w := int(seq / 64)
+	return w < len(v.words) && v.words[w]&(uint64(1)<<(seq%64)) != 0
+}
+
+// reset clears every visited bit.
+func (v *visitedSet) reset() {
+	for _, w := range v.touched {
+		v.words[w] = 0
+	}
+	v.touched = v.touched[:0]
+}
+
+// distHeap is a binary heap of nodes by distance: a min-heap, or a max-heap
+// if max is set. It works on nodeDist values directly, so pushes and pops do
+// not allocate.
+type distHeap struct {
+	data []nodeDist
+	max  bool
+}
+
+func (h *distHeap) Len() int { return len(h.data) }
+
+// before reports whether element i belongs above element j.
+func (h *distHeap) before(i, j int) bool {
+	if h.max {
+		return h.data[i].dist > h.data[j].dist
+	}
+	return h.data[i].dist < h.data[j].dist
+}
+
+// top returns the nearest (min-heap) or farthest (max-heap) node.
+func (h *distHeap) top() nodeDist {
+	return h.data[0]
+}
+
+func (h *distHeap) push(nd nodeDist) {
+	h.data = append(h.data, nd)
+	for i := len(h.data) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !h.before(i, parent) {
+			break
+		}
+		h.data[i], h.data[parent] = h.data[parent], h.data[i]
+		i = parent
+	}
+}
+
+func (h *distHeap) pop() nodeDist {
+	top := h.data[0]
+	last := len(h.data) - 1
+	h.data[0] = h.data[last]
+	h.data = h.data[:last]
+	for i := 0; ; {
+		child := 2*i + 1
+		if child >= last {
+			break
+		}
+		if child+1 < last && h.before(child+1, child) {
+			child++
+		}
+		if !h.before(child, i) {
+			break
+		}
+		h.data[i], h.data[child] = h.data[child], h.data[i]
+		i = child
+	}
+	return top
+}
@@ -0,0 +1,104 @@
+package src
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// heuristicDataset returns n vectors and q queries of dim dimensions, drawn
+// uniformly from [0, 1) or, with clusters > 0, around that many Gaussian
+// centers with a standard deviation of 0.05
+func heuristicDataset(n, q, dim, clusters int) (vectors, queries []Vector) {
+	rng := rand.New(rand.NewSource(1))
+	centers := make([]Vector, clusters)
+	for i := range centers {
+		centers[i] = make(Vector, dim)
+		for j := range centers[i] {
+			centers[i][j] = rng.Float32()
+		}
+	}
+	draw := func() Vector {
+		v := make(Vector, dim)
+		if clusters == 0 {
+			for j := range v {
+				v[j] = rng.Float32()
+			}
+			return v
+		}
+		center := centers[rng.Intn(clusters)]
+		for j := range v {
+			v[j] = center[j] + float32(rng.NormFloat64()*0.05)
+		}
+		return v
+	}
+	for i := 0; i < n; i++ {
+		vectors = append(vectors, draw())
+	}
+	for i := 0; i < q; i++ {
+		queries = append(queries, draw())
+	}
+	return vectors, queries
+}
+
+// heuristicEval builds an HNSW index over vectors and returns its build time,
+// the mean latency of searching queries and the mean recall@k against exact
+// flat search
+func heuristicEval(tb testing.TB, vectors, queries []Vector, config HNSWConfig, k int) (build, latency time.Duration, recall float64) {
+	flat := NewFlatSearch(MetricL2)
+	h := NewHNSW(config, MetricL2)
+	start := time.Now()
+	for i, v := range vectors {
+		id := fmt.Sprint(i)
+		if err := h.Add(id, v, nil); err != nil {
+			tb.Fatal(err)
+		}
+		flat.Add(id, v, nil)
+	}
+	build = time.Since(start)
+
+	for _, query := range queries {
+		exact, err := flat.Search(query, k)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		start := time.Now()
+		found, err := h.Search(query, k)
+		latency += time.Since(start)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		recall += recallOf(exact, found)
+	}
+	return build, latency / time.Duration(len(queries)), recall / float64(len(queries))
+}
+
+// BenchmarkHNSWHeuristic measures the neighbor selection heuristic on 10,000
+// random 32-dimensional vectors, uniform or in 20 Gaussian clusters, with 500
+// queries; it produces the table in docs/vector.md:
+//
+//	go test ./src -run '^$' -bench HNSWHeuristic -benchtime 1x
+func BenchmarkHNSWHeuristic(b *testing.B) {
+	for _, data := range []struct {
+		name     string
+		clusters int
+	}{{"uniform", 0}, {"clustered", 20}} {
+		vectors, queries := heuristicDataset(10_000, 500, 32, data.clusters)
+		for _, heuristic := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/heuristic=%v", data.name, heuristic), func(b *testing.B) {
+				config := DefaultHNSWConfig()
+				config.Heuristic = heuristic
+				config.Seed = 1
+				var build, latency time.Duration
+				var recall float64
+				for i := 0; i < b.N; i++ {
+					build, latency, recall = heuristicEval(b, vectors, queries, config, 10)
+				}
+				b.ReportMetric(recall, "recall@10")
+				b.ReportMetric(float64(latency.Microseconds()), "µs/query")
+				b.ReportMetric(build.Seconds(), "build-s")
+			})
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHTTPMaxValueSize is the default limit for values sent with PUT.
+const DefaultHTTPMaxValueSize = 1 << 20
+
+// HTTPServer exposes a RistrettoCache over a small REST API:
+//
+//	GET    /keys/{key}   read a value
+//	PUT    /keys/{key}   store the request body (?ttl=30s&cost=N)
+//	DELETE /keys/{key}   delete a key
+//	GET    /stats        cache statistics as JSON
+//	GET    /metrics      metrics in the Prometheus text format
+//
+// Values are converted according to their content type: text/* bodies are
+// stored as string, application/json bodies are decoded, and anything else
+// is stored as []byte. On GET, strings are returned as text/plain, []byte as
+// application/octet-stream and other values as JSON.
+//
+// When the cache has a Config.Audit log, PUTs and DELETEs are recorded with
+// the actor of the request context, which a middleware authenticating
+// callers attaches with WithAuditActor; without one, a server with a Policy
+// attributes them to the bearer token, see TokenActor.
+//
+// With a Policy, requests carry a token in an "Authorization: Bearer" header.
+// Reads need PermRead and writes PermWrite on the key, and /stats and
+// /metrics PermRead on ScopeAll. An unknown token is answered with 401 and a
+// missing permission with 403.
+//
+// HTTPServer implements http.Handler, so it can be mounted on an existing mux.
+type HTTPServer struct {
+	// MaxValueSize limits PUT bodies, DefaultHTTPMaxValueSize if 0
+	MaxValueSize int64
+
+	// Policy authorizes requests, nil to allow all of them. Set it before
+	// serving.
+	Policy *AccessPolicy
+
+	cache  *RistrettoCache
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// NewHTTPServer creates an HTTP server for cache.
+func NewHTTPServer(cache *RistrettoCache) *HTTPServer {
+	s := &HTTPServer{cache: cache, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/keys/", s.handleKey)
+	s.mux.HandleFunc("/stats", s.handleStats)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.server = &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe listens on the TCP address addr and serves requests.
+func (s *HTTPServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves requests on ln until Close is called.
+func (s *HTTPServer) Serve(ln net.Listener) error {
+	if err := s.server.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Close stops the server and closes open connections.
+func (s *HTTPServer) Close() error {
+	return s.server.Close()
+}
+
+func (s *HTTPServer) handleKey(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/keys/")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+
+	perm := PermWrite
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		perm = PermRead
+	}
+	if !s.authorize(w, r, key, perm) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		value, found := s.cache.Get(key)
+		if !found {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		contentType, body, err := encodeHTTPValue(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if ttl, ok := s.cache.GetTTL(key); ok && ttl > 0 {
+			w.Header().Set("X-Cache-TTL", ttl.String())
+		}
+		if r.Method == http.MethodGet {
+			w.Write(body)
+		}
+
+	case http.MethodPut:
+		s.putKey(w, r, key)
+
+	case http.MethodDelete:
+		s.cache.del(s.auditContext(r), key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorize checks the request's bearer token against the policy and
+// answers the request if it is refused.
+func (s *HTTPServer) authorize(w http.ResponseWriter, r *http.Request, scope string, perm Permission) bool {
+	err := s.Policy.Authorize(BearerToken(r.Header.Get("Authorization")), scope, perm)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUnauthenticated):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fastcache"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	}
+	return false
+}
+
+// auditContext returns the request context attributed to its bearer token.
+func (s *HTTPServer) auditContext(r *http.Request) context.Context {
+	return auditContext(r.Context(), s.Policy, BearerToken(r.Header.Get("Authorization")))
+}
+
+func (s *HTTPServer) putKey(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+
+	var ttl time.Duration
+	if v := query.Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	var cost int64
+	if v := query.Get("cost"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid cost", http.StatusBadRequest)
+			return
+		}
+		cost = n
+	}
+
+	limit := s.MaxValueSize
+	if limit <= 0 {
+		limit = DefaultHTTPMaxValueSize
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > limit {
+		http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	value, err := decodeHTTPValue(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if cost == 0 && s.cache.config.Cost == nil {
+		cost = int64(len(key) + len(body))
+	}
+
+	var expiration int64
+	if ttl > 0 {
+		expiration = time.Now().Add(ttl).UnixNano()
+	}
+	stored := s.cache.setSync(s.auditContext(r), key, value, cost, expiration)
+	if !stored {
+		http.Error(w, "value rejected", http.StatusInsufficientStorage)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeHTTPValue converts a request body to a cache value by content type.
+func decodeHTTPValue(contentType string, body []byte) (any, error) {
+	mediaType := "application/octet-stream"
+	if contentType != "" {
+		t, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, err
+		}
+		mediaType = t
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return string(body), nil
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, fmt.Errorf("invalid json: %w", err)
+		}
+		return v, nil
+	default:
+		return body, nil
+	}
+}
+
+// encodeHTTPValue converts a cache value to a response body and content type.
+func encodeHTTPValue(value any) (string, []byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return "application/octet-stream", v, nil
+	case string:
+		return "text/plain; charset=utf-8", []byte(v), nil
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, err
+	}
+	return "application/json", body, nil
+}
+
+// httpStats is the JSON body of /stats.
+type httpStats struct {
+	Len          int     `json:"len"`
+	Cost         int64   `json:"cost"`
+	MaxCost      int64   `json:"max_cost"`
+	Hits         int64   `json:"hits"`
+	Misses       int64   `json:"misses"`
+	HitRatio     float64 `json:"hit_ratio"`
+	KeysAdded    int64   `json:"keys_added"`
+	KeysEvicted  int64   `json:"keys_evicted"`
+	SetsDropped  int64   `json:"sets_dropped"`
+	SetsRejected int64   `json:"sets_rejected"`
+}
+
+func (s *HTTPServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, ScopeAll, PermRead) {
+		return
+	}
+	m := s.cache.Metrics()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(httpStats{
+		Len:          s.cache.Len(),
+		Cost:         s.cache.Cost(),
+		MaxCost:      s.cache.MaxCost(),
+		Hits:         m.Hits(),
+		Misses:       m.Misses(),
+		HitRatio:     m.Ratio(),
+		KeysAdded:    m.KeysAdded(),
+		KeysEvicted:  m.KeysEvicted(),
+		SetsDropped:  m.SetsDropped(),
+		SetsRejected: m.SetsRejected(),
+	})
+}
+
+func (s *HTTPServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, ScopeAll, PermRead) {
+		return
+	}
+	m := s.cache.Metrics()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metric := func(name, kind, help string, value any) {
+		fmt.Fprintf(w, "# HELP fastcache_%s %s\n# TYPE fastcache_%s %s\nfastcache_%s %v\n", name, help, name, kind, name, value)
+	}
+	metric("entries", "gauge", "Number of entries in the cache.", s.cache.Len())
+	metric("cost", "gauge", "Total cost of the entries in the cache.", s.cache.Cost())
+	metric("max_cost", "gauge", "Maximum cost of the cache.", s.cache.MaxCost())
+	metric("hits_total", "counter", "Cache hits.", m.Hits())
+	metric("misses_total", "counter", "Cache misses.", m.Misses())
+	metric("keys_added_total", "counter", "Keys added.", m.KeysAdded())
+	metric("keys_evicted_total", "counter", "Keys evicted.", m.KeysEvicted())
+	metric("sets_dropped_total", "counter", "Sets dropped because the write buffer was full.", m.SetsDropped())
+	metric("sets_rejected_total", "counter", "Sets rejected by admission.", m.SetsRejected())
+	metric("cost_added_total", "counter", "Total cost added.", m.CostAdded())
+	metric("cost_evicted_total", "counter", "Total cost evicted.", m.CostEvicted())
+	metric("loads_total", "counter", "Loader calls made on misses.", m.Loads())
+}
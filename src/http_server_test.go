@@ -0,0 +1,51 @@
+package src
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServerAccessPolicy(t *testing.T) {
+	cache, err := NewRistrettoCache(&Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	s := NewHTTPServer(cache)
+	s.Policy = NewAccessPolicy()
+	s.Policy.Grant("team-a", "a/*", PermRead|PermWrite)
+	s.Policy.Grant("ops", "*", PermAdmin)
+
+	do := func(method, path, token string) int {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader("v"))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for _, tc := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodPut, "/keys/a/k", "", http.StatusUnauthorized},
+		{http.MethodPut, "/keys/a/k", "wrong", http.StatusUnauthorized},
+		{http.MethodPut, "/keys/b/k", "team-a", http.StatusForbidden},
+		{http.MethodPut, "/keys/a/k", "team-a", http.StatusNoContent},
+		{http.MethodGet, "/keys/a/k", "team-a", http.StatusOK},
+		{http.MethodDelete, "/keys/b/k", "team-a", http.StatusForbidden},
+		{http.MethodGet, "/stats", "team-a", http.StatusForbidden},
+		{http.MethodGet, "/metrics", "", http.StatusUnauthorized},
+		{http.MethodGet, "/stats", "ops", http.StatusOK},
+		{http.MethodDelete, "/keys/a/k", "ops", http.StatusNoContent},
+	} {
+		if got := do(tc.method, tc.path, tc.token); got != tc.want {
+			t.Errorf("%s %s with %q = %d, want %d", tc.method, tc.path, tc.token, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRebuildInProgress is returned when an index rebuild is already running.
+var ErrRebuildInProgress = errors.New("index rebuild already in progress")
+
+// RebuildOptions configures an online index rebuild.
+type RebuildOptions struct {
+	// HNSW overrides the HNSW parameters of the rebuilt index.
+	// nil keeps the current configuration.
+	HNSW *HNSWConfig
+
+	// OnProgress is called periodically while the shadow index is built.
+	OnProgress func(IndexProgress)
+}
+
+// itemLister is implemented by indexes that can enumerate their live vectors.
+type itemLister interface {
+	liveItems() []*VectorItem
+}
+
+// rebuildOp is a mutation applied to the live index while a rebuild is running.
+type rebuildOp struct {
+	id       string
+	vector   Vector
+	metadata map[string]any
+	deleted  bool
+}
+
+// rebuildLog records mutations that happen while a shadow index is built,
+// so they can be replayed onto it before the swap.
+type rebuildLog struct {
+	mu  sync.Mutex
+	ops []rebuildOp
+}
+
+func (l *rebuildLog) record(op rebuildOp) {
+	l.mu.Lock()
+	l.ops = append(l.ops, op)
+	l.mu.Unlock()
+}
+
+// replay applies the recorded mutations to index, stopping at the first error.
+func (l *rebuildLog) replay(index VectorStore) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, op := range l.ops {
+		var err error
+		if op.deleted {
+			err = index.Delete(op.id)
+		} else {
+			err = index.Add(op.id, op.vector, op.metadata)
+		}
+		if err != nil {
+			return fmt.Errorf("replay %s: %w", op.id, err)
+		}
+	}
+	return nil
+}
+
+// currentIndex returns the live index of a single shard.
+func (vc *VectorCache) currentIndex() VectorStore {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return vc.index
+}
+
+// hnswConfig returns the HNSW parameters of the live index.
+func (vc *VectorCache) hnswConfig() HNSWConfig {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return vc.hnsw
+}
+
+// newIndex creates an empty index of the configured type.
+func (vc *VectorCache) newIndex(config HNSWConfig) VectorStore {
+	switch vc.config.IndexType {
+	case "hnsw":
+		h := NewHNSW(config, vc.config.Metric)
+		h.norms = vc.config.PrecomputeNorms
+		return h
+	default:
+		if vc.config.Quantization != QuantizationNone {
+			return NewQuantizedFlatSearch(vc.config.Metric, vc.config.Quantization)
+		}
+		f := NewFlatSearch(vc.config.Metric)
+		f.norms = vc.config.PrecomputeNorms
+		return f
+	}
+}
+
+// indexAdd adds a vector to the live index, recording it for a running rebuild.
+func (vc *VectorCache) indexAdd(id string, vector Vector, metadata map[string]any) error {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	if vc.rebuild != nil {
+		vc.rebuild.record(rebuildOp{id: id, vector: vector, metadata: metadata})
+	}
+	return vc.index.Add(id, vector, metadata)
+}
+
+// batchAdder is implemented by indexes that can insert many vectors under a
+// single lock acquisition.
+type batchAdder interface {
+	AddBatch(items []VectorItem) error
+}
+
+// indexAddBatch adds vectors to the live index, recording them for a running rebuild.
+func (vc *VectorCache) indexAddBatch(items []VectorItem) error {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	if vc.rebuild != nil {
+		for _, item := range items {
+			vc.rebuild.record(rebuildOp{id: item.ID, vector: item.Vector, metadata: item.Metadata})
+		}
+	}
+	if b, ok := vc.index.(batchAdder); ok {
+		return b.AddBatch(items)
+	}
+	for _, item := range items {
+		if err := vc.index.Add(item.ID, item.Vector, item.Metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexDelete deletes a vector from the live index, recording it for a running rebuild.
+func (vc *VectorCache) indexDelete(id string) error {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	if vc.rebuild != nil {
+		vc.rebuild.record(rebuildOp{id: id, deleted: true})
+	}
+	vc.order.remove(id)
+	return vc.index.Delete(id)
+}
+
+// RebuildIndex rebuilds the index online from the vectors of the current index.
+// The new index is built in the background while the old one keeps serving
+// searches, and the two are swapped once the build completes. Writes that
+// arrive during the build are replayed onto the new index before the swap;
+// the first one that fails aborts the swap and is returned. Cancelling ctx
+// aborts the rebuild and leaves the current index in place.
+func (vc *VectorCache) RebuildIndex(ctx context.Context, opts RebuildOptions) error {
+	return vc.rebuildAll(ctx, opts, func(_ *VectorCache, current VectorStore) []*VectorItem {
+		if lister, ok := current.(itemLister); ok {
+			return lister.liveItems()
+		}
+		return nil
+	})
+}
+
+// rebuildAll rebuilds the index of every shard, one shard at a time, from the
+// items returned by source and reports aggregated progress.
+func (vc *VectorCache) rebuildAll(ctx context.Context, opts RebuildOptions, source func(s *VectorCache, current VectorStore) []*VectorItem) error {
+	shards := []*VectorCache{vc}
+	if vc.shardCount > 1 {
+		shards = vc.shards
+	}
+
+	config := vc.hnswConfig()
+	if opts.HNSW != nil {
+		config = *opts.HNSW
+	}
+
+	total := 0
+	for _, shard := range shards {
+		total += shard.currentIndex().Len()
+	}
+	tracker := newProgressTracker(total, opts.OnProgress)
+
+	done := 0
+	for _, shard := range shards {
+		s := shard
+		n, err := s.rebuildShadow(ctx, func(current VectorStore) []*VectorItem {
+			return source(s, current)
+		}, config, func(shardDone int) {
+			tracker.update(done + shardDone)
+		})
+		if err != nil {
+			return err
+		}
+		done += n
+	}
+
+	vc.mu.Lock()
+	vc.hnsw = config
+	vc.mu.Unlock()
+	tracker.finish(done)
+	return nil
+}
+
+// rebuildShadow builds a new index from the items returned by source and
+// atomically swaps it in place of the live index. It returns the number of
+// items inserted from source. If a write made during the build cannot be
+// replayed onto the new index, the live index is kept and the error returned.
+func (vc *VectorCache) rebuildShadow(ctx context.Context, source func(current VectorStore) []*VectorItem, config HNSWConfig, progress func(done int)) (int, error) {
+	vc.mu.Lock()
+	if vc.rebuild != nil {
+		vc.mu.Unlock()
+		return 0, ErrRebuildInProgress
+	}
+	log := &rebuildLog{}
+	vc.rebuild = log
+	current := vc.index
+	vc.mu.Unlock()
+
+	abort := func() {
+		vc.mu.Lock()
+		vc.rebuild = nil
+		vc.mu.Unlock()
+	}
+
+	items := source(current)
+	shadow := vc.newIndex(config)
+
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			abort()
+			return 0, err
+		}
+		if err := shadow.Add(item.ID, item.Vector, item.Metadata); err != nil {
+			abort()
+			return 0, err
+		}
+		progress(i + 1)
+	}
+
+	vc.mu.Lock()
+	// Replay writes that reached the old index during the build. A shadow
+	// missing one of them must not replace the old index.
+	if err := log.replay(shadow); err != nil {
+		vc.rebuild = nil
+		vc.mu.Unlock()
+		return 0, err
+	}
+
+	vc.index = shadow
+	vc.rebuild = nil
+	vc.hnsw = config
+	vc.mu.Unlock()
+
+	return len(items), nil
+}
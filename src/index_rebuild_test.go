@@ -0,0 +1,116 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// failingIndex is a FlatSearch whose Add and Delete fail for one ID
+type failingIndex struct {
+	*FlatSearch
+	fail string
+}
+
+var errIndexFailed = errors.New("index failed")
+
+func (f *failingIndex) Add(id string, vector Vector, metadata map[string]any) error {
+	if id == f.fail {
+		return errIndexFailed
+	}
+	return f.FlatSearch.Add(id, vector, metadata)
+}
+
+func (f *failingIndex) Delete(id string) error {
+	if id == f.fail {
+		return errIndexFailed
+	}
+	return f.FlatSearch.Delete(id)
+}
+
+func TestRebuildLogReplayStopsAtFirstError(t *testing.T) {
+	for _, deleted := range []bool{false, true} {
+		log := &rebuildLog{}
+		log.record(rebuildOp{id: "a", vector: Vector{1, 0}})
+		log.record(rebuildOp{id: "bad", vector: Vector{0, 1}, deleted: deleted})
+		log.record(rebuildOp{id: "c", vector: Vector{1, 1}})
+
+		index := &failingIndex{FlatSearch: NewFlatSearch(MetricL2), fail: "bad"}
+		if err := log.replay(index); !errors.Is(err, errIndexFailed) {
+			t.Fatalf("deleted %v: replay = %v, want the index error", deleted, err)
+		}
+		if _, ok := index.Get("a"); !ok {
+			t.Fatalf("deleted %v: op before the failure not applied", deleted)
+		}
+		if _, ok := index.Get("c"); ok {
+			t.Fatalf("deleted %v: op after the failure applied", deleted)
+		}
+	}
+}
+
+// Rebuilds with new parameters race neither with searches and writes nor
+// with each other, and leave the caller's config alone
+func TestOptimizeIndexWithConfigDuringSearches(t *testing.T) {
+	for _, shards := range []int{1, 2} {
+		config := DefaultVectorStoreConfig()
+		config.Dimension = 4
+		config.ShardCount = shards
+		seeded := config.HNSW
+		store, err := NewVectorStore(&config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200; i++ {
+			store.Add(fmt.Sprint(i), Vector{float32(i), 1, 2, 3}, nil)
+		}
+		store.Wait()
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if _, err := store.Search(Vector{float32(i % 200), 1, 2, 3}, 5); err != nil {
+						t.Error(err)
+						return
+					}
+					if g == 0 {
+						store.Add(fmt.Sprintf("new-%d", i), Vector{float32(i), 3, 2, 1}, nil)
+					}
+				}
+			}(g)
+		}
+
+		var rebuilds sync.WaitGroup
+		for m := 8; m < 12; m++ {
+			rebuilds.Add(1)
+			go func(m int) {
+				defer rebuilds.Done()
+				hnsw := DefaultHNSWConfig()
+				hnsw.M = m
+				if err := store.OptimizeIndexWithConfig(hnsw); err != nil && !errors.Is(err, ErrRebuildInProgress) {
+					t.Error(err)
+				}
+				if err := store.OptimizeIndex(); err != nil && !errors.Is(err, ErrRebuildInProgress) {
+					t.Error(err)
+				}
+			}(m)
+		}
+		rebuilds.Wait()
+		close(stop)
+		wg.Wait()
+
+		if config.HNSW != seeded {
+			t.Fatalf("%d shards: rebuild changed the caller's HNSW config to %+v", shards, config.HNSW)
+		}
+		store.Close()
+	}
+}
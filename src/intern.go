@@ -0,0 +1,197 @@
+package src
+
+import "unsafe"
+
+const (
+	// keySlabSize is the size of the slabs interned keys are packed into
+	keySlabSize = 16 << 10
+	// maxInternedKey is the longest key that is interned
+	maxInternedKey = 1024
+	// keySlabMinLive is the share of a full slab's bytes that must be live
+	// for CompactKeys to leave it alone
+	keySlabMinLive = 0.5
+)
+
+// KeyInternStats reports the memory of interned keys
+type KeyInternStats struct {
+	Keys       int64 // interned keys
+	Slabs      int   // slabs holding them
+	SlabBytes  int64 // memory of the slabs
+	LiveBytes  int64 // bytes of the live keys
+	HeapBytes  int64 // estimated memory of the keys as separate strings
+	BytesSaved int64 // HeapBytes - SlabBytes, negative when interning costs memory
+}
+
+// keySlab is a block of key bytes. Bytes are never rewritten, so strings
+// pointing into a slab stay valid; a slab is freed by the GC once no key
+// points into it
+type keySlab struct {
+	buf  []byte
+	live int64 // bytes of keys still in the cache
+	heap int64 // estimated heap size of those keys as separate strings
+}
+
+// keyArena packs the keys of a cache into shared slabs. Structurally similar
+// keys are small and numerous; as separate strings each is a heap object
+// rounded up to its size class, and a key sliced from a larger buffer keeps
+// the whole buffer alive. Packed keys cost their length only. Deleted keys
+// leave holes, which CompactKeys reclaims by moving the keys of sparse slabs
+type keyArena struct {
+	current *keySlab
+	slabs   map[*keySlab]struct{}
+	keys    int64
+}
+
+func newKeyArena() *keyArena {
+	return &keyArena{slabs: make(map[*keySlab]struct{})}
+}
+
+// intern copies key into a slab and returns the copy and its slab.
+// Keys longer than maxInternedKey are returned as they are with a nil slab
+func (a *keyArena) intern(key string) (string, *keySlab) {
+	n := len(key)
+	if n == 0 || n > maxInternedKey {
+		return key, nil
+	}
+	if a.current == nil || len(a.current.buf)+n > cap(a.current.buf) {
+		a.current = &keySlab{buf: make([]byte, 0, keySlabSize)}
+		a.slabs[a.current] = struct{}{}
+	}
+	s := a.current
+	off := len(s.buf)
+	s.buf = append(s.buf, key...)
+	s.live += int64(n)
+	s.heap += stringAllocSize(n)
+	a.keys++
+	return unsafe.String(&s.buf[off], n), s
+}
+
+// release records that key, interned in slab, left the cache
+func (a *keyArena) release(key string, slab *keySlab) {
+	if slab == nil {
+		return
+	}
+	slab.live -= int64(len(key))
+	slab.heap -= stringAllocSize(len(key))
+	a.keys--
+	if slab.live == 0 && slab != a.current {
+		delete(a.slabs, slab)
+	}
+}
+
+// sparse reports whether slab is full and mostly holes
+func (a *keyArena) sparse(slab *keySlab) bool {
+	return slab != a.current && float64(slab.live) < float64(cap(slab.buf))*keySlabMinLive
+}
+
+// stats returns the arena statistics
+func (a *keyArena) stats() KeyInternStats {
+	st := KeyInternStats{Keys: a.keys, Slabs: len(a.slabs)}
+	for slab := range a.slabs {
+		st.SlabBytes += int64(cap(slab.buf))
+		st.LiveBytes += slab.live
+		st.HeapBytes += slab.heap
+	}
+	st.BytesSaved = st.HeapBytes - st.SlabBytes
+	return st
+}
+
+// stringAllocSize estimates the heap memory of an n-byte string: the
+// allocation rounded up to a runtime size class
+func stringAllocSize(n int) int64 {
+	switch {
+	case n <= 8:
+		return 8
+	case n <= 16:
+		return 16
+	case n <= 32:
+		return int64((n + 7) &^ 7)
+	case n <= 128:
+		return int64((n + 15) &^ 15)
+	case n <= 256:
+		return int64((n + 31) &^ 31)
+	default:
+		return int64((n + 127) &^ 127)
+	}
+}
+
+// internKey interns a new item's key (caller must hold lock)
+func (c *LRUCache) internKey(key string) (string, *keySlab) {
+	if c.arena == nil {
+		return key, nil
+	}
+	return c.arena.intern(key)
+}
+
+// compactKeys moves the keys of sparse slabs into fresh slabs, so the
+// sparse slabs can be freed, and returns the number of keys moved
+func (c *LRUCache) compactKeys() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.arena == nil {
+		return 0
+	}
+
+	moved := 0
+	for _, item := range c.items {
+		if item.slab == nil || !c.arena.sparse(item.slab) {
+			continue
+		}
+		old := item.Key
+		c.arena.release(old, item.slab)
+		item.Key, item.slab = c.arena.intern(old)
+		delete(c.items, old)
+		c.items[item.Key] = item
+		if c.keys != nil {
+			c.keys.remove(old)
+			c.keys.insert(item.Key)
+		}
+		moved++
+	}
+	return moved
+}
+
+// keyInternStats returns the arena statistics
+func (c *LRUCache) keyInternStats() KeyInternStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.arena == nil {
+		return KeyInternStats{}
+	}
+	return c.arena.stats()
+}
+
+// CompactKeys reclaims the slabs left mostly empty by deleted keys and
+// returns the number of keys moved (0 unless Config.InternKeys is set)
+func (c *RistrettoCache) CompactKeys() int {
+	return c.cache.compactKeys()
+}
+
+// KeyInternStats returns the memory of interned keys (zero unless Config.InternKeys is set)
+func (c *RistrettoCache) KeyInternStats() KeyInternStats {
+	return c.cache.keyInternStats()
+}
+
+// CompactKeys reclaims sparse key slabs on every shard
+func (sc *ShardedCacheV2) CompactKeys() int {
+	moved := 0
+	for _, shard := range sc.shards {
+		moved += shard.CompactKeys()
+	}
+	return moved
+}
+
+// KeyInternStats returns the memory of interned keys summed over shards
+func (sc *ShardedCacheV2) KeyInternStats() KeyInternStats {
+	var total KeyInternStats
+	for _, shard := range sc.shards {
+		st := shard.KeyInternStats()
+		total.Keys += st.Keys
+		total.Slabs += st.Slabs
+		total.SlabBytes += st.SlabBytes
+		total.LiveBytes += st.LiveBytes
+		total.HeapBytes += st.HeapBytes
+		total.BytesSaved += st.BytesSaved
+	}
+	return total
+}
@@ -0,0 +1,187 @@
+package src
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// invalidationQueue is the number of invalidations waiting to be published
+const invalidationQueue = 1024
+
+// Invalidation is a message broadcast to the peers of a cache: drop Keys, or
+// everything if Clear is set
+type Invalidation struct {
+	Origin string   `json:"origin"` // InstanceID of the publisher
+	Keys   []string `json:"keys,omitempty"`
+	Clear  bool     `json:"clear,omitempty"`
+}
+
+// Marshal encodes the invalidation as JSON, for buses that carry bytes
+func (inv Invalidation) Marshal() ([]byte, error) {
+	return json.Marshal(inv)
+}
+
+// UnmarshalInvalidation decodes an invalidation encoded by Marshal
+func UnmarshalInvalidation(data []byte) (Invalidation, error) {
+	var inv Invalidation
+	err := json.Unmarshal(data, &inv)
+	return inv, err
+}
+
+// Invalidator is a pub/sub bus shared by the instances of a cache fleet,
+// e.g. a Redis channel or a NATS subject. Subscribe must deliver every
+// message published by any instance, including the subscriber's own
+type Invalidator interface {
+	Publish(ctx context.Context, inv Invalidation) error
+	Subscribe(handler func(Invalidation)) (unsubscribe func(), err error)
+}
+
+// invalidationLink connects a cache to an Invalidator: local deletes are
+// queued and published in batches, messages of other instances are applied
+type invalidationLink struct {
+	bus         Invalidator
+	origin      string
+	queue       chan Invalidation
+	overflow    atomic.Bool // a message was dropped, publish a Clear instead
+	unsubscribe func()
+}
+
+// newInstanceID returns a random instance ID
+func newInstanceID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// startInvalidation subscribes apply to bus and starts the publisher on wg,
+// which runs until stop is closed
+func startInvalidation(bus Invalidator, origin string, apply func(Invalidation), wg *sync.WaitGroup, stop chan struct{}, restarts *atomic.Int64) (*invalidationLink, error) {
+	if origin == "" {
+		origin = newInstanceID()
+	}
+	l := &invalidationLink{
+		bus:    bus,
+		origin: origin,
+		queue:  make(chan Invalidation, invalidationQueue),
+	}
+	unsubscribe, err := bus.Subscribe(func(inv Invalidation) {
+		if inv.Origin != l.origin {
+			apply(inv)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.unsubscribe = unsubscribe
+	goWorker(wg, "invalidator", restarts, func() { l.run(stop) })
+	return l, nil
+}
+
+// publish queues an invalidation. When the queue is full the message is
+// dropped and peers are cleared instead, so they never keep a stale entry
+func (l *invalidationLink) publish(inv Invalidation) {
+	inv.Origin = l.origin
+	select {
+	case l.queue <- inv:
+	default:
+		l.overflow.Store(true)
+	}
+}
+
+// run publishes queued invalidations, merging the keys of messages queued
+// together into one message, until stop is closed
+func (l *invalidationLink) run(stop chan struct{}) {
+	for {
+		select {
+		case inv := <-l.queue:
+			l.send(l.merge(inv))
+		case <-stop:
+			l.unsubscribe()
+			return
+		}
+	}
+}
+
+// merge adds the keys of the messages already queued behind inv
+func (l *invalidationLink) merge(inv Invalidation) Invalidation {
+	for !inv.Clear {
+		select {
+		case next := <-l.queue:
+			inv.Keys = append(inv.Keys, next.Keys...)
+			inv.Clear = next.Clear
+		default:
+			return inv
+		}
+	}
+	return inv
+}
+
+// send publishes inv, or a Clear if messages were dropped
+func (l *invalidationLink) send(inv Invalidation) {
+	if l.overflow.Swap(false) {
+		inv = Invalidation{Origin: l.origin, Clear: true}
+	}
+	if inv.Clear {
+		inv.Keys = nil
+	}
+	if err := l.bus.Publish(context.Background(), inv); err != nil {
+		log.Printf("fastcache: publishing invalidation: %v", err)
+	}
+}
+
+// invalidate publishes keys to the peers of the cache, if it has an Invalidator
+func (c *RistrettoCache) invalidate(keys ...string) {
+	if c.invalidator != nil {
+		c.invalidator.publish(Invalidation{Keys: keys})
+	}
+}
+
+// invalidateOnSet publishes key on a Set if Config.InvalidateOnSet is set
+func (c *RistrettoCache) invalidateOnSet(key string) {
+	if c.config.InvalidateOnSet {
+		c.invalidate(key)
+	}
+}
+
+// applyInvalidation drops the keys of a peer's invalidation without publishing
+func (c *RistrettoCache) applyInvalidation(inv Invalidation) {
+	if inv.Clear {
+		c.cache.Clear()
+		return
+	}
+	for _, key := range inv.Keys {
+		c.delLocal(key)
+	}
+}
+
+// invalidate publishes keys to the peers of the cache, if it has an Invalidator
+func (sc *ShardedCacheV2) invalidate(keys ...string) {
+	if sc.invalidator != nil {
+		sc.invalidator.publish(Invalidation{Keys: keys})
+	}
+}
+
+// invalidateOnSet publishes key on a Set if Config.InvalidateOnSet is set
+func (sc *ShardedCacheV2) invalidateOnSet(key string) {
+	if sc.invalidateSets {
+		sc.invalidate(key)
+	}
+}
+
+// applyInvalidation drops the keys of a peer's invalidation without publishing
+func (sc *ShardedCacheV2) applyInvalidation(inv Invalidation) {
+	if inv.Clear {
+		for _, shard := range sc.shards {
+			shard.cache.Clear()
+		}
+		return
+	}
+	for _, key := range inv.Keys {
+		sc.getShard(key).delLocal(key)
+	}
+}
@@ -0,0 +1,76 @@
+package src
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBus delivers every published invalidation to all subscribers
+type testBus struct {
+	mu       sync.Mutex
+	handlers []func(Invalidation)
+}
+
+func (b *testBus) Publish(_ context.Context, inv Invalidation) error {
+	b.mu.Lock()
+	handlers := append([](func(Invalidation)){}, b.handlers...)
+	b.mu.Unlock()
+	for _, h := range handlers {
+		h(inv)
+	}
+	return nil
+}
+
+func (b *testBus) Subscribe(handler func(Invalidation)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return func() {}, nil
+}
+
+// Bulk and TTL deletes of a sharded cache reach its peers like Del does
+func TestShardedDeletesInvalidatePeers(t *testing.T) {
+	bus := &testBus{}
+	newPeer := func() *ShardedCacheV2 {
+		sc, err := NewShardedCacheV2(4, &Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64, Invalidator: bus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sc.Close() })
+		return sc
+	}
+	a, b := newPeer(), newPeer()
+
+	keys := []string{"user:1", "user:2", "job:1", "job:2", "ttl:1"}
+	for _, sc := range []*ShardedCacheV2{a, b} {
+		for _, key := range keys {
+			sc.Set(key, 1, 1)
+		}
+		sc.Wait()
+	}
+
+	if n := a.DelPrefix("user:"); n != 2 {
+		t.Fatalf("DelPrefix deleted %d keys, want 2", n)
+	}
+	if n, err := a.DelPattern("job:*"); err != nil || n != 2 {
+		t.Fatalf("DelPattern = %d, %v, want 2", n, err)
+	}
+	if !a.Expire("ttl:1", 0) {
+		t.Fatal("Expire(0) on a live key returned false")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for _, key := range keys {
+		for {
+			if !b.Exists(key) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("peer still holds %q", key)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package src
+
+// allKeys returns the keys of all items, live or not, under a single read lock
+func (c *LRUCache) allKeys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]string, 0, len(c.items))
+	for key := range c.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// forEach calls fn for every live item until it returns false. Only the keys
+// are copied up front; each item is read under its own short lock, so fn
+// may call back into the cache
+func (c *LRUCache) forEach(fn func(key string, value any, cost int64, exp int64) bool) {
+	for _, key := range c.allKeys() {
+		item, ok := c.snapshotItem(key)
+		if !ok {
+			continue
+		}
+		if !fn(key, item.Value, item.Cost, item.Expiration) {
+			return
+		}
+	}
+}
+
+// ForEach calls fn for every live entry, with its cost and expiration in
+// Unix nanoseconds (0 if the entry does not expire), until fn returns false.
+// Order is unspecified. fn may read and write the cache; entries written
+// during the iteration may or may not be visited. Range is the ordered,
+// bounded query
+func (c *RistrettoCache) ForEach(fn func(key string, value any, cost int64, exp int64) bool) {
+	c.cache.forEach(fn)
+}
+
+// Keys returns the keys of all live entries, in no particular order
+func (c *RistrettoCache) Keys() []string {
+	var keys []string
+	c.cache.forEach(func(key string, _ any, _ int64, _ int64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// ForEach calls fn for every live entry across all shards, shard by shard,
+// until fn returns false
+func (sc *ShardedCacheV2) ForEach(fn func(key string, value any, cost int64, exp int64) bool) {
+	stopped := false
+	for _, shard := range sc.shards {
+		shard.ForEach(func(key string, value any, cost int64, exp int64) bool {
+			stopped = !fn(key, value, cost, exp)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Keys returns the keys of all live entries across all shards, in no
+// particular order
+func (sc *ShardedCacheV2) Keys() []string {
+	var keys []string
+	for _, shard := range sc.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
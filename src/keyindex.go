@@ -0,0 +1,285 @@
+package src
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// keyIndex is an ordered set of keys kept as a string AVL tree.
+// It is not safe for concurrent use; LRUCache guards it with its own lock.
+type keyIndex struct {
+	root *keyNode
+	size int
+}
+
+type keyNode struct {
+	key         string
+	left, right *keyNode
+	height      int
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{}
+}
+
+func keyHeight(n *keyNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func (n *keyNode) update() {
+	n.height = 1 + max(keyHeight(n.left), keyHeight(n.right))
+}
+
+func rotateKeyLeft(z *keyNode) *keyNode {
+	y := z.right
+	z.right = y.left
+	y.left = z
+	z.update()
+	y.update()
+	return y
+}
+
+func rotateKeyRight(z *keyNode) *keyNode {
+	y := z.left
+	z.left = y.right
+	y.right = z
+	z.update()
+	y.update()
+	return y
+}
+
+func balanceKey(n *keyNode) *keyNode {
+	n.update()
+	switch b := keyHeight(n.left) - keyHeight(n.right); {
+	case b > 1:
+		if keyHeight(n.left.left) < keyHeight(n.left.right) {
+			n.left = rotateKeyLeft(n.left)
+		}
+		return rotateKeyRight(n)
+	case b < -1:
+		if keyHeight(n.right.right) < keyHeight(n.right.left) {
+			n.right = rotateKeyRight(n.right)
+		}
+		return rotateKeyLeft(n)
+	}
+	return n
+}
+
+// insert adds key to the index if it is not present.
+func (t *keyIndex) insert(key string) {
+	var added bool
+	var insert func(n *keyNode) *keyNode
+	insert = func(n *keyNode) *keyNode {
+		if n == nil {
+			added = true
+			return &keyNode{key: key, height: 1}
+		}
+		switch {
+		case key < n.key:
+			n.left = insert(n.left)
+		case key > n.key:
+			n.right = insert(n.right)
+		default:
+			return n
+		}
+		return balanceKey(n)
+	}
+	t.root = insert(t.root)
+	if added {
+		t.size++
+	}
+}
+
+// remove deletes key from the index if it is present.
+func (t *keyIndex) remove(key string) {
+	var removed bool
+	var remove func(n *keyNode, key string) *keyNode
+	remove = func(n *keyNode, key string) *keyNode {
+		if n == nil {
+			return nil
+		}
+		switch {
+		case key < n.key:
+			n.left = remove(n.left, key)
+		case key > n.key:
+			n.right = remove(n.right, key)
+		default:
+			removed = true
+			if n.left == nil {
+				return n.right
+			}
+			if n.right == nil {
+				return n.left
+			}
+			successor := n.right
+			for successor.left != nil {
+				successor = successor.left
+			}
+			n.key = successor.key
+			n.right = remove(n.right, successor.key)
+		}
+		return balanceKey(n)
+	}
+	t.root = remove(t.root, key)
+	if removed {
+		t.size--
+	}
+}
+
+// ascend calls fn for keys >= from in order until fn returns false.
+func (t *keyIndex) ascend(from string, fn func(key string) bool) {
+	var walk func(n *keyNode) bool
+	walk = func(n *keyNode) bool {
+		if n == nil {
+			return true
+		}
+		if n.key >= from {
+			if !walk(n.left) || !fn(n.key) {
+				return false
+			}
+		}
+		return walk(n.right)
+	}
+	walk(t.root)
+}
+
+// KeyValue is an entry returned by ordered key queries.
+type KeyValue struct {
+	Key   string
+	Value any
+}
+
+// rangeEntries returns the live entries with from <= key < to in key order,
+// stopping after limit entries when limit > 0. An empty to means no upper
+// bound. Without a key index it falls back to a full scan.
+func (c *LRUCache) rangeEntries(from, to, prefix string, limit int) []KeyValue {
+	return c.filterEntries(from, to, prefix, nil, limit)
+}
+
+// filterEntries is rangeEntries that also skips keys for which filter
+// returns false. A nil filter keeps every key
+func (c *LRUCache) filterEntries(from, to, prefix string, filter func(key string) bool, limit int) []KeyValue {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now().UnixNano()
+	var out []KeyValue
+	match := func(key string) bool {
+		return key >= from && (to == "" || key < to) && strings.HasPrefix(key, prefix)
+	}
+	live := func(key string) (any, bool) {
+		item, ok := c.items[key]
+		if !ok || (item.Expiration > 0 && now > item.Expiration) {
+			return nil, false
+		}
+		return item.Value, true
+	}
+
+	if c.keys != nil {
+		start := from
+		if prefix > start {
+			start = prefix
+		}
+		c.keys.ascend(start, func(key string) bool {
+			if !match(key) {
+				return false
+			}
+			if filter != nil && !filter(key) {
+				return true
+			}
+			if value, ok := live(key); ok {
+				out = append(out, KeyValue{Key: key, Value: value})
+			}
+			return limit <= 0 || len(out) < limit
+		})
+		return out
+	}
+
+	for key := range c.items {
+		if !match(key) || (filter != nil && !filter(key)) {
+			continue
+		}
+		if value, ok := live(key); ok {
+			out = append(out, KeyValue{Key: key, Value: value})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// ScanPrefix returns the entries whose key starts with prefix, in key order.
+// limit <= 0 returns all of them. With Config.OrderedKeys this runs in
+// O(log n + k); otherwise every key is visited.
+func (c *RistrettoCache) ScanPrefix(prefix string, limit int) []KeyValue {
+	return c.cache.rangeEntries("", "", prefix, limit)
+}
+
+// Range returns the entries with from <= key < to, in key order. An empty
+// to means no upper bound; limit <= 0 returns all of them.
+func (c *RistrettoCache) Range(from, to string, limit int) []KeyValue {
+	return c.cache.rangeEntries(from, to, "", limit)
+}
+
+// DelPrefix deletes every key that starts with prefix and returns the
+// number of deleted keys.
+func (c *RistrettoCache) DelPrefix(prefix string) int {
+	entries := c.ScanPrefix(prefix, 0)
+	for _, e := range entries {
+		c.Del(e.Key)
+	}
+	return len(entries)
+}
+
+// ScanPrefix returns the entries whose key starts with prefix across all
+// shards, in key order. limit <= 0 returns all of them.
+func (sc *ShardedCacheV2) ScanPrefix(prefix string, limit int) []KeyValue {
+	return sc.mergeShards(limit, func(s *RistrettoCache) []KeyValue {
+		return s.ScanPrefix(prefix, limit)
+	})
+}
+
+// Range returns the entries with from <= key < to across all shards, in
+// key order. An empty to means no upper bound; limit <= 0 returns all of them.
+func (sc *ShardedCacheV2) Range(from, to string, limit int) []KeyValue {
+	return sc.mergeShards(limit, func(s *RistrettoCache) []KeyValue {
+		return s.Range(from, to, limit)
+	})
+}
+
+// DelPrefix deletes every key that starts with prefix and returns the
+// number of deleted keys. The deleted keys are published to peers.
+func (sc *ShardedCacheV2) DelPrefix(prefix string) int {
+	var keys []string
+	for _, shard := range sc.shards {
+		for _, e := range shard.ScanPrefix(prefix, 0) {
+			shard.Del(e.Key)
+			sc.audit.Record(context.Background(), AuditDel, e.Key, nil, true)
+			keys = append(keys, e.Key)
+		}
+	}
+	if len(keys) > 0 {
+		sc.invalidate(keys...)
+	}
+	return len(keys)
+}
+
+// mergeShards merges the ordered results of every shard.
+func (sc *ShardedCacheV2) mergeShards(limit int, query func(s *RistrettoCache) []KeyValue) []KeyValue {
+	var out []KeyValue
+	for _, shard := range sc.shards {
+		out = append(out, query(shard)...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrBadPattern is returned for a malformed key pattern
+var ErrBadPattern = errors.New("syntax error in key pattern")
+
+// Key patterns are globs: '*' matches any sequence of characters (including
+// none), '?' matches one character, [abc], [a-z] and [^a-z] match character
+// classes and '\' escapes the next character. Unlike path.Match, '*' also
+// matches '/' and ':'
+
+// patternPrefix returns the literal prefix of a pattern, up to its first
+// special character
+func patternPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// validPattern reports whether every class and escape in pattern is complete
+func validPattern(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i+1 >= len(pattern) {
+				return false
+			}
+			i++
+		case '[':
+			_, n, ok := matchClass(pattern[i:], 0)
+			if !ok {
+				return false
+			}
+			i += n - 1
+		}
+	}
+	return true
+}
+
+// matchPattern reports whether key matches a valid pattern. '*' is matched
+// by backtracking to the last star only, so matching is O(len(pattern) * len(key))
+func matchPattern(pattern, key string) bool {
+	p, k := 0, 0
+	starP, starK := -1, 0
+	for k < len(key) {
+		if p < len(pattern) {
+			switch c := pattern[p]; c {
+			case '*':
+				starP, starK = p, k
+				p++
+				continue
+			case '?':
+				p++
+				k++
+				continue
+			case '[':
+				if matched, n, _ := matchClass(pattern[p:], key[k]); matched {
+					p += n
+					k++
+					continue
+				}
+			case '\\':
+				if pattern[p+1] == key[k] {
+					p += 2
+					k++
+					continue
+				}
+			default:
+				if c == key[k] {
+					p++
+					k++
+					continue
+				}
+			}
+		}
+		// Mismatch: let the last star absorb one more character
+		if starP < 0 {
+			return false
+		}
+		starK++
+		p, k = starP+1, starK
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches c against the class at the start of pattern and
+// returns the length of the class; ok is false if the class is unterminated
+func matchClass(pattern string, c byte) (matched bool, n int, ok bool) {
+	i := 1
+	negate := i < len(pattern) && (pattern[i] == '^' || pattern[i] == '!')
+	if negate {
+		i++
+	}
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+		lo := pattern[i]
+		if lo == '\\' {
+			i++
+			if i >= len(pattern) {
+				return false, 0, false
+			}
+			lo = pattern[i]
+		}
+		i++
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi = pattern[i+1]
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	return false, 0, false
+}
+
+// ScanPattern returns the entries whose key matches a glob pattern such as
+// "user:*:profile", in key order. limit <= 0 returns all of them. With
+// Config.OrderedKeys only the keys sharing the pattern's literal prefix are
+// visited
+func (c *RistrettoCache) ScanPattern(pattern string, limit int) ([]KeyValue, error) {
+	if !validPattern(pattern) {
+		return nil, ErrBadPattern
+	}
+	match := func(key string) bool { return matchPattern(pattern, key) }
+	return c.cache.filterEntries("", "", patternPrefix(pattern), match, limit), nil
+}
+
+// DelPattern deletes every key matching a glob pattern and returns the
+// number of deleted keys
+func (c *RistrettoCache) DelPattern(pattern string) (int, error) {
+	entries, err := c.ScanPattern(pattern, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		c.Del(e.Key)
+	}
+	return len(entries), nil
+}
+
+// ScanPattern returns the entries whose key matches a glob pattern across
+// all shards, in key order. limit <= 0 returns all of them
+func (sc *ShardedCacheV2) ScanPattern(pattern string, limit int) ([]KeyValue, error) {
+	if !validPattern(pattern) {
+		return nil, ErrBadPattern
+	}
+	return sc.mergeShards(limit, func(s *RistrettoCache) []KeyValue {
+		entries, _ := s.ScanPattern(pattern, limit)
+		return entries
+	}), nil
+}
+
+// DelPattern deletes every key matching a glob pattern across all shards
+// and returns the number of deleted keys. The deleted keys are published
+// to peers
+func (sc *ShardedCacheV2) DelPattern(pattern string) (int, error) {
+	if !validPattern(pattern) {
+		return 0, ErrBadPattern
+	}
+	var keys []string
+	for _, shard := range sc.shards {
+		entries, _ := shard.ScanPattern(pattern, 0)
+		for _, e := range entries {
+			shard.Del(e.Key)
+			sc.audit.Record(context.Background(), AuditDel, e.Key, nil, true)
+			keys = append(keys, e.Key)
+		}
+	}
+	if len(keys) > 0 {
+		sc.invalidate(keys...)
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,136 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNoLoader is returned by Load when the cache has no configured Loader
+	ErrNoLoader = errors.New("no loader configured")
+	// ErrLoaderPanic is returned to callers waiting on a load that panicked;
+	// the caller that ran it panics again with the original value.
+	ErrLoaderPanic = errors.New("loader panicked")
+)
+
+// LoaderFunc loads a value on a cache miss, returning the value and its cost
+type LoaderFunc func() (any, int64, error)
+
+// GetOrSet returns the cached value for key, or calls loader and stores its result.
+// Concurrent callers for the same key share a single loader call. Loader errors
+// are returned to every waiting caller and nothing is cached; if the loader
+// panics, waiting callers get ErrLoaderPanic and the panic propagates.
+func (c *RistrettoCache) GetOrSet(key string, loader LoaderFunc) (any, error) {
+	return c.getOrSet(key, 0, loader)
+}
+
+// GetOrSetWithTTL is GetOrSet with a TTL for the loaded value
+func (c *RistrettoCache) GetOrSetWithTTL(key string, ttl time.Duration, loader LoaderFunc) (any, error) {
+	return c.getOrSet(key, ttl, loader)
+}
+
+// Load returns the cached value for key, or loads it with the configured Loader.
+// Concurrent misses on the same key are collapsed into a single Loader call.
+func (c *RistrettoCache) Load(key string) (any, error) {
+	if c.config.Loader == nil {
+		return nil, ErrNoLoader
+	}
+	return c.getOrSet(key, c.config.TTL, func() (any, int64, error) {
+		return c.config.Loader(key)
+	})
+}
+
+func (c *RistrettoCache) getOrSet(key string, ttl time.Duration, loader LoaderFunc) (any, error) {
+	return c.getOrLoad(key, func() (any, int64, time.Duration, error) {
+		value, cost, err := loader()
+		return value, cost, ttl, err
+	})
+}
+
+// getOrLoad is getOrSet with the TTL chosen by the load itself
+func (c *RistrettoCache) getOrLoad(key string, load func() (any, int64, time.Duration, error)) (any, error) {
+	if value, found := c.Get(key); found {
+		return value, nil
+	}
+	return c.loadShared(key, load)
+}
+
+// loadShared runs load for key, or waits for a load of key already in flight,
+// and stores the value
+func (c *RistrettoCache) loadShared(key string, load func() (any, int64, time.Duration, error)) (any, error) {
+	// A load may have completed between the miss and joining;
+	// calls are only forgotten once their value is in the cache.
+	call, leader := c.flights.join(key, func() (any, bool) {
+		item, found := c.cache.Get(key)
+		if !found {
+			return nil, false
+		}
+		return item.Value, true
+	})
+	if !leader {
+		c.metrics.loadsShared.Add(1)
+		<-call.done
+		return call.value, call.err
+	}
+	c.metrics.loads.Add(1)
+
+	stored := false
+	defer func() {
+		if r := recover(); r != nil {
+			// Waiters must not mistake the panic for a load of nil
+			call.value, call.err = nil, fmt.Errorf("%w: %v", ErrLoaderPanic, r)
+			close(call.done)
+			if !stored {
+				c.flights.forget(key)
+			}
+			panic(r)
+		}
+		// Waiters are released with the loaded value right away; the call
+		// stays registered until the value lands in the cache.
+		close(call.done)
+		if !stored {
+			c.flights.forget(key)
+		}
+	}()
+
+	value, cost, ttl, err := load()
+	if err != nil {
+		call.err = err
+		return nil, err
+	}
+	call.value = value
+
+	var expiration int64
+	if ttl > 0 {
+		expiration = time.Now().UnixNano() + int64(ttl)
+	}
+	stored = c.set(&setItem{
+		key:        key,
+		value:      value,
+		cost:       cost,
+		expiration: expiration,
+		internal:   true,
+		done:       func() { c.flights.forget(key) },
+	})
+	return value, nil
+}
+
+// GetOrSet returns the cached value for key, or calls loader and stores its result
+func (sc *ShardedCacheV2) GetOrSet(key string, loader LoaderFunc) (any, error) {
+	return sc.getShard(key).GetOrSet(key, loader)
+}
+
+// GetOrSetWithTTL is GetOrSet with a TTL for the loaded value
+func (sc *ShardedCacheV2) GetOrSetWithTTL(key string, ttl time.Duration, loader LoaderFunc) (any, error) {
+	return sc.getShard(key).GetOrSetWithTTL(key, ttl, loader)
+}
+
+func (sc *ShardedCacheV2) getOrLoad(key string, load func() (any, int64, time.Duration, error)) (any, error) {
+	return sc.getShard(key).getOrLoad(key, load)
+}
+
+// Load returns the cached value for key, or loads it with the configured Loader
+func (sc *ShardedCacheV2) Load(key string) (any, error) {
+	return sc.getShard(key).Load(key)
+}
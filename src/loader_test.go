@@ -0,0 +1,71 @@
+package src
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Callers waiting on a loader that panics get an error, not a nil value
+func TestGetOrSetLoaderPanic(t *testing.T) {
+	c, err := NewRistrettoCache(&Config{NumCounters: 1e3, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	leader := make(chan any, 1)
+	go func() {
+		defer func() { leader <- recover() }()
+		c.GetOrSet("k", func() (any, int64, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	const waiters = 4
+	errs := make(chan error, waiters)
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := c.GetOrSet("k", func() (any, int64, error) { return "late", 1, nil })
+			if err == nil && value == nil {
+				err = errors.New("nil value without an error")
+			}
+			errs <- err
+		}()
+	}
+	// Let the waiters join the call in flight before it panics
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	if r := <-leader; r != "boom" {
+		t.Fatalf("leader recovered %v, want the loader's panic", r)
+	}
+	panicked := 0
+	for err := range errs {
+		// A waiter that joined after the panic runs its own loader
+		if err != nil && !errors.Is(err, ErrLoaderPanic) {
+			t.Fatalf("waiter got %v, want ErrLoaderPanic", err)
+		}
+		if err != nil {
+			panicked++
+		}
+	}
+	if panicked == 0 {
+		t.Fatal("no caller waited on the panicking load")
+	}
+
+	// The key is not stuck: the next load runs
+	if value, err := c.GetOrSet("k", func() (any, int64, error) { return "v", 1, nil }); err != nil || value == nil {
+		t.Fatalf("GetOrSet after the panic = %v, %v", value, err)
+	}
+}
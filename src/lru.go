@@ -2,7 +2,9 @@ package src
 
 import (
 	"container/list"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +15,23 @@ type CacheItem struct {
 	Cost       int64
 	Expiration int64 // expiration time in nanoseconds, 0 means no expiration
 	element    *list.Element // element in LRU linked list
+	stamp      uint64        // write stamp, changes on every value update
+	inWindow   bool          // item is in the window segment
+	heapIndex  int           // position in the expiration heap + 1, 0 if not in it
+	sliding    int64         // TTL in nanoseconds renewed on every read, 0 if the TTL is fixed
+	inRecent   bool          // item is in the ARC recent list
+	lifetime   int64         // TTL in nanoseconds the expiration was set with, 0 if none
+	slab       *keySlab      // slab holding the interned key, nil if not interned
+	mainIndex  int           // position in LRUCache.main + 1, 0 if not in the main segment
+	protected  bool          // item is in the protected part of the main segment
+}
+
+// itemStamps issues write stamps, so a reader can detect that an entry was
+// rewritten without comparing values
+var itemStamps atomic.Uint64
+
+func nextItemStamp() uint64 {
+	return itemStamps.Add(1)
 }
 
 // LRUCache LRU cache implementation
@@ -22,6 +41,120 @@ type LRUCache struct {
 	list    *list.List // doubly linked list, head is most recently used
 	cost    int64
 	maxCost int64
+	keys    *keyIndex // ordered key index, nil unless enabled
+
+	// main holds the items of the main segment in no particular order, so
+	// Sample can pick random items without walking the list
+	main []*CacheItem
+
+	// window segment for W-TinyLFU: new items enter here and compete for
+	// the main segment once it overflows. nil unless enabled
+	window        *list.List
+	windowCost    int64
+	windowMaxCost int64
+
+	// protected part of the main segment, enabled with the window: items
+	// read again while in the main list (probation) move here, and the
+	// protected overflow moves back to the front of probation, so keys
+	// leaving the window compete with the probation tail. nil unless enabled
+	protectedList    *list.List
+	protectedCost    int64
+	protectedMaxCost int64
+
+	expiries expiryHeap // items with an expiration, soonest first
+
+	// ARC replacement state, nil unless enabled. The main list then holds
+	// items that were accessed more than once
+	arc *arcState
+
+	// arena packs keys into shared slabs, nil unless key interning is enabled
+	arena *keyArena
+
+	// changed holds keys removed or re-timed since the last snapshot, nil
+	// unless delta snapshots are enabled. Value writes are found by stamp
+	changed map[string]struct{}
+}
+
+// enableWindow routes new items through a window segment of maxCost
+func (c *LRUCache) enableWindow(maxCost int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.window = list.New()
+	c.windowMaxCost = maxCost
+	c.protectedList = list.New()
+	c.protectedMaxCost = protectedCost(c.maxCost, maxCost)
+}
+
+// DefaultProtectedRatio is the share of the main segment kept for items read
+// again after they entered it
+const DefaultProtectedRatio = 0.8
+
+// protectedCost returns the protected budget of a main segment that holds
+// what the window leaves of maxCost
+func protectedCost(maxCost, windowMaxCost int64) int64 {
+	return int64(float64(maxCost-windowMaxCost) * DefaultProtectedRatio)
+}
+
+// resize changes the cost limits used by the LRU's own evictions, the
+// window and ARC; the caller evicts the excess
+func (c *LRUCache) resize(maxCost, windowMaxCost int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxCost = maxCost
+	if c.window != nil {
+		c.windowMaxCost = windowMaxCost
+		c.protectedMaxCost = protectedCost(maxCost, windowMaxCost)
+		c.demoteProtected()
+	}
+	if c.arc != nil {
+		c.arc.target = min(c.arc.target, maxCost)
+	}
+}
+
+// listOf returns the segment holding item
+func (c *LRUCache) listOf(item *CacheItem) *list.List {
+	if item.inWindow {
+		return c.window
+	}
+	if item.inRecent {
+		return c.arc.recent
+	}
+	if item.protected {
+		return c.protectedList
+	}
+	return c.list
+}
+
+// touch moves an accessed item to the front of its segment; with ARC it
+// moves to the front of the main list, and a probation item moves to the
+// protected list (caller must hold lock)
+func (c *LRUCache) touch(item *CacheItem) {
+	if c.arc != nil {
+		c.arcTouch(item)
+		return
+	}
+	if c.protectedList == nil || item.inWindow || item.protected {
+		c.listOf(item).MoveToFront(item.element)
+		return
+	}
+	c.list.Remove(item.element)
+	item.element = c.protectedList.PushFront(item)
+	item.protected = true
+	c.protectedCost += item.Cost
+	c.demoteProtected()
+}
+
+// demoteProtected moves the least recently used protected items back to the
+// front of probation until the protected list fits its budget (caller must
+// hold lock)
+func (c *LRUCache) demoteProtected() {
+	for c.protectedCost > c.protectedMaxCost && c.protectedList.Len() > 1 {
+		item := c.protectedList.Back().Value.(*CacheItem)
+		c.protectedList.Remove(item.element)
+		c.protectedCost -= item.Cost
+		item.protected = false
+		item.element = c.list.PushFront(item)
+	}
 }
 
 // NewLRUCache creates a new LRU cache
@@ -35,37 +168,102 @@ func NewLRUCache(maxCost int64) *LRUCache {
 
 // Add adds an item to the cache
 func (c *LRUCache) Add(key string, value any, cost int64, expiration int64) {
+	c.add(key, value, cost, expiration, 0)
+}
+
+// add adds an item whose TTL slides by sliding nanoseconds on every read
+func (c *LRUCache) add(key string, value any, cost int64, expiration int64, sliding int64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// Update if exists
 	if item, ok := c.items[key]; ok {
-		c.cost -= item.Cost
-		c.cost += cost
+		c.setCost(item, cost)
 		item.Value = value
-		item.Cost = cost
 		item.Expiration = expiration
-		c.list.MoveToFront(item.element)
+		item.sliding = sliding
+		item.lifetime = lifetime(expiration)
+		c.trackExpiration(item)
+		item.stamp = nextItemStamp()
+		c.touch(item)
 		return
 	}
 
 	// Get item from pool
 	item := GetCacheItem()
+	key, item.slab = c.internKey(key)
 	item.Key = key
 	item.Value = value
 	item.Cost = cost
 	item.Expiration = expiration
+	item.sliding = sliding
+	item.lifetime = lifetime(expiration)
+	c.trackExpiration(item)
+	item.stamp = nextItemStamp()
 
-	item.element = c.list.PushFront(item)
+	if c.window != nil {
+		item.inWindow = true
+		item.element = c.window.PushFront(item)
+		c.windowCost += cost
+	} else if c.arc != nil {
+		c.arcInsert(item)
+	} else {
+		c.pushMain(item)
+	}
 	c.items[key] = item
 	c.cost += cost
+	if c.keys != nil {
+		c.keys.insert(key)
+	}
 
 	// Evict if over max cost
-	for c.cost > c.maxCost && c.list.Len() > 0 {
+	for c.cost > c.maxCost && len(c.items) > 0 {
 		c.evictOldest()
 	}
 }
 
+// setCost changes the cost of an item (caller must hold lock)
+func (c *LRUCache) setCost(item *CacheItem, cost int64) {
+	c.cost += cost - item.Cost
+	if item.inWindow {
+		c.windowCost += cost - item.Cost
+	}
+	if item.inRecent {
+		c.arc.recentCost += cost - item.Cost
+	}
+	if item.protected {
+		c.protectedCost += cost - item.Cost
+	}
+	item.Cost = cost
+}
+
+// Replace updates an existing item and moves it to the front of its segment.
+// It returns the previous value, or false if the key is missing
+func (c *LRUCache) Replace(key string, value any, cost int64, expiration int64) (any, bool) {
+	return c.replace(key, value, cost, expiration, 0)
+}
+
+// replace is Replace with a sliding TTL
+func (c *LRUCache) replace(key string, value any, cost int64, expiration int64, sliding int64) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	old := item.Value
+	c.setCost(item, cost)
+	item.Value = value
+	item.Expiration = expiration
+	item.sliding = sliding
+	item.lifetime = lifetime(expiration)
+	c.trackExpiration(item)
+	item.stamp = nextItemStamp()
+	c.touch(item)
+	return old, true
+}
+
 // Get gets an item (read-only, does not update LRU)
 func (c *LRUCache) Get(key string) (*CacheItem, bool) {
 	c.mu.RLock()
@@ -95,16 +293,54 @@ func (c *LRUCache) GetAndUpdate(key string) (*CacheItem, bool) {
 	}
 
 	// Check expiration
-	if item.Expiration > 0 && time.Now().UnixNano() > item.Expiration {
+	now := time.Now().UnixNano()
+	if item.Expiration > 0 && now > item.Expiration {
 		c.removeElement(item)
 		return nil, false
 	}
 
+	// Renew sliding TTL
+	if item.sliding > 0 {
+		item.Expiration = now + item.sliding
+		c.trackExpiration(item)
+	}
+
 	// Move to front
-	c.list.MoveToFront(item.element)
+	c.touch(item)
 	return item, true
 }
 
+// SetExpiration updates the expiration of an item without touching its value
+// or LRU position. It returns false if the item is missing or already expired.
+func (c *LRUCache) SetExpiration(key string, expiration int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	if item.Expiration > 0 && time.Now().UnixNano() > item.Expiration {
+		return false
+	}
+	item.Expiration = expiration
+	item.sliding = 0
+	item.lifetime = lifetime(expiration)
+	c.trackExpiration(item)
+	if c.changed != nil {
+		c.changed[key] = struct{}{}
+	}
+	return true
+}
+
+// lifetime returns the TTL an expiration set now stands for, 0 if none
+func lifetime(expiration int64) int64 {
+	if expiration <= 0 {
+		return 0
+	}
+	return expiration - time.Now().UnixNano()
+}
+
 // Delete removes an item from the cache
 func (c *LRUCache) Delete(key string) (any, bool) {
 	c.mu.Lock()
@@ -115,26 +351,223 @@ func (c *LRUCache) Delete(key string) (any, bool) {
 		return nil, false
 	}
 
+	// Capture the value before the item is returned to the pool.
+	value := item.Value
 	c.removeElement(item)
-	return item.Value, true
+	return value, true
+}
+
+// evictedEntry is a copy of an entry removed from the cache,
+// taken before the item is returned to the pool.
+type evictedEntry struct {
+	key   string
+	value any
+	cost  int64
+}
+
+// DeleteExpired removes all items that expired before now and returns them.
+// Only expired items are visited, in expiration order.
+func (c *LRUCache) DeleteExpired(now int64) []evictedEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expired []evictedEntry
+	for len(c.expiries) > 0 && now > c.expiries[0].Expiration {
+		item := c.expiries[0]
+		expired = append(expired, evictedEntry{key: item.Key, value: item.Value, cost: item.Cost})
+		c.removeElement(item)
+	}
+	return expired
+}
+
+// removeExpired removes key if it expired before now and returns a copy of it
+func (c *LRUCache) removeExpired(key string, now int64) (evictedEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || item.Expiration <= 0 || now <= item.Expiration {
+		return evictedEntry{}, false
+	}
+	e := evictedEntry{key: item.Key, value: item.Value, cost: item.Cost}
+	c.removeElement(item)
+	return e, true
 }
 
 // removeElement removes an element from the cache
 func (c *LRUCache) removeElement(item *CacheItem) {
 	if item.element != nil {
-		c.list.Remove(item.element)
+		c.listOf(item).Remove(item.element)
+	}
+	if item.inWindow {
+		c.windowCost -= item.Cost
+		item.inWindow = false
+	}
+	if item.inRecent {
+		c.arc.recentCost -= item.Cost
+		item.inRecent = false
+	}
+	if item.protected {
+		c.protectedCost -= item.Cost
+		item.protected = false
 	}
+	c.dropMain(item)
+	c.untrackExpiration(item)
 	delete(c.items, item.Key)
+	if c.changed != nil {
+		c.changed[item.Key] = struct{}{}
+	}
 	c.cost -= item.Cost
+	if c.keys != nil {
+		c.keys.remove(item.Key)
+	}
+	if c.arena != nil {
+		c.arena.release(item.Key, item.slab)
+		item.slab = nil
+	}
 	// Return item to pool
 	PutCacheItem(item)
 }
 
+// oldest returns the least recently used item of the main segment,
+// probation first, falling back to the window, or the ARC victim (caller
+// must hold lock)
+func (c *LRUCache) oldest() *CacheItem {
+	if c.arc != nil {
+		return c.arcVictim()
+	}
+	if item := c.mainTail(); item != nil {
+		return item
+	}
+	if c.window != nil {
+		if elem := c.window.Back(); elem != nil {
+			return elem.Value.(*CacheItem)
+		}
+	}
+	return nil
+}
+
+// mainTail returns the least recently used item of probation, or of the
+// protected list if probation is empty (caller must hold lock)
+func (c *LRUCache) mainTail() *CacheItem {
+	if elem := c.list.Back(); elem != nil {
+		return elem.Value.(*CacheItem)
+	}
+	if c.protectedList != nil {
+		if elem := c.protectedList.Back(); elem != nil {
+			return elem.Value.(*CacheItem)
+		}
+	}
+	return nil
+}
+
+// mainVictim returns the key at the LRU end of the main segment, "" if it is
+// empty
+func (c *LRUCache) mainVictim() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if item := c.mainTail(); item != nil {
+		return item.Key
+	}
+	return ""
+}
+
 // evictOldest evicts the oldest item
 func (c *LRUCache) evictOldest() {
-	if elem := c.list.Back(); elem != nil {
-		item := elem.Value.(*CacheItem)
+	if item := c.oldest(); item != nil {
+		c.removeEvicted(item)
+	}
+}
+
+// removeEvicted removes an item chosen for eviction; ARC remembers its key
+// in a ghost list (caller must hold lock)
+func (c *LRUCache) removeEvicted(item *CacheItem) {
+	if c.arc == nil {
 		c.removeElement(item)
+		return
+	}
+	key, cost, recent := item.Key, item.Cost, item.inRecent
+	c.removeElement(item)
+	c.arcRemember(key, cost, recent)
+}
+
+// RemoveOldest removes the oldest item and returns a copy of it
+func (c *LRUCache) RemoveOldest() (CacheItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item := c.oldest()
+	if item == nil {
+		return CacheItem{}, false
+	}
+	removed := CacheItem{Key: item.Key, Value: item.Value, Cost: item.Cost, Expiration: item.Expiration}
+	c.removeEvicted(item)
+	return removed, true
+}
+
+// Remove removes key and returns a copy of its item
+func (c *LRUCache) Remove(key string) (CacheItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return CacheItem{}, false
+	}
+	removed := CacheItem{Key: item.Key, Value: item.Value, Cost: item.Cost, Expiration: item.Expiration}
+	c.removeElement(item)
+	return removed, true
+}
+
+// windowCandidate returns the key that would leave the window if an item of
+// cost incoming were added, or "" if the window has room
+func (c *LRUCache) windowCandidate(incoming int64) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.window == nil || c.windowCost+incoming <= c.windowMaxCost {
+		return ""
+	}
+	if elem := c.window.Back(); elem != nil {
+		return elem.Value.(*CacheItem).Key
+	}
+	return ""
+}
+
+// promote moves key from the window to the front of the main segment
+func (c *LRUCache) promote(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || !item.inWindow {
+		return
+	}
+	c.window.Remove(item.element)
+	c.windowCost -= item.Cost
+	item.inWindow = false
+	c.pushMain(item)
+}
+
+// promoteOverflow moves the oldest window items to the main segment until
+// the window fits its budget
+func (c *LRUCache) promoteOverflow() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.window == nil {
+		return
+	}
+	for c.windowCost > c.windowMaxCost {
+		elem := c.window.Back()
+		if elem == nil {
+			return
+		}
+		item := elem.Value.(*CacheItem)
+		c.window.Remove(elem)
+		c.windowCost -= item.Cost
+		item.inWindow = false
+		c.pushMain(item)
 	}
 }
 
@@ -156,9 +589,31 @@ func (c *LRUCache) Cost() int64 {
 func (c *LRUCache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	for key := range c.items {
+		if c.changed != nil {
+			c.changed[key] = struct{}{}
+		}
+	}
 	c.items = make(map[string]*CacheItem)
 	c.list.Init()
+	c.main = nil
 	c.cost = 0
+	c.expiries = nil
+	if c.window != nil {
+		c.window.Init()
+		c.windowCost = 0
+		c.protectedList.Init()
+		c.protectedCost = 0
+	}
+	if c.arc != nil {
+		c.arcReset()
+	}
+	if c.keys != nil {
+		c.keys = newKeyIndex()
+	}
+	if c.arena != nil {
+		c.arena = newKeyArena()
+	}
 }
 
 // Items returns all items (for iteration)
@@ -173,6 +628,119 @@ func (c *LRUCache) Items() []*CacheItem {
 	return items
 }
 
+// Sample calls fn for n distinct keys of the main segment chosen uniformly at
+// random, in O(n) and without copying the item set
+func (c *LRUCache) Sample(n int, fn func(key string)) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	size := len(c.main)
+	if n > size {
+		n = size
+	}
+	if n <= 0 {
+		return
+	}
+
+	// Floyd's algorithm: n distinct positions in [0, size)
+	positions := make([]int, 0, n)
+	for j := size - n; j < size; j++ {
+		p := rand.Intn(j + 1)
+		if containsInt(positions, p) {
+			p = j
+		}
+		positions = append(positions, p)
+		fn(c.main[p].Key)
+	}
+}
+
+// pushMain adds item to the front of the main segment (caller must hold lock)
+func (c *LRUCache) pushMain(item *CacheItem) {
+	item.element = c.list.PushFront(item)
+	c.main = append(c.main, item)
+	item.mainIndex = len(c.main)
+}
+
+// dropMain removes item from the sampling index of the main segment by
+// moving the last item into its place (caller must hold lock)
+func (c *LRUCache) dropMain(item *CacheItem) {
+	if item.mainIndex == 0 {
+		return
+	}
+	i, last := item.mainIndex-1, len(c.main)-1
+	c.main[i] = c.main[last]
+	c.main[i].mainIndex = i + 1
+	c.main[last] = nil
+	c.main = c.main[:last]
+	item.mainIndex = 0
+}
+
+func containsInt(s []int, v int) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotItem returns a copy of a live item, including its write stamp
+func (c *LRUCache) snapshotItem(key string) (CacheItem, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.items[key]
+	if !ok || (item.Expiration > 0 && time.Now().UnixNano() > item.Expiration) {
+		return CacheItem{}, false
+	}
+	return CacheItem{Key: item.Key, Value: item.Value, Cost: item.Cost, Expiration: item.Expiration, stamp: item.stamp}, true
+}
+
+// replaceIf replaces the value and cost of key if it has not been written
+// since stamp was read. Expiration and LRU position are kept. A larger cost
+// may leave the cache over its limit, see RistrettoCache.replaceIfSync
+func (c *LRUCache) replaceIf(key string, stamp uint64, value any, cost int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || item.stamp != stamp {
+		return false
+	}
+	c.setCost(item, cost)
+	item.Value = value
+	item.stamp = nextItemStamp()
+	return true
+}
+
+// Entries returns copies of all items, from least to most recently used
+func (c *LRUCache) Entries() []CacheItem {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]CacheItem, 0, len(c.items))
+	// The window holds the most recently added items
+	lists := []*list.List{c.list, c.protectedList, c.window}
+	if c.arc != nil {
+		lists = []*list.List{c.arc.recent, c.list}
+	}
+	for _, l := range lists {
+		if l == nil {
+			continue
+		}
+		for e := l.Back(); e != nil; e = e.Prev() {
+			item := e.Value.(*CacheItem)
+			entries = append(entries, CacheItem{
+				Key:        item.Key,
+				Value:      item.Value,
+				Cost:       item.Cost,
+				Expiration: item.Expiration,
+			})
+		}
+	}
+	return entries
+}
+
 // GetItem returns the internal item map (for advanced operations)
 func (c *LRUCache) GetItem(key string) (*CacheItem, bool) {
 	c.mu.RLock()
@@ -186,7 +754,8 @@ func (c *LRUCache) RemoveElement(item *CacheItem) {
 	c.removeElement(item)
 }
 
-// GetList returns the list (caller must hold lock)
+// GetList returns the probation list of the main segment, which is all of it
+// without a window (caller must hold lock)
 func (c *LRUCache) GetList() *list.List {
 	return c.list
 }
@@ -0,0 +1,114 @@
+package src
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+)
+
+// checkMainIndex verifies that the sampling index holds exactly the items of
+// the main segment, probation and protected
+func checkMainIndex(t *testing.T, c *LRUCache) {
+	t.Helper()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	lists := []*list.List{c.list}
+	if c.protectedList != nil {
+		lists = append(lists, c.protectedList)
+	}
+	size, protectedCost := 0, int64(0)
+	for _, l := range lists {
+		size += l.Len()
+		for e := l.Front(); e != nil; e = e.Next() {
+			item := e.Value.(*CacheItem)
+			if item.mainIndex == 0 || c.main[item.mainIndex-1] != item {
+				t.Fatalf("item %q is not at its index %d", item.Key, item.mainIndex)
+			}
+			if item.protected != (l == c.protectedList) {
+				t.Fatalf("item %q has protected %v in the wrong list", item.Key, item.protected)
+			}
+			if item.protected {
+				protectedCost += item.Cost
+			}
+		}
+	}
+	if len(c.main) != size {
+		t.Fatalf("sampling index holds %d items, main segment %d", len(c.main), size)
+	}
+	if protectedCost != c.protectedCost {
+		t.Fatalf("protected cost %d, items add up to %d", c.protectedCost, protectedCost)
+	}
+}
+
+func TestLRUSampleIndexFollowsSegments(t *testing.T) {
+	for _, policy := range []EvictionPolicy{PolicyTinyLFU, PolicyARC} {
+		t.Run(string(policy), func(t *testing.T) {
+			c, err := NewRistrettoCache(&Config{NumCounters: 1e4, MaxCost: 200, BufferItems: 64, Policy: policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			for i := 0; i < 2000; i++ {
+				c.Set(fmt.Sprint(i%400), i, 1)
+				if i%3 == 0 {
+					c.Get(fmt.Sprint(i % 50))
+				}
+				if i%7 == 0 {
+					c.Del(fmt.Sprint(i % 300))
+				}
+				if i%100 == 0 {
+					c.Wait()
+					checkMainIndex(t, c.cache)
+				}
+			}
+			c.Wait()
+			checkMainIndex(t, c.cache)
+			c.Clear()
+			checkMainIndex(t, c.cache)
+		})
+	}
+}
+
+func TestLRUSampleIsDistinctAndUniform(t *testing.T) {
+	c := NewLRUCache(1 << 20)
+	const size = 100
+	for i := 0; i < size; i++ {
+		c.Add(fmt.Sprint(i), i, 1, 0)
+	}
+	counts := make(map[string]int)
+	const rounds = 20000
+	for r := 0; r < rounds; r++ {
+		seen := make(map[string]bool)
+		c.Sample(5, func(key string) {
+			if seen[key] {
+				t.Fatalf("key %q sampled twice", key)
+			}
+			seen[key] = true
+			counts[key]++
+		})
+		if len(seen) != 5 {
+			t.Fatalf("sampled %d keys, want 5", len(seen))
+		}
+	}
+	// Each key is expected rounds*5/size = 1000 times
+	for i := 0; i < size; i++ {
+		if n := counts[fmt.Sprint(i)]; n < 800 || n > 1200 {
+			t.Fatalf("key %d sampled %d times, want about 1000", i, n)
+		}
+	}
+}
+
+func BenchmarkLRUSample(b *testing.B) {
+	for _, size := range []int{1_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			c := NewLRUCache(int64(size))
+			for i := 0; i < size; i++ {
+				c.Add(fmt.Sprint(i), i, 1, 0)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Sample(DefaultSampleSize, func(string) {})
+			}
+		})
+	}
+}
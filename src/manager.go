@@ -0,0 +1,334 @@
+package src
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrInstanceExists is returned when a Manager already has an instance of that name
+	ErrInstanceExists = errors.New("instance already exists")
+	// ErrUnknownInstance is returned when a Manager has no instance of that name
+	ErrUnknownInstance = errors.New("unknown instance")
+)
+
+// Instance kinds reported by Manager.Stats
+const (
+	KindCache        = "cache"
+	KindShardedCache = "sharded"
+	KindVectorStore  = "vector"
+)
+
+// managedInstance is a named instance owned by a Manager. Exactly one of
+// its fields is set
+type managedInstance struct {
+	cache   *RistrettoCache
+	sharded *ShardedCacheV2
+	vectors *VectorCache
+}
+
+// kind returns the instance kind
+func (mi *managedInstance) kind() string {
+	switch {
+	case mi.cache != nil:
+		return KindCache
+	case mi.sharded != nil:
+		return KindShardedCache
+	default:
+		return KindVectorStore
+	}
+}
+
+// caches returns the RistrettoCaches backing the instance
+func (mi *managedInstance) caches() []*RistrettoCache {
+	switch {
+	case mi.cache != nil:
+		return []*RistrettoCache{mi.cache}
+	case mi.sharded != nil:
+		return mi.sharded.shards
+	default:
+		return mi.vectors.caches()
+	}
+}
+
+// close closes the instance
+func (mi *managedInstance) close() error {
+	switch {
+	case mi.cache != nil:
+		return mi.cache.Close()
+	case mi.sharded != nil:
+		return mi.sharded.Close()
+	default:
+		return mi.vectors.Close()
+	}
+}
+
+// Manager owns named caches and vector stores. They share one memory
+// budget: when they together exceed it, the instance shard holding the most
+// cost evicts. Soft quotas alert before that happens. Metrics are aggregated
+// across instances and Close closes them all
+type Manager struct {
+	mu        sync.RWMutex
+	budget    *costBudget
+	instances map[string]*managedInstance
+
+	quotas        map[string]*quotaState
+	onQuotaAlert  func(QuotaAlert)
+	watch         sync.Once
+	watchRestarts atomic.Int64
+	stopCh        chan struct{}
+	stopOnce      sync.Once
+	wg            sync.WaitGroup
+}
+
+// NewManager creates a manager whose instances share maxCost
+// (no shared limit if 0, each instance keeps its own MaxCost)
+func NewManager(maxCost int64) *Manager {
+	m := &Manager{
+		instances: make(map[string]*managedInstance),
+		quotas:    make(map[string]*quotaState),
+		stopCh:    make(chan struct{}),
+	}
+	if maxCost > 0 {
+		m.budget = newCostBudget(maxCost)
+	}
+	return m
+}
+
+// register adds an instance created by create under name
+func (m *Manager) register(name string, create func() (*managedInstance, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.instances[name]; ok {
+		return ErrInstanceExists
+	}
+	mi, err := create()
+	if err != nil {
+		return err
+	}
+	if m.budget != nil && mi.vectors == nil {
+		// Vector stores join through their config
+		for _, c := range mi.caches() {
+			m.budget.join(c)
+		}
+	}
+	m.instances[name] = mi
+	return nil
+}
+
+// cacheConfig returns a copy of config whose MaxCost defaults to the budget
+func (m *Manager) cacheConfig(config *Config) *Config {
+	cfg := defaultConfig()
+	if config != nil {
+		*cfg = *config
+	}
+	if m.budget != nil && (config == nil || config.MaxCost <= 0) {
+		cfg.MaxCost = m.budget.max
+	}
+	return cfg
+}
+
+// NewCache creates a cache named name. A nil config uses the defaults,
+// with MaxCost set to the shared budget
+func (m *Manager) NewCache(name string, config *Config) (*RistrettoCache, error) {
+	var c *RistrettoCache
+	err := m.register(name, func() (*managedInstance, error) {
+		var err error
+		c, err = NewRistrettoCache(m.cacheConfig(config))
+		return &managedInstance{cache: c}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewShardedCache creates a sharded cache named name
+func (m *Manager) NewShardedCache(name string, shardCount int, config *Config) (*ShardedCacheV2, error) {
+	var sc *ShardedCacheV2
+	err := m.register(name, func() (*managedInstance, error) {
+		var err error
+		sc, err = NewShardedCacheV2(shardCount, m.cacheConfig(config))
+		return &managedInstance{sharded: sc}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// NewVectorStore creates a vector store named name. A nil config uses
+// DefaultVectorStoreConfig, with MaxCost set to the shared budget
+func (m *Manager) NewVectorStore(name string, config *VectorStoreConfig) (*VectorCache, error) {
+	cfg := DefaultVectorStoreConfig()
+	if config != nil {
+		cfg = *config
+	}
+	if m.budget != nil && (config == nil || config.MaxCost <= 0) {
+		cfg.MaxCost = m.budget.max
+	}
+	cfg.budget = m.budget
+
+	var vc *VectorCache
+	err := m.register(name, func() (*managedInstance, error) {
+		var err error
+		vc, err = NewVectorStore(&cfg)
+		return &managedInstance{vectors: vc}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
+
+// instance returns the instance named name
+func (m *Manager) instance(name string) (*managedInstance, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mi, ok := m.instances[name]
+	return mi, ok
+}
+
+// Cache returns the cache named name
+func (m *Manager) Cache(name string) (*RistrettoCache, bool) {
+	mi, ok := m.instance(name)
+	if !ok || mi.cache == nil {
+		return nil, false
+	}
+	return mi.cache, true
+}
+
+// ShardedCache returns the sharded cache named name
+func (m *Manager) ShardedCache(name string) (*ShardedCacheV2, bool) {
+	mi, ok := m.instance(name)
+	if !ok || mi.sharded == nil {
+		return nil, false
+	}
+	return mi.sharded, true
+}
+
+// VectorStore returns the vector store named name
+func (m *Manager) VectorStore(name string) (*VectorCache, bool) {
+	mi, ok := m.instance(name)
+	if !ok || mi.vectors == nil {
+		return nil, false
+	}
+	return mi.vectors, true
+}
+
+// Names returns the instance names, sorted
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.instances))
+	for name := range m.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove closes the instance named name and releases its share of the budget
+func (m *Manager) Remove(name string) error {
+	m.mu.Lock()
+	mi, ok := m.instances[name]
+	delete(m.instances, name)
+	delete(m.quotas, name)
+	m.mu.Unlock()
+	if !ok {
+		return ErrUnknownInstance
+	}
+	return mi.close()
+}
+
+// Cost returns the total cost of all instances
+func (m *Manager) Cost() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var total int64
+	for _, mi := range m.instances {
+		for _, c := range mi.caches() {
+			total += c.Cost()
+		}
+	}
+	return total
+}
+
+// MaxCost returns the shared budget, 0 if there is none
+func (m *Manager) MaxCost() int64 {
+	if m.budget == nil {
+		return 0
+	}
+	return m.budget.max
+}
+
+// Metrics returns the metrics of all instances added together
+func (m *Manager) Metrics() *Metrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	total := &Metrics{}
+	for _, mi := range m.instances {
+		if mi.sharded != nil {
+			total.merge(mi.sharded.Metrics())
+			continue
+		}
+		for _, c := range mi.caches() {
+			total.merge(c.Metrics())
+		}
+	}
+	return total
+}
+
+// Stats returns the kind, length and cost of every instance and the totals
+func (m *Manager) Stats() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var totalCost int64
+	var totalLen int
+	instances := make(map[string]interface{}, len(m.instances))
+	for name, mi := range m.instances {
+		var cost int64
+		var n int
+		for _, c := range mi.caches() {
+			cost += c.Cost()
+			n += c.Len()
+		}
+		totalCost += cost
+		totalLen += n
+		instances[name] = map[string]interface{}{
+			"kind": mi.kind(),
+			"len":  n,
+			"cost": cost,
+		}
+	}
+
+	return map[string]interface{}{
+		"instances": instances,
+		"len":       totalLen,
+		"cost":      totalCost,
+		"maxCost":   m.MaxCost(),
+	}
+}
+
+// Close stops the quota watcher, closes every instance and returns the first error
+func (m *Manager) Close() error {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+	m.wg.Wait()
+
+	m.mu.Lock()
+	instances := m.instances
+	m.instances = make(map[string]*managedInstance)
+	m.quotas = make(map[string]*quotaState)
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, mi := range instances {
+		if err := mi.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
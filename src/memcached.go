@@ -0,0 +1,556 @@
+package src
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMemcachedMaxValueSize is the default largest value accepted by set.
+const DefaultMemcachedMaxValueSize = 1 << 20
+
+// memcachedRelativeLimit is the largest exptime treated as relative seconds;
+// larger values are absolute Unix timestamps, as in memcached.
+const memcachedRelativeLimit = 60 * 60 * 24 * 30
+
+// Protocol limits, as in memcached.
+const (
+	// memcachedMaxKeyLength is the longest key accepted.
+	memcachedMaxKeyLength = 250
+	// memcachedMaxLineLength is the longest command line accepted; a longer
+	// line closes the connection.
+	memcachedMaxLineLength = 8 << 10
+)
+
+// memcachedItem is a value stored through the memcached protocol.
+type memcachedItem struct {
+	flags uint32
+	data  []byte
+}
+
+// MemcachedServer serves the memcached text protocol (get, gets, set, cas,
+// delete, incr, decr, touch) over a ShardedCacheV2, so existing memcached
+// clients can use fastcache unchanged.
+//
+// With a Policy, each command is authorized with the token of its
+// connection: Token, or the one sent with "auth <token>", which clients
+// without that command cannot send. get and gets need PermRead on each key
+// and the other commands PermWrite; refused commands are answered with a
+// CLIENT_ERROR. Writes are then recorded to the cache's Config.Audit with
+// the connection's TokenActor.
+type MemcachedServer struct {
+	cache *ShardedCacheV2
+
+	// MaxValueSize is the largest value accepted by set.
+	MaxValueSize int
+
+	// Policy authorizes commands, nil to allow all of them. Set it before
+	// serving.
+	Policy *AccessPolicy
+
+	// Token is the token of connections until they send auth, so that a
+	// listener can be dedicated to one tenant.
+	Token string
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewMemcachedServer creates a memcached protocol server for cache.
+func NewMemcachedServer(cache *ShardedCacheV2) *MemcachedServer {
+	return &MemcachedServer{
+		cache:        cache,
+		MaxValueSize: DefaultMemcachedMaxValueSize,
+		conns:        make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *MemcachedServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until Close is called.
+func (s *MemcachedServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listener, closes open connections and waits for them to finish.
+func (s *MemcachedServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn handles commands on a single connection.
+func (s *MemcachedServer) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReaderSize(conn, memcachedMaxLineLength)
+	w := bufio.NewWriter(conn)
+	token := s.Token
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if fields[0] == "quit" {
+			w.Flush()
+			return
+		} else if err := s.handle(fields, &token, r, w); err != nil {
+			w.Flush()
+			return
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle executes one command with the connection's token. It returns an
+// error only if the connection must be closed.
+func (s *MemcachedServer) handle(fields []string, token *string, r *bufio.Reader, w *bufio.Writer) error {
+	cmd, args := fields[0], fields[1:]
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+	reply := func(msg string) {
+		if !noreply {
+			w.WriteString(msg)
+			w.WriteString("\r\n")
+		}
+	}
+	// denied answers a command whose token lacks perm on key.
+	denied := func(key string, perm Permission) bool {
+		if err := s.Policy.Authorize(*token, key, perm); err != nil {
+			w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+			return true
+		}
+		return false
+	}
+	// audited attributes a write to the connection's token.
+	audited := func() context.Context {
+		return auditContext(context.Background(), s.Policy, *token)
+	}
+
+	switch cmd {
+	case "auth":
+		if len(args) != 1 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		// A permission of 0 only checks that the token is known
+		if err := s.Policy.Authorize(args[0], ScopeAll, 0); err != nil {
+			w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+			return nil
+		}
+		*token = args[0]
+		reply("OK")
+
+	case "get", "gets":
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		for _, key := range args {
+			if len(key) > memcachedMaxKeyLength {
+				w.WriteString("CLIENT_ERROR bad command line format\r\n")
+				return nil
+			}
+		}
+		for _, key := range args {
+			if denied(key, PermRead) {
+				return nil
+			}
+		}
+		for _, key := range args {
+			if cmd == "gets" {
+				if item, unique, ok := s.gets(key); ok {
+					fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, item.flags, len(item.data), unique)
+					w.Write(item.data)
+					w.WriteString("\r\n")
+				}
+			} else if item, ok := s.get(key); ok {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, item.flags, len(item.data))
+				w.Write(item.data)
+				w.WriteString("\r\n")
+			}
+		}
+		w.WriteString("END\r\n")
+
+	case "set", "cas":
+		want := 4
+		if cmd == "cas" {
+			want = 5
+		}
+		if len(args) != want {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		flags, err1 := strconv.ParseUint(args[1], 10, 32)
+		exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+		size, err3 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		var unique uint64
+		if cmd == "cas" {
+			var err error
+			if unique, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+				w.WriteString("CLIENT_ERROR bad command line format\r\n")
+				return nil
+			}
+		}
+		key := args[0]
+		if len(key) > memcachedMaxKeyLength || size > s.MaxValueSize {
+			// Skip the payload so the connection stays in sync.
+			if _, err := r.Discard(size + 2); err != nil {
+				return err
+			}
+			if size > s.MaxValueSize {
+				w.WriteString("SERVER_ERROR object too large for cache\r\n")
+			} else {
+				w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			}
+			return nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if string(data[size:]) != "\r\n" {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return nil
+		}
+		if denied(key, PermWrite) {
+			return nil
+		}
+		item := &memcachedItem{flags: uint32(flags), data: data[:size]}
+		if cmd == "cas" {
+			reply(s.cas(audited(), key, unique, item, exptime))
+			return nil
+		}
+		expiration, expired := memcachedExpiration(exptime)
+		if expired {
+			s.cache.del(audited(), key)
+			reply("STORED")
+			return nil
+		}
+		ctx := audited()
+		stored := s.cache.getShard(key).setSync(ctx, key, item, int64(len(key)+size), expiration)
+		s.cache.audit.Record(ctx, AuditSet, key, item.data, stored)
+		if stored {
+			reply("STORED")
+		} else {
+			reply("NOT_STORED")
+		}
+
+	case "delete":
+		if len(args) != 1 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		if len(args[0]) > memcachedMaxKeyLength {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		if denied(args[0], PermWrite) {
+			return nil
+		}
+		if _, ok := s.get(args[0]); !ok {
+			reply("NOT_FOUND")
+			return nil
+		}
+		s.cache.del(audited(), args[0])
+		reply("DELETED")
+
+	case "incr", "decr":
+		if len(args) != 2 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		if len(args[0]) > memcachedMaxKeyLength {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		delta, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+			return nil
+		}
+		if denied(args[0], PermWrite) {
+			return nil
+		}
+		value, err := s.incr(args[0], delta, cmd == "decr")
+		if !errors.Is(err, errMemcachedNotFound) {
+			s.cache.audit.Record(audited(), AuditIncr, args[0], value, err == nil)
+		}
+		switch {
+		case errors.Is(err, errMemcachedNotFound):
+			reply("NOT_FOUND")
+		case err != nil:
+			w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+		default:
+			reply(strconv.FormatUint(value, 10))
+		}
+
+	case "touch":
+		if len(args) != 2 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		exptime, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+			return nil
+		}
+		key := args[0]
+		if len(key) > memcachedMaxKeyLength {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		if denied(key, PermWrite) {
+			return nil
+		}
+		// Through Expire and Persist, so the change is ordered with queued
+		// sets and published to peers
+		var touched bool
+		switch expiration, expired := memcachedExpiration(exptime); {
+		case expired:
+			touched = s.cache.expire(audited(), key, 0)
+		case expiration == 0:
+			touched = s.cache.persist(audited(), key)
+		default:
+			touched = s.cache.expire(audited(), key, time.Until(time.Unix(0, expiration)))
+		}
+		if touched {
+			reply("TOUCHED")
+		} else {
+			reply("NOT_FOUND")
+		}
+
+	case "version":
+		w.WriteString("VERSION fastcache\r\n")
+
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+var (
+	errMemcachedNotFound   = errors.New("not found")
+	errMemcachedNotNumeric = errors.New("cannot increment or decrement non-numeric value")
+)
+
+// get returns the item stored under key.
+func (s *MemcachedServer) get(key string) (*memcachedItem, bool) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return toMemcachedItem(value)
+}
+
+// gets returns the item stored under key with its CAS unique, the write
+// stamp of the entry.
+func (s *MemcachedServer) gets(key string) (*memcachedItem, uint64, bool) {
+	shard := s.cache.getShard(key)
+	entry, ok := shard.cache.snapshotItem(key)
+	if !ok {
+		return nil, 0, false
+	}
+	shard.Touch(key)
+	item, ok := toMemcachedItem(entry.Value)
+	return item, entry.stamp, ok
+}
+
+// toMemcachedItem returns the item of a stored value. Plain []byte and string
+// values set through the Go API are served with zero flags.
+func toMemcachedItem(value any) (*memcachedItem, bool) {
+	switch v := value.(type) {
+	case *memcachedItem:
+		return v, true
+	case []byte:
+		return &memcachedItem{data: v}, true
+	case string:
+		return &memcachedItem{data: []byte(v)}, true
+	}
+	return nil, false
+}
+
+// cas stores item under key if the entry was not written since gets returned
+// unique, and returns the reply: STORED, EXISTS or NOT_FOUND. The check and
+// the store run on the shard's write goroutine, ordered with other sets.
+func (s *MemcachedServer) cas(ctx context.Context, key string, unique uint64, item *memcachedItem, exptime int64) string {
+	shard := s.cache.getShard(key)
+	cost := int64(len(key) + len(item.data))
+	if cost > shard.MaxCost() {
+		return "SERVER_ERROR object too large for cache"
+	}
+	expiration, expired := memcachedExpiration(exptime)
+
+	result := "NOT_STORED"
+	err := shard.applySync(key, func() {
+		entry, ok := shard.cache.snapshotItem(key)
+		switch {
+		case !ok:
+			result = "NOT_FOUND"
+		case entry.stamp != unique:
+			result = "EXISTS"
+		case expired:
+			shard.delLocal(key)
+			result = "STORED"
+		case shard.store(&setItem{key: key, value: item, cost: cost, expiration: expiration}):
+			result = "STORED"
+		}
+	})
+	if err != nil {
+		return "NOT_STORED"
+	}
+	if result == "STORED" {
+		if expired {
+			s.cache.invalidate(key)
+			s.cache.audit.Record(ctx, AuditDel, key, nil, true)
+		} else {
+			s.cache.invalidateOnSet(key)
+			s.cache.audit.Record(ctx, AuditSet, key, item.data, true)
+		}
+	}
+	return result
+}
+
+// incr adds delta to (or subtracts it from) a decimal value. Decrements stop
+// at zero and increments wrap at 64 bits, as in memcached. Like IncrBy, the
+// update runs on the shard's write goroutine, and the value is replaced only
+// if no Del got in between, so concurrent sets and deletes are not lost.
+func (s *MemcachedServer) incr(key string, delta uint64, decr bool) (uint64, error) {
+	shard := s.cache.getShard(key)
+	var value uint64
+	var incrErr error
+	err := shard.applySync(key, func() {
+		shard.recordAccess(key)
+		for {
+			entry, ok := shard.cache.snapshotItem(key)
+			if !ok {
+				incrErr = errMemcachedNotFound
+				return
+			}
+			item, ok := toMemcachedItem(entry.Value)
+			var err error
+			if ok {
+				value, err = strconv.ParseUint(string(item.data), 10, 64)
+			}
+			if !ok || err != nil {
+				incrErr = errMemcachedNotNumeric
+				return
+			}
+			if decr {
+				if delta > value {
+					value = 0
+				} else {
+					value -= delta
+				}
+			} else {
+				value += delta
+			}
+
+			data := []byte(strconv.FormatUint(value, 10))
+			cost := int64(len(key) + len(data))
+			// Retry if a concurrent Del or expiry got in between
+			if shard.cache.replaceIf(key, entry.stamp, &memcachedItem{flags: item.flags, data: data}, cost) {
+				shard.metrics.costAdded.Add(cost - entry.Cost)
+				shard.evictOverLimit()
+				return
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, incrErr
+}
+
+// memcachedExpiration converts a memcached exptime to an absolute expiration
+// in nanoseconds. expired reports a time in the past.
+func memcachedExpiration(exptime int64) (expiration int64, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= memcachedRelativeLimit:
+		return time.Now().Add(time.Duration(exptime) * time.Second).UnixNano(), false
+	default:
+		at := time.Unix(exptime, 0)
+		return at.UnixNano(), !at.After(time.Now())
+	}
+}
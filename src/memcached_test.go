@@ -0,0 +1,226 @@
+package src
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memcachedConn is a client connection to a test MemcachedServer
+type memcachedConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newMemcachedConn(t *testing.T, s *MemcachedServer) *memcachedConn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &memcachedConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func newTestMemcachedServer(t *testing.T) *MemcachedServer {
+	t.Helper()
+	cache, err := NewShardedCacheV2(4, &Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return NewMemcachedServer(cache)
+}
+
+// send writes a request and returns the reply lines up to the one starting with last
+func (c *memcachedConn) send(req, last string) []string {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(req)); err != nil {
+		c.t.Fatal(err)
+	}
+	var lines []string
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("reading reply to %q: %v (got %q)", req, err, lines)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		if strings.HasPrefix(line, last) {
+			return lines
+		}
+	}
+}
+
+// expect sends req and checks its single reply line
+func (c *memcachedConn) expect(req, want string) {
+	c.t.Helper()
+	if got := c.send(req, ""); got[0] != want {
+		c.t.Fatalf("%q replied %q, want %q", req, got[0], want)
+	}
+}
+
+func TestMemcachedCommands(t *testing.T) {
+	c := newMemcachedConn(t, newTestMemcachedServer(t))
+
+	c.expect("set k 5 0 5\r\nhello\r\n", "STORED")
+	if got := c.send("get k missing\r\n", "END"); strings.Join(got, "|") != "VALUE k 5 5|hello|END" {
+		t.Fatalf("get = %q", got)
+	}
+
+	// gets returns a CAS unique that cas checks
+	got := c.send("gets k\r\n", "END")
+	var flags, size int
+	var unique uint64
+	if _, err := fmt.Sscanf(got[0], "VALUE k %d %d %d", &flags, &size, &unique); err != nil {
+		t.Fatalf("gets = %q: %v", got, err)
+	}
+	c.expect(fmt.Sprintf("cas k 0 0 3 %d\r\nnew\r\n", unique), "STORED")
+	c.expect(fmt.Sprintf("cas k 0 0 3 %d\r\nold\r\n", unique), "EXISTS")
+	c.expect("cas missing 0 0 1 1\r\nx\r\n", "NOT_FOUND")
+	if got := c.send("get k\r\n", "END"); got[1] != "new" {
+		t.Fatalf("get after cas = %q", got)
+	}
+
+	c.expect("set n 0 0 2\r\n10\r\n", "STORED")
+	c.expect("incr n 5\r\n", "15")
+	c.expect("decr n 20\r\n", "0")
+	c.expect("incr k 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+	c.expect("incr missing 1\r\n", "NOT_FOUND")
+
+	c.expect("touch n 100\r\n", "TOUCHED")
+	c.expect("touch missing 100\r\n", "NOT_FOUND")
+
+	// noreply commands answer nothing, so the next reply is the version
+	c.expect("set quiet 0 0 1 noreply\r\nq\r\ndelete k noreply\r\nversion\r\n", "VERSION fastcache")
+	if got := c.send("get quiet k\r\n", "END"); strings.Join(got, "|") != "VALUE quiet 0 1|q|END" {
+		t.Fatalf("get after noreply commands = %q", got)
+	}
+	c.expect("delete quiet\r\n", "DELETED")
+	c.expect("delete quiet\r\n", "NOT_FOUND")
+}
+
+func TestMemcachedMalformedCommands(t *testing.T) {
+	c := newMemcachedConn(t, newTestMemcachedServer(t))
+
+	c.expect("bogus\r\n", "ERROR")
+	c.expect("get\r\n", "ERROR")
+	c.expect("set k x 0 1\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("set k 0 0 1\r\nxyz", "CLIENT_ERROR bad data chunk")
+
+	// Long keys are rejected, and the payload of a set is skipped
+	long := strings.Repeat("k", memcachedMaxKeyLength+1)
+	c.expect("get "+long+"\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("set "+long+" 0 0 1\r\nx\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("version\r\n", "VERSION fastcache")
+
+	// A line past the limit closes the connection
+	c.expect(strings.Repeat("x", memcachedMaxLineLength+1)+"\r\n", "CLIENT_ERROR line too long")
+	if _, err := c.r.ReadString('\n'); err == nil {
+		t.Fatal("connection still open after a line too long")
+	}
+}
+
+func TestMemcachedAccessPolicy(t *testing.T) {
+	s := newTestMemcachedServer(t)
+	s.Policy = NewAccessPolicy()
+	s.Policy.Grant("reader", "*", PermRead)
+	s.Policy.Grant("team-a", "a/*", PermRead|PermWrite)
+	s.Token = "reader"
+	c := newMemcachedConn(t, s)
+
+	// The listener's token reads but does not write
+	c.expect("set a/k 0 0 1\r\nx\r\n", `CLIENT_ERROR permission denied: w on "a/k"`)
+	c.expect("get a/k\r\n", "END")
+
+	c.expect("auth wrong\r\n", "CLIENT_ERROR unknown access token")
+	c.expect("auth team-a\r\n", "OK")
+	c.expect("set a/k 0 0 1\r\nx\r\n", "STORED")
+	c.expect("set b/k 0 0 1\r\nx\r\n", `CLIENT_ERROR permission denied: w on "b/k"`)
+	c.expect("get a/k b/k\r\n", `CLIENT_ERROR permission denied: r on "b/k"`)
+	c.expect("incr b/k 1\r\n", `CLIENT_ERROR permission denied: w on "b/k"`)
+	c.expect("touch b/k 10\r\n", `CLIENT_ERROR permission denied: w on "b/k"`)
+	c.expect("delete b/k noreply\r\n", `CLIENT_ERROR permission denied: w on "b/k"`)
+	c.expect("delete a/k\r\n", "DELETED")
+}
+
+// touch changes the TTL through Expire, so peers drop their copy
+func TestMemcachedTouch(t *testing.T) {
+	bus := &testBus{}
+	newPeer := func() *ShardedCacheV2 {
+		sc, err := NewShardedCacheV2(4, &Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64, Invalidator: bus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sc.Close() })
+		return sc
+	}
+	cache, peer := newPeer(), newPeer()
+	c := newMemcachedConn(t, NewMemcachedServer(cache))
+
+	// touch right after set sees the set
+	c.expect("set k 0 0 1\r\nx\r\ntouch k 100\r\n", "STORED")
+	c.expect("", "TOUCHED")
+	if ttl, ok := cache.GetTTL("k"); !ok || ttl <= 90*time.Second || ttl > 100*time.Second {
+		t.Fatalf("TTL after touch = %v, %v", ttl, ok)
+	}
+
+	peer.Set("k", 1, 1)
+	peer.Wait()
+	c.expect("touch k 0\r\n", "TOUCHED")
+	if _, ok := cache.GetTTL("k"); ok || !cache.Exists("k") {
+		t.Fatal("touch 0 did not leave k without a TTL")
+	}
+	deadline := time.Now().Add(time.Second)
+	for peer.Exists("k") {
+		if time.Now().After(deadline) {
+			t.Fatal("peer still holds k after touch")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.expect("touch k -1\r\n", "TOUCHED")
+	c.expect("get k\r\n", "END")
+	c.expect("touch k 100\r\n", "NOT_FOUND")
+}
+
+// Writes are audited with the actor of the connection's token
+func TestMemcachedAudit(t *testing.T) {
+	audit := NewAuditLog(AuditConfig{RedactValue: func(key string, value any) any { return value }})
+	cache, err := NewShardedCacheV2(4, &Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64, Audit: audit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	s := NewMemcachedServer(cache)
+	s.Policy = NewAccessPolicy()
+	s.Policy.Grant("team-a", "a/*", PermRead|PermWrite)
+	c := newMemcachedConn(t, s)
+
+	c.expect("set a/k 0 0 1\r\nx\r\n", `CLIENT_ERROR unknown access token`)
+	c.expect("auth team-a\r\n", "OK")
+	c.expect("set a/k 0 0 1\r\nx\r\n", "STORED")
+
+	events := audit.Events()
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events, want 1: %+v", len(events), events)
+	}
+	e := events[0]
+	if e.Op != AuditSet || e.Key != "a/k" || e.Actor != TokenActor("team-a") || !e.Applied {
+		t.Fatalf("event = %+v", e)
+	}
+	if v, ok := e.Value.([]byte); !ok || string(v) != "x" {
+		t.Fatalf("recorded value %#v, want the stored bytes", e.Value)
+	}
+}
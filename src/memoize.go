@@ -0,0 +1,99 @@
+package src
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultMemoizeErrorTTL is how long Memoize caches errors
+	DefaultMemoizeErrorTTL = time.Second
+	// DefaultMemoizeJitter spreads TTLs by ±10% so entries loaded together
+	// do not expire together
+	DefaultMemoizeJitter = 0.1
+)
+
+// MemoCache is a cache that Memoize can store results in.
+// It is implemented by RistrettoCache and ShardedCacheV2.
+type MemoCache interface {
+	getOrLoad(key string, load func() (any, int64, time.Duration, error)) (any, error)
+}
+
+// MemoizeOptions configures MemoizeWithOptions
+type MemoizeOptions[V any] struct {
+	// TTL of successful results (0 means no expiration)
+	TTL time.Duration
+	// ErrorTTL of cached errors (DefaultMemoizeErrorTTL if 0, negative disables negative caching)
+	ErrorTTL time.Duration
+	// Jitter is the fraction by which TTLs are randomly spread
+	// (DefaultMemoizeJitter if 0, negative disables jitter)
+	Jitter float64
+	// KeyPrefix namespaces the keys of this function in a shared cache
+	KeyPrefix string
+	// Cost computes the cost of a result (1 if nil)
+	Cost func(V) int64
+}
+
+// memoEntry is a memoized result, including cached errors
+type memoEntry[V any] struct {
+	value V
+	err   error
+}
+
+// Memoize wraps fn with a cache: results are cached for ttl, concurrent
+// calls for the same key share one fn call, errors are cached for
+// DefaultMemoizeErrorTTL and TTLs are jittered by DefaultMemoizeJitter.
+// Keys are converted to strings like Typed keys.
+func Memoize[K comparable, V any](cache MemoCache, ttl time.Duration, fn func(K) (V, error)) func(K) (V, error) {
+	return MemoizeWithOptions(cache, fn, MemoizeOptions[V]{TTL: ttl})
+}
+
+// MemoizeWithOptions is Memoize with options
+func MemoizeWithOptions[K comparable, V any](cache MemoCache, fn func(K) (V, error), opts MemoizeOptions[V]) func(K) (V, error) {
+	if opts.ErrorTTL == 0 {
+		opts.ErrorTTL = DefaultMemoizeErrorTTL
+	}
+	if opts.Jitter == 0 {
+		opts.Jitter = DefaultMemoizeJitter
+	}
+
+	return func(key K) (V, error) {
+		value, err := cache.getOrLoad(opts.KeyPrefix+typedKey(key), func() (any, int64, time.Duration, error) {
+			v, err := fn(key)
+			if err != nil {
+				if opts.ErrorTTL < 0 {
+					return nil, 0, 0, err
+				}
+				return &memoEntry[V]{err: err}, 1, jitterTTL(opts.ErrorTTL, opts.Jitter), nil
+			}
+			cost := int64(1)
+			if opts.Cost != nil {
+				cost = opts.Cost(v)
+			}
+			return &memoEntry[V]{value: v}, cost, jitterTTL(opts.TTL, opts.Jitter), nil
+		})
+
+		var zero V
+		if err != nil {
+			return zero, err
+		}
+		entry, ok := value.(*memoEntry[V])
+		if !ok {
+			// Another writer stored a foreign value under this key
+			return fn(key)
+		}
+		if entry.err != nil {
+			return zero, entry.err
+		}
+		return entry.value, nil
+	}
+}
+
+// jitterTTL spreads ttl randomly by ±jitter
+func jitterTTL(ttl time.Duration, jitter float64) time.Duration {
+	if ttl <= 0 || jitter <= 0 {
+		return ttl
+	}
+	spread := (rand.Float64()*2 - 1) * jitter
+	return ttl + time.Duration(float64(ttl)*spread)
+}
@@ -7,14 +7,22 @@ import (
 
 // Metrics cache metrics statistics
 type Metrics struct {
-	hits         atomic.Int64
-	misses       atomic.Int64
-	keysAdded    atomic.Int64
-	keysEvicted  atomic.Int64
-	setsDropped  atomic.Int64
-	setsRejected atomic.Int64
-	costAdded    atomic.Int64
-	costEvicted  atomic.Int64
+	hits          atomic.Int64
+	misses        atomic.Int64
+	keysAdded     atomic.Int64
+	keysEvicted   atomic.Int64
+	setsDropped   atomic.Int64
+	setsRejected  atomic.Int64
+	setsThrottled atomic.Int64
+	costAdded     atomic.Int64
+	costEvicted   atomic.Int64
+	loads         atomic.Int64
+	loadsShared   atomic.Int64
+
+	refreshes     atomic.Int64
+	refreshErrors atomic.Int64
+
+	workerRestarts atomic.Int64
 }
 
 // NewMetrics creates a new metrics instance
@@ -52,6 +60,11 @@ func (m *Metrics) SetsRejected() int64 {
 	return m.setsRejected.Load()
 }
 
+// SetsThrottled returns the number of SET operations rejected by write limits
+func (m *Metrics) SetsThrottled() int64 {
+	return m.setsThrottled.Load()
+}
+
 // CostAdded returns the total cost added
 func (m *Metrics) CostAdded() int64 {
 	return m.costAdded.Load()
@@ -62,6 +75,52 @@ func (m *Metrics) CostEvicted() int64 {
 	return m.costEvicted.Load()
 }
 
+// Loads returns the number of loader calls made on misses
+func (m *Metrics) Loads() int64 {
+	return m.loads.Load()
+}
+
+// LoadsShared returns the number of misses served by another caller's in-flight load
+func (m *Metrics) LoadsShared() int64 {
+	return m.loadsShared.Load()
+}
+
+// Refreshes returns the number of entries reloaded ahead of expiry
+func (m *Metrics) Refreshes() int64 {
+	return m.refreshes.Load()
+}
+
+// RefreshErrors returns the number of refresh-ahead reloads that failed
+func (m *Metrics) RefreshErrors() int64 {
+	return m.refreshErrors.Load()
+}
+
+// WorkerRestarts returns the number of background workers restarted after a panic
+func (m *Metrics) WorkerRestarts() int64 {
+	return m.workerRestarts.Load()
+}
+
+// merge adds the counters of m2 to m
+func (m *Metrics) merge(m2 *Metrics) {
+	if m2 == nil {
+		return
+	}
+	m.hits.Add(m2.Hits())
+	m.misses.Add(m2.Misses())
+	m.keysAdded.Add(m2.KeysAdded())
+	m.keysEvicted.Add(m2.KeysEvicted())
+	m.setsDropped.Add(m2.SetsDropped())
+	m.setsRejected.Add(m2.SetsRejected())
+	m.setsThrottled.Add(m2.SetsThrottled())
+	m.costAdded.Add(m2.CostAdded())
+	m.costEvicted.Add(m2.CostEvicted())
+	m.loads.Add(m2.Loads())
+	m.loadsShared.Add(m2.LoadsShared())
+	m.refreshes.Add(m2.Refreshes())
+	m.refreshErrors.Add(m2.RefreshErrors())
+	m.workerRestarts.Add(m2.WorkerRestarts())
+}
+
 // Ratio returns the hit ratio
 func (m *Metrics) Ratio() float64 {
 	total := m.hits.Load() + m.misses.Load()
@@ -82,8 +141,14 @@ Cache Metrics:
   Keys Evicted: %d
   Sets Dropped: %d
   Sets Rejected: %d
+  Sets Throttled: %d
   Cost Added: %d
   Cost Evicted: %d
+  Loads: %d
+  Loads Shared: %d
+  Refreshes: %d
+  Refresh Errors: %d
+  Worker Restarts: %d
 `,
 		m.hits.Load(),
 		m.misses.Load(),
@@ -92,7 +157,13 @@ Cache Metrics:
 		m.keysEvicted.Load(),
 		m.setsDropped.Load(),
 		m.setsRejected.Load(),
+		m.setsThrottled.Load(),
 		m.costAdded.Load(),
 		m.costEvicted.Load(),
+		m.loads.Load(),
+		m.loadsShared.Load(),
+		m.refreshes.Load(),
+		m.refreshErrors.Load(),
+		m.workerRestarts.Load(),
 	)
 }
@@ -0,0 +1,206 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsVersion is the current version of the persisted metrics format
+const MetricsVersion = 1
+
+// persistedHotKeys is how many hot keys SaveMetrics keeps
+const persistedHotKeys = 1024
+
+// metricsSuffix names the metrics file written next to a snapshot with PersistMetrics
+const metricsSuffix = ".metrics"
+
+// HotKey is a cached key with its estimated access frequency
+type HotKey struct {
+	Key       string `json:"key"`
+	Frequency int64  `json:"frequency"`
+}
+
+// MetricsSnapshot is the persisted form of the cumulative metrics and hot
+// keys of a cache, written by SaveMetrics as JSON
+type MetricsSnapshot struct {
+	Version  int              `json:"version"`
+	SavedAt  time.Time        `json:"savedAt"`
+	Counters map[string]int64 `json:"counters"`
+	HotKeys  []HotKey         `json:"hotKeys,omitempty"`
+}
+
+// counters returns the cumulative counters by name, as published by expvar
+func (m *Metrics) counters() map[string]*atomic.Int64 {
+	return map[string]*atomic.Int64{
+		"hits":           &m.hits,
+		"misses":         &m.misses,
+		"keysAdded":      &m.keysAdded,
+		"keysEvicted":    &m.keysEvicted,
+		"setsDropped":    &m.setsDropped,
+		"setsRejected":   &m.setsRejected,
+		"setsThrottled":  &m.setsThrottled,
+		"costAdded":      &m.costAdded,
+		"costEvicted":    &m.costEvicted,
+		"loads":          &m.loads,
+		"loadsShared":    &m.loadsShared,
+		"refreshes":      &m.refreshes,
+		"refreshErrors":  &m.refreshErrors,
+		"workerRestarts": &m.workerRestarts,
+	}
+}
+
+// snapshot returns the current counter values
+func (m *Metrics) snapshot() map[string]int64 {
+	values := make(map[string]int64)
+	for name, counter := range m.counters() {
+		values[name] = counter.Load()
+	}
+	return values
+}
+
+// restore adds persisted counter values, so counting continues from them.
+// Unknown names, e.g. from a newer release, are ignored
+func (m *Metrics) restore(values map[string]int64) {
+	counters := m.counters()
+	for name, v := range values {
+		if counter, ok := counters[name]; ok {
+			counter.Add(v)
+		}
+	}
+}
+
+// hotKeys returns the live keys of c with their estimated frequency
+func (c *RistrettoCache) hotKeys() []HotKey {
+	var keys []HotKey
+	for _, key := range c.Keys() {
+		if freq := c.estimate(key); freq > 0 {
+			keys = append(keys, HotKey{Key: key, Frequency: freq})
+		}
+	}
+	return keys
+}
+
+// topHotKeys sorts keys by descending frequency and keeps the first n
+func topHotKeys(keys []HotKey, n int) []HotKey {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Frequency != keys[j].Frequency {
+			return keys[i].Frequency > keys[j].Frequency
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if n >= 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// HotKeys returns up to n live keys with the highest estimated access
+// frequency, most frequent first
+func (c *RistrettoCache) HotKeys(n int) []HotKey {
+	return topHotKeys(c.hotKeys(), n)
+}
+
+// HotKeys returns up to n live keys with the highest estimated access
+// frequency across all shards, most frequent first
+func (sc *ShardedCacheV2) HotKeys(n int) []HotKey {
+	var keys []HotKey
+	for _, shard := range sc.shards {
+		keys = append(keys, shard.hotKeys()...)
+	}
+	return topHotKeys(keys, n)
+}
+
+// writeMetrics encodes the counters and hot keys as a MetricsSnapshot
+func writeMetrics(w io.Writer, metrics *Metrics, hot []HotKey) error {
+	return json.NewEncoder(w).Encode(&MetricsSnapshot{
+		Version:  MetricsVersion,
+		SavedAt:  time.Now(),
+		Counters: metrics.snapshot(),
+		HotKeys:  hot,
+	})
+}
+
+// readMetrics decodes and validates a MetricsSnapshot
+func readMetrics(r io.Reader) (*MetricsSnapshot, error) {
+	var snap MetricsSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != MetricsVersion {
+		return nil, fmt.Errorf("unsupported metrics version %d", snap.Version)
+	}
+	return &snap, nil
+}
+
+// restoreHotKeys raises the frequency of the persisted hot keys that are
+// cached again, so they keep winning admission after a restart
+func (c *RistrettoCache) restoreHotKeys(hot []HotKey) {
+	for _, h := range hot {
+		if c.Exists(h.Key) {
+			c.freq.restore(h.Key, h.Frequency)
+		}
+	}
+}
+
+// SaveMetrics writes the cumulative metrics and the hottest keys to w
+func (c *RistrettoCache) SaveMetrics(w io.Writer) error {
+	return writeMetrics(w, c.metrics, c.HotKeys(persistedHotKeys))
+}
+
+// LoadMetrics adds metrics written by SaveMetrics to the counters of the
+// cache, so hit ratios keep their history across restarts, and restores the
+// frequency of hot keys that are cached. Load the snapshot first
+func (c *RistrettoCache) LoadMetrics(r io.Reader) error {
+	snap, err := readMetrics(r)
+	if err != nil {
+		return err
+	}
+	c.metrics.restore(snap.Counters)
+	c.restoreHotKeys(snap.HotKeys)
+	return nil
+}
+
+// SaveMetrics writes the aggregated metrics and the hottest keys of all
+// shards to w
+func (sc *ShardedCacheV2) SaveMetrics(w io.Writer) error {
+	return writeMetrics(w, sc.Metrics(), sc.HotKeys(persistedHotKeys))
+}
+
+// LoadMetrics adds metrics written by SaveMetrics to the aggregated
+// counters and restores the frequency of hot keys that are cached. The
+// shard count may differ from the saving cache. Load the snapshot first
+func (sc *ShardedCacheV2) LoadMetrics(r io.Reader) error {
+	snap, err := readMetrics(r)
+	if err != nil {
+		return err
+	}
+	// Metrics sums the shards, so the history lives in the first one
+	sc.shards[0].metrics.restore(snap.Counters)
+	for _, h := range snap.HotKeys {
+		sc.getShard(h.Key).restoreHotKeys([]HotKey{h})
+	}
+	return nil
+}
+
+// saveMetricsFile writes the metrics file that accompanies the snapshot at path
+func saveMetricsFile(path string, write func(w io.Writer) error) error {
+	return saveFile(path+metricsSuffix, write)
+}
+
+// loadMetricsFile restores the metrics file that accompanies the snapshot at
+// path. A missing file, e.g. from before PersistMetrics was set, is not an error
+func loadMetricsFile(path string, read func(r io.Reader) error) error {
+	_, err := loadFile(path+metricsSuffix, func(r io.Reader) (int, error) {
+		return 0, read(r)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
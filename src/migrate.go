@@ -0,0 +1,204 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCacheClosed is returned when a migration runs into a closed cache.
+var ErrCacheClosed = errors.New("cache closed")
+
+// DefaultMigrateBatchSize is the default number of entries rewritten between pauses.
+const DefaultMigrateBatchSize = 100
+
+// MigrateFunc converts an old value to its new format and returns its cost.
+// Returning a nil value leaves the entry unchanged; a cost <= 0 keeps the
+// old cost, or uses Config.Cost when it is set.
+type MigrateFunc func(old any) (new any, cost int64)
+
+// MigrateOptions controls the pacing of a migration.
+type MigrateOptions struct {
+	// BatchSize is the number of entries rewritten before each pause
+	// (DefaultMigrateBatchSize if 0).
+	BatchSize int
+
+	// Pause is the time to sleep between batches, which bounds the load a
+	// migration puts on the cache. 0 means no pause.
+	Pause time.Duration
+}
+
+// MigrationStats reports the progress of a migration.
+type MigrationStats struct {
+	Scanned   int64 // entries matching the prefix
+	Rewritten int64 // entries rewritten
+	Skipped   int64 // entries deleted, expired or written concurrently, or left unchanged by fn
+}
+
+// Migration is a running background migration.
+type Migration struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	audit  *AuditLog
+
+	scanned   atomic.Int64
+	rewritten atomic.Int64
+	skipped   atomic.Int64
+}
+
+// Stats returns the current progress.
+func (m *Migration) Stats() MigrationStats {
+	return MigrationStats{
+		Scanned:   m.scanned.Load(),
+		Rewritten: m.rewritten.Load(),
+		Skipped:   m.skipped.Load(),
+	}
+}
+
+// Done is closed when the migration finishes or is cancelled.
+func (m *Migration) Done() <-chan struct{} {
+	return m.done
+}
+
+// Wait blocks until the migration finishes and returns its final stats.
+// The error is non-nil if the migration was cancelled.
+func (m *Migration) Wait() (MigrationStats, error) {
+	<-m.done
+	return m.Stats(), m.err
+}
+
+// Cancel stops the migration. Entries already rewritten keep their new value.
+func (m *Migration) Cancel() {
+	m.cancel()
+}
+
+// Migrate rewrites every entry whose key starts with prefix in the
+// background, so a value format change does not require flushing the cache.
+// Readers see either the old or the new value of an entry. Entries written
+// concurrently by Set are left alone, since they already hold a fresh value.
+// Expiration and LRU position are preserved.
+func (c *RistrettoCache) Migrate(prefix string, fn MigrateFunc) *Migration {
+	return c.MigrateWithOptions(context.Background(), prefix, fn, MigrateOptions{})
+}
+
+// MigrateWithOptions is Migrate with a context and pacing controls. The
+// rewrites are audited with the actor of ctx.
+func (c *RistrettoCache) MigrateWithOptions(ctx context.Context, prefix string, fn MigrateFunc, opts MigrateOptions) *Migration {
+	return startMigration(ctx, []*RistrettoCache{c}, c.config.Audit, prefix, fn, opts)
+}
+
+// Migrate rewrites every entry whose key starts with prefix in the
+// background, one shard at a time. See RistrettoCache.Migrate.
+func (sc *ShardedCacheV2) Migrate(prefix string, fn MigrateFunc) *Migration {
+	return sc.MigrateWithOptions(context.Background(), prefix, fn, MigrateOptions{})
+}
+
+// MigrateWithOptions is Migrate with a context and pacing controls. The
+// rewrites are audited with the actor of ctx.
+func (sc *ShardedCacheV2) MigrateWithOptions(ctx context.Context, prefix string, fn MigrateFunc, opts MigrateOptions) *Migration {
+	return startMigration(ctx, sc.shards, sc.audit, prefix, fn, opts)
+}
+
+func startMigration(ctx context.Context, shards []*RistrettoCache, audit *AuditLog, prefix string, fn MigrateFunc, opts MigrateOptions) *Migration {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultMigrateBatchSize
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	m := &Migration{cancel: cancel, done: make(chan struct{}), audit: audit}
+
+	go func() {
+		defer close(m.done)
+		defer cancel()
+		for _, shard := range shards {
+			if err := m.migrateShard(ctx, shard, prefix, fn, opts); err != nil {
+				m.err = err
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// migrateShard rewrites the matching entries of one shard.
+func (m *Migration) migrateShard(ctx context.Context, c *RistrettoCache, prefix string, fn MigrateFunc, opts MigrateOptions) error {
+	entries := c.cache.rangeEntries("", "", prefix, 0)
+	m.scanned.Add(int64(len(entries)))
+
+	for i, e := range entries {
+		if i > 0 && i%opts.BatchSize == 0 {
+			if err := pause(ctx, opts.Pause); err != nil {
+				return err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if c.closed.Load() {
+			return ErrCacheClosed
+		}
+		if m.rewrite(c, e.Key, fn) {
+			m.rewritten.Add(1)
+			m.audit.Record(ctx, AuditMigrate, e.Key, nil, true)
+		} else {
+			m.skipped.Add(1)
+		}
+	}
+	return nil
+}
+
+// rewrite converts a single entry unless it changed after being read.
+func (m *Migration) rewrite(c *RistrettoCache, key string, fn MigrateFunc) bool {
+	item, ok := c.cache.snapshotItem(key)
+	if !ok {
+		return false
+	}
+	value, cost := fn(item.Value)
+	if value == nil {
+		return false
+	}
+	if cost <= 0 {
+		cost = item.Cost
+		if c.config.Cost != nil {
+			cost = c.config.Cost(value)
+		}
+	}
+	if !c.replaceIfSync(key, item.stamp, value, cost) {
+		return false
+	}
+
+	c.metrics.costAdded.Add(cost)
+	if c.onExit != nil && item.Value != nil {
+		c.onExit(item.Value)
+	}
+	return true
+}
+
+// replaceIfSync replaces the value and cost of key on the write goroutine
+// unless it was written since stamp was read, see LRUCache.replaceIf. A
+// larger cost evicts as an update by Set would
+func (c *RistrettoCache) replaceIfSync(key string, stamp uint64, value any, cost int64) bool {
+	replaced := false
+	err := c.applySync(key, func() {
+		if replaced = c.cache.replaceIf(key, stamp, value, cost); replaced {
+			c.evictOverLimit()
+		}
+	})
+	return err == nil && replaced
+}
+
+// pause sleeps for d or until ctx is done.
+func pause(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+package src
+
+import (
+	"sync"
+	"testing"
+)
+
+// A migration that grows values evicts through OnEvict like a Set would
+func TestMigrateEvictsThroughCallbacks(t *testing.T) {
+	var mu sync.Mutex
+	evicted := 0
+	c, err := NewRistrettoCache(&Config{
+		NumCounters: 1e4, MaxCost: 10, BufferItems: 64,
+		OnEvict: func(key string, value any, cost int64) {
+			mu.Lock()
+			evicted++
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(key, 1, 2)
+	}
+	c.Wait()
+
+	stats, err := c.Migrate("", func(old any) (any, int64) { return 2, 4 }).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Cost() > c.MaxCost() {
+		t.Fatalf("cost %d over MaxCost %d after migration", c.Cost(), c.MaxCost())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if evicted == 0 {
+		t.Fatalf("no OnEvict calls, stats %+v", stats)
+	}
+	if got := c.Metrics().KeysEvicted(); got != int64(evicted) {
+		t.Fatalf("KeysEvicted = %d, OnEvict calls = %d", got, evicted)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package src
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapSupported reports whether mmapFile works on this platform
+const mmapSupported = false
+
+// errMmapUnsupported is returned by mmapFile on platforms without mmap
+var errMmapUnsupported = errors.New("memory-mapped storage is not supported on this platform")
+
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(data []byte) error {
+	return errMmapUnsupported
+}
+
+// processAlive assumes pid is alive where it cannot be checked
+func processAlive(pid int) bool {
+	return true
+}
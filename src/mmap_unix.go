@@ -0,0 +1,28 @@
+//go:build unix
+
+package src
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapSupported reports whether mmapFile works on this platform
+const mmapSupported = true
+
+// mmapFile maps the first size bytes of f read-write and shared, so writes
+// reach the file
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// munmap unmaps a mapping returned by mmapFile
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
+
+// processAlive reports whether the process pid exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
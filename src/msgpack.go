@@ -0,0 +1,578 @@
+package src
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A minimal MessagePack codec without extension types. Values are encoded
+// by kind: integers use the smallest representation, []byte is bin, structs
+// are maps keyed by field name (a `msgpack:"name,omitempty"` tag renames or
+// omits a field, "-" skips it), map keys are sorted when they are strings so
+// that equal values encode to equal bytes, and types implementing
+// encoding.BinaryMarshaler, such as time.Time, are encoded as bin.
+//
+// Decoding into an interface yields nil, bool, int64 (uint64 above
+// math.MaxInt64), float32, float64, string, []byte, []any and map[string]any
+// (map[any]any for non-string keys)
+
+// errMsgpackShort is returned for truncated MessagePack data
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+func marshalMsgpack(v any) ([]byte, error) {
+	return appendMsgpack(nil, reflect.ValueOf(v))
+}
+
+func unmarshalMsgpack(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("msgpack: Unmarshal needs a non-nil pointer, got %T", v)
+	}
+	d := msgpackDecoder{data: data}
+	val, err := d.value()
+	if err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return fmt.Errorf("msgpack: %d trailing bytes", len(data)-d.pos)
+	}
+	return assignMsgpack(rv.Elem(), val)
+}
+
+// appendMsgpack appends the encoding of v to buf
+func appendMsgpack(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, 0xc0), nil
+	}
+	kind := v.Kind()
+	if kind != reflect.Interface && !(kind == reflect.Pointer && v.IsNil()) && v.Type().Implements(binaryMarshalerType) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackBin(buf, data), nil
+	}
+
+	switch kind {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		return appendMsgpack(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendMsgpackUint(buf, v.Uint()), nil
+	case reflect.Float32:
+		buf = append(buf, 0xca)
+		return binary.BigEndian.AppendUint32(buf, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		buf = append(buf, 0xcb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendMsgpackString(buf, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendMsgpackBin(buf, v.Bytes()), nil
+		}
+		return appendMsgpackArray(buf, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return appendMsgpackBin(buf, data), nil
+		}
+		return appendMsgpackArray(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		return appendMsgpackMap(buf, v)
+	case reflect.Struct:
+		return appendMsgpackStruct(buf, v)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type %s", v.Type())
+}
+
+func appendMsgpackInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0:
+		return appendMsgpackUint(buf, uint64(n))
+	case n >= -32:
+		return append(buf, byte(n))
+	case n >= math.MinInt8:
+		return append(buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(n))
+}
+
+func appendMsgpackUint(buf []byte, n uint64) []byte {
+	switch {
+	case n <= 0x7f:
+		return append(buf, byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xcf), n)
+}
+
+// appendMsgpackHeader appends a length header: the fix form if n is below
+// fixLimit, else the 8 (if code8 is non-zero), 16 or 32 bit form
+func appendMsgpackHeader(buf []byte, n int, fix byte, fixLimit int, code8, code16, code32 byte) []byte {
+	switch {
+	case n < fixLimit:
+		return append(buf, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(buf, code8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, code32), uint32(n))
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	buf = appendMsgpackHeader(buf, len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	return append(buf, s...)
+}
+
+func appendMsgpackBin(buf []byte, data []byte) []byte {
+	buf = appendMsgpackHeader(buf, len(data), 0, 0, 0xc4, 0xc5, 0xc6)
+	return append(buf, data...)
+}
+
+func appendMsgpackArray(buf []byte, v reflect.Value) ([]byte, error) {
+	buf = appendMsgpackHeader(buf, v.Len(), 0x90, 16, 0, 0xdc, 0xdd)
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if buf, err = appendMsgpack(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func appendMsgpackMap(buf []byte, v reflect.Value) ([]byte, error) {
+	keys := v.MapKeys()
+	if v.Type().Key().Kind() == reflect.String {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	}
+	buf = appendMsgpackHeader(buf, len(keys), 0x80, 16, 0, 0xde, 0xdf)
+	var err error
+	for _, key := range keys {
+		if buf, err = appendMsgpack(buf, key); err != nil {
+			return nil, err
+		}
+		if buf, err = appendMsgpack(buf, v.MapIndex(key)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// msgpackField is an encoded struct field
+type msgpackField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// msgpackFields returns the encoded fields of a struct type
+func msgpackFields(t reflect.Type) []msgpackField {
+	var fields []msgpackField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("msgpack")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, msgpackField{name: name, index: i, omitEmpty: opts == "omitempty"})
+	}
+	return fields
+}
+
+func appendMsgpackStruct(buf []byte, v reflect.Value) ([]byte, error) {
+	var fields []msgpackField
+	for _, f := range msgpackFields(v.Type()) {
+		if !f.omitEmpty || !v.Field(f.index).IsZero() {
+			fields = append(fields, f)
+		}
+	}
+	buf = appendMsgpackHeader(buf, len(fields), 0x80, 16, 0, 0xde, 0xdf)
+	var err error
+	for _, f := range fields {
+		buf = appendMsgpackString(buf, f.name)
+		if buf, err = appendMsgpack(buf, v.Field(f.index)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// msgpackDecoder parses MessagePack data into generic values
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *msgpackDecoder) value() (any, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	code := b[0]
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return d.mapOf(int(code & 0x0f))
+	case code&0xf0 == 0x90:
+		return d.array(int(code & 0x0f))
+	case code&0xe0 == 0xa0:
+		return d.str(int(code & 0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 0xca:
+		n, err := d.uint(4)
+		return math.Float32frombits(uint32(n)), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (code - 0xcc))
+		if n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), err
+	case 0xd0:
+		n, err := d.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return int64(n), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type code 0x%02x", code)
+}
+
+func (d *msgpackDecoder) str(n int) (any, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) array(n int) (any, error) {
+	// Every element takes at least one byte.
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	out := make([]any, n)
+	for i := range out {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (d *msgpackDecoder) mapOf(n int) (any, error) {
+	if 2*n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	keys := make([]any, n)
+	values := make([]any, n)
+	strKeys := true
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.(string); !ok {
+			strKeys = false
+		}
+		keys[i], values[i] = k, v
+	}
+	if strKeys {
+		out := make(map[string]any, n)
+		for i, k := range keys {
+			out[k.(string)] = values[i]
+		}
+		return out, nil
+	}
+	out := make(map[any]any, n)
+	for i, k := range keys {
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			return nil, fmt.Errorf("msgpack: unhashable map key of type %T", k)
+		}
+		out[k] = values[i]
+	}
+	return out, nil
+}
+
+// assignMsgpack stores a decoded generic value into v
+func assignMsgpack(v reflect.Value, val any) error {
+	if val == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if data, ok := val.([]byte); ok && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(binaryUnmarshalerType) {
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+	}
+	mismatch := func() error {
+		return fmt.Errorf("msgpack: cannot decode %T into %s", val, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch()
+		}
+		v.Set(reflect.ValueOf(val))
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignMsgpack(v.Elem(), val)
+	case reflect.Bool:
+		b, ok := val.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := val.(int64)
+		if !ok || v.OverflowInt(n) {
+			return mismatch()
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch x := val.(type) {
+		case int64:
+			if x < 0 {
+				return mismatch()
+			}
+			n = uint64(x)
+		case uint64:
+			n = x
+		default:
+			return mismatch()
+		}
+		if v.OverflowUint(n) {
+			return mismatch()
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch x := val.(type) {
+		case float32:
+			v.SetFloat(float64(x))
+		case float64:
+			v.SetFloat(x)
+		case int64:
+			v.SetFloat(float64(x))
+		case uint64:
+			v.SetFloat(float64(x))
+		default:
+			return mismatch()
+		}
+	case reflect.String:
+		switch x := val.(type) {
+		case string:
+			v.SetString(x)
+		case []byte:
+			v.SetString(string(x))
+		default:
+			return mismatch()
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch x := val.(type) {
+			case []byte:
+				v.SetBytes(x)
+				return nil
+			case string:
+				v.SetBytes([]byte(x))
+				return nil
+			}
+		}
+		items, ok := val.([]any)
+		if !ok {
+			return mismatch()
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assignMsgpack(s.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		if data, ok := val.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			if len(data) != v.Len() {
+				return mismatch()
+			}
+			reflect.Copy(v, reflect.ValueOf(data))
+			return nil
+		}
+		items, ok := val.([]any)
+		if !ok || len(items) != v.Len() {
+			return mismatch()
+		}
+		for i, item := range items {
+			if err := assignMsgpack(v.Index(i), item); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		set := func(k, e any) error {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := assignMsgpack(key, k); err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := assignMsgpack(elem, e); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+			return nil
+		}
+		switch x := val.(type) {
+		case map[string]any:
+			for k, e := range x {
+				if err := set(k, e); err != nil {
+					return err
+				}
+			}
+		case map[any]any:
+			for k, e := range x {
+				if err := set(k, e); err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch()
+		}
+		v.Set(m)
+	case reflect.Struct:
+		fields, ok := val.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range msgpackFields(v.Type()) {
+			if e, ok := fields[f.name]; ok {
+				if err := assignMsgpack(v.Field(f.index), e); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
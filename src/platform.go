@@ -0,0 +1,75 @@
+package src
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// Some subsystems depend on the platform: file mappings need a Unix kernel,
+// and a 32-bit process has too little address space to map large files.
+// They check canMap and fall back to heap memory instead of failing, and
+// PlatformCapabilities reports which ones are active
+
+// Capabilities reports which platform-dependent subsystems are active in
+// this process
+type Capabilities struct {
+	// OS and Arch are runtime.GOOS and runtime.GOARCH
+	OS   string
+	Arch string
+	// WordSize is the size of a pointer in bits, 32 or 64
+	WordSize int
+	// Mmap reports whether files can be memory-mapped
+	Mmap bool
+	// MaxMappedBytes is the largest file mapping attempted (0 without
+	// Mmap); larger caches fall back to heap memory
+	MaxMappedBytes int64
+	// MappedStorage reports whether ChunkedCache maps its chunks from
+	// Config.StorageDir; otherwise they stay on the heap and are not persisted
+	MappedStorage bool
+	// SharedMemory reports whether SharedCache segments are shared between
+	// processes; otherwise each SharedCache is private heap memory
+	SharedMemory bool
+	// LockRecovery reports whether SharedCache detects locks left by dead
+	// processes
+	LockRecovery bool
+	// Chaos reports whether fault injection is built in (fastcache_chaos tag)
+	Chaos bool
+}
+
+// PlatformCapabilities returns the capabilities of the current platform
+func PlatformCapabilities() Capabilities {
+	return Capabilities{
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		WordSize:       strconv.IntSize,
+		Mmap:           mmapSupported,
+		MaxMappedBytes: maxMappedBytes(),
+		MappedStorage:  mmapSupported,
+		SharedMemory:   mmapSupported,
+		LockRecovery:   mmapSupported,
+		Chaos:          chaosEnabled,
+	}
+}
+
+// maxMappedBytes returns the largest file mapping attempted, 0 without mmap
+func maxMappedBytes() int64 {
+	if !mmapSupported {
+		return 0
+	}
+	return maxSegmentBytes()
+}
+
+// maxSegmentBytes returns the largest single block of memory, mapped or
+// not, that is allocated up front. A 32-bit process has about 2GB of
+// address space for everything, so blocks there are limited to 1GB
+func maxSegmentBytes() int64 {
+	if strconv.IntSize == 32 {
+		return 1 << 30
+	}
+	return 1 << 46
+}
+
+// canMap reports whether a file mapping of size bytes is attempted
+func canMap(size int64) bool {
+	return mmapSupported && size <= maxMappedBytes()
+}
@@ -154,8 +154,9 @@ func PutStringBuilder(sb *stringBuilderPoolWrapper) {
 
 // GCStats holds GC statistics for monitoring
 type GCStats struct {
-	lastNumGC     uint32
+	// atomicPauseNs comes first so it is 64-bit aligned on 32-bit platforms
 	atomicPauseNs uint64
+	lastNumGC     uint32
 }
 
 // NewGCStats creates a new GC stats tracker
@@ -0,0 +1,268 @@
+package src
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Prefetch defaults
+const (
+	// DefaultPrefetchWorkers is the number of goroutines running prefetch loads
+	DefaultPrefetchWorkers = 2
+	// DefaultPrefetchTable is the number of keys whose successors are learned
+	// before the table starts over
+	DefaultPrefetchTable = 1 << 16
+
+	// prefetchMinCount is how often a successor must follow a key before it is predicted
+	prefetchMinCount = 2
+	// prefetchSuccessors is the number of successors remembered per key
+	prefetchSuccessors = 4
+)
+
+// PrefetchStats reports how well prefetching predicts reads. Precision is
+// the share of prefetched keys that were read; recall the share of reads
+// that would have missed and were served by a prefetch
+type PrefetchStats struct {
+	Issued int64 // prefetch loads started
+	Used   int64 // prefetched keys read before eviction
+	Misses int64 // reads that missed
+
+	Precision float64
+	Recall    float64
+}
+
+// successor is a key seen after another key and how often
+type successor struct {
+	key   string
+	count int64
+}
+
+// prefetcher observes the sequence of read keys and loads the keys likely
+// to be read next: the key with the trailing number incremented
+// (page:1 -> page:2) and successors learned from earlier sequences
+type prefetcher struct {
+	mu        sync.Mutex
+	last      string
+	next      map[string][]successor
+	tableSize int
+
+	load    func(key string) // loads key unless it is cached
+	queue   chan string
+	pending sync.Map // key -> struct{}, queued or loading
+	loaded  sync.Map // key -> struct{}, prefetched and not read yet
+	tracked atomic.Int64
+
+	issued atomic.Int64
+	used   atomic.Int64
+	misses atomic.Int64
+}
+
+// newPrefetcher creates a prefetcher whose workers run on wg until stop is closed
+func newPrefetcher(workers int, load func(key string), wg *sync.WaitGroup, stop chan struct{}, restarts *atomic.Int64) *prefetcher {
+	if workers <= 0 {
+		workers = DefaultPrefetchWorkers
+	}
+	p := &prefetcher{
+		next:      make(map[string][]successor),
+		tableSize: DefaultPrefetchTable,
+		load:      load,
+		queue:     make(chan string, workers*64),
+	}
+	for i := 0; i < workers; i++ {
+		goWorker(wg, "prefetcher", restarts, func() {
+			for {
+				select {
+				case key := <-p.queue:
+					p.run(key)
+				case <-stop:
+					return
+				}
+			}
+		})
+	}
+	return p
+}
+
+// observe records a read of key and queues the keys predicted to follow it
+func (p *prefetcher) observe(key string, hit bool) {
+	if _, ok := p.loaded.LoadAndDelete(key); ok {
+		p.tracked.Add(-1)
+		if hit {
+			p.used.Add(1)
+		}
+	}
+	if !hit {
+		p.misses.Add(1)
+	}
+
+	p.mu.Lock()
+	if p.last != "" && p.last != key {
+		p.learn(p.last, key)
+	}
+	p.last = key
+	predicted := p.predict(key)
+	p.mu.Unlock()
+
+	if next, ok := nextInSequence(key); ok {
+		p.schedule(next)
+	}
+	if predicted != "" {
+		p.schedule(predicted)
+	}
+}
+
+// learn counts next as a successor of prev (caller must hold lock)
+func (p *prefetcher) learn(prev, next string) {
+	succ, ok := p.next[prev]
+	if !ok && len(p.next) >= p.tableSize {
+		// Start over rather than track an unbounded number of keys
+		p.next = make(map[string][]successor)
+	}
+	for i := range succ {
+		if succ[i].key == next {
+			succ[i].count++
+			return
+		}
+	}
+	if len(succ) < prefetchSuccessors {
+		p.next[prev] = append(succ, successor{key: next, count: 1})
+		return
+	}
+	// Replace the least frequent successor
+	minIdx := 0
+	for i := range succ {
+		if succ[i].count < succ[minIdx].count {
+			minIdx = i
+		}
+	}
+	succ[minIdx] = successor{key: next, count: 1}
+}
+
+// predict returns the successor that followed key in at least half of the
+// observed sequences, "" if there is none (caller must hold lock)
+func (p *prefetcher) predict(key string) string {
+	var total int64
+	var best successor
+	for _, s := range p.next[key] {
+		total += s.count
+		if s.count > best.count {
+			best = s
+		}
+	}
+	if best.count < prefetchMinCount || best.count*2 < total {
+		return ""
+	}
+	return best.key
+}
+
+// schedule queues key for a prefetch unless it is already queued
+func (p *prefetcher) schedule(key string) {
+	if p.tracked.Load() >= int64(p.tableSize) {
+		// Too many prefetched keys are waiting to be read
+		return
+	}
+	if _, queued := p.pending.LoadOrStore(key, struct{}{}); queued {
+		return
+	}
+	select {
+	case p.queue <- key:
+	default:
+		p.pending.Delete(key)
+	}
+}
+
+// run loads a queued key
+func (p *prefetcher) run(key string) {
+	defer p.pending.Delete(key)
+	if _, loaded := p.loaded.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	p.tracked.Add(1)
+	p.issued.Add(1)
+	p.load(key)
+}
+
+// forget undoes a prefetch that loaded nothing, because the load failed or
+// the key was cached already
+func (p *prefetcher) forget(key string) {
+	if _, ok := p.loaded.LoadAndDelete(key); ok {
+		p.tracked.Add(-1)
+		p.issued.Add(-1)
+	}
+}
+
+// stats returns the prefetch counters
+func (p *prefetcher) stats() PrefetchStats {
+	s := PrefetchStats{
+		Issued: p.issued.Load(),
+		Used:   p.used.Load(),
+		Misses: p.misses.Load(),
+	}
+	if s.Issued > 0 {
+		s.Precision = float64(s.Used) / float64(s.Issued)
+	}
+	if s.Used+s.Misses > 0 {
+		s.Recall = float64(s.Used) / float64(s.Used+s.Misses)
+	}
+	return s
+}
+
+// nextInSequence returns key with its trailing number incremented, keeping
+// zero padding: page:1 -> page:2, img-009 -> img-010
+func nextInSequence(key string) (string, bool) {
+	end := len(key)
+	start := end
+	for start > 0 && key[start-1] >= '0' && key[start-1] <= '9' {
+		start--
+	}
+	if start == end || end-start > 18 {
+		return "", false
+	}
+	n, err := strconv.ParseInt(key[start:], 10, 64)
+	if err != nil {
+		return "", false
+	}
+	next := strconv.FormatInt(n+1, 10)
+	for len(next) < end-start {
+		next = "0" + next
+	}
+	return key[:start] + next, true
+}
+
+// prefetchLoad loads key with the configured Loader for a prefetcher,
+// unless it is cached already
+func (c *RistrettoCache) prefetchLoad(p *prefetcher, key string) {
+	if c.closed.Load() || c.config.Loader == nil {
+		p.forget(key)
+		return
+	}
+	if _, found := c.cache.Get(key); found {
+		p.forget(key)
+		return
+	}
+	_, err := c.loadShared(key, func() (any, int64, time.Duration, error) {
+		value, cost, err := c.config.Loader(key)
+		return value, cost, c.config.TTL, err
+	})
+	if err != nil {
+		p.forget(key)
+	}
+}
+
+// PrefetchStats returns the prefetch counters (zero unless Config.Prefetch is set)
+func (c *RistrettoCache) PrefetchStats() PrefetchStats {
+	if c.prefetch == nil {
+		return PrefetchStats{}
+	}
+	return c.prefetch.stats()
+}
+
+// PrefetchStats returns the prefetch counters (zero unless Config.Prefetch is set)
+func (sc *ShardedCacheV2) PrefetchStats() PrefetchStats {
+	if sc.prefetch == nil {
+		return PrefetchStats{}
+	}
+	return sc.prefetch.stats()
+}
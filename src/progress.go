@@ -0,0 +1,85 @@
+package src
+
+import (
+	"time"
+)
+
+// IndexProgress reports the progress of an index build or import.
+type IndexProgress struct {
+	Done    int           // Number of vectors processed so far.
+	Total   int           // Total number of vectors to process.
+	Rate    float64       // Vectors processed per second.
+	Elapsed time.Duration // Time since the operation started.
+	ETA     time.Duration // Estimated time remaining, 0 when unknown or done.
+}
+
+// progressInterval is the number of processed vectors between progress reports.
+const progressInterval = 1000
+
+// ProgressChan returns a progress callback that delivers updates to ch.
+// Updates are dropped rather than blocking the build when ch is full.
+func ProgressChan(ch chan<- IndexProgress) func(IndexProgress) {
+	return func(p IndexProgress) {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// progressTracker computes rate and ETA and reports progress at a fixed interval.
+type progressTracker struct {
+	total    int
+	start    time.Time
+	last     int
+	callback func(IndexProgress)
+}
+
+// newProgressTracker creates a tracker; a nil callback disables reporting.
+func newProgressTracker(total int, callback func(IndexProgress)) *progressTracker {
+	return &progressTracker{
+		total:    total,
+		start:    time.Now(),
+		callback: callback,
+	}
+}
+
+// update records that done items have been processed.
+func (t *progressTracker) update(done int) {
+	if t.callback == nil || done-t.last < progressInterval {
+		return
+	}
+	t.last = done
+	t.callback(t.snapshot(done))
+}
+
+// finish reports the final progress.
+func (t *progressTracker) finish(done int) {
+	if t.callback == nil {
+		return
+	}
+	t.total = done
+	t.callback(t.snapshot(done))
+}
+
+// snapshot builds a progress report for done items.
+func (t *progressTracker) snapshot(done int) IndexProgress {
+	total := t.total
+	if done > total {
+		total = done
+	}
+
+	elapsed := time.Since(t.start)
+	p := IndexProgress{
+		Done:    done,
+		Total:   total,
+		Elapsed: elapsed,
+	}
+	if elapsed > 0 {
+		p.Rate = float64(done) / elapsed.Seconds()
+	}
+	if p.Rate > 0 && total > done {
+		p.ETA = time.Duration(float64(total-done) / p.Rate * float64(time.Second))
+	}
+	return p
+}
@@ -0,0 +1,238 @@
+package src
+
+import (
+	"math"
+	"sync"
+)
+
+// QuantizationMode selects how a flat index stores and compares vectors.
+type QuantizationMode string
+
+const (
+	// QuantizationNone stores full-precision vectors.
+	QuantizationNone QuantizationMode = ""
+	// QuantizationInt8 stores int8 codes and quantizes the query as well
+	// (symmetric distance).
+	QuantizationInt8 QuantizationMode = "int8"
+	// QuantizationInt8Asymmetric stores int8 codes and compares them against
+	// the full-precision query (asymmetric distance), which preserves recall
+	// much better than quantizing both sides.
+	QuantizationInt8Asymmetric QuantizationMode = "int8-asymmetric"
+)
+
+// int8Code is a vector quantized to int8 with a per-vector scale:
+// v[i] ≈ scale * codes[i].
+type int8Code struct {
+	codes []int8
+	scale float32
+	norm  float32 // L2 norm of the decoded vector.
+}
+
+// quantizeInt8 quantizes v symmetrically around zero.
+func quantizeInt8(v Vector) int8Code {
+	var maxAbs float32
+	for _, x := range v {
+		if a := float32(math.Abs(float64(x))); a > maxAbs {
+			maxAbs = a
+		}
+	}
+
+	c := int8Code{codes: make([]int8, len(v))}
+	if maxAbs == 0 {
+		return c
+	}
+	c.scale = maxAbs / 127
+	var sq float64
+	for i, x := range v {
+		q := int8(math.Round(float64(x / c.scale)))
+		c.codes[i] = q
+		d := float64(c.scale) * float64(q)
+		sq += d * d
+	}
+	c.norm = float32(math.Sqrt(sq))
+	return c
+}
+
+// decode returns the approximate full-precision vector.
+func (c int8Code) decode() Vector {
+	v := make(Vector, len(c.codes))
+	for i, q := range c.codes {
+		v[i] = c.scale * float32(q)
+	}
+	return v
+}
+
+// dotAsymmetric computes the dot product of a full-precision query and c.
+func (c int8Code) dotAsymmetric(query Vector) float32 {
+	var sum float32
+	for i, q := range c.codes {
+		sum += query[i] * float32(q)
+	}
+	return sum * c.scale
+}
+
+// dotSymmetric computes the dot product of two quantized vectors using
+// integer arithmetic.
+func (c int8Code) dotSymmetric(other int8Code) float32 {
+	var sum int32
+	for i, q := range c.codes {
+		sum += int32(q) * int32(other.codes[i])
+	}
+	return float32(sum) * c.scale * other.scale
+}
+
+// quantizedItem is a vector stored by QuantizedFlatSearch.
+type quantizedItem struct {
+	id       string
+	code     int8Code
+	metadata map[string]any
+}
+
+// QuantizedFlatSearch is a brute-force index that stores vectors as int8
+// codes, using a quarter of the memory of FlatSearch.
+type QuantizedFlatSearch struct {
+	mu     sync.RWMutex
+	items  map[string]*quantizedItem
+	metric MetricType
+	mode   QuantizationMode
+}
+
+// NewQuantizedFlatSearch creates a quantized flat index. mode selects
+// symmetric or asymmetric distance computation.
+func NewQuantizedFlatSearch(metric MetricType, mode QuantizationMode) *QuantizedFlatSearch {
+	if mode == QuantizationNone {
+		mode = QuantizationInt8Asymmetric
+	}
+	return &QuantizedFlatSearch{
+		items:  make(map[string]*quantizedItem),
+		metric: metric,
+		mode:   mode,
+	}
+}
+
+// Add quantizes and inserts a vector.
+func (q *QuantizedFlatSearch) Add(id string, vector Vector, metadata map[string]any) error {
+	item := &quantizedItem{id: id, code: quantizeInt8(vector), metadata: metadata}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items[id] = item
+	return nil
+}
+
+// toVectorItem decodes a stored item.
+func (it *quantizedItem) toVectorItem() *VectorItem {
+	return &VectorItem{
+		ID:       it.id,
+		Vector:   it.code.decode(),
+		Metadata: it.metadata,
+		Cost:     int64(len(it.code.codes)) + 4,
+		norm:     it.code.norm,
+	}
+}
+
+// Get retrieves a vector by its ID. The returned vector is decoded from its
+// int8 codes and therefore approximate.
+func (q *QuantizedFlatSearch) Get(id string) (*VectorItem, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	item, found := q.items[id]
+	if !found {
+		return nil, false
+	}
+	return item.toVectorItem(), true
+}
+
+// Delete removes a vector by its ID.
+func (q *QuantizedFlatSearch) Delete(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.items, id)
+	return nil
+}
+
+// liveItems returns all vectors in the store, decoded.
+func (q *QuantizedFlatSearch) liveItems() []*VectorItem {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	items := make([]*VectorItem, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, item.toVectorItem())
+	}
+	return items
+}
+
+// Search searches for the k nearest vectors to the query.
+func (q *QuantizedFlatSearch) Search(query Vector, k int) ([]SearchResult, error) {
+	return q.searchWithMetric(query, k, q.metric, nil)
+}
+
+// SearchWithFilter performs a search with metadata filtering.
+func (q *QuantizedFlatSearch) SearchWithFilter(query Vector, k int, filter FilterFunc) ([]SearchResult, error) {
+	return q.searchWithMetric(query, k, q.metric, filter)
+}
+
+// searchWithMetric scores every stored code against the query with the
+// given metric. Inner product scores are positive, higher is better.
+func (q *QuantizedFlatSearch) searchWithMetric(query Vector, k int, metric MetricType, filter FilterFunc) ([]SearchResult, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if k <= 0 {
+		k = 10
+	}
+
+	symmetric := q.mode == QuantizationInt8
+	queryNorm := vectorNorm(query)
+	var queryCode int8Code
+	if symmetric {
+		queryCode = quantizeInt8(query)
+		queryNorm = queryCode.norm
+	}
+
+	results := make([]SearchResult, 0, len(q.items))
+	for _, item := range q.items {
+		if len(item.code.codes) != len(query) {
+			continue
+		}
+		if filter != nil && !filter(item.metadata) {
+			continue
+		}
+		var dot float32
+		if symmetric {
+			dot = item.code.dotSymmetric(queryCode)
+		} else {
+			dot = item.code.dotAsymmetric(query)
+		}
+		results = append(results, SearchResult{
+			ID:       item.id,
+			Score:    metricScore(metric, dot, queryNorm, item.code.norm),
+			Metadata: item.metadata,
+		})
+	}
+
+	sortResults(results, metric)
+	if len(results) > k {
+		results = results[:k]
+	}
+	for i := range results {
+		results[i].Vector = q.items[results[i].ID].code.decode()
+	}
+	return results, nil
+}
+
+// Len returns the number of vectors in the store.
+func (q *QuantizedFlatSearch) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.items)
+}
+
+// Clear removes all vectors from the store.
+func (q *QuantizedFlatSearch) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = make(map[string]*quantizedItem)
+}
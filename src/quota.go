@@ -0,0 +1,168 @@
+package src
+
+import (
+	"time"
+)
+
+// Quota alert reasons
+const (
+	QuotaCost      = "cost"
+	QuotaEvictions = "evictions"
+)
+
+// SoftQuota sets thresholds on a Manager instance that raise alerts before
+// the shared budget starts evicting. Zero fields are not checked
+type SoftQuota struct {
+	// CostShare is the share of the Manager budget (of the instance MaxCost
+	// without a budget) the instance may hold, e.g. 0.25
+	CostShare float64
+	// EvictionRate is the number of evictions per second the instance may see
+	EvictionRate float64
+}
+
+// QuotaAlert reports an instance that went over a soft quota
+type QuotaAlert struct {
+	Name   string
+	Reason string // QuotaCost or QuotaEvictions
+
+	Cost         int64
+	CostLimit    int64
+	EvictionRate float64
+	RateLimit    float64
+}
+
+// quotaState is the soft quota of an instance and what the last check saw
+type quotaState struct {
+	quota SoftQuota
+
+	lastEvicted int64
+	lastCheck   time.Time
+
+	// over tracks which reasons are alerted, so an alert fires once per
+	// crossing and again only after the instance went back under
+	over map[string]bool
+}
+
+// SetSoftQuota sets the soft quota of the instance named name; a zero quota
+// removes it. Quotas are checked by CheckQuotas and WatchQuotas
+func (m *Manager) SetSoftQuota(name string, quota SoftQuota) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mi, ok := m.instances[name]
+	if !ok {
+		return ErrUnknownInstance
+	}
+	if quota == (SoftQuota{}) {
+		delete(m.quotas, name)
+		return nil
+	}
+	m.quotas[name] = &quotaState{
+		quota:       quota,
+		lastEvicted: instanceEvictions(mi),
+		lastCheck:   time.Now(),
+		over:        make(map[string]bool),
+	}
+	return nil
+}
+
+// OnQuotaAlert sets the callback called for every new alert
+func (m *Manager) OnQuotaAlert(fn func(QuotaAlert)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onQuotaAlert = fn
+}
+
+// CheckQuotas checks every soft quota and returns the new alerts: instances
+// that went over a threshold since the last check. The OnQuotaAlert callback
+// is called for each
+func (m *Manager) CheckQuotas() []QuotaAlert {
+	m.mu.Lock()
+	now := time.Now()
+	var alerts []QuotaAlert
+	for name, qs := range m.quotas {
+		mi, ok := m.instances[name]
+		if !ok {
+			continue
+		}
+		alerts = append(alerts, qs.check(name, mi, m.MaxCost(), now)...)
+	}
+	fn := m.onQuotaAlert
+	m.mu.Unlock()
+
+	if fn != nil {
+		for _, alert := range alerts {
+			fn(alert)
+		}
+	}
+	return alerts
+}
+
+// WatchQuotas runs CheckQuotas every interval until the Manager is closed
+func (m *Manager) WatchQuotas(interval time.Duration) {
+	m.watch.Do(func() {
+		goWorker(&m.wg, "quotaWatcher", &m.watchRestarts, func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					m.CheckQuotas()
+				case <-m.stopCh:
+					return
+				}
+			}
+		})
+	})
+}
+
+// check compares the instance against the quota and returns the alerts of
+// thresholds newly crossed. budget is the Manager budget, 0 if none
+func (qs *quotaState) check(name string, mi *managedInstance, budget int64, now time.Time) []QuotaAlert {
+	var alerts []QuotaAlert
+	caches := mi.caches()
+
+	if qs.quota.CostShare > 0 {
+		limitBase := budget
+		var cost int64
+		for _, c := range caches {
+			cost += c.Cost()
+			if budget == 0 {
+				limitBase += c.MaxCost()
+			}
+		}
+		limit := int64(float64(limitBase) * qs.quota.CostShare)
+		if qs.crossed(QuotaCost, cost > limit) {
+			alerts = append(alerts, QuotaAlert{Name: name, Reason: QuotaCost, Cost: cost, CostLimit: limit})
+		}
+	}
+
+	evicted := instanceEvictions(mi)
+	if qs.quota.EvictionRate > 0 {
+		if elapsed := now.Sub(qs.lastCheck).Seconds(); elapsed > 0 {
+			rate := float64(evicted-qs.lastEvicted) / elapsed
+			if qs.crossed(QuotaEvictions, rate > qs.quota.EvictionRate) {
+				alerts = append(alerts, QuotaAlert{Name: name, Reason: QuotaEvictions, EvictionRate: rate, RateLimit: qs.quota.EvictionRate})
+			}
+		}
+	}
+	qs.lastEvicted = evicted
+	qs.lastCheck = now
+	return alerts
+}
+
+// crossed records whether reason is over its threshold and reports whether
+// it just went over
+func (qs *quotaState) crossed(reason string, over bool) bool {
+	was := qs.over[reason]
+	qs.over[reason] = over
+	return over && !was
+}
+
+// instanceEvictions returns the number of keys the instance evicted
+func instanceEvictions(mi *managedInstance) int64 {
+	var evicted int64
+	for _, c := range mi.caches() {
+		evicted += c.Metrics().KeysEvicted()
+	}
+	return evicted
+}
@@ -0,0 +1,197 @@
+package src
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Permission is a set of access rights on a scope.
+type Permission uint8
+
+const (
+	// PermRead allows reads and searches.
+	PermRead Permission = 1 << iota
+	// PermWrite allows sets and deletes.
+	PermWrite
+	// PermAdmin allows administrative operations and implies read and write.
+	PermAdmin
+)
+
+// ScopeAll is the scope of operations on a whole server, such as stats. Only
+// a grant on "*" covers it.
+const ScopeAll = "*"
+
+var (
+	// ErrUnauthenticated is returned for an unknown token.
+	ErrUnauthenticated = errors.New("unknown access token")
+	// ErrForbidden is returned when a token lacks a permission on a scope.
+	ErrForbidden = errors.New("permission denied")
+)
+
+// ParsePermission parses a permission string such as "r", "rw" or "admin".
+func ParsePermission(s string) (Permission, error) {
+	if s == "admin" {
+		return PermAdmin, nil
+	}
+	var p Permission
+	for _, c := range s {
+		switch c {
+		case 'r':
+			p |= PermRead
+		case 'w':
+			p |= PermWrite
+		case 'a':
+			p |= PermAdmin
+		default:
+			return 0, fmt.Errorf("invalid permission %q", s)
+		}
+	}
+	return p, nil
+}
+
+// String returns the permission as a string of r, w and a flags.
+func (p Permission) String() string {
+	var b strings.Builder
+	if p&PermRead != 0 {
+		b.WriteByte('r')
+	}
+	if p&PermWrite != 0 {
+		b.WriteByte('w')
+	}
+	if p&PermAdmin != 0 {
+		b.WriteByte('a')
+	}
+	return b.String()
+}
+
+// AccessPolicy maps access tokens to permissions on scopes, so that one
+// daemon can serve several teams. A scope names a namespace or collection,
+// e.g. "search/products"; a grant on "search/*" covers every scope with that
+// prefix and a grant on "*" covers all scopes. Network front-ends call
+// Authorize before each operation, with the key as the scope of cache
+// operations, so a grant on "team-a/*" covers the keys with that prefix.
+// Tokens are kept only as SHA-256 digests.
+type AccessPolicy struct {
+	mu     sync.RWMutex
+	grants map[[sha256.Size]byte]map[string]Permission
+}
+
+// NewAccessPolicy creates an empty policy that denies everything.
+func NewAccessPolicy() *AccessPolicy {
+	return &AccessPolicy{grants: make(map[[sha256.Size]byte]map[string]Permission)}
+}
+
+// Grant adds perm on scope to token.
+func (p *AccessPolicy) Grant(token, scope string, perm Permission) {
+	key := sha256.Sum256([]byte(token))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	scopes, ok := p.grants[key]
+	if !ok {
+		scopes = make(map[string]Permission)
+		p.grants[key] = scopes
+	}
+	scopes[scope] |= perm
+}
+
+// Revoke removes all permissions of token on scope.
+func (p *AccessPolicy) Revoke(token, scope string) {
+	key := sha256.Sum256([]byte(token))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.grants[key], scope)
+}
+
+// RevokeToken removes token entirely.
+func (p *AccessPolicy) RevokeToken(token string) {
+	key := sha256.Sum256([]byte(token))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.grants, key)
+}
+
+// Authorize checks that token holds perm on scope.
+// It returns ErrUnauthenticated or ErrForbidden otherwise. A nil policy
+// allows everything, so front-ends without one stay open; a perm of 0 only
+// checks that the token is known.
+func (p *AccessPolicy) Authorize(token, scope string, perm Permission) error {
+	if p == nil {
+		return nil
+	}
+	key := sha256.Sum256([]byte(token))
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	scopes, ok := p.grants[key]
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	var held Permission
+	for pattern, granted := range scopes {
+		if scopeMatches(pattern, scope) {
+			held |= granted
+		}
+	}
+	if held&PermAdmin != 0 {
+		held |= PermRead | PermWrite
+	}
+	if held&perm != perm {
+		return fmt.Errorf("%w: %s on %q", ErrForbidden, perm, scope)
+	}
+	return nil
+}
+
+// Allowed reports whether token holds perm on scope.
+func (p *AccessPolicy) Allowed(token, scope string, perm Permission) bool {
+	return p.Authorize(token, scope, perm) == nil
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header
+// value, or "" if it holds none.
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// scopeMatches reports whether a grant pattern covers scope.
+func scopeMatches(pattern, scope string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(scope, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == scope
+}
+
+// LoadAccessPolicy reads a policy from JSON mapping tokens to scopes and
+// permissions:
+//
+//	{"team-a-token": {"team-a/*": "rw", "shared/*": "r"}, "ops-token": {"*": "admin"}}
+func LoadAccessPolicy(r io.Reader) (*AccessPolicy, error) {
+	var raw map[string]map[string]string
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	p := NewAccessPolicy()
+	for token, scopes := range raw {
+		for scope, s := range scopes {
+			perm, err := ParsePermission(s)
+			if err != nil {
+				return nil, err
+			}
+			p.Grant(token, scope, perm)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,191 @@
+package src
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Refresh-ahead defaults
+const (
+	// DefaultRefreshAhead is the share of an entry's TTL left at which a read
+	// triggers a background refresh
+	DefaultRefreshAhead = 0.2
+	// DefaultRefreshWorkers is the number of refresh workers per cache
+	DefaultRefreshWorkers = 4
+)
+
+// RefreshFunc reloads key before it expires, returning the new value, its
+// cost and its TTL (0 keeps the entry without expiration)
+type RefreshFunc func(key string) (any, int64, time.Duration, error)
+
+// refresher holds the registered RefreshFuncs of a cache and the keys
+// queued or being refreshed
+type refresher struct {
+	mu       sync.RWMutex
+	keys     map[string]RefreshFunc
+	prefixes map[string]RefreshFunc
+
+	active  atomic.Bool // a RefreshFunc was registered
+	pending sync.Map    // key -> struct{}, queued or in flight
+	queue   chan string
+	start   sync.Once
+}
+
+func newRefresher(workers int) *refresher {
+	return &refresher{
+		keys:     make(map[string]RefreshFunc),
+		prefixes: make(map[string]RefreshFunc),
+		queue:    make(chan string, workers*64),
+	}
+}
+
+// lookup returns the RefreshFunc of key: the one registered for the key
+// itself, else the one of the longest matching prefix
+func (r *refresher) lookup(key string) (RefreshFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if fn, ok := r.keys[key]; ok {
+		return fn, true
+	}
+	var best RefreshFunc
+	bestLen := -1
+	for prefix, fn := range r.prefixes {
+		if len(prefix) > bestLen && strings.HasPrefix(key, prefix) {
+			best, bestLen = fn, len(prefix)
+		}
+	}
+	return best, best != nil
+}
+
+// RefreshKey registers fn to reload key in the background when a read finds
+// less than Config.RefreshAhead of its TTL left, so readers keep hitting the
+// old value instead of missing. A nil fn removes the registration
+func (c *RistrettoCache) RefreshKey(key string, fn RefreshFunc) {
+	c.registerRefresh(c.refresh.keys, key, fn)
+}
+
+// RefreshPrefix is RefreshKey for every key starting with prefix.
+// A key registration wins over a prefix, a longer prefix over a shorter one
+func (c *RistrettoCache) RefreshPrefix(prefix string, fn RefreshFunc) {
+	c.registerRefresh(c.refresh.prefixes, prefix, fn)
+}
+
+func (c *RistrettoCache) registerRefresh(funcs map[string]RefreshFunc, name string, fn RefreshFunc) {
+	r := c.refresh
+	r.mu.Lock()
+	if fn == nil {
+		delete(funcs, name)
+	} else {
+		funcs[name] = fn
+	}
+	r.mu.Unlock()
+
+	if fn != nil {
+		r.active.Store(true)
+		// Workers start with the first registration
+		r.start.Do(func() {
+			for i := 0; i < c.config.RefreshWorkers; i++ {
+				goWorker(&c.bgWg, "refresher", &c.metrics.workerRestarts, c.refreshWorker)
+			}
+		})
+	}
+}
+
+// refreshDue reports whether less than share of the TTL of key is left.
+// Entries without a fixed TTL are never due
+func (c *LRUCache) refreshDue(key string, share float64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, ok := c.items[key]
+	if !ok || item.Expiration <= 0 || item.lifetime <= 0 || item.sliding > 0 {
+		return false
+	}
+	left := item.Expiration - time.Now().UnixNano()
+	return float64(left) < float64(item.lifetime)*share
+}
+
+// refreshAhead queues key for a refresh if its remaining TTL is below the
+// refresh-ahead share and a RefreshFunc is registered for it
+func (c *RistrettoCache) refreshAhead(key string) {
+	r := c.refresh
+	if !r.active.Load() || !c.cache.refreshDue(key, c.config.RefreshAhead) {
+		return
+	}
+	if _, ok := r.lookup(key); !ok {
+		return
+	}
+	if _, queued := r.pending.LoadOrStore(key, struct{}{}); queued {
+		return
+	}
+	select {
+	case r.queue <- key:
+	default:
+		// All workers busy, a later read tries again
+		r.pending.Delete(key)
+	}
+}
+
+// refreshWorker reloads queued keys until the cache is closed
+func (c *RistrettoCache) refreshWorker() {
+	for {
+		select {
+		case key := <-c.refresh.queue:
+			c.reload(key)
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// reload runs the RefreshFunc of key and stores the result. On error the
+// old value is kept until it expires
+func (c *RistrettoCache) reload(key string) {
+	r := c.refresh
+	stored := false
+	defer func() {
+		if !stored {
+			r.pending.Delete(key)
+		}
+	}()
+
+	fn, ok := r.lookup(key)
+	if !ok {
+		return
+	}
+	value, cost, ttl, err := fn(key)
+	if err != nil {
+		c.metrics.refreshErrors.Add(1)
+		return
+	}
+	c.metrics.refreshes.Add(1)
+
+	var expiration int64
+	if ttl > 0 {
+		expiration = time.Now().UnixNano() + int64(ttl)
+	}
+	// The key stays pending until the new value lands, so reads in
+	// between do not queue it again
+	stored = c.set(&setItem{
+		key:        key,
+		value:      value,
+		cost:       cost,
+		expiration: expiration,
+		internal:   true,
+		done:       func() { r.pending.Delete(key) },
+	})
+}
+
+// RefreshKey registers fn to reload key before it expires
+func (sc *ShardedCacheV2) RefreshKey(key string, fn RefreshFunc) {
+	sc.getShard(key).RefreshKey(key, fn)
+}
+
+// RefreshPrefix registers fn to reload keys starting with prefix before
+// they expire, on every shard
+func (sc *ShardedCacheV2) RefreshPrefix(prefix string, fn RefreshFunc) {
+	for _, shard := range sc.shards {
+		shard.RefreshPrefix(prefix, fn)
+	}
+}
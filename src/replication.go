@@ -0,0 +1,467 @@
+package src
+
+import (
+	"errors"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Replication defaults
+const (
+	// DefaultReplicaBacklog is the number of records buffered per replica;
+	// a replica that falls further behind is disconnected and resyncs
+	DefaultReplicaBacklog = 8192
+	// DefaultReplicationHeartbeat is how often an idle primary pings replicas
+	DefaultReplicationHeartbeat = time.Second
+	// DefaultReplicaRetry is the wait between reconnection attempts
+	DefaultReplicaRetry = time.Second
+)
+
+// replicationStripes is the number of key locks ordering writes with their
+// replication records
+const replicationStripes = 64
+
+// Server roles reported by RPCStatsReply.Role
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+// ErrReadOnlyReplica is returned by writes to a server replicating from a primary
+var ErrReadOnlyReplica = errors.New("server is a read-only replica")
+
+// ErrAlreadyReplicating is returned by ReplicateFrom on a server that is already a replica
+var ErrAlreadyReplicating = errors.New("server is already replicating")
+
+// replication is the replication state of a CacheServer: the replicas it
+// streams writes to as a primary, or the primary it follows as a replica
+type replication struct {
+	stripes [replicationStripes]sync.Mutex
+
+	mu       sync.Mutex
+	replicas map[*replicaConn]struct{}
+	active   atomic.Int32 // len(replicas), read without mu on every write
+	replica  *Replica     // set while following a primary
+
+	readOnly atomic.Bool
+	backlog  int
+}
+
+func newReplication() *replication {
+	return &replication{replicas: make(map[*replicaConn]struct{}), backlog: DefaultReplicaBacklog}
+}
+
+// lock orders the writes of key with their records and returns the unlock
+func (r *replication) lock(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	m := &r.stripes[h.Sum32()%replicationStripes]
+	m.Lock()
+	return m.Unlock
+}
+
+// record streams rec to every connected replica. A replica whose backlog is
+// full is disconnected; it resyncs when it reconnects
+func (r *replication) record(rec AOFRecord) {
+	if r.active.Load() == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for rc := range r.replicas {
+		select {
+		case rc.records <- rec:
+		default:
+			log.Printf("fastcache: replica %s fell behind, disconnecting", rc.conn.RemoteAddr())
+			r.dropLocked(rc)
+		}
+	}
+}
+
+func (r *replication) dropLocked(rc *replicaConn) {
+	if _, ok := r.replicas[rc]; !ok {
+		return
+	}
+	delete(r.replicas, rc)
+	r.active.Add(-1)
+	close(rc.records)
+	rc.conn.Close()
+}
+
+func (r *replication) drop(rc *replicaConn) {
+	r.mu.Lock()
+	r.dropLocked(rc)
+	r.mu.Unlock()
+}
+
+// role returns RolePrimary or RoleReplica
+func (r *replication) role() string {
+	if r.readOnly.Load() {
+		return RoleReplica
+	}
+	return RolePrimary
+}
+
+// replicaConn is the connection of a replica to this primary
+type replicaConn struct {
+	conn    net.Conn
+	records chan AOFRecord
+}
+
+// ServeReplication accepts replica connections on ln until Close is called.
+// Each replica first receives a full sync of the cache, then every Set and
+// Del the server applies, in the AOF format. Replication is asynchronous:
+// writes are acknowledged before replicas apply them. Only writes made
+// through the server are replicated
+func (s *CacheServer) ServeReplication(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.replListener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if s.repl.readOnly.Load() {
+			// A replica does not chain replicas until it is promoted
+			conn.Close()
+			continue
+		}
+
+		rc := &replicaConn{conn: conn, records: make(chan AOFRecord, s.repl.backlog)}
+		s.repl.mu.Lock()
+		s.repl.replicas[rc] = struct{}{}
+		s.repl.active.Add(1)
+		s.repl.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.streamTo(rc)
+		}()
+	}
+}
+
+// ListenAndServeReplication listens on the TCP address addr for replicas
+func (s *CacheServer) ListenAndServeReplication(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeReplication(ln)
+}
+
+// streamTo sends a full sync and then the live records to a replica.
+// The replica is registered before the sync, so writes racing with it are
+// sent again afterwards; records are idempotent, so the replica converges
+func (s *CacheServer) streamTo(rc *replicaConn) {
+	defer s.repl.drop(rc)
+	w := NewAOFWriter(rc.conn)
+
+	if err := s.fullSync(w); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(DefaultReplicationHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case rec, ok := <-rc.records:
+			if !ok {
+				return
+			}
+			if err := w.Write(rec); err != nil {
+				return
+			}
+			// Batch the records already queued into one write
+			if len(rc.records) == 0 || w.Buffered() > 64<<10 {
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		case <-heartbeat.C:
+			if err := w.Write(AOFRecord{Op: AOFPing}); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// fullSync writes a FLUSHALL followed by a SET for every live []byte or
+// string entry
+func (s *CacheServer) fullSync(w *AOFWriter) error {
+	if err := w.Write(AOFRecord{Op: AOFFlushAll}); err != nil {
+		return err
+	}
+	for _, shard := range s.cache.shards {
+		now := time.Now().UnixNano()
+		for _, item := range shard.cache.Entries() {
+			if item.Expiration > 0 && now > item.Expiration {
+				continue
+			}
+			value, ok := rpcBytes(item.Value, true)
+			if !ok {
+				continue
+			}
+			rec := AOFRecord{Op: AOFSet, Key: item.Key, Value: value, Cost: item.Cost}
+			if item.Expiration > 0 {
+				rec.TTL = time.Duration(item.Expiration - now)
+			}
+			if err := w.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// ReplicaOptions configures a replica
+type ReplicaOptions struct {
+	// PromoteAfter promotes the replica to primary once the primary has been
+	// unreachable this long. 0 disables automatic promotion; use Promote
+	PromoteAfter time.Duration
+	// RetryInterval is the wait between reconnection attempts (default DefaultReplicaRetry)
+	RetryInterval time.Duration
+	// OnPromote is called after the replica is promoted
+	OnPromote func()
+}
+
+// ReplicaStatus reports the state of a replica
+type ReplicaStatus struct {
+	Primary     string
+	Connected   bool
+	Promoted    bool
+	Applied     int64     // records applied
+	Resyncs     int64     // full syncs received
+	LastContact time.Time // last record or heartbeat from the primary
+}
+
+// Replica follows a primary, applying its stream to the local cache
+type Replica struct {
+	server  *CacheServer
+	primary string
+	opts    ReplicaOptions
+
+	mu          sync.Mutex
+	conn        net.Conn
+	connected   bool
+	lastContact time.Time
+
+	applied  atomic.Int64
+	resyncs  atomic.Int64
+	promoted atomic.Bool
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// ReplicateFrom makes the server a read-only replica of the primary whose
+// ServeReplication listens at addr. Writes to the server return
+// ErrReadOnlyReplica until the replica is promoted, either by Promote or
+// after the primary has been unreachable for opts.PromoteAfter
+func (s *CacheServer) ReplicateFrom(addr string, opts ReplicaOptions) (*Replica, error) {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultReplicaRetry
+	}
+
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if s.repl.replica != nil {
+		return nil, ErrAlreadyReplicating
+	}
+	r := &Replica{
+		server:      s,
+		primary:     addr,
+		opts:        opts,
+		lastContact: time.Now(),
+		stopCh:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	s.repl.replica = r
+	s.repl.readOnly.Store(true)
+	go r.run()
+	return r, nil
+}
+
+// Role returns RolePrimary or RoleReplica
+func (s *CacheServer) Role() string {
+	return s.repl.role()
+}
+
+// run connects to the primary and applies its stream, reconnecting on
+// errors, until the replica is stopped or promoted
+func (r *Replica) run() {
+	defer close(r.done)
+	var lastLogged time.Time
+	for {
+		err := r.follow()
+		if r.stopped() {
+			return
+		}
+
+		r.mu.Lock()
+		lastContact := r.lastContact
+		r.mu.Unlock()
+		// Log once per outage, not on every retry
+		if err != nil && err != io.EOF && lastContact != lastLogged {
+			log.Printf("fastcache: replicating from %s: %v", r.primary, err)
+			lastLogged = lastContact
+		}
+
+		since := time.Since(lastContact)
+		if r.opts.PromoteAfter > 0 && since >= r.opts.PromoteAfter {
+			log.Printf("fastcache: primary %s unreachable for %v, promoting", r.primary, since.Round(time.Millisecond))
+			r.Promote()
+			return
+		}
+
+		select {
+		case <-time.After(r.opts.RetryInterval):
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// follow applies the stream of one connection until it fails
+func (r *Replica) follow() error {
+	conn, err := net.DialTimeout("tcp", r.primary, r.opts.RetryInterval)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if r.stopped() {
+		r.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	r.conn, r.connected = conn, true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.conn, r.connected = nil, false
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	// The primary pings every heartbeat, so silence means it is gone
+	timeout := 3 * DefaultReplicationHeartbeat
+	aof := NewAOFReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		rec, err := aof.Read()
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.lastContact = time.Now()
+		r.mu.Unlock()
+
+		switch rec.Op {
+		case AOFPing:
+			continue
+		case AOFFlushAll:
+			r.resyncs.Add(1)
+		}
+		r.server.cache.applyAOF(rec)
+		r.applied.Add(1)
+	}
+}
+
+func (r *Replica) stopped() bool {
+	select {
+	case <-r.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop ends replication and waits for the replica loop to exit
+func (r *Replica) stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+		r.mu.Lock()
+		if r.conn != nil {
+			r.conn.Close()
+		}
+		r.mu.Unlock()
+	})
+}
+
+// Promote stops replicating and makes the server a writable primary. The
+// cache keeps the data replicated so far; writes the old primary
+// acknowledged but had not streamed yet are lost
+func (r *Replica) Promote() {
+	if r.promoted.Swap(true) {
+		return
+	}
+	r.stop()
+
+	repl := r.server.repl
+	repl.mu.Lock()
+	if repl.replica == r {
+		repl.replica = nil
+	}
+	repl.mu.Unlock()
+	repl.readOnly.Store(false)
+
+	if r.opts.OnPromote != nil {
+		r.opts.OnPromote()
+	}
+}
+
+// Status returns the state of the replica
+func (r *Replica) Status() ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ReplicaStatus{
+		Primary:     r.primary,
+		Connected:   r.connected,
+		Promoted:    r.promoted.Load(),
+		Applied:     r.applied.Load(),
+		Resyncs:     r.resyncs.Load(),
+		LastContact: r.lastContact,
+	}
+}
+
+// Done is closed when the replica stops following the primary
+func (r *Replica) Done() <-chan struct{} {
+	return r.done
+}
+
+// closeReplication disconnects replicas and stops following a primary
+func (s *CacheServer) closeReplication() {
+	s.repl.mu.Lock()
+	for rc := range s.repl.replicas {
+		s.repl.dropLocked(rc)
+	}
+	replica := s.repl.replica
+	s.repl.mu.Unlock()
+
+	if replica != nil {
+		replica.stop()
+		<-replica.done
+	}
+}
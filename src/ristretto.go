@@ -1,6 +1,7 @@
 package src
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
@@ -13,6 +14,7 @@ type RistrettoCache struct {
 	config  *Config
 	cache   *LRUCache
 	freq    *Frequency
+	door    *doorkeeper
 	metrics *Metrics
 	closed  atomic.Bool
 
@@ -28,10 +30,46 @@ type RistrettoCache struct {
 	// GC configuration (from ShardedCacheV2)
 	gcInterval     time.Duration
 	gcMemThreshold int
-	// Shared stop channel for ShardedCacheV2 GC
+	// Stop channel for background workers (TTL cleaner, GC), closed on Close
 	stopCh chan struct{}
 
-	wg sync.WaitGroup
+	// wg tracks the write processor, bgWg tracks background workers
+	wg   sync.WaitGroup
+	bgWg sync.WaitGroup
+
+	// in-flight GetOrSet loads, keyed by cache key
+	flights flightGroup
+
+	// maxCost is Config.MaxCost, changed at runtime by SetMaxCost
+	maxCost atomic.Int64
+
+	// victim picks the main segment key that a key leaving the window
+	// competes with under AdmissionTinyLFU, mainVictim
+	victim func() string
+
+	// budget is a MaxCost shared with other caches, nil if the cache has its own
+	budget *costBudget
+
+	// refresh-ahead registrations and queue
+	refresh *refresher
+
+	// prefetch predicts and loads the next keys, nil unless Config.Prefetch is set
+	prefetch *prefetcher
+
+	// invalidator publishes deletes to peers, nil unless Config.Invalidator is set
+	invalidator *invalidationLink
+
+	// throttle applies per-caller write limits, nil unless Config.WriteLimit(s) is set
+	throttle *writeThrottle
+
+	// degrade switches optional bookkeeping off under overload
+	degrade *degrader
+
+	// deltas tracks the snapshot chain of SaveDelta and SaveIncremental
+	deltas deltaChain
+
+	// chaos injects faults in test builds with the fastcache_chaos tag
+	chaos chaosHooks
 }
 
 type setItem struct {
@@ -39,6 +77,14 @@ type setItem struct {
 	value      any
 	cost       int64
 	expiration int64
+	sliding    int64  // sliding TTL in nanoseconds, 0 for a fixed TTL
+	apply      func() // read-modify-write run instead of the set, see applySync
+	internal   bool   // written by the cache itself, exempt from write limits
+	waited     bool   // the caller waits for done, so DropOldest must not drop it
+	dropped    bool   // dropped from the buffer by DropOldest before done
+
+	// done is called once the item has been processed
+	done func()
 }
 
 // NewRistrettoCache creates a new cache
@@ -57,11 +103,30 @@ func NewRistrettoCache(config *Config) (*RistrettoCache, error) {
 	if config.BufferItems <= 0 {
 		config.BufferItems = 64
 	}
+	if config.SampleSize <= 0 {
+		config.SampleSize = DefaultSampleSize
+	}
+	if config.CloseTimeout <= 0 {
+		config.CloseTimeout = DefaultCloseTimeout
+	}
+	if config.WindowRatio <= 0 || config.WindowRatio >= 1 {
+		config.WindowRatio = DefaultWindowRatio
+	}
+	if config.AdmissionThreshold <= 0 || config.AdmissionThreshold > 1 {
+		config.AdmissionThreshold = DefaultAdmissionThreshold
+	}
+	if config.RefreshAhead <= 0 || config.RefreshAhead >= 1 {
+		config.RefreshAhead = DefaultRefreshAhead
+	}
+	if config.RefreshWorkers <= 0 {
+		config.RefreshWorkers = DefaultRefreshWorkers
+	}
 
 	c := &RistrettoCache{
 		config:         config,
 		cache:          NewLRUCache(config.MaxCost),
 		freq:           NewFrequency(config.NumCounters),
+		door:           newDoorkeeper(config.NumCounters),
 		metrics:        NewMetrics(),
 		setBuf:         make(chan *setItem, config.BufferItems*10),
 		waitCh:         make(chan struct{}),
@@ -71,23 +136,54 @@ func NewRistrettoCache(config *Config) (*RistrettoCache, error) {
 		gcInterval:     config.GCInterval,
 		gcMemThreshold: config.GcMemThreshold,
 		stopCh:         make(chan struct{}),
+		refresh:        newRefresher(config.RefreshWorkers),
+		throttle:       newWriteThrottle(config),
+	}
+	c.degrade = newDegrader(config, c.bufferFill)
+	if config.OrderedKeys {
+		c.cache.keys = newKeyIndex()
+	}
+	if config.InternKeys {
+		c.cache.arena = newKeyArena()
+	}
+	if config.DeltaSnapshots {
+		c.cache.changed = make(map[string]struct{})
+	}
+	c.maxCost.Store(config.MaxCost)
+	c.victim = c.mainVictim
+	if config.Policy == PolicyARC {
+		c.cache.enableARC()
+	} else {
+		c.cache.enableWindow(c.windowCost(config.MaxCost))
+	}
+	c.freq.onDecay = c.door.reset
+	if config.Prefetch && config.Loader != nil {
+		c.prefetch = newPrefetcher(config.PrefetchWorkers, func(key string) { c.prefetchLoad(c.prefetch, key) },
+			&c.bgWg, c.stopCh, &c.metrics.workerRestarts)
 	}
 
 	// Start async write processor
-	c.wg.Add(1)
-	go c.processSets()
+	c.startProcessor()
 
 	// Start TTL cleaner
 	if config.TTL > 0 {
-		c.wg.Add(1)
-		go c.ttlCleaner(config.TTL)
+		goWorker(&c.bgWg, "ttlCleaner", &c.metrics.workerRestarts, func() { c.ttlCleaner(config.TTL) })
 	}
 
 	// Start GC if enabled (for standalone RistrettoCache)
 	// ShardedCacheV2 will manage GC separately
 	if config.GCInterval > 0 && config.GcMemThreshold > 0 {
-		c.wg.Add(1)
-		go c.gcRunner()
+		goWorker(&c.bgWg, "gcRunner", &c.metrics.workerRestarts, c.gcRunner)
+	}
+
+	if config.Invalidator != nil {
+		link, err := startInvalidation(config.Invalidator, config.InstanceID, c.applyInvalidation,
+			&c.bgWg, c.stopCh, &c.metrics.workerRestarts)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.invalidator = link
 	}
 
 	return c, nil
@@ -96,59 +192,138 @@ func NewRistrettoCache(config *Config) (*RistrettoCache, error) {
 // Set sets a value
 // returns accepted - may be dropped due to contention
 func (c *RistrettoCache) Set(key string, value any, cost int64) bool {
-	return c.setWithOptions(key, value, cost, 0)
+	return c.setWithTTL(context.Background(), key, value, cost, 0)
 }
 
 // SetWithTTL sets a value with TTL
 func (c *RistrettoCache) SetWithTTL(key string, value any, cost int64, ttl time.Duration) bool {
+	return c.setWithTTL(context.Background(), key, value, cost, ttl)
+}
+
+// setWithTTL is SetWithTTL, audited with the actor of ctx
+func (c *RistrettoCache) setWithTTL(ctx context.Context, key string, value any, cost int64, ttl time.Duration) bool {
+	c.invalidateOnSet(key)
 	var expiration int64
 	if ttl > 0 {
 		expiration = time.Now().UnixNano() + int64(ttl)
 	}
-	return c.setWithOptions(key, value, cost, expiration)
+	var stored bool
+	if c.config.SlidingTTL && ttl > 0 {
+		stored = c.set(&setItem{key: key, value: value, cost: cost, expiration: expiration, sliding: int64(ttl)})
+	} else {
+		stored = c.setWithOptions(key, value, cost, expiration)
+	}
+	c.config.Audit.Record(ctx, AuditSet, key, value, stored)
+	return stored
+}
+
+// SetWithSlidingTTL sets a value whose TTL is renewed on every Get, so it
+// expires after ttl without reads
+func (c *RistrettoCache) SetWithSlidingTTL(key string, value any, cost int64, ttl time.Duration) bool {
+	if ttl <= 0 {
+		return c.Set(key, value, cost)
+	}
+	c.invalidateOnSet(key)
+	stored := c.set(&setItem{key: key, value: value, cost: cost, expiration: time.Now().UnixNano() + int64(ttl), sliding: int64(ttl)})
+	c.config.Audit.Record(context.Background(), AuditSet, key, value, stored)
+	return stored
 }
 
 // setWithOptions internal set method
 func (c *RistrettoCache) setWithOptions(key string, value any, cost int64, expiration int64) bool {
-	if c.closed.Load() {
+	return c.set(&setItem{key: key, value: value, cost: cost, expiration: expiration})
+}
+
+// setSync sets a value and waits until it has been applied,
+// so that a following Get observes it; it is audited with the actor of ctx
+func (c *RistrettoCache) setSync(ctx context.Context, key string, value any, cost int64, expiration int64) bool {
+	stored := c.setItemSync(&setItem{key: key, value: value, cost: cost, expiration: expiration})
+	c.config.Audit.Record(ctx, AuditSet, key, value, stored)
+	return stored
+}
+
+// setItemSync sends item to the write buffer and waits until it has been applied
+func (c *RistrettoCache) setItemSync(item *setItem) bool {
+	applied := make(chan struct{})
+	item.done = func() { close(applied) }
+	item.waited = true
+	if !c.set(item) {
 		return false
 	}
+	<-applied
+	return !item.dropped
+}
 
-	// Validate cost
-	if cost < 0 {
-		cost = 1
+// set validates an item and sends it to the write buffer
+func (c *RistrettoCache) set(item *setItem) bool {
+	if c.closed.Load() {
+		return false
 	}
-	if cost == 0 {
-		cost = 1
+	if c.throttled(item) {
+		return false
 	}
+	c.degrade.check()
+	key, value := item.key, item.value
+	cost := c.itemCost(value, item.cost)
 
 	// Reject if cost exceeds max cost
-	if int64(cost) > c.config.MaxCost {
-		c.metrics.setsRejected.Add(1)
-		if c.onReject != nil {
-			c.onReject(key, value, cost)
-		}
-		if c.onExit != nil {
-			c.onExit(value)
-		}
+	if int64(cost) > c.maxCost.Load() {
+		c.reject(key, value, cost)
 		return false
 	}
 
+	item.cost = cost
+
 	// Send to buffer
 	select {
-	case c.setBuf <- &setItem{key, value, cost, expiration}:
+	case c.setBuf <- item:
 		return true
 	default:
-		// Buffer full, drop
-		c.metrics.setsDropped.Add(1)
-		return false
+		// Buffer full, see Config.DropPolicy
+		return c.overflow(item)
+	}
+}
+
+// reject counts a value whose cost exceeds MaxCost and hands it to the
+// OnReject and OnExit callbacks
+func (c *RistrettoCache) reject(key string, value any, cost int64) {
+	c.metrics.setsRejected.Add(1)
+	if c.onReject != nil {
+		c.onReject(key, value, cost)
+	}
+	if c.onExit != nil {
+		c.onExit(value)
+	}
+}
+
+// itemCost returns the cost to store value with: cost if positive, otherwise
+// the CacheCost of a Sizer, Config.Cost or EstimateCost, and at least 1
+func (c *RistrettoCache) itemCost(value any, cost int64) int64 {
+	// Compute cost if not provided
+	if cost == 0 {
+		if sizer, ok := value.(Sizer); ok {
+			cost = sizer.CacheCost()
+		} else if c.config.Cost != nil {
+			cost = c.config.Cost(value)
+		} else {
+			cost = EstimateCost(value)
+		}
+	}
+
+	// Validate cost
+	if cost <= 0 {
+		cost = 1
 	}
+	return cost
+}
+
+// startProcessor starts the write processor
+func (c *RistrettoCache) startProcessor() {
+	goWorker(&c.wg, "processSets", &c.metrics.workerRestarts, c.processSets)
 }
 
 // processSets processes async Sets
 func (c *RistrettoCache) processSets() {
-	defer c.wg.Done()
-
 	for {
 		select {
 		case item := <-c.setBuf:
@@ -169,122 +344,172 @@ func (c *RistrettoCache) processSets() {
 
 // processOneSet processes a single Set
 func (c *RistrettoCache) processOneSet(item *setItem) {
+	if item.done != nil {
+		defer item.done()
+	}
+	c.chaos.delay()
+	if item.apply != nil {
+		item.apply()
+		return
+	}
+	if c.chaos.dropWrite() {
+		c.metrics.setsDropped.Add(1)
+		item.dropped = true
+		return
+	}
+	c.store(item)
+}
+
+// store writes a set to the cache and reports whether it was admitted
+// (write goroutine only)
+func (c *RistrettoCache) store(item *setItem) bool {
 	key := item.key
 
 	// Update frequency first (for admission control)
-	c.freq.Increment(key)
-
-	// TinyLFU admission policy: sample and compare
-	// Only apply when cache is near capacity
-	currentCost := c.cache.Cost()
-	isNearCapacity := c.config.MaxCost > 0 && currentCost > c.config.MaxCost*7/10
-
-	if isNearCapacity && c.cache.Len() > 0 {
-		// Get current key's frequency
-		currentFreq := c.freq.Get(key)
+	c.recordAccess(key)
 
-		// Sample existing keys and find minimum frequency
-		minFreq, evictKey := c.sampleMinFrequency(5)
+	// Custom admission hook
+	if c.config.Admit != nil && !c.admit(item) {
+		return false
+	}
 
-		// If new key frequency is higher, admit it and potentially evict sample
-		if currentFreq > minFreq && evictKey != "" {
-			// Evict the sampled key to make room
-			c.cache.Delete(evictKey)
+	// Update existing item
+	if oldValue, found := c.cache.replace(key, item.value, item.cost, item.expiration, item.sliding); found {
+		c.metrics.costAdded.Add(item.cost)
+		if c.onExit != nil && oldValue != nil {
+			c.onExit(oldValue)
 		}
+		// A larger value may push the cache over its limit
+		c.evictOverLimit()
+		return true
 	}
 
-	// Check current cost
-	availCost := c.config.MaxCost - c.cache.Cost()
+	// W-TinyLFU: make room, add the new item to the window and move the
+	// window overflow into the main segment
+	c.makeRoom(item.cost)
+	c.cache.add(key, item.value, item.cost, item.expiration, item.sliding)
+	c.admitOverflow()
+	c.metrics.keysAdded.Add(1)
+	c.metrics.costAdded.Add(item.cost)
+	return true
+}
 
-	// If new item cost exceeds available cost, evict
-	if int64(item.cost) > availCost {
-		// Evict until enough space
-		for c.cache.Cost()+int64(item.cost) > c.config.MaxCost && c.cache.Len() > 0 {
-			evicted := c.evictOne()
-			if evicted == nil {
-				break
-			}
-		}
+// windowCost returns the size of the W-TinyLFU window for maxCost
+func (c *RistrettoCache) windowCost(maxCost int64) int64 {
+	windowCost := int64(float64(maxCost) * c.config.WindowRatio)
+	if windowCost < 1 {
+		windowCost = 1
 	}
+	return windowCost
+}
 
-	// Try to get old value
-	oldItem, found := c.cache.GetItem(key)
-	if found {
-		// Update existing item
-		c.cache.mu.Lock()
-		oldValue := oldItem.Value
-		oldCost := oldItem.Cost
-		oldItem.Value = item.value
-		oldItem.Cost = item.cost
-		oldItem.Expiration = item.expiration
-		c.cache.cost = c.cache.cost - oldCost + item.cost
-		c.cache.list.MoveToFront(oldItem.element)
-		c.cache.mu.Unlock()
+// MaxCost returns the current cost limit, Config.MaxCost unless changed by
+// SetMaxCost
+func (c *RistrettoCache) MaxCost() int64 {
+	return c.maxCost.Load()
+}
 
-		c.metrics.costAdded.Add(item.cost)
+// SetMaxCost changes the cost limit of a running cache. Shrinking it evicts
+// as a set would, by frequency under PolicyTinyLFU, before it returns
+func (c *RistrettoCache) SetMaxCost(maxCost int64) error {
+	if maxCost <= 0 {
+		return fmt.Errorf("invalid MaxCost %d", maxCost)
+	}
+	return c.applySync("", func() {
+		c.maxCost.Store(maxCost)
+		c.cache.resize(maxCost, c.windowCost(maxCost))
+		c.admitOverflow()
+		c.makeRoom(0)
+	})
+}
 
-		if c.onExit != nil && oldValue != nil {
-			c.onExit(oldValue)
+// evictOverLimit evicts until the cache is within MaxCost again,
+// after an update made a value larger
+func (c *RistrettoCache) evictOverLimit() {
+	for c.cache.Cost() > c.maxCost.Load() && c.cache.Len() > 1 {
+		if c.evictOne() == nil {
+			break
 		}
-	} else {
-		// Add new item
-		c.cache.Add(key, item.value, item.cost, item.expiration)
-		c.metrics.keysAdded.Add(1)
-		c.metrics.costAdded.Add(item.cost)
 	}
 }
 
-// sampleMinFrequency samples keys and returns the minimum frequency
-func (c *RistrettoCache) sampleMinFrequency(sampleSize int) (minFreq int64, evictKey string) {
-	items := c.cache.Items()
-	if len(items) == 0 {
-		return 0, ""
+// admit runs the Admit hook and reports a rejection through the callbacks
+func (c *RistrettoCache) admit(item *setItem) bool {
+	stats := AdmissionStats{
+		Len:     c.cache.Len(),
+		Cost:    c.cache.Cost(),
+		MaxCost: c.maxCost.Load(),
+	}
+	if c.config.Admit(item.key, item.cost, c.estimate(item.key), stats) {
+		return true
 	}
 
-	// Limit sample size
-	if len(items) < sampleSize {
-		sampleSize = len(items)
+	c.metrics.setsRejected.Add(1)
+	if c.onReject != nil {
+		c.onReject(item.key, item.value, item.cost)
 	}
+	if c.onExit != nil {
+		c.onExit(item.value)
+	}
+	return false
+}
 
-	minFreq = 1<<63 - 1
+// mainVictim returns the least recently used probation key of the main
+// segment, the key W-TinyLFU evicts next and so the one a key leaving the
+// window competes with, or "" if the main segment is empty
+func (c *RistrettoCache) mainVictim() string {
+	return c.cache.mainVictim()
+}
+
+// sampledVictim returns the least frequent of SampleSize keys sampled from
+// the main segment, the victim admission used before mainVictim
+func (c *RistrettoCache) sampledVictim() string {
+	_, victim := c.sampleMinFrequency(c.config.SampleSize)
+	return victim
+}
 
-	// Sample random keys
-	for i := 0; i < sampleSize; i++ {
-		key := items[i].Key
-		freq := c.freq.Get(key)
-		if freq < minFreq {
+// sampleMinFrequency samples random keys and returns the one with the minimum frequency
+func (c *RistrettoCache) sampleMinFrequency(sampleSize int) (minFreq int64, evictKey string) {
+	minFreq = 1<<63 - 1
+	c.cache.Sample(sampleSize, func(key string) {
+		if freq := c.estimate(key); freq < minFreq {
 			minFreq = freq
 			evictKey = key
 		}
+	})
+	if evictKey == "" {
+		return 0, ""
 	}
-
 	return minFreq, evictKey
 }
 
-// evictOne evicts one item
+// evictOne evicts the least recently used item
 func (c *RistrettoCache) evictOne() *CacheItem {
-	// Evict from LRU tail (oldest)
-	item := c.cache.GetList().Back()
-	if item == nil {
+	evicted, ok := c.cache.RemoveOldest()
+	if !ok {
 		return nil
 	}
+	c.evicted(&evicted)
+	return &evicted
+}
 
-	evicted := item.Value.(*CacheItem)
+// evictKey evicts key
+func (c *RistrettoCache) evictKey(key string) {
+	if evicted, ok := c.cache.Remove(key); ok {
+		c.evicted(&evicted)
+	}
+}
 
-	// Call callbacks
+// evicted runs the eviction callbacks and metrics for a removed item
+func (c *RistrettoCache) evicted(item *CacheItem) {
 	if c.onEvict != nil {
-		c.onEvict(evicted.Key, evicted.Value, evicted.Cost)
+		c.onEvict(item.Key, item.Value, item.Cost)
 	}
 	if c.onExit != nil {
-		c.onExit(evicted.Value)
+		c.onExit(item.Value)
 	}
-
-	c.cache.RemoveElement(evicted)
-
 	c.metrics.keysEvicted.Add(1)
-	c.metrics.costEvicted.Add(evicted.Cost)
-
-	return evicted
+	c.metrics.costEvicted.Add(item.Cost)
 }
 
 // Get gets a value
@@ -295,13 +520,25 @@ func (c *RistrettoCache) Get(key string) (any, bool) {
 
 	// Use GetAndUpdate to update LRU
 	item, found := c.cache.GetAndUpdate(key)
+	if c.degraded() {
+		// Skip prefetch learning, frequency and metrics
+		if found {
+			c.refreshAhead(key)
+			return item.Value, true
+		}
+		return nil, false
+	}
+	if c.prefetch != nil {
+		c.prefetch.observe(key, found)
+	}
 	if !found {
 		c.metrics.misses.Add(1)
 		return nil, false
 	}
 
 	// Increment frequency
-	c.freq.Increment(key)
+	c.recordAccess(key)
+	c.refreshAhead(key)
 
 	c.metrics.hits.Add(1)
 	return item.Value, true
@@ -315,12 +552,23 @@ func (c *RistrettoCache) GetWithTTL(key string) (any, bool, time.Duration) {
 
 	item, found := c.cache.GetAndUpdate(key)
 	if !found {
-		c.metrics.misses.Add(1)
+		if !c.degraded() {
+			if c.prefetch != nil {
+				c.prefetch.observe(key, found)
+			}
+			c.metrics.misses.Add(1)
+		}
 		return nil, false, 0
 	}
 
-	c.freq.Increment(key)
-	c.metrics.hits.Add(1)
+	if !c.degraded() {
+		if c.prefetch != nil {
+			c.prefetch.observe(key, found)
+		}
+		c.recordAccess(key)
+		c.metrics.hits.Add(1)
+	}
+	c.refreshAhead(key)
 
 	var ttl time.Duration
 	if item.Expiration > 0 {
@@ -333,9 +581,9 @@ func (c *RistrettoCache) GetWithTTL(key string) (any, bool, time.Duration) {
 	return item.Value, true, ttl
 }
 
-// GetTTL gets remaining TTL
+// GetTTL gets remaining TTL (does not renew a sliding TTL)
 func (c *RistrettoCache) GetTTL(key string) (time.Duration, bool) {
-	item, found := c.cache.GetAndUpdate(key)
+	item, found := c.cache.Get(key)
 	if !found {
 		return 0, false
 	}
@@ -377,11 +625,8 @@ func (c *RistrettoCache) MSet(items map[string]any, defaultCost int64) int {
 
 	successCount := 0
 	for key, value := range items {
-		cost := defaultCost
-		if cost <= 0 {
-			cost = 1
-		}
-		if c.Set(key, value, cost) {
+		// A cost of 0 is estimated per value, see itemCost
+		if c.Set(key, value, defaultCost) {
 			successCount++
 		}
 	}
@@ -401,11 +646,7 @@ func (c *RistrettoCache) MSetWithCosts(items map[string]struct {
 
 	successCount := 0
 	for key, item := range items {
-		cost := item.Cost
-		if cost <= 0 {
-			cost = 1
-		}
-		if c.Set(key, item.Value, cost) {
+		if c.Set(key, item.Value, item.Cost) {
 			successCount++
 		}
 	}
@@ -418,6 +659,78 @@ func (c *RistrettoCache) Exists(key string) bool {
 	return found
 }
 
+// Expire sets the TTL of a key without rewriting its value.
+// A ttl of zero or less deletes the key. Returns false if the key is missing.
+// The change is ordered after queued sets and published to peers
+func (c *RistrettoCache) Expire(key string, ttl time.Duration) bool {
+	return c.expire(context.Background(), key, ttl)
+}
+
+// expire is Expire, audited with the actor of ctx
+func (c *RistrettoCache) expire(ctx context.Context, key string, ttl time.Duration) bool {
+	if c.closed.Load() {
+		return false
+	}
+	if ttl <= 0 {
+		if !c.Exists(key) {
+			return false
+		}
+		c.del(ctx, key)
+		return true
+	}
+	ok := c.setExpiration(key, ttl)
+	c.config.Audit.Record(ctx, AuditExpire, key, ttl, ok)
+	return ok
+}
+
+// Persist removes the TTL of a key. Returns false if the key is missing
+func (c *RistrettoCache) Persist(key string) bool {
+	return c.persist(context.Background(), key)
+}
+
+// persist is Persist, audited with the actor of ctx
+func (c *RistrettoCache) persist(ctx context.Context, key string) bool {
+	if c.closed.Load() {
+		return false
+	}
+	ok := c.setExpiration(key, 0)
+	c.config.Audit.Record(ctx, AuditExpire, key, time.Duration(0), ok)
+	return ok
+}
+
+// setExpiration gives a live key a TTL, none if 0, on the write goroutine so
+// that a set queued before it is not left with the old one, and publishes
+// the key so peers drop their copy with the old TTL
+func (c *RistrettoCache) setExpiration(key string, ttl time.Duration) bool {
+	var ok bool
+	err := c.applySync(key, func() {
+		var expiration int64
+		if ttl > 0 {
+			expiration = time.Now().UnixNano() + int64(ttl)
+		}
+		ok = c.cache.SetExpiration(key, expiration)
+	})
+	if err != nil || !ok {
+		return false
+	}
+	c.invalidate(key)
+	return true
+}
+
+// Touch marks a key as used without reading it: it moves the key to the
+// front of the LRU, counts an access and renews a sliding TTL.
+// Returns false if the key is missing
+func (c *RistrettoCache) Touch(key string) bool {
+	if c.closed.Load() {
+		return false
+	}
+	if _, found := c.cache.GetAndUpdate(key); !found {
+		return false
+	}
+	c.recordAccess(key)
+	return true
+}
+
 // CAS performs compare-and-swap operation
 // Only sets the value if the current value matches the old value
 // Returns true if the operation succeeded
@@ -449,6 +762,18 @@ func (c *RistrettoCache) CAS(key string, oldValue any, newValue any, cost int64)
 
 // Del deletes a value
 func (c *RistrettoCache) Del(key string) {
+	c.del(context.Background(), key)
+}
+
+// del is Del, audited with the actor of ctx
+func (c *RistrettoCache) del(ctx context.Context, key string) {
+	c.delLocal(key)
+	c.invalidate(key)
+	c.config.Audit.Record(ctx, AuditDel, key, nil, true)
+}
+
+// delLocal deletes key without notifying peers
+func (c *RistrettoCache) delLocal(key string) {
 	value, found := c.cache.Delete(key)
 	if found {
 		if c.onExit != nil && value != nil {
@@ -469,26 +794,38 @@ func (c *RistrettoCache) Wait() {
 
 	// Recreate waitCh (since it was closed)
 	c.waitCh = make(chan struct{})
-	c.wg.Add(1)
-	go c.processSets()
+	c.startProcessor()
 }
 
-// Close closes the cache
+// Close closes the cache. It returns ErrWorkersStuck if the write processor
+// or a background worker does not stop within Config.CloseTimeout
 func (c *RistrettoCache) Close() error {
 	if c.closed.Swap(true) {
 		return nil
 	}
+	if c.budget != nil {
+		c.budget.leave(c)
+	}
 
 	// Wait for all writes to complete
 	close(c.waitCh)
-	c.wg.Wait()
+	writesDone := waitTimeout(&c.wg, c.config.CloseTimeout)
 
+	// Stop background workers
+	close(c.stopCh)
+	if !waitTimeout(&c.bgWg, c.config.CloseTimeout) || !writesDone {
+		return ErrWorkersStuck
+	}
 	return nil
 }
 
 // Clear clears the cache
 func (c *RistrettoCache) Clear() {
 	c.cache.Clear()
+	if c.invalidator != nil {
+		c.invalidator.publish(Invalidation{Clear: true})
+	}
+	c.config.Audit.Record(context.Background(), AuditClear, "", nil, true)
 }
 
 // Len returns the number of items in the cache
@@ -508,8 +845,6 @@ func (c *RistrettoCache) Metrics() *Metrics {
 
 // ttlCleaner TTL cleaner
 func (c *RistrettoCache) ttlCleaner(ttl time.Duration) {
-	defer c.wg.Done()
-
 	ticker := time.NewTicker(ttl / 2)
 	defer ticker.Stop()
 
@@ -520,7 +855,7 @@ func (c *RistrettoCache) ttlCleaner(ttl time.Duration) {
 				return
 			}
 			c.cleanupExpired()
-		case <-c.waitCh:
+		case <-c.stopCh:
 			return
 		}
 	}
@@ -528,23 +863,22 @@ func (c *RistrettoCache) ttlCleaner(ttl time.Duration) {
 
 // cleanupExpired cleans up expired items
 func (c *RistrettoCache) cleanupExpired() {
-	now := time.Now().UnixNano()
-	items := c.cache.Items()
-
-	for _, item := range items {
-		if item.Expiration > 0 && now > item.Expiration {
-			value, found := c.cache.Delete(item.Key)
-			if found {
-				c.metrics.keysEvicted.Add(1)
-				c.metrics.costEvicted.Add(item.Cost)
-				if c.onEvict != nil {
-					c.onEvict(item.Key, value, item.Cost)
-				}
-				if c.onExit != nil {
-					c.onExit(value)
-				}
-			}
-		}
+	expired := c.cache.DeleteExpired(time.Now().UnixNano())
+
+	for _, e := range expired {
+		c.expired(e)
+	}
+}
+
+// expired runs the eviction callbacks and metrics for an expired entry
+func (c *RistrettoCache) expired(e evictedEntry) {
+	c.metrics.keysEvicted.Add(1)
+	c.metrics.costEvicted.Add(e.cost)
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.value, e.cost)
+	}
+	if c.onExit != nil {
+		c.onExit(e.value)
 	}
 }
 
@@ -555,8 +889,6 @@ func (c *RistrettoCache) GC() {
 
 // gcRunner runs periodic GC and memory management
 func (c *RistrettoCache) gcRunner() {
-	defer c.wg.Done()
-
 	ticker := time.NewTicker(c.gcInterval)
 	defer ticker.Stop()
 
@@ -567,8 +899,6 @@ func (c *RistrettoCache) gcRunner() {
 				return
 			}
 			c.doGC()
-		case <-c.waitCh:
-			return
 		case <-c.stopCh:
 			return
 		}
@@ -578,9 +908,9 @@ func (c *RistrettoCache) gcRunner() {
 // doGC performs garbage collection and memory management
 func (c *RistrettoCache) doGC() {
 	// Check cache cost vs max cost
-	if c.config.MaxCost > 0 {
+	if c.maxCost.Load() > 0 {
 		currentCost := c.cache.Cost()
-		costPercent := int(currentCost * 100 / c.config.MaxCost)
+		costPercent := int(currentCost * 100 / c.maxCost.Load())
 
 		// If cache cost exceeds threshold, trigger cleanup
 		if costPercent > c.gcMemThreshold {
@@ -589,7 +919,7 @@ func (c *RistrettoCache) doGC() {
 
 			// If still over cost limit, evict more items
 			currentCost = c.cache.Cost()
-			for currentCost > c.config.MaxCost && c.cache.Len() > 0 {
+			for currentCost > c.maxCost.Load() && c.cache.Len() > 0 {
 				// Evict 10% of cache items
 				toEvict := c.cache.Len() / 10
 				if toEvict < 1 {
@@ -618,7 +948,7 @@ func (c *RistrettoCache) GetMemStats() map[string]interface{} {
 	runtime.ReadMemStats(&memStats)
 
 	cost := c.cache.Cost()
-	maxCost := c.config.MaxCost
+	maxCost := c.maxCost.Load()
 
 	stats := map[string]interface{}{
 		"alloc":       int64(memStats.Alloc),
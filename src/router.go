@@ -0,0 +1,182 @@
+package src
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Router picks the shard of a key in ShardedCacheV2 and sharded vector
+// stores. Route must return the same shard for a key every time and an
+// index in [0, shards); other indexes are reduced modulo shards
+type Router interface {
+	Route(key string, shards int) int
+}
+
+// MetadataRouter is a Router that places vectors by their metadata when they
+// are added. A vector store remembers the shard of every ID it routes this
+// way, as with VectorStoreConfig.PersistentRouting, so later lookups by ID
+// find it
+type MetadataRouter interface {
+	Router
+	RouteMetadata(key string, metadata map[string]any, shards int) int
+}
+
+// RouterFunc adapts a function to Router, e.g. to force keys onto specific
+// shards in tests
+type RouterFunc func(key string, shards int) int
+
+// Route calls f
+func (f RouterFunc) Route(key string, shards int) int {
+	return f(key, shards)
+}
+
+// HashRouter spreads keys by their FNV-1a hash modulo the shard count. It is
+// the default; changing the shard count moves most keys
+type HashRouter struct{}
+
+// Route returns the hash of key modulo shards
+func (HashRouter) Route(key string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// DefaultRouterReplicas is the default number of points per shard on the
+// ring of a ConsistentHashRouter
+const DefaultRouterReplicas = 128
+
+// ConsistentHashRouter places shards at Replicas points each on a hash ring
+// and routes a key to the next point, so growing from n to n+1 shards only
+// moves about 1/(n+1) of the keys
+type ConsistentHashRouter struct {
+	// Replicas is the number of points per shard (default DefaultRouterReplicas)
+	Replicas int
+
+	mu    sync.RWMutex
+	rings map[int][]ringPoint // by shard count
+}
+
+// ringPoint is a point of the ring owned by a shard
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// NewConsistentHashRouter creates a consistent hash router with replicas
+// points per shard
+func NewConsistentHashRouter(replicas int) *ConsistentHashRouter {
+	return &ConsistentHashRouter{Replicas: replicas}
+}
+
+// Route returns the shard owning the first ring point at or after the hash
+// of key
+func (r *ConsistentHashRouter) Route(key string, shards int) int {
+	ring := r.ring(shards)
+	h := routerHash(key)
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].shard
+}
+
+// ring returns the ring of shards, building it on first use
+func (r *ConsistentHashRouter) ring(shards int) []ringPoint {
+	r.mu.RLock()
+	ring, ok := r.rings[shards]
+	r.mu.RUnlock()
+	if ok {
+		return ring
+	}
+
+	replicas := r.Replicas
+	if replicas <= 0 {
+		replicas = DefaultRouterReplicas
+	}
+	ring = make([]ringPoint, 0, shards*replicas)
+	for shard := 0; shard < shards; shard++ {
+		for i := 0; i < replicas; i++ {
+			ring = append(ring, ringPoint{hash: routerHash(strconv.Itoa(shard) + "#" + strconv.Itoa(i)), shard: shard})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rings == nil {
+		r.rings = make(map[int][]ringPoint)
+	}
+	r.rings[shards] = ring
+	return ring
+}
+
+// routerHash is the 64-bit FNV-1a hash of key with a final mix, so that
+// similar keys spread over the ring
+func routerHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+// MetadataFieldRouter routes vectors by the value of one metadata field, so
+// that e.g. all vectors of a tenant share a shard. Vectors without the field,
+// and keys routed without metadata, use Fallback (default HashRouter)
+type MetadataFieldRouter struct {
+	Field    string
+	Fallback Router
+}
+
+// Route routes key with Fallback
+func (r MetadataFieldRouter) Route(key string, shards int) int {
+	if r.Fallback == nil {
+		return HashRouter{}.Route(key, shards)
+	}
+	return r.Fallback.Route(key, shards)
+}
+
+// RouteMetadata hashes the value of Field in metadata, or routes key with
+// Fallback if it is missing
+func (r MetadataFieldRouter) RouteMetadata(key string, metadata map[string]any, shards int) int {
+	value, ok := metadata[r.Field]
+	if !ok {
+		return r.Route(key, shards)
+	}
+	return HashRouter{}.Route(fmt.Sprint(value), shards)
+}
+
+// route asks router for the shard of key, keeping the index in range
+func route(router Router, key string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	return routeIndex(router.Route(key, shards), shards)
+}
+
+// routeMetadata is route for a key added with metadata
+func routeMetadata(router Router, key string, metadata map[string]any, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	if mr, ok := router.(MetadataRouter); ok {
+		return routeIndex(mr.RouteMetadata(key, metadata, shards), shards)
+	}
+	return routeIndex(router.Route(key, shards), shards)
+}
+
+// routeIndex reduces a routed index modulo shards
+func routeIndex(i, shards int) int {
+	if i < 0 || i >= shards {
+		i %= shards
+		if i < 0 {
+			i += shards
+		}
+	}
+	return i
+}
@@ -0,0 +1,130 @@
+package src
+
+import (
+	"fmt"
+	"time"
+)
+
+// ShardedCacheV2 splits MaxCost between its shards evenly unless
+// Config.ShardWeights says otherwise. Keys rarely spread as evenly as the
+// cost, so with Config.RebalanceInterval a background worker periodically
+// moves cost limit from shards holding less than their share to shards that
+// had to evict. Each shard keeps at least a quarter of its weighted share,
+// and limits move halfway towards their target per step, so a short burst
+// cannot starve a shard
+
+// shardMaxCosts splits total between shards in proportion to weights; every
+// shard gets at least 1
+func shardMaxCosts(total int64, shards int, weights []float64) ([]int64, error) {
+	if len(weights) != shards {
+		return nil, fmt.Errorf("%d shard weights for %d shards", len(weights), shards)
+	}
+	var sum float64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("negative shard weight %v", w)
+		}
+		sum += w
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("shard weights sum to 0")
+	}
+
+	costs := make([]int64, shards)
+	for i, w := range weights {
+		costs[i] = max(int64(float64(total)*w/sum), 1)
+	}
+	return costs, nil
+}
+
+// ShardMaxCosts returns the current cost limit of every shard
+func (sc *ShardedCacheV2) ShardMaxCosts() []int64 {
+	costs := make([]int64, sc.shardCount)
+	for i, shard := range sc.shards {
+		costs[i] = shard.MaxCost()
+	}
+	return costs
+}
+
+// Rebalance moves cost limit from shards with spare room to shards that
+// evicted since the previous Rebalance, keeping the total. It is called every
+// Config.RebalanceInterval, or can be called directly
+func (sc *ShardedCacheV2) Rebalance() error {
+	sc.balanceMu.Lock()
+	defer sc.balanceMu.Unlock()
+
+	// Demand is what a shard holds plus what it had to evict for lack of room
+	demand := make([]int64, sc.shardCount)
+	var totalDemand int64
+	pressure := false
+	for i, shard := range sc.shards {
+		evicted := max(shard.metrics.CostEvicted()-sc.balanceEvicted[i], 0)
+		demand[i] = shard.cache.Cost() + evicted
+		totalDemand += demand[i]
+		pressure = pressure || evicted > 0
+	}
+	if !pressure || totalDemand == 0 {
+		sc.snapshotEvictions()
+		return nil
+	}
+
+	var total, floors int64
+	for _, base := range sc.baseMaxCosts {
+		total += base
+		floors += base / 4
+	}
+	targets := make([]int64, sc.shardCount)
+	current := sc.ShardMaxCosts()
+	var assigned int64
+	for i, base := range sc.baseMaxCosts {
+		target := base/4 + int64(float64(total-floors)*float64(demand[i])/float64(totalDemand))
+		targets[i] = max(current[i]+(target-current[i])/2, 1)
+		assigned += targets[i]
+	}
+	// Rounding leftovers go to the shard with the most demand
+	busiest := 0
+	for i := range demand {
+		if demand[i] > demand[busiest] {
+			busiest = i
+		}
+	}
+	targets[busiest] = max(targets[busiest]+total-assigned, 1)
+
+	// Shrink before growing, so the shards never exceed the total together
+	for _, shrink := range []bool{true, false} {
+		for i, shard := range sc.shards {
+			if (targets[i] < current[i]) != shrink || targets[i] == current[i] {
+				continue
+			}
+			if err := shard.SetMaxCost(targets[i]); err != nil {
+				return err
+			}
+		}
+	}
+	// Evictions caused by shrinking are not demand
+	sc.snapshotEvictions()
+	return nil
+}
+
+// snapshotEvictions records the cost evicted by every shard so far (caller
+// must hold balanceMu)
+func (sc *ShardedCacheV2) snapshotEvictions() {
+	for i, shard := range sc.shards {
+		sc.balanceEvicted[i] = shard.metrics.CostEvicted()
+	}
+}
+
+// rebalancer runs Rebalance every Config.RebalanceInterval
+func (sc *ShardedCacheV2) rebalancer() {
+	ticker := time.NewTicker(sc.rebalanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sc.Rebalance()
+		case <-sc.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package src
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ShardManifestVersion is the current version of the shard export format.
+const ShardManifestVersion = 1
+
+const (
+	// ShardKindVector marks a manifest produced by VectorCache.
+	ShardKindVector = "vector"
+	// ShardKindCache marks a manifest produced by ShardedCacheV2.
+	ShardKindCache = "cache"
+)
+
+// ErrShardOutOfRange is returned when a shard index does not exist.
+var ErrShardOutOfRange = errors.New("shard index out of range")
+
+// ShardManifest describes a set of per-shard export streams.
+// It is written once all shard streams are complete and is required to
+// restore them in parallel.
+type ShardManifest struct {
+	Version    int                  `json:"version"`
+	Kind       string               `json:"kind"`
+	ShardCount int                  `json:"shard_count"`
+	Metric     MetricType           `json:"metric,omitempty"`
+	IndexType  string               `json:"index_type,omitempty"`
+	CreatedAt  int64                `json:"created_at"`
+	Shards     []ShardManifestEntry `json:"shards"`
+}
+
+// ShardManifestEntry describes a single shard stream.
+type ShardManifestEntry struct {
+	Shard int   `json:"shard"`
+	Items int   `json:"items"`
+	Bytes int64 `json:"bytes"`
+}
+
+// WriteShardManifest writes a manifest as JSON.
+func WriteShardManifest(w io.Writer, m *ShardManifest) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// ReadShardManifest reads a manifest written by WriteShardManifest.
+func ReadShardManifest(r io.Reader) (*ShardManifest, error) {
+	var m ShardManifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Version != ShardManifestVersion {
+		return nil, fmt.Errorf("unsupported shard manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// countingWriter counts bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// runShards runs fn for every shard in parallel and returns the first error.
+func runShards(count int, fn func(shard int) error) error {
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = fn(idx)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// shardAt returns the shard with the given index.
+// A non-sharded store is treated as a single shard.
+func (vc *VectorCache) shardAt(shard int) (*VectorCache, error) {
+	if vc.shardCount > 1 {
+		if shard < 0 || shard >= vc.shardCount {
+			return nil, ErrShardOutOfRange
+		}
+		return vc.shards[shard], nil
+	}
+	if shard != 0 {
+		return nil, ErrShardOutOfRange
+	}
+	return vc, nil
+}
+
+// ShardCount returns the number of shards, 1 for a non-sharded store.
+func (vc *VectorCache) ShardCount() int {
+	if vc.shardCount > 1 {
+		return vc.shardCount
+	}
+	return 1
+}
+
+// storedItems returns all vectors held in this shard's cache. Entries copies
+// the values under the cache lock, as cache items are pooled and reused.
+func (vc *VectorCache) storedItems() []*VectorItem {
+	cached := vc.cache.cache.Entries()
+	items := make([]*VectorItem, 0, len(cached))
+	for _, ci := range cached {
+		if v, ok := ci.Value.(*VectorItemWithIndex); ok && v.Item != nil {
+			items = append(items, v.Item)
+		}
+	}
+	return items
+}
+
+// ExportShard writes the vectors of a single shard to w as newline-delimited JSON.
+func (vc *VectorCache) ExportShard(shard int, w io.Writer) (ShardManifestEntry, error) {
+	s, err := vc.shardAt(shard)
+	if err != nil {
+		return ShardManifestEntry{}, err
+	}
+
+	cw := &countingWriter{w: w}
+	enc := json.NewEncoder(cw)
+	entry := ShardManifestEntry{Shard: shard}
+	for _, item := range s.storedItems() {
+		if err := enc.Encode(ExportItem{ID: item.ID, Vector: item.Vector, Metadata: item.Metadata}); err != nil {
+			return entry, err
+		}
+		entry.Items++
+	}
+	entry.Bytes = cw.n
+	return entry, nil
+}
+
+// ExportShards exports all shards in parallel.
+// open is called once per shard to obtain its destination; if the returned
+// writer implements io.Closer it is closed after the shard is written.
+func (vc *VectorCache) ExportShards(open func(shard int) (io.Writer, error)) (*ShardManifest, error) {
+	count := vc.ShardCount()
+	manifest := &ShardManifest{
+		Version:    ShardManifestVersion,
+		Kind:       ShardKindVector,
+		ShardCount: count,
+		Metric:     vc.config.Metric,
+		IndexType:  vc.config.IndexType,
+		CreatedAt:  time.Now().UnixNano(),
+		Shards:     make([]ShardManifestEntry, count),
+	}
+
+	err := runShards(count, func(shard int) error {
+		w, err := open(shard)
+		if err != nil {
+			return err
+		}
+		entry, err := vc.ExportShard(shard, w)
+		if c, ok := w.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+		manifest.Shards[shard] = entry
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ImportShard reads a shard stream written by ExportShard.
+// Vectors are routed by ID, so a stream can be restored into a store with a
+// different shard count. Like RestoreShards, it stores vectors in batches on
+// the write goroutines, so none are dropped, and indexes only the vectors
+// stored. It returns the number of imported vectors, and fails with
+// ErrNotApplied if some vector read was not stored.
+func (vc *VectorCache) ImportShard(r io.Reader) (int, error) {
+	return vc.importShardStream(r, -1)
+}
+
+// importShardStream imports a shard stream. With persistent routing and a
+// valid pin, every vector is assigned to the pinned shard.
+func (vc *VectorCache) importShardStream(r io.Reader, pin int) (int, error) {
+	pinned := vc.routes != nil && pin >= 0 && pin < vc.shardCount
+
+	// owner is the shard each queued vector is stored in
+	owner := make(map[string]*VectorCache)
+	w := newWarmer(func(key string) *RistrettoCache { return owner[key].cache })
+	count, imported := 0, 0
+	var indexErr error
+	w.stored = func(set *setItem) {
+		shard := owner[set.key]
+		item := set.value.(*VectorItemWithIndex).Item
+		if indexErr != nil {
+			return
+		}
+		if indexErr = shard.indexAdd(item.ID, item.Vector, item.Metadata); indexErr != nil {
+			return
+		}
+		shard.order.add(item.ID, &vc.seq)
+		imported++
+	}
+
+	dec := json.NewDecoder(r)
+	var err error
+	for w.err == nil && indexErr == nil {
+		var item ExportItem
+		if err = dec.Decode(&item); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		id, vector := item.ID, Vector(item.Vector)
+		if err = vc.checkDimension(vector); err != nil {
+			break
+		}
+		if !pinned && vc.config.Dedup != DedupOff {
+			// Duplicates are looked up in the index, so it must hold the
+			// vectors read before
+			if err = w.flush(); err != nil {
+				break
+			}
+			handled, derr := vc.dedup(id, vector, item.Metadata)
+			if err = derr; handled {
+				if err != nil {
+					break
+				}
+				count++
+				imported++
+				continue
+			}
+		}
+		if vc.aliases != nil {
+			vc.aliases.remove(id)
+		}
+
+		idx := pin
+		if !pinned {
+			idx = vc.storeShardIndex(id, item.Metadata)
+		}
+		shard := vc
+		if vc.shardCount > 1 {
+			shard = vc.shards[idx]
+			if vc.routes != nil {
+				vc.routes.assign(id, idx)
+			}
+		}
+		set := shard.vectorSet(id, vector, item.Metadata)
+		owner[set.key] = shard
+		w.addItem(set)
+		count++
+	}
+	if ferr := w.flush(); err == nil {
+		err = ferr
+	}
+	if err == nil {
+		err = indexErr
+	}
+	if err == nil && imported < count {
+		err = fmt.Errorf("%w: %d of %d", ErrNotApplied, count-imported, count)
+	}
+	return imported, err
+}
+
+// ImportShards restores all shards listed in the manifest in parallel.
+// open is called once per shard to obtain its source; if the returned reader
+// implements io.Closer it is closed after the shard is read.
+func (vc *VectorCache) ImportShards(manifest *ShardManifest, open func(shard int) (io.Reader, error)) error {
+	if manifest.Kind != ShardKindVector {
+		return fmt.Errorf("manifest kind %q is not %q", manifest.Kind, ShardKindVector)
+	}
+
+	err := runShards(len(manifest.Shards), func(i int) error {
+		entry := manifest.Shards[i]
+		r, err := open(entry.Shard)
+		if err != nil {
+			return err
+		}
+		n, err := vc.importShardStream(r, entry.Shard)
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		if err == nil && n != entry.Items {
+			err = fmt.Errorf("expected %d items, read %d", entry.Items, n)
+		}
+		return err
+	})
+	vc.Wait()
+	return err
+}
+
+// RestoreShards restores a shard export into a store with the same shard
+// count without going through Add, e.g. when the vectors survived but the
+// index graph was lost or corrupted. Each stream's vectors are stored straight
+// into the cache of the shard they were exported from, in batches so none are
+// dropped, and must match the manifest's count. The shard's index is then
+// rebuilt in a single pass from all vectors the shard holds. Shards
+// are restored in parallel. Use ImportShards to restore into a different
+// shard count. Cancelling ctx leaves the indexes of unfinished shards unchanged.
+func (vc *VectorCache) RestoreShards(ctx context.Context, manifest *ShardManifest, open func(shard int) (io.Reader, error)) error {
+	if manifest.Kind != ShardKindVector {
+		return fmt.Errorf("manifest kind %q is not %q", manifest.Kind, ShardKindVector)
+	}
+	if manifest.ShardCount != vc.ShardCount() {
+		return fmt.Errorf("manifest has %d shards, store has %d", manifest.ShardCount, vc.ShardCount())
+	}
+
+	err := runShards(len(manifest.Shards), func(i int) error {
+		entry := manifest.Shards[i]
+		s, err := vc.shardAt(entry.Shard)
+		if err != nil {
+			return err
+		}
+		r, err := open(entry.Shard)
+		if err != nil {
+			return err
+		}
+		n, err := vc.restoreShardStream(s, entry.Shard, r)
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		if err == nil && n != entry.Items {
+			err = fmt.Errorf("expected %d items, restored %d", entry.Items, n)
+		}
+		if err != nil {
+			return err
+		}
+
+		s.cache.Wait()
+		_, err = s.rebuildShadow(ctx, func(VectorStore) []*VectorItem {
+			return s.storedItems()
+		}, s.hnswConfig(), func(int) {})
+		return err
+	})
+	vc.Wait()
+	return err
+}
+
+// restoreShardStream stores the vectors of a shard stream in shard, whose
+// index is idx, without indexing them. Vectors are written in batches on the
+// shard's write goroutine, so none are dropped when its set buffer is full.
+// It returns the number of vectors stored, and fails with ErrNotApplied if
+// some vector read was not.
+func (vc *VectorCache) restoreShardStream(shard *VectorCache, idx int, r io.Reader) (int, error) {
+	w := newWarmer(func(string) *RistrettoCache { return shard.cache })
+	dec := json.NewDecoder(r)
+	count := 0
+	var err error
+	for w.err == nil {
+		var item ExportItem
+		if err = dec.Decode(&item); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		if vc.routes != nil {
+			vc.routes.assign(item.ID, idx)
+		}
+		w.addItem(shard.vectorSet(item.ID, Vector(item.Vector), item.Metadata))
+		shard.order.add(item.ID, &vc.seq)
+		count++
+	}
+	if ferr := w.flush(); err == nil {
+		err = ferr
+	}
+	if err == nil && w.loaded < count {
+		err = fmt.Errorf("%w: %d of %d", ErrNotApplied, count-w.loaded, count)
+	}
+	return w.loaded, err
+}
+
+// vectorSet returns the write storing a vector in the shard's cache with the
+// shard's TTL, for a warmer.
+func (vc *VectorCache) vectorSet(id string, vector Vector, metadata map[string]any) *setItem {
+	key, value, cost := vectorEntry(id, vector, metadata)
+	set := &setItem{key: key, value: value, cost: cost, internal: true}
+	if ttl := vc.config.TTL; ttl > 0 {
+		set.expiration = time.Now().Add(ttl).UnixNano()
+		if vc.cache.config.SlidingTTL {
+			set.sliding = int64(ttl)
+		}
+	}
+	return set
+}
+
+// shardEntry is the on-stream representation of a ShardedCacheV2 entry.
+// Values are gob-encoded, so custom types must be registered with gob.Register.
+type shardEntry struct {
+	Key        string
+	Value      any
+	Cost       int64
+	Expiration int64
+	// TTL is the remaining time to live when the entry was written and
+	// Clock the writer's hybrid clock, so readers on other hosts do not
+	// depend on the two wall clocks agreeing
+	TTL   int64
+	Clock Timestamp
+	// Deleted marks a key removed since the previous snapshot, in delta
+	// snapshots only
+	Deleted bool
+}
+
+// ExportShard writes the entries of a single shard to w as a gob stream.
+// Expired entries are skipped.
+func (sc *ShardedCacheV2) ExportShard(shard int, w io.Writer) (ShardManifestEntry, error) {
+	if shard < 0 || shard >= sc.shardCount {
+		return ShardManifestEntry{}, ErrShardOutOfRange
+	}
+
+	cw := &countingWriter{w: w}
+	n, err := writeEntries(gob.NewEncoder(cw), sc.shards[shard])
+	return ShardManifestEntry{Shard: shard, Items: n, Bytes: cw.n}, err
+}
+
+// ExportShards exports all shards in parallel.
+// open is called once per shard to obtain its destination; if the returned
+// writer implements io.Closer it is closed after the shard is written.
+func (sc *ShardedCacheV2) ExportShards(open func(shard int) (io.Writer, error)) (*ShardManifest, error) {
+	manifest := &ShardManifest{
+		Version:    ShardManifestVersion,
+		Kind:       ShardKindCache,
+		ShardCount: sc.shardCount,
+		CreatedAt:  time.Now().UnixNano(),
+		Shards:     make([]ShardManifestEntry, sc.shardCount),
+	}
+
+	err := runShards(sc.shardCount, func(shard int) error {
+		w, err := open(shard)
+		if err != nil {
+			return err
+		}
+		entry, err := sc.ExportShard(shard, w)
+		if c, ok := w.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+		manifest.Shards[shard] = entry
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ImportShard reads a shard stream written by ExportShard.
+// Keys are routed by hash, so a stream can be restored into a cache with a
+// different shard count. Expirations are rebuilt from each entry's remaining
+// TTL against the local clock, so clock skew between the exporting and
+// importing hosts does not shift them; DefaultClock.Skew reports the skew seen.
+// Entries are written in batches on the shards' write goroutines, so none
+// are dropped when a set buffer is full. It returns the number of imported
+// entries, and ErrNotApplied if some entries could not be stored.
+func (sc *ShardedCacheV2) ImportShard(r io.Reader) (int, error) {
+	n, _, err := sc.importShard(r)
+	return n, err
+}
+
+// importShard imports a shard stream and also returns the number of entries
+// skipped because they expired since the export.
+func (sc *ShardedCacheV2) importShard(r io.Reader) (int, int, error) {
+	var expired int
+	n, err := restoreEntries(sc.getShard, func(set func(e *shardEntry) bool) (int, error) {
+		var n int
+		var err error
+		n, expired, err = readEntriesExpired(gob.NewDecoder(r), true, set)
+		return n, err
+	})
+	return n, expired, err
+}
+
+// ImportShards restores all shards listed in the manifest in parallel.
+// open is called once per shard to obtain its source; if the returned reader
+// implements io.Closer it is closed after the shard is read. It fails if a
+// shard's entries, apart from those expired since the export, were not all
+// imported.
+func (sc *ShardedCacheV2) ImportShards(manifest *ShardManifest, open func(shard int) (io.Reader, error)) error {
+	if manifest.Kind != ShardKindCache {
+		return fmt.Errorf("manifest kind %q is not %q", manifest.Kind, ShardKindCache)
+	}
+
+	err := runShards(len(manifest.Shards), func(i int) error {
+		entry := manifest.Shards[i]
+		r, err := open(entry.Shard)
+		if err != nil {
+			return err
+		}
+		n, expired, err := sc.importShard(r)
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		if err == nil && n+expired != entry.Items {
+			err = fmt.Errorf("expected %d items, imported %d (%d expired)", entry.Items, n, expired)
+		}
+		return err
+	})
+	sc.Wait()
+	return err
+}
@@ -0,0 +1,216 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestShardedImportShardsRestoresEveryEntry(t *testing.T) {
+	src, err := NewShardedCacheV2(4, &Config{NumCounters: 1e6, MaxCost: 1 << 30, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	fillSnapshotCache(t, func(k string, v any) bool { return src.Set(k, v, 1) }, src.Wait)
+	want := src.Len()
+
+	streams := make([]*bytes.Buffer, 4)
+	manifest, err := src.ExportShards(func(shard int) (io.Writer, error) {
+		streams[shard] = new(bytes.Buffer)
+		return streams[shard], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewShardedCacheV2(4, &Config{NumCounters: 1e6, MaxCost: 1 << 30, BufferItems: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	err = dst.ImportShards(manifest, func(shard int) (io.Reader, error) {
+		return bytes.NewReader(streams[shard].Bytes()), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Len() != want {
+		t.Fatalf("imported %d entries, want %d", dst.Len(), want)
+	}
+}
+
+func TestShardedImportShardsChecksManifest(t *testing.T) {
+	src, err := NewShardedCacheV2(2, &Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for i := 0; i < 100; i++ {
+		src.Set(fmt.Sprint(i), i, 1)
+	}
+	src.Wait()
+
+	streams := make([]*bytes.Buffer, 2)
+	manifest, err := src.ExportShards(func(shard int) (io.Writer, error) {
+		streams[shard] = new(bytes.Buffer)
+		return streams[shard], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Shards[0].Items++
+
+	dst, err := NewShardedCacheV2(2, &Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	err = dst.ImportShards(manifest, func(shard int) (io.Reader, error) {
+		return bytes.NewReader(streams[shard].Bytes()), nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Fatalf("ImportShards = %v, want a manifest mismatch", err)
+	}
+}
+
+func TestVectorExportShardWhileWriting(t *testing.T) {
+	config := DefaultVectorStoreConfig()
+	config.Dimension = 4
+	config.MaxCost = 4096
+	store, err := NewVectorStore(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				store.Add(fmt.Sprintf("v%d-%d", w, i), Vector{float32(i), 1, 2, 3}, nil)
+			}
+		}(w)
+	}
+	for i := 0; i < 200; i++ {
+		if _, err := store.ExportShard(0, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+// exportVectorShards fills a store of two shards and exports it to memory
+func exportVectorShards(t *testing.T) (*ShardManifest, []*bytes.Buffer) {
+	t.Helper()
+	config := DefaultVectorStoreConfig()
+	config.ShardCount = 2
+	store, err := NewVectorStore(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for i := 0; i < 5000; i++ {
+		store.Add(fmt.Sprint(i), Vector{float32(i), 1, 2, 3}, nil)
+	}
+	store.Wait()
+
+	streams := make([]*bytes.Buffer, 2)
+	manifest, err := store.ExportShards(func(shard int) (io.Writer, error) {
+		streams[shard] = new(bytes.Buffer)
+		return streams[shard], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest, streams
+}
+
+func TestVectorRestoreShardsRestoresEveryVector(t *testing.T) {
+	manifest, streams := exportVectorShards(t)
+	want := 0
+	for _, entry := range manifest.Shards {
+		want += entry.Items
+	}
+	if want == 0 {
+		t.Fatal("nothing exported")
+	}
+
+	config := DefaultVectorStoreConfig()
+	config.ShardCount = 2
+	dst, err := NewVectorStore(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	err = dst.RestoreShards(context.Background(), manifest, func(shard int) (io.Reader, error) {
+		return bytes.NewReader(streams[shard].Bytes()), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Len() != want {
+		t.Fatalf("restored %d vectors, want %d", dst.Len(), want)
+	}
+}
+
+func TestVectorRestoreShardsChecksManifest(t *testing.T) {
+	manifest, streams := exportVectorShards(t)
+	manifest.Shards[1].Items++
+
+	config := DefaultVectorStoreConfig()
+	config.ShardCount = 2
+	dst, err := NewVectorStore(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	err = dst.RestoreShards(context.Background(), manifest, func(shard int) (io.Reader, error) {
+		return bytes.NewReader(streams[shard].Bytes()), nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Fatalf("RestoreShards = %v, want a manifest mismatch", err)
+	}
+}
+
+// Imported vectors are stored without drops, so every indexed vector is
+// also in the cache
+func TestVectorImportShardsStoresEveryVector(t *testing.T) {
+	manifest, streams := exportVectorShards(t)
+	want := 0
+	for _, entry := range manifest.Shards {
+		want += entry.Items
+	}
+
+	config := DefaultVectorStoreConfig()
+	config.ShardCount = 2
+	config.IndexType = "flat"
+	dst, err := NewVectorStore(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	err = dst.ImportShards(manifest, func(shard int) (io.Reader, error) {
+		return bytes.NewReader(streams[shard].Bytes()), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for i, shard := range dst.shards {
+		indexed, stored := shard.currentIndex().Len(), shard.cache.Len()
+		if indexed != stored {
+			t.Fatalf("shard %d indexes %d vectors but stores %d", i, indexed, stored)
+		}
+		total += stored
+	}
+	if total != want {
+		t.Fatalf("imported %d vectors, want %d", total, want)
+	}
+}
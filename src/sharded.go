@@ -1,8 +1,10 @@
 package src
 
 import (
-	"hash/fnv"
+	"context"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,6 +12,7 @@ import (
 type ShardedCacheV2 struct {
 	shards      []*RistrettoCache
 	shardCount  int
+	router      Router
 	numCounters int64
 	maxCost     int64
 	bufferItems int64
@@ -18,6 +21,53 @@ type ShardedCacheV2 struct {
 	onEvict     func(key string, value any, cost int64)
 	onReject    func(key string, value any, cost int64)
 	onExit      func(value any)
+	loader      func(key string) (any, int64, error)
+	costFunc    func(value any) int64
+	admit       func(key string, cost int64, freq int64, stats AdmissionStats) bool
+	sampleSize  int
+	windowRatio float64
+	tracer      Tracer
+	audit       *AuditLog
+	orderedKeys bool
+	internKeys  bool
+	slidingTTL  bool
+	policy      EvictionPolicy
+	admission   AdmissionPolicy
+	admitAbove  float64
+
+	closeTimeout   time.Duration
+	workerRestarts atomic.Int64
+
+	refreshAhead   float64
+	refreshWorkers int
+	dropPolicy     DropPolicy
+	persistMetrics bool
+	deltaSnapshots bool
+	fullEvery      int
+	valueCodec     string
+
+	// prefetch observes reads across all shards, nil unless Config.Prefetch is set
+	prefetch *prefetcher
+
+	// invalidator publishes deletes of all shards, nil unless Config.Invalidator is set
+	invalidator    *invalidationLink
+	invalidateSets bool
+
+	// throttle limits the sets of each caller across all shards, nil unless Config.WriteLimit(s) is set
+	throttle *writeThrottle
+
+	// degrade is shared by the shards, so they enter and leave degraded mode together
+	degrade *degrader
+
+	// deltas tracks the snapshot chain of SaveDelta and SaveIncremental across all shards
+	deltas deltaChain
+
+	// baseMaxCosts are the weighted cost limits of the shards, which
+	// Rebalance moves away from as load requires
+	baseMaxCosts      []int64
+	rebalanceInterval time.Duration
+	balanceMu         sync.Mutex
+	balanceEvicted    []int64 // cost evicted by each shard at the last Rebalance
 
 	// GC management
 	gcInterval     time.Duration
@@ -44,6 +94,30 @@ func NewShardedCacheV2(shardCount int, config *Config) (*ShardedCacheV2, error)
 	var onEvict func(key string, value any, cost int64)
 	var onReject func(key string, value any, cost int64)
 	var onExit func(value any)
+	var loader func(key string) (any, int64, error)
+	var costFunc func(value any) int64
+	var admit func(key string, cost int64, freq int64, stats AdmissionStats) bool
+	var sampleSize int
+	var windowRatio float64
+	var tracer Tracer
+	var audit *AuditLog
+	var orderedKeys bool
+	var internKeys bool
+	var slidingTTL bool
+	var policy EvictionPolicy
+	var admission AdmissionPolicy
+	var admitAbove float64
+	var closeTimeout time.Duration
+	var refreshAhead float64
+	var refreshWorkers int
+	var dropPolicy DropPolicy
+	var persistMetrics bool
+	var deltaSnapshots bool
+	var fullEvery int
+	var valueCodec string
+	var router Router = HashRouter{}
+	var shardWeights []float64
+	var rebalanceInterval time.Duration
 	gcInterval := time.Duration(0)
 	gcMemThreshold := 80
 
@@ -63,41 +137,127 @@ func NewShardedCacheV2(shardCount int, config *Config) (*ShardedCacheV2, error)
 		onEvict = config.OnEvict
 		onReject = config.OnReject
 		onExit = config.OnExit
+		loader = config.Loader
+		costFunc = config.Cost
+		admit = config.Admit
+		sampleSize = config.SampleSize
+		windowRatio = config.WindowRatio
+		tracer = config.Tracer
+		audit = config.Audit
+		orderedKeys = config.OrderedKeys
+		internKeys = config.InternKeys
+		slidingTTL = config.SlidingTTL
+		policy = config.Policy
+		admission = config.AdmissionPolicy
+		admitAbove = config.AdmissionThreshold
+		closeTimeout = config.CloseTimeout
+		refreshAhead = config.RefreshAhead
+		refreshWorkers = config.RefreshWorkers
+		dropPolicy = config.DropPolicy
+		persistMetrics = config.PersistMetrics
+		deltaSnapshots = config.DeltaSnapshots
+		fullEvery = config.FullSnapshotEvery
+		valueCodec = config.ValueCodec
 		gcInterval = config.GCInterval
+		if config.Router != nil {
+			router = config.Router
+		}
+		shardWeights = config.ShardWeights
+		rebalanceInterval = config.RebalanceInterval
 		if config.GcMemThreshold > 0 {
 			gcMemThreshold = config.GcMemThreshold
 		}
 	}
 
+	// Shards get MaxCost in proportion to ShardWeights, evenly without them
+	baseMaxCosts := make([]int64, shardCount)
+	for i := range baseMaxCosts {
+		baseMaxCosts[i] = maxCost
+	}
+	if shardWeights != nil {
+		total := maxCost * int64(shardCount)
+		if config.MaxCost > 0 {
+			total = config.MaxCost
+		}
+		costs, err := shardMaxCosts(total, shardCount, shardWeights)
+		if err != nil {
+			return nil, err
+		}
+		baseMaxCosts = costs
+	}
+
 	sc := &ShardedCacheV2{
-		shards:         make([]*RistrettoCache, shardCount),
-		shardCount:     shardCount,
-		numCounters:    numCounters,
-		maxCost:        maxCost,
-		bufferItems:    bufferItems,
-		metrics:        metrics,
-		ttl:            ttl,
-		onEvict:        onEvict,
-		onReject:       onReject,
-		onExit:         onExit,
-		gcInterval:     gcInterval,
-		gcMemThreshold: gcMemThreshold,
-		stopCh:         make(chan struct{}),
+		shards:            make([]*RistrettoCache, shardCount),
+		shardCount:        shardCount,
+		router:            router,
+		numCounters:       numCounters,
+		maxCost:           maxCost,
+		baseMaxCosts:      baseMaxCosts,
+		bufferItems:       bufferItems,
+		metrics:           metrics,
+		ttl:               ttl,
+		onEvict:           onEvict,
+		onReject:          onReject,
+		onExit:            onExit,
+		loader:            loader,
+		costFunc:          costFunc,
+		admit:             admit,
+		sampleSize:        sampleSize,
+		windowRatio:       windowRatio,
+		tracer:            tracer,
+		audit:             audit,
+		orderedKeys:       orderedKeys,
+		internKeys:        internKeys,
+		slidingTTL:        slidingTTL,
+		policy:            policy,
+		admission:         admission,
+		admitAbove:        admitAbove,
+		closeTimeout:      closeTimeout,
+		refreshAhead:      refreshAhead,
+		refreshWorkers:    refreshWorkers,
+		dropPolicy:        dropPolicy,
+		persistMetrics:    persistMetrics,
+		deltaSnapshots:    deltaSnapshots,
+		fullEvery:         fullEvery,
+		valueCodec:        valueCodec,
+		rebalanceInterval: rebalanceInterval,
+		balanceEvicted:    make([]int64, shardCount),
+		gcInterval:        gcInterval,
+		gcMemThreshold:    gcMemThreshold,
+		stopCh:            make(chan struct{}),
 	}
 
 	// Initialize shards
 	for i := 0; i < shardCount; i++ {
 		shardConfig := &Config{
-			NumCounters:    sc.numCounters,
-			MaxCost:        sc.maxCost,
-			BufferItems:    sc.bufferItems,
-			Metrics:        sc.metrics,
-			TTL:            sc.ttl,
-			OnEvict:        sc.onEvict,
-			OnReject:       sc.onReject,
-			OnExit:         sc.onExit,
-			GCInterval:     0, // ShardedCacheV2 manages GC centrally
-			GcMemThreshold: 0,  // ShardedCacheV2 manages GC centrally
+			NumCounters:        sc.numCounters,
+			MaxCost:            sc.baseMaxCosts[i],
+			BufferItems:        sc.bufferItems,
+			Metrics:            sc.metrics,
+			TTL:                sc.ttl,
+			OnEvict:            sc.onEvict,
+			OnReject:           sc.onReject,
+			OnExit:             sc.onExit,
+			Loader:             sc.loader,
+			Cost:               sc.costFunc,
+			Admit:              sc.admit,
+			SampleSize:         sc.sampleSize,
+			WindowRatio:        sc.windowRatio,
+			OrderedKeys:        sc.orderedKeys,
+			InternKeys:         sc.internKeys,
+			SlidingTTL:         sc.slidingTTL,
+			Policy:             sc.policy,
+			AdmissionPolicy:    sc.admission,
+			AdmissionThreshold: sc.admitAbove,
+			CloseTimeout:       sc.closeTimeout,
+			RefreshAhead:       sc.refreshAhead,
+			RefreshWorkers:     sc.refreshWorkers,
+			DropPolicy:         sc.dropPolicy,
+			PersistMetrics:     sc.persistMetrics,
+			DeltaSnapshots:     sc.deltaSnapshots,
+			ValueCodec:         sc.valueCodec,
+			GCInterval:         0, // ShardedCacheV2 manages GC centrally
+			GcMemThreshold:     0, // ShardedCacheV2 manages GC centrally
 		}
 		cache, err := NewRistrettoCache(shardConfig)
 		if err != nil {
@@ -110,10 +270,49 @@ func NewShardedCacheV2(shardCount int, config *Config) (*ShardedCacheV2, error)
 		sc.shards[i] = cache
 	}
 
+	degradeConfig := config
+	if degradeConfig == nil {
+		degradeConfig = &Config{}
+	}
+	sc.degrade = newDegrader(degradeConfig, sc.shardFill)
+	for _, shard := range sc.shards {
+		shard.degrade = sc.degrade
+	}
+
+	// Write limits are per caller, not per shard, so the shards share one throttle
+	if config != nil {
+		if sc.throttle = newWriteThrottle(config); sc.throttle != nil {
+			for _, shard := range sc.shards {
+				shard.throttle = sc.throttle
+			}
+		}
+	}
+
+	// Sequences span shards, so one prefetcher observes all reads
+	if config != nil && config.Prefetch && loader != nil {
+		sc.prefetch = newPrefetcher(config.PrefetchWorkers, func(key string) { sc.getShard(key).prefetchLoad(sc.prefetch, key) },
+			&sc.wg, sc.stopCh, &sc.workerRestarts)
+	}
+
+	if sc.rebalanceInterval > 0 {
+		goWorker(&sc.wg, "rebalancer", &sc.workerRestarts, sc.rebalancer)
+	}
+
 	// Start unified GC goroutine (only one for all shards)
 	if sc.gcInterval > 0 {
-		sc.wg.Add(1)
-		go sc.gcRunner()
+		goWorker(&sc.wg, "gcRunner", &sc.workerRestarts, sc.gcRunner)
+	}
+
+	// One subscription for all shards
+	if config != nil && config.Invalidator != nil {
+		link, err := startInvalidation(config.Invalidator, config.InstanceID, sc.applyInvalidation,
+			&sc.wg, sc.stopCh, &sc.workerRestarts)
+		if err != nil {
+			sc.Close()
+			return nil, err
+		}
+		sc.invalidator = link
+		sc.invalidateSets = config.InvalidateOnSet
 	}
 
 	return sc, nil
@@ -121,34 +320,73 @@ func NewShardedCacheV2(shardCount int, config *Config) (*ShardedCacheV2, error)
 
 // getShard returns the shard for a given key
 func (sc *ShardedCacheV2) getShard(key string) *RistrettoCache {
-	h := fnv.New32a()
-	h.Write([]byte(key))
-	hash := int(h.Sum32())
-	return sc.shards[hash%sc.shardCount]
+	return sc.shards[sc.shardIndex(key)]
+}
+
+// shardIndex returns the index of the shard for a given key, see Config.Router
+func (sc *ShardedCacheV2) shardIndex(key string) int {
+	return route(sc.router, key, sc.shardCount)
+}
+
+// ShardOf returns the index of the shard that holds key
+func (sc *ShardedCacheV2) ShardOf(key string) int {
+	return sc.shardIndex(key)
 }
 
 // Set sets a value
 func (sc *ShardedCacheV2) Set(key string, value any, cost int64) bool {
-	shard := sc.getShard(key)
-	return shard.Set(key, value, cost)
+	return sc.setWithTTL(context.Background(), key, value, cost, 0)
 }
 
 // SetWithTTL sets a value with TTL
 func (sc *ShardedCacheV2) SetWithTTL(key string, value any, cost int64, ttl time.Duration) bool {
+	return sc.setWithTTL(context.Background(), key, value, cost, ttl)
+}
+
+// setWithTTL is SetWithTTL, audited with the actor of ctx
+func (sc *ShardedCacheV2) setWithTTL(ctx context.Context, key string, value any, cost int64, ttl time.Duration) bool {
+	sc.invalidateOnSet(key)
+	shard := sc.getShard(key)
+	stored := shard.SetWithTTL(key, value, cost, ttl)
+	sc.audit.Record(ctx, AuditSet, key, value, stored)
+	return stored
+}
+
+// setSync stores a value in its shard and waits until it has been applied,
+// audited with the actor of ctx
+func (sc *ShardedCacheV2) setSync(ctx context.Context, key string, value any, cost int64, expiration int64) bool {
+	stored := sc.getShard(key).setSync(ctx, key, value, cost, expiration)
+	sc.audit.Record(ctx, AuditSet, key, value, stored)
+	return stored
+}
+
+// SetWithSlidingTTL sets a value whose TTL is renewed on every Get
+func (sc *ShardedCacheV2) SetWithSlidingTTL(key string, value any, cost int64, ttl time.Duration) bool {
+	sc.invalidateOnSet(key)
 	shard := sc.getShard(key)
-	return shard.SetWithTTL(key, value, cost, ttl)
+	stored := shard.SetWithSlidingTTL(key, value, cost, ttl)
+	sc.audit.Record(context.Background(), AuditSet, key, value, stored)
+	return stored
 }
 
 // Get gets a value
 func (sc *ShardedCacheV2) Get(key string) (any, bool) {
 	shard := sc.getShard(key)
-	return shard.Get(key)
+	value, found := shard.Get(key)
+	if sc.prefetch != nil && !sc.degrade.degraded() {
+		sc.prefetch.observe(key, found)
+	}
+	return value, found
 }
 
 // GetWithTTL gets a value and remaining TTL
 func (sc *ShardedCacheV2) GetWithTTL(key string) (any, bool, time.Duration) {
 	shard := sc.getShard(key)
-	return shard.GetWithTTL(key)
+	value, found, ttl := shard.GetWithTTL(key)
+	if sc.prefetch != nil && !sc.degrade.degraded() {
+		sc.prefetch.observe(key, found)
+	}
+	return value, found, ttl
 }
 
 // GetTTL gets remaining TTL
@@ -285,18 +523,75 @@ func (sc *ShardedCacheV2) Exists(key string) bool {
 	return shard.Exists(key)
 }
 
+// Expire sets the TTL of a key without rewriting its value.
+// A ttl of zero or less deletes the key, like Del
+func (sc *ShardedCacheV2) Expire(key string, ttl time.Duration) bool {
+	return sc.expire(context.Background(), key, ttl)
+}
+
+// expire is Expire, audited with the actor of ctx
+func (sc *ShardedCacheV2) expire(ctx context.Context, key string, ttl time.Duration) bool {
+	shard := sc.getShard(key)
+	if ttl <= 0 {
+		if !shard.Exists(key) {
+			return false
+		}
+		sc.del(ctx, key)
+		return true
+	}
+	ok := shard.Expire(key, ttl)
+	if ok {
+		sc.invalidate(key)
+	}
+	sc.audit.Record(ctx, AuditExpire, key, ttl, ok)
+	return ok
+}
+
+// Persist removes the TTL of a key
+func (sc *ShardedCacheV2) Persist(key string) bool {
+	return sc.persist(context.Background(), key)
+}
+
+// persist is Persist, audited with the actor of ctx
+func (sc *ShardedCacheV2) persist(ctx context.Context, key string) bool {
+	shard := sc.getShard(key)
+	ok := shard.Persist(key)
+	if ok {
+		sc.invalidate(key)
+	}
+	sc.audit.Record(ctx, AuditExpire, key, time.Duration(0), ok)
+	return ok
+}
+
+// Touch marks a key as used without reading it
+func (sc *ShardedCacheV2) Touch(key string) bool {
+	shard := sc.getShard(key)
+	return shard.Touch(key)
+}
+
 // CAS performs compare-and-swap operation
 // Only sets the value if the current value matches the old value
 // Returns true if the operation succeeded
 func (sc *ShardedCacheV2) CAS(key string, oldValue any, newValue any, cost int64) bool {
 	shard := sc.getShard(key)
-	return shard.CAS(key, oldValue, newValue, cost)
+	if !shard.CAS(key, oldValue, newValue, cost) {
+		return false
+	}
+	sc.audit.Record(context.Background(), AuditSet, key, newValue, true)
+	return true
 }
 
 // Del deletes a value
 func (sc *ShardedCacheV2) Del(key string) {
+	sc.del(context.Background(), key)
+}
+
+// del is Del, audited with the actor of ctx
+func (sc *ShardedCacheV2) del(ctx context.Context, key string) {
 	shard := sc.getShard(key)
 	shard.Del(key)
+	sc.invalidate(key)
+	sc.audit.Record(ctx, AuditDel, key, nil, true)
 }
 
 // Wait waits for all buffered writes to complete
@@ -312,7 +607,8 @@ func (sc *ShardedCacheV2) Wait() {
 	wg.Wait()
 }
 
-// Close closes all shards
+// Close closes all shards. It returns ErrWorkersStuck if a worker of the
+// cache or of a shard does not stop within Config.CloseTimeout
 func (sc *ShardedCacheV2) Close() error {
 	if sc.closed {
 		return nil
@@ -321,26 +617,54 @@ func (sc *ShardedCacheV2) Close() error {
 
 	// Stop GC goroutine
 	close(sc.stopCh)
-	sc.wg.Wait()
+	timeout := sc.closeTimeout
+	if timeout <= 0 {
+		timeout = DefaultCloseTimeout
+	}
+	gcDone := waitTimeout(&sc.wg, timeout)
 
 	// Close all shards
+	errs := make([]error, sc.shardCount)
 	var wg sync.WaitGroup
 	wg.Add(sc.shardCount)
-	for _, shard := range sc.shards {
-		go func(s *RistrettoCache) {
-			s.Close()
+	for i, shard := range sc.shards {
+		go func(i int, s *RistrettoCache) {
+			errs[i] = s.Close()
 			wg.Done()
-		}(shard)
+		}(i, shard)
 	}
 	wg.Wait()
+
+	if !gcDone {
+		return ErrWorkersStuck
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// WorkerRestarts returns the number of background workers of the cache and
+// its shards restarted after a panic
+func (sc *ShardedCacheV2) WorkerRestarts() int64 {
+	n := sc.workerRestarts.Load()
+	for _, shard := range sc.shards {
+		n += shard.metrics.WorkerRestarts()
+	}
+	return n
+}
+
 // Clear clears all shards
 func (sc *ShardedCacheV2) Clear() {
 	for _, shard := range sc.shards {
 		shard.Clear()
 	}
+	if sc.invalidator != nil {
+		sc.invalidator.publish(Invalidation{Clear: true})
+	}
+	sc.audit.Record(context.Background(), AuditClear, "", nil, true)
 }
 
 // Len returns the total number of items
@@ -366,18 +690,9 @@ func (sc *ShardedCacheV2) Metrics() *Metrics {
 	total := &Metrics{}
 
 	for _, shard := range sc.shards {
-		m := shard.Metrics()
-		if m != nil {
-			total.hits.Add(m.Hits())
-			total.misses.Add(m.Misses())
-			total.keysAdded.Add(m.KeysAdded())
-			total.keysEvicted.Add(m.KeysEvicted())
-			total.setsDropped.Add(m.SetsDropped())
-			total.setsRejected.Add(m.SetsRejected())
-			total.costAdded.Add(m.CostAdded())
-			total.costEvicted.Add(m.CostEvicted())
-		}
+		total.merge(shard.Metrics())
 	}
+	total.workerRestarts.Add(sc.workerRestarts.Load())
 
 	return total
 }
@@ -407,17 +722,20 @@ type ShardStat struct {
 	Cost  int64
 }
 
-// GetMemStats returns aggregated memory statistics from all shards
+// GetMemStats returns aggregated memory statistics from all shards.
+// totalAlloc is the heap of the process, which the shards share, so it is
+// read once rather than summed per shard
 func (sc *ShardedCacheV2) GetMemStats() map[string]interface{} {
-	var totalAlloc, totalCost, totalMaxCost int64
-	var totalLen int
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	totalAlloc := int64(memStats.Alloc)
 
+	var totalCost, totalMaxCost int64
+	var totalLen int
 	for _, shard := range sc.shards {
-		stats := shard.GetMemStats()
-		totalAlloc += stats["alloc"].(int64)
-		totalCost += stats["cacheCost"].(int64)
-		totalMaxCost += stats["maxCost"].(int64)
-		totalLen += stats["cacheLen"].(int)
+		totalCost += shard.cache.Cost()
+		totalMaxCost += shard.MaxCost()
+		totalLen += shard.cache.Len()
 	}
 
 	result := map[string]interface{}{
@@ -437,8 +755,6 @@ func (sc *ShardedCacheV2) GetMemStats() map[string]interface{} {
 
 // gcRunner runs periodic GC for all shards (unified management)
 func (sc *ShardedCacheV2) gcRunner() {
-	defer sc.wg.Done()
-
 	ticker := time.NewTicker(sc.gcInterval)
 	defer ticker.Stop()
 
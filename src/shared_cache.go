@@ -0,0 +1,561 @@
+package src
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// SharedCache is an experimental []byte cache that lives in a memory-mapped
+// file, usually under /dev/shm, so several processes on one host, e.g. an
+// application and its sidecars, share one cache without a network hop.
+//
+// The segment holds no pointers, only offsets: a header, then per bucket a
+// control block, a fixed table of hash slots and a ring of entries written
+// like ChunkedCache's, overwriting the oldest when it wraps. Writers take a
+// per-bucket spinlock holding their pid; a lock left by a dead process is
+// taken over and its bucket cleared. Readers take no lock: each bucket has a
+// seqlock, odd while a write is in progress, and a read that saw it change
+// is retried
+
+const (
+	// sharedMagic identifies an initialized segment ("fcshm001")
+	sharedMagic = 0x3130306d68736366
+	// sharedBuckets is the number of independently locked buckets
+	sharedBuckets = 256
+	// sharedHeaderSize is the size of the segment header
+	sharedHeaderSize = 4096
+	// sharedControlSize is the size of a bucket control block: lock holder
+	// pid (4), sequence (4), ring offset (8) and generation (8)
+	sharedControlSize = 64
+	// sharedSlotSize is the size of a slot: key hash (8) and gen<<40 | offset (8)
+	sharedSlotSize = 16
+	// sharedSlotWindow is how many slots from its home slot a key may use
+	sharedSlotWindow = 8
+	// sharedEntryHeader is the size of an entry header: key length (4),
+	// value length (4) and expiration in Unix nanoseconds (8)
+	sharedEntryHeader = 16
+	// sharedAvgEntry sizes the slot tables: one slot per this many data bytes
+	sharedAvgEntry = 256
+	// sharedLockTimeout is how long a writer spins before checking whether
+	// the lock holder is still alive
+	sharedLockTimeout = time.Second
+	// sharedOpenTimeout is how long opening waits for another process to
+	// initialize a new segment
+	sharedOpenTimeout = 5 * time.Second
+)
+
+var (
+	// ErrNotSharedCache is returned when opening a file that is not a shared cache segment
+	ErrNotSharedCache = errors.New("not a fastcache shared memory segment")
+	// errSegmentTooLarge is returned when opening a segment larger than this
+	// process can map
+	errSegmentTooLarge = errors.New("shared cache segment too large to map on this platform")
+)
+
+// SharedCache stores []byte values by string key in shared memory
+type SharedCache struct {
+	file *os.File // nil for a private heap segment
+	data []byte
+	ttl  time.Duration
+	pid  uint32
+
+	slots      int    // slots per bucket
+	bucketData uint64 // ring bytes per bucket
+	slotsOff   int    // offset of the first slot table
+	dataOff    int    // offset of the first ring
+
+	// mu keeps Close from unmapping the segment under a running operation
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewSharedCache maps the shared cache segment at path, creating it with
+// config.MaxCost bytes of entries (1GB if 0) if it does not exist; an
+// existing segment keeps its size. config.TTL is this process's default TTL.
+// A new segment is limited to 1GB in 32-bit processes. Where files cannot
+// be mapped, the segment is private heap memory and path is not used, see
+// Shared
+func NewSharedCache(path string, config *Config) (*SharedCache, error) {
+	if config == nil {
+		config = defaultConfig()
+	}
+	maxBytes := config.MaxCost
+	if maxBytes <= 0 {
+		maxBytes = 1 << 30
+	}
+	// The slot tables and headers add about 1/16 to the entries
+	if limit := maxSegmentBytes() / 8 * 7; maxBytes > limit {
+		maxBytes = limit
+	}
+	c := &SharedCache{ttl: config.TTL, pid: uint32(os.Getpid())}
+	if !mmapSupported {
+		if err := c.create(uint64(maxBytes), func(size int) ([]byte, error) {
+			return make([]byte, size), nil
+		}); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err == nil {
+		err = c.create(uint64(maxBytes), func(size int) ([]byte, error) {
+			if err := f.Truncate(int64(size)); err != nil {
+				return nil, err
+			}
+			return mmapFile(f, size)
+		})
+		if err != nil {
+			// Without a header every later open would wait for one and
+			// fail, so don't leave the file behind
+			f.Close()
+			os.Remove(path)
+			return nil, err
+		}
+	} else if os.IsExist(err) {
+		if f, err = os.OpenFile(path, os.O_RDWR, 0); err == nil {
+			err = c.open(f)
+		}
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+	c.file = f
+	return c, nil
+}
+
+// layout computes the offsets of a segment with the given geometry and
+// returns its size
+func (c *SharedCache) layout(slots int, bucketData uint64) int {
+	c.slots, c.bucketData = slots, bucketData
+	c.slotsOff = sharedHeaderSize + sharedBuckets*sharedControlSize
+	c.dataOff = c.slotsOff + sharedBuckets*slots*sharedSlotSize
+	return c.dataOff + sharedBuckets*int(bucketData)
+}
+
+// create sizes and initializes a new segment in the memory returned by
+// alloc. The magic is written last, so processes opening the segment
+// meanwhile wait for it
+func (c *SharedCache) create(maxBytes uint64, alloc func(size int) ([]byte, error)) error {
+	bucketData := (maxBytes + sharedBuckets - 1) / sharedBuckets
+	bucketData = (bucketData + 7) &^ 7
+	slots := int(bucketData / sharedAvgEntry)
+	if slots < 64 {
+		slots = 64
+	}
+	data, err := alloc(c.layout(slots, bucketData))
+	if err != nil {
+		return err
+	}
+	c.data = data
+	binary.LittleEndian.PutUint64(data[8:], uint64(slots))
+	binary.LittleEndian.PutUint64(data[16:], bucketData)
+	for b := 0; b < sharedBuckets; b++ {
+		atomic.StoreUint64(c.gen(b), 1)
+	}
+	atomic.StoreUint64(c.u64(0), sharedMagic)
+	return nil
+}
+
+// open maps an existing segment once its creator has initialized it
+func (c *SharedCache) open(f *os.File) error {
+	deadline := time.Now().Add(sharedOpenTimeout)
+	for {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() >= sharedHeaderSize {
+			header, err := mmapFile(f, sharedHeaderSize)
+			if err != nil {
+				return err
+			}
+			magic := atomic.LoadUint64((*uint64)(unsafe.Pointer(&header[0])))
+			slots := binary.LittleEndian.Uint64(header[8:])
+			bucketData := binary.LittleEndian.Uint64(header[16:])
+			munmap(header)
+			if magic == sharedMagic {
+				size := int64(sharedHeaderSize) + sharedBuckets*(int64(sharedControlSize)+int64(slots)*sharedSlotSize+int64(bucketData))
+				if info.Size() < size {
+					return ErrNotSharedCache
+				}
+				if !canMap(size) {
+					return errSegmentTooLarge
+				}
+				c.layout(int(slots), bucketData)
+				c.data, err = mmapFile(f, int(size))
+				return err
+			}
+			if magic != 0 {
+				return ErrNotSharedCache
+			}
+		}
+		if time.Now().After(deadline) {
+			return ErrNotSharedCache
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (c *SharedCache) u32(off int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&c.data[off]))
+}
+
+func (c *SharedCache) u64(off int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&c.data[off]))
+}
+
+func (c *SharedCache) control(b int) int  { return sharedHeaderSize + b*sharedControlSize }
+func (c *SharedCache) lock(b int) *uint32 { return c.u32(c.control(b)) }
+func (c *SharedCache) seq(b int) *uint32  { return c.u32(c.control(b) + 4) }
+func (c *SharedCache) offset(b int) *uint64 {
+	return c.u64(c.control(b) + 8)
+}
+func (c *SharedCache) gen(b int) *uint64 { return c.u64(c.control(b) + 16) }
+
+// slot returns the offset of slot i of bucket b
+func (c *SharedCache) slot(b, i int) int {
+	return c.slotsOff + (b*c.slots+i)*sharedSlotSize
+}
+
+// ring returns the entry ring of bucket b
+func (c *SharedCache) ring(b int) []byte {
+	start := c.dataOff + b*int(c.bucketData)
+	return c.data[start : start+int(c.bucketData)]
+}
+
+// sharedHash returns the non-zero hash of key, 0 marking empty slots
+func sharedHash(key string) uint64 {
+	h := chunkedHash(key)
+	if h == 0 {
+		h = 1
+	}
+	return h
+}
+
+// locate returns the bucket and home slot of a hash
+func (c *SharedCache) locate(h uint64) (int, int) {
+	return int(h % sharedBuckets), int((h >> 8) % uint64(c.slots))
+}
+
+// sharedLive reports whether a slot location points to an entry that has not been
+// overwritten, see chunkedBucket.liveLocked
+func sharedLive(loc, offset, gen uint64) bool {
+	if loc == 0 {
+		return false
+	}
+	locGen := loc >> chunkedOffsetBits
+	locOff := loc & (1<<chunkedOffsetBits - 1)
+	gen &= chunkedMaxGen
+	if locGen == gen {
+		return locOff < offset
+	}
+	return (locGen+1 == gen || locGen == chunkedMaxGen && gen == 1) && locOff >= offset
+}
+
+// acquire takes the write lock of bucket b. A lock held past
+// sharedLockTimeout by a process that no longer exists is taken over and
+// the bucket, possibly half written, cleared
+func (c *SharedCache) acquire(b int) {
+	lock := c.lock(b)
+	start := time.Now()
+	for spins := 0; ; spins++ {
+		if atomic.CompareAndSwapUint32(lock, 0, c.pid) {
+			return
+		}
+		runtime.Gosched()
+		if spins&1023 != 1023 || time.Since(start) < sharedLockTimeout {
+			continue
+		}
+		owner := atomic.LoadUint32(lock)
+		if owner != 0 && owner != c.pid && !processAlive(int(owner)) && atomic.CompareAndSwapUint32(lock, owner, c.pid) {
+			if s := atomic.LoadUint32(c.seq(b)); s&1 == 0 {
+				atomic.AddUint32(c.seq(b), 1)
+			}
+			c.resetLocked(b)
+			atomic.AddUint32(c.seq(b), 1)
+			return
+		}
+		start = time.Now()
+	}
+}
+
+// release drops the write lock of bucket b
+func (c *SharedCache) release(b int) {
+	atomic.StoreUint32(c.lock(b), 0)
+}
+
+// write runs fn under the write lock of bucket b with its seqlock odd
+func (c *SharedCache) write(b int, fn func()) {
+	c.acquire(b)
+	atomic.AddUint32(c.seq(b), 1)
+	fn()
+	atomic.AddUint32(c.seq(b), 1)
+	c.release(b)
+}
+
+// read runs fn until it completes without a concurrent write to bucket b.
+// fn must tolerate torn data; its result is discarded when it was torn. A
+// write that stays in progress past sharedLockTimeout may come from a dead
+// process, so the reader takes the lock once, which recovers the bucket
+func (c *SharedCache) read(b int, fn func()) {
+	seq := c.seq(b)
+	start := time.Now()
+	for spins := 0; ; spins++ {
+		s := atomic.LoadUint32(seq)
+		if s&1 == 0 {
+			fn()
+			if atomic.LoadUint32(seq) == s {
+				return
+			}
+		} else if spins&1023 == 1023 && time.Since(start) >= sharedLockTimeout {
+			c.acquire(b)
+			c.release(b)
+			start = time.Now()
+		}
+		runtime.Gosched()
+	}
+}
+
+// resetLocked empties bucket b and starts a new generation
+func (c *SharedCache) resetLocked(b int) {
+	for i := 0; i < c.slots; i++ {
+		off := c.slot(b, i)
+		atomic.StoreUint64(c.u64(off), 0)
+		atomic.StoreUint64(c.u64(off+8), 0)
+	}
+	gen := atomic.LoadUint64(c.gen(b)) + 1
+	if gen&chunkedMaxGen == 0 {
+		gen++
+	}
+	atomic.StoreUint64(c.gen(b), gen)
+	atomic.StoreUint64(c.offset(b), 0)
+}
+
+// Set stores value under key with the default TTL. It returns false if the
+// entry does not fit in a bucket's ring or the cache is closed
+func (c *SharedCache) Set(key string, value []byte) bool {
+	return c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores value under key, expiring after ttl (0 means no expiration)
+func (c *SharedCache) SetWithTTL(key string, value []byte, ttl time.Duration) bool {
+	size := uint64(sharedEntryHeader + len(key) + len(value))
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed || size > c.bucketData {
+		return false
+	}
+	var exp int64
+	if ttl > 0 {
+		exp = time.Now().Add(ttl).UnixNano()
+	}
+	h := sharedHash(key)
+	b, home := c.locate(h)
+	c.write(b, func() {
+		offset := atomic.LoadUint64(c.offset(b))
+		gen := atomic.LoadUint64(c.gen(b))
+		if offset+size > c.bucketData {
+			offset = 0
+			gen++
+			if gen&chunkedMaxGen == 0 {
+				gen++
+			}
+			atomic.StoreUint64(c.gen(b), gen)
+		}
+		ring := c.ring(b)
+		binary.LittleEndian.PutUint32(ring[offset:], uint32(len(key)))
+		binary.LittleEndian.PutUint32(ring[offset+4:], uint32(len(value)))
+		binary.LittleEndian.PutUint64(ring[offset+8:], uint64(exp))
+		copy(ring[offset+sharedEntryHeader:], key)
+		copy(ring[offset+sharedEntryHeader+uint64(len(key)):], value)
+		atomic.StoreUint64(c.offset(b), offset+size)
+
+		off := c.slot(b, c.pick(b, home, h, offset+size, gen))
+		atomic.StoreUint64(c.u64(off), h)
+		atomic.StoreUint64(c.u64(off+8), offset|(gen&chunkedMaxGen)<<chunkedOffsetBits)
+	})
+	return true
+}
+
+// pick returns the slot for hash h in the window of home: the slot already
+// holding h, else a free or dead one, else home itself
+func (c *SharedCache) pick(b, home int, h, offset, gen uint64) int {
+	free := -1
+	for i := 0; i < sharedSlotWindow; i++ {
+		s := (home + i) % c.slots
+		off := c.slot(b, s)
+		if atomic.LoadUint64(c.u64(off)) == h {
+			return s
+		}
+		if free < 0 && !sharedLive(atomic.LoadUint64(c.u64(off+8)), offset, gen) {
+			free = s
+		}
+	}
+	if free >= 0 {
+		return free
+	}
+	return home
+}
+
+// Get returns a copy of the value stored under key
+func (c *SharedCache) Get(key string) ([]byte, bool) {
+	return c.GetTo(key, nil)
+}
+
+// GetTo appends the value stored under key to dst and returns the extended
+// buffer
+func (c *SharedCache) GetTo(key string, dst []byte) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return dst, false
+	}
+	h := sharedHash(key)
+	b, home := c.locate(h)
+	n := len(dst)
+	var found bool
+	c.read(b, func() {
+		dst, found = c.lookup(b, home, h, key, dst[:n])
+	})
+	return dst, found
+}
+
+// lookup finds key in the window of its home slot. Data may be torn by a
+// concurrent write, so every length is checked before it is used
+func (c *SharedCache) lookup(b, home int, h uint64, key string, dst []byte) ([]byte, bool) {
+	offset := atomic.LoadUint64(c.offset(b))
+	gen := atomic.LoadUint64(c.gen(b))
+	ring := c.ring(b)
+	for i := 0; i < sharedSlotWindow; i++ {
+		off := c.slot(b, (home+i)%c.slots)
+		if atomic.LoadUint64(c.u64(off)) != h {
+			continue
+		}
+		loc := atomic.LoadUint64(c.u64(off + 8))
+		if !sharedLive(loc, offset, gen) {
+			continue
+		}
+		start := loc & (1<<chunkedOffsetBits - 1)
+		if start+sharedEntryHeader > c.bucketData {
+			continue
+		}
+		keyLen := uint64(binary.LittleEndian.Uint32(ring[start:]))
+		valueLen := uint64(binary.LittleEndian.Uint32(ring[start+4:]))
+		exp := int64(binary.LittleEndian.Uint64(ring[start+8:]))
+		start += sharedEntryHeader
+		if keyLen != uint64(len(key)) || valueLen > c.bucketData || start+keyLen+valueLen > c.bucketData {
+			continue
+		}
+		if string(ring[start:start+keyLen]) != key {
+			continue
+		}
+		if exp > 0 && time.Now().UnixNano() > exp {
+			return dst, false
+		}
+		start += keyLen
+		return append(dst, ring[start:start+valueLen]...), true
+	}
+	return dst, false
+}
+
+// Has reports whether a live value is stored under key
+func (c *SharedCache) Has(key string) bool {
+	_, found := c.Get(key)
+	return found
+}
+
+// Del removes key. The space it used is reclaimed when the ring wraps
+func (c *SharedCache) Del(key string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+	h := sharedHash(key)
+	b, home := c.locate(h)
+	c.write(b, func() {
+		for i := 0; i < sharedSlotWindow; i++ {
+			off := c.slot(b, (home+i)%c.slots)
+			if atomic.LoadUint64(c.u64(off)) == h {
+				atomic.StoreUint64(c.u64(off), 0)
+				atomic.StoreUint64(c.u64(off+8), 0)
+			}
+		}
+	})
+}
+
+// Len returns the number of entries that have not been overwritten or
+// deleted. Expired entries are counted until they are overwritten
+func (c *SharedCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return 0
+	}
+	total := 0
+	for b := 0; b < sharedBuckets; b++ {
+		var n int
+		c.read(b, func() {
+			n = 0
+			offset := atomic.LoadUint64(c.offset(b))
+			gen := atomic.LoadUint64(c.gen(b))
+			for i := 0; i < c.slots; i++ {
+				off := c.slot(b, i)
+				if atomic.LoadUint64(c.u64(off)) != 0 && sharedLive(atomic.LoadUint64(c.u64(off+8)), offset, gen) {
+					n++
+				}
+			}
+		})
+		total += n
+	}
+	return total
+}
+
+// Clear removes all entries, for every process sharing the segment
+func (c *SharedCache) Clear() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+	for b := 0; b < sharedBuckets; b++ {
+		c.write(b, func() { c.resetLocked(b) })
+	}
+}
+
+// Shared reports whether the segment is shared with other processes, false
+// for the private heap segment of platforms without file mappings
+func (c *SharedCache) Shared() bool {
+	return c.file != nil
+}
+
+// Close unmaps the segment. The entries stay in the file for the other
+// processes and later opens; remove the file to drop them. Later sets fail
+// and gets miss
+func (c *SharedCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.file == nil {
+		c.data = nil
+		return nil
+	}
+	err := munmap(c.data)
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package src
+
+import "sync"
+
+// loadCall is an in-flight load shared by concurrent callers
+type loadCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// flightGroup collapses concurrent loads of the same key into one call
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+// join returns the in-flight call for key, or registers a new one.
+// leader reports whether the caller must run the load and later call forget.
+// check runs under the lock before a new call is registered; if it finds
+// the value, no call is registered and the value is returned in call.
+func (g *flightGroup) join(key string, check func() (any, bool)) (call *loadCall, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if call, ok := g.calls[key]; ok {
+		return call, false
+	}
+	if value, found := check(); found {
+		call = &loadCall{done: make(chan struct{}), value: value}
+		close(call.done)
+		return call, false
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	call = &loadCall{done: make(chan struct{})}
+	g.calls[key] = call
+	return call, true
+}
+
+// forget unregisters the call for key
+func (g *flightGroup) forget(key string) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
@@ -0,0 +1,169 @@
+package src
+
+import "reflect"
+
+// DefaultDeepSizeMaxDepth is the default depth limit of DeepSize.
+const DefaultDeepSizeMaxDepth = 64
+
+// DeepSizeOptions caps a deep size estimation.
+type DeepSizeOptions struct {
+	// MaxDepth limits how many references are followed from the root
+	// (default DefaultDeepSizeMaxDepth).
+	MaxDepth int
+
+	// MaxBytes stops the walk once the estimate reaches this size and returns
+	// it; 0 means no limit.
+	MaxBytes int64
+}
+
+// DeepSize estimates the memory held by v, following pointers, slices, maps,
+// interfaces and struct fields. Memory reachable more than once (shared or
+// cyclic references) is counted once. Channels and functions are not followed.
+// A Sizer reports its own size. It can be used as Config.Cost so that nested
+// values are costed by size.
+func DeepSize(v any) int64 {
+	return DeepSizeWithOptions(v, DeepSizeOptions{})
+}
+
+// DeepSizeWithOptions is DeepSize with depth and size caps.
+func DeepSizeWithOptions(v any, opts DeepSizeOptions) int64 {
+	if v == nil {
+		return 0
+	}
+	if sizer, ok := v.(Sizer); ok {
+		size := sizer.CacheCost()
+		if opts.MaxBytes > 0 && size > opts.MaxBytes {
+			return opts.MaxBytes
+		}
+		return size
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultDeepSizeMaxDepth
+	}
+
+	rv := reflect.ValueOf(v)
+	w := &sizeWalker{
+		seen: make(map[sizeKey]struct{}),
+		opts: opts,
+		size: int64(rv.Type().Size()),
+	}
+	w.walk(rv, 0)
+	if opts.MaxBytes > 0 && w.size > opts.MaxBytes {
+		return opts.MaxBytes
+	}
+	return w.size
+}
+
+// sizeKey identifies a visited memory block; the type is part of the key
+// because a struct and its first field share an address.
+type sizeKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// sizeWalker accumulates the size of the memory referenced by a value.
+type sizeWalker struct {
+	seen map[sizeKey]struct{}
+	opts DeepSizeOptions
+	size int64
+}
+
+// visit reports whether a block is seen for the first time.
+func (w *sizeWalker) visit(ptr uintptr, typ reflect.Type) bool {
+	key := sizeKey{ptr: ptr, typ: typ}
+	if _, ok := w.seen[key]; ok {
+		return false
+	}
+	w.seen[key] = struct{}{}
+	return true
+}
+
+// done reports whether the size cap has been reached.
+func (w *sizeWalker) done() bool {
+	return w.opts.MaxBytes > 0 && w.size >= w.opts.MaxBytes
+}
+
+// walk adds the memory referenced by v, excluding v's own inline size.
+func (w *sizeWalker) walk(v reflect.Value, depth int) {
+	if depth > w.opts.MaxDepth || w.done() {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || !w.visit(v.Pointer(), v.Type()) {
+			return
+		}
+		elem := v.Elem()
+		w.size += int64(elem.Type().Size())
+		w.walk(elem, depth+1)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		elem := v.Elem()
+		w.size += int64(elem.Type().Size())
+		w.walk(elem, depth+1)
+
+	case reflect.String:
+		w.size += int64(v.Len())
+
+	case reflect.Slice:
+		if v.IsNil() || !w.visit(v.Pointer(), v.Type()) {
+			return
+		}
+		w.size += int64(v.Cap()) * int64(v.Type().Elem().Size())
+		if !hasReferences(v.Type().Elem()) {
+			return
+		}
+		for i := 0; i < v.Len() && !w.done(); i++ {
+			w.walk(v.Index(i), depth+1)
+		}
+
+	case reflect.Array:
+		if !hasReferences(v.Type().Elem()) {
+			return
+		}
+		for i := 0; i < v.Len() && !w.done(); i++ {
+			w.walk(v.Index(i), depth+1)
+		}
+
+	case reflect.Map:
+		if v.IsNil() || !w.visit(v.Pointer(), v.Type()) {
+			return
+		}
+		// Buckets hold keys, values and roughly one byte of metadata per slot.
+		w.size += int64(v.Len()) * (int64(v.Type().Key().Size()) + int64(v.Type().Elem().Size()) + 1)
+		if !hasReferences(v.Type().Key()) && !hasReferences(v.Type().Elem()) {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() && !w.done() {
+			w.walk(iter.Key(), depth+1)
+			w.walk(iter.Value(), depth+1)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField() && !w.done(); i++ {
+			w.walk(v.Field(i), depth+1)
+		}
+	}
+}
+
+// hasReferences reports whether values of t can reference other memory.
+func hasReferences(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.String, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Array:
+		return hasReferences(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasReferences(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package src
+
+import "unsafe"
+
+// Sizer is implemented by values that know their cache cost. A Sizer set
+// with cost 0 costs CacheCost, taking precedence over Config.Cost.
+type Sizer interface {
+	CacheCost() int64
+}
+
+// EstimateCost estimates the bytes held by value: CacheCost for a Sizer,
+// the length plus header for strings and []byte, and DeepSize for anything
+// else. It costs values set with cost 0 when Config.Cost is nil.
+func EstimateCost(value any) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case Sizer:
+		return v.CacheCost()
+	case string:
+		return int64(unsafe.Sizeof(v)) + int64(len(v))
+	case []byte:
+		return int64(unsafe.Sizeof(v)) + int64(cap(v))
+	}
+	return DeepSize(value)
+}
@@ -0,0 +1,34 @@
+package src
+
+import "testing"
+
+// sizedValue reports a fixed cache cost
+type sizedValue struct{ cost int64 }
+
+func (v sizedValue) CacheCost() int64 { return v.cost }
+
+// Batch writes with cost 0 are costed like Set: by Sizer, then EstimateCost
+func TestMSetCostsZeroCostValues(t *testing.T) {
+	c, err := NewRistrettoCache(&Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if n := c.MSet(map[string]any{"sized": sizedValue{cost: 40}}, 0); n != 1 {
+		t.Fatalf("MSet stored %d items", n)
+	}
+	c.Wait()
+	if item, ok := c.cache.GetItem("sized"); !ok || item.Cost != 40 {
+		t.Fatalf("MSet of a Sizer cost %+v, want 40", item)
+	}
+
+	c.MSetWithCosts(map[string]struct {
+		Value any
+		Cost  int64
+	}{"text": {Value: "hello"}})
+	c.Wait()
+	if item, ok := c.cache.GetItem("text"); !ok || item.Cost != EstimateCost("hello") {
+		t.Fatalf("MSetWithCosts of a string cost %+v, want %d", item, EstimateCost("hello"))
+	}
+}
@@ -0,0 +1,266 @@
+package src
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotVersion is the current version of the snapshot file format
+const SnapshotVersion = 1
+
+// snapshotMagic identifies a snapshot file
+const snapshotMagic = "fastcache-snapshot"
+
+// ErrNotSnapshot is returned when reading data that is not a snapshot
+var ErrNotSnapshot = errors.New("not a fastcache snapshot")
+
+// ErrNotApplied is returned when a restore could not store some entries,
+// e.g. because they exceed MaxCost or Config.Admit rejected them
+var ErrNotApplied = errors.New("entries not applied")
+
+// snapshotHeader is the first record of a snapshot stream
+type snapshotHeader struct {
+	Magic     string
+	Version   int
+	CreatedAt int64
+	// Delta streams hold the changes since the full snapshot created at
+	// Base, Seq counting the deltas on top of it
+	Delta bool
+	Base  int64
+	Seq   int
+}
+
+// writeEntries gob-encodes the live entries of a cache, least recently used
+// first so that loading them back restores the LRU order
+func writeEntries(enc *gob.Encoder, c *RistrettoCache) (int, error) {
+	return writeItems(enc, c.cache.Entries())
+}
+
+// writeItems gob-encodes the unexpired items
+func writeItems(enc *gob.Encoder, items []CacheItem) (int, error) {
+	count := 0
+	stamp := DefaultClock.Now()
+	now := time.Now().UnixNano()
+	for _, item := range items {
+		if item.Expiration > 0 && now > item.Expiration {
+			continue
+		}
+		e := shardEntry{Key: item.Key, Value: item.Value, Cost: item.Cost, Expiration: item.Expiration, Clock: stamp}
+		if item.Expiration > 0 {
+			e.TTL = item.Expiration - now
+		}
+		if err := enc.Encode(&e); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// readEntries decodes entries until EOF and passes the unexpired ones to set.
+// With relative set, expirations are rebuilt from the remaining TTL against
+// the local clock, so a stream from a host with a skewed clock neither
+// expires early nor late; streams without a TTL keep their absolute expiration
+func readEntries(dec *gob.Decoder, relative bool, set func(e *shardEntry) bool) (int, error) {
+	n, _, err := readEntriesExpired(dec, relative, set)
+	return n, err
+}
+
+// readEntriesExpired is readEntries that also returns the number of entries
+// skipped because they expired
+func readEntriesExpired(dec *gob.Decoder, relative bool, set func(e *shardEntry) bool) (int, int, error) {
+	count, expired := 0, 0
+	for {
+		var e shardEntry
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return count, expired, nil
+			}
+			return count, expired, err
+		}
+		if relative {
+			DefaultClock.Observe(e.Clock)
+			if e.TTL > 0 {
+				e.Expiration = time.Now().UnixNano() + e.TTL
+			}
+		}
+		if e.Expiration > 0 && time.Now().UnixNano() > e.Expiration {
+			expired++
+			continue
+		}
+		if set(&e) {
+			count++
+		}
+	}
+}
+
+// restoreEntries stores the entries passed to set by read in batches on the
+// write goroutines of their shards, so none are dropped when a set buffer is
+// full. It fails with ErrNotApplied if some entry was not stored
+func restoreEntries(shard func(key string) *RistrettoCache, read func(set func(e *shardEntry) bool) (int, error)) (int, error) {
+	w := newWarmer(shard)
+	n, err := read(func(e *shardEntry) bool {
+		w.addItem(&setItem{key: e.Key, value: e.Value, cost: e.Cost, expiration: e.Expiration, internal: true})
+		return w.err == nil
+	})
+	if ferr := w.flush(); err == nil {
+		err = ferr
+	}
+	if err == nil && w.loaded < n {
+		err = fmt.Errorf("%w: %d of %d", ErrNotApplied, n-w.loaded, n)
+	}
+	return w.loaded, err
+}
+
+// writeSnapshotHeader writes the versioned header of a full snapshot and
+// returns its creation time
+func writeSnapshotHeader(enc *gob.Encoder) (int64, error) {
+	h := snapshotHeader{Magic: snapshotMagic, Version: SnapshotVersion, CreatedAt: time.Now().UnixNano()}
+	return h.CreatedAt, enc.Encode(&h)
+}
+
+// readHeader reads and validates the header of a full or delta snapshot
+func readHeader(dec *gob.Decoder) (snapshotHeader, error) {
+	var h snapshotHeader
+	if err := dec.Decode(&h); err != nil || h.Magic != snapshotMagic {
+		return h, ErrNotSnapshot
+	}
+	if h.Version != SnapshotVersion {
+		return h, fmt.Errorf("unsupported snapshot version %d", h.Version)
+	}
+	return h, nil
+}
+
+// readSnapshotHeader reads and validates the header of a full snapshot
+func readSnapshotHeader(dec *gob.Decoder) error {
+	h, err := readHeader(dec)
+	if err == nil && h.Delta {
+		err = ErrDeltaSnapshot
+	}
+	return err
+}
+
+// saveFile writes a snapshot to a temporary file and renames it over path,
+// so a crash never leaves a truncated snapshot behind
+func saveFile(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	bw := bufio.NewWriter(tmp)
+	if err := write(bw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadFile opens path and passes a buffered reader to read
+func loadFile(path string, read func(r io.Reader) (int, error)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return read(bufio.NewReader(f))
+}
+
+// SaveSnapshot writes all unexpired entries to w.
+// Values are gob-encoded, so custom types must be registered with gob.Register.
+func (c *RistrettoCache) SaveSnapshot(w io.Writer) error {
+	return c.deltas.saveBaseline(w, []*RistrettoCache{c})
+}
+
+// LoadSnapshot restores entries written by SaveSnapshot.
+// Entries that expired since the snapshot are skipped.
+// It returns the number of restored entries, and ErrNotApplied if some
+// entries could not be stored.
+func (c *RistrettoCache) LoadSnapshot(r io.Reader) (int, error) {
+	dec := gob.NewDecoder(r)
+	if err := readSnapshotHeader(dec); err != nil {
+		return 0, err
+	}
+	return restoreEntries(func(string) *RistrettoCache { return c }, func(set func(e *shardEntry) bool) (int, error) {
+		return readEntries(dec, false, set)
+	})
+}
+
+// SaveToFile writes a snapshot of the cache to path, and with
+// Config.PersistMetrics its metrics to path+".metrics"
+func (c *RistrettoCache) SaveToFile(path string) error {
+	if err := saveFile(path, c.SaveSnapshot); err != nil {
+		return err
+	}
+	if c.config.PersistMetrics {
+		return saveMetricsFile(path, c.SaveMetrics)
+	}
+	return nil
+}
+
+// LoadFromFile restores a snapshot written by SaveToFile, and with
+// Config.PersistMetrics the metrics saved with it
+func (c *RistrettoCache) LoadFromFile(path string) (int, error) {
+	n, err := loadFile(path, c.LoadSnapshot)
+	if err == nil && c.config.PersistMetrics {
+		err = loadMetricsFile(path, c.LoadMetrics)
+	}
+	return n, err
+}
+
+// SaveSnapshot writes all unexpired entries of every shard to w.
+// The snapshot can be loaded into a cache with a different shard count.
+func (sc *ShardedCacheV2) SaveSnapshot(w io.Writer) error {
+	return sc.deltas.saveBaseline(w, sc.shards)
+}
+
+// LoadSnapshot restores entries written by SaveSnapshot
+func (sc *ShardedCacheV2) LoadSnapshot(r io.Reader) (int, error) {
+	dec := gob.NewDecoder(r)
+	if err := readSnapshotHeader(dec); err != nil {
+		return 0, err
+	}
+	return restoreEntries(sc.getShard, func(set func(e *shardEntry) bool) (int, error) {
+		return readEntries(dec, false, set)
+	})
+}
+
+// SaveToFile writes a snapshot of the cache to path, and with
+// Config.PersistMetrics its metrics to path+".metrics"
+func (sc *ShardedCacheV2) SaveToFile(path string) error {
+	if err := saveFile(path, sc.SaveSnapshot); err != nil {
+		return err
+	}
+	if sc.persistMetrics {
+		return saveMetricsFile(path, sc.SaveMetrics)
+	}
+	return nil
+}
+
+// LoadFromFile restores a snapshot written by SaveToFile, and with
+// Config.PersistMetrics the metrics saved with it
+func (sc *ShardedCacheV2) LoadFromFile(path string) (int, error) {
+	n, err := loadFile(path, sc.LoadSnapshot)
+	if err == nil && sc.persistMetrics {
+		err = loadMetricsFile(path, sc.LoadMetrics)
+	}
+	return n, err
+}
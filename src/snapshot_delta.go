@@ -0,0 +1,340 @@
+package src
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultFullSnapshotEvery is how many SaveIncremental calls write one full
+// snapshot by default
+const DefaultFullSnapshotEvery = 10
+
+// deltaSuffix names the delta files of SaveIncremental, numbered from 1
+const deltaSuffix = ".delta."
+
+var (
+	// ErrDeltaSnapshot is returned when a delta snapshot is loaded as a full one
+	ErrDeltaSnapshot = errors.New("snapshot is a delta, load it with LoadIncremental")
+	// ErrNoBaseline is returned by SaveDelta before a full snapshot was saved,
+	// or when Config.DeltaSnapshots is not set
+	ErrNoBaseline = errors.New("no full snapshot to base a delta on")
+)
+
+// deltaChain tracks the full snapshot that deltas build on
+type deltaChain struct {
+	mu     sync.Mutex
+	fileMu sync.Mutex // serializes SaveIncremental
+	base   int64      // creation time of the last full snapshot, 0 before the first
+	mark   uint64     // item stamp when the last snapshot started
+	seq    int        // deltas written since the full snapshot
+}
+
+// takeChanged swaps out the keys removed or re-timed since the last snapshot
+func (c *LRUCache) takeChanged() map[string]struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := c.changed
+	c.changed = make(map[string]struct{})
+	return changed
+}
+
+// restoreChanged puts back the keys of a snapshot that failed
+func (c *LRUCache) restoreChanged(changed map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range changed {
+		c.changed[key] = struct{}{}
+	}
+}
+
+// changedSince returns copies of the items written after stamp mark or
+// named in changed, and the keys of changed that are gone
+func (c *LRUCache) changedSince(mark uint64, changed map[string]struct{}) ([]CacheItem, []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var items []CacheItem
+	for key, item := range c.items {
+		_, touched := changed[key]
+		if item.stamp > mark || touched {
+			items = append(items, CacheItem{Key: item.Key, Value: item.Value, Cost: item.Cost, Expiration: item.Expiration})
+		}
+	}
+	var deleted []string
+	for key := range changed {
+		if _, ok := c.items[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+	return items, deleted
+}
+
+// beginSnapshot starts a snapshot of shards: it returns the current item
+// stamp and the changed keys of each shard, nil without delta tracking
+func beginSnapshot(shards []*RistrettoCache) (uint64, []map[string]struct{}) {
+	mark := itemStamps.Load()
+	if shards[0].cache.changed == nil {
+		return mark, nil
+	}
+	changed := make([]map[string]struct{}, len(shards))
+	for i, shard := range shards {
+		changed[i] = shard.cache.takeChanged()
+	}
+	return mark, changed
+}
+
+// abortSnapshot puts back the changed keys of a snapshot that failed
+func abortSnapshot(shards []*RistrettoCache, changed []map[string]struct{}) {
+	for i := range changed {
+		shards[i].cache.restoreChanged(changed[i])
+	}
+}
+
+// saveBaseline writes a full snapshot of shards that later deltas build on
+func (d *deltaChain) saveBaseline(w io.Writer, shards []*RistrettoCache) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	mark, changed := beginSnapshot(shards)
+	enc := gob.NewEncoder(w)
+	created, err := writeSnapshotHeader(enc)
+	for _, shard := range shards {
+		if err != nil {
+			break
+		}
+		_, err = writeEntries(enc, shard)
+	}
+	if err != nil {
+		abortSnapshot(shards, changed)
+		return err
+	}
+	d.base, d.mark, d.seq = created, mark, 0
+	return nil
+}
+
+// saveDelta writes the changes of shards since the previous snapshot
+func (d *deltaChain) saveDelta(w io.Writer, shards []*RistrettoCache) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.base == 0 || shards[0].cache.changed == nil {
+		return ErrNoBaseline
+	}
+	mark, changed := beginSnapshot(shards)
+	enc := gob.NewEncoder(w)
+	err := enc.Encode(&snapshotHeader{
+		Magic:     snapshotMagic,
+		Version:   SnapshotVersion,
+		CreatedAt: time.Now().UnixNano(),
+		Delta:     true,
+		Base:      d.base,
+		Seq:       d.seq + 1,
+	})
+	for i, shard := range shards {
+		if err != nil {
+			break
+		}
+		err = writeDelta(enc, shard.cache, d.mark, changed[i])
+	}
+	if err != nil {
+		abortSnapshot(shards, changed)
+		return err
+	}
+	d.mark = mark
+	d.seq++
+	return nil
+}
+
+// writeDelta encodes the items of c changed since mark, and tombstones for
+// removed and expired keys
+func writeDelta(enc *gob.Encoder, c *LRUCache, mark uint64, changed map[string]struct{}) error {
+	items, deleted := c.changedSince(mark, changed)
+	now := time.Now().UnixNano()
+	live := items[:0]
+	for _, item := range items {
+		if item.Expiration > 0 && now > item.Expiration {
+			deleted = append(deleted, item.Key)
+		} else {
+			live = append(live, item)
+		}
+	}
+	if _, err := writeItems(enc, live); err != nil {
+		return err
+	}
+	for _, key := range deleted {
+		if err := enc.Encode(&shardEntry{Key: key, Deleted: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveDelta writes the keys changed since the previous SaveSnapshot or
+// SaveDelta to w: their current entries, and tombstones for removed keys.
+// It needs Config.DeltaSnapshots and a full snapshot to build on, and
+// returns ErrNoBaseline otherwise. Renewals of sliding TTLs are not changes
+func (c *RistrettoCache) SaveDelta(w io.Writer) error {
+	return c.deltas.saveDelta(w, []*RistrettoCache{c})
+}
+
+// SaveDelta writes the keys of all shards changed since the previous
+// SaveSnapshot or SaveDelta to w, see RistrettoCache.SaveDelta
+func (sc *ShardedCacheV2) SaveDelta(w io.Writer) error {
+	return sc.deltas.saveDelta(w, sc.shards)
+}
+
+// deltaPath returns the path of the seq-th delta on top of the snapshot at path
+func deltaPath(path string, seq int) string {
+	return path + deltaSuffix + strconv.Itoa(seq)
+}
+
+// saveIncremental writes a full snapshot to path every fullEvery calls and
+// a numbered delta next to it otherwise. Deltas of the previous full
+// snapshot are removed once a new one is written; a delta left behind by a
+// crash belongs to another base and is ignored on load
+func (d *deltaChain) saveIncremental(path string, fullEvery int, saveFull func(string) error, saveDelta func(io.Writer) error) error {
+	d.fileMu.Lock()
+	defer d.fileMu.Unlock()
+
+	if fullEvery <= 0 {
+		fullEvery = DefaultFullSnapshotEvery
+	}
+	d.mu.Lock()
+	base, seq := d.base, d.seq
+	d.mu.Unlock()
+
+	if base != 0 && seq+1 < fullEvery {
+		if err := saveFile(deltaPath(path, seq+1), saveDelta); !errors.Is(err, ErrNoBaseline) {
+			return err
+		}
+	}
+	if err := saveFull(path); err != nil {
+		return err
+	}
+	stale, _ := filepath.Glob(filepath.Join(filepath.Dir(path), filepath.Base(path)+deltaSuffix+"*"))
+	for _, name := range stale {
+		os.Remove(name)
+	}
+	return nil
+}
+
+// SaveIncremental saves the cache to path as a chain: a full snapshot every
+// Config.FullSnapshotEvery calls, and in between a delta with the keys
+// changed since the previous call in path.delta.1, path.delta.2, ...
+// LoadIncremental merges the chain. Without Config.DeltaSnapshots every call
+// writes a full snapshot
+func (c *RistrettoCache) SaveIncremental(path string) error {
+	return c.deltas.saveIncremental(path, c.config.FullSnapshotEvery, c.SaveToFile, c.SaveDelta)
+}
+
+// SaveIncremental saves all shards to path as a chain of a full snapshot and
+// deltas, see RistrettoCache.SaveIncremental
+func (sc *ShardedCacheV2) SaveIncremental(path string) error {
+	return sc.deltas.saveIncremental(path, sc.fullEvery, sc.SaveToFile, sc.SaveDelta)
+}
+
+// loadIncremental loads the full snapshot at path and merges its deltas:
+// they are read first, newest entry per key winning, so the snapshot's
+// entries they replace or delete are skipped and each key is set once
+func loadIncremental(path string, set func(e *shardEntry) bool) (int, error) {
+	return loadFile(path, func(r io.Reader) (int, error) {
+		dec := gob.NewDecoder(r)
+		h, err := readHeader(dec)
+		if err != nil {
+			return 0, err
+		}
+		if h.Delta {
+			return 0, ErrDeltaSnapshot
+		}
+		merged, err := mergeDeltas(path, h.CreatedAt)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := readEntries(dec, false, func(e *shardEntry) bool {
+			if _, replaced := merged[e.Key]; replaced {
+				return false
+			}
+			return set(e)
+		})
+		if err != nil {
+			return n, err
+		}
+		now := time.Now().UnixNano()
+		for _, e := range merged {
+			if e.Deleted || (e.Expiration > 0 && now > e.Expiration) {
+				continue
+			}
+			if set(e) {
+				n++
+			}
+		}
+		return n, nil
+	})
+}
+
+// mergeDeltas reads the deltas on top of the full snapshot created at base,
+// in order, and returns the latest entry of every key they mention. It stops
+// at the first missing delta or one of another base
+func mergeDeltas(path string, base int64) (map[string]*shardEntry, error) {
+	merged := make(map[string]*shardEntry)
+	for seq := 1; ; seq++ {
+		_, err := loadFile(deltaPath(path, seq), func(r io.Reader) (int, error) {
+			dec := gob.NewDecoder(r)
+			h, err := readHeader(dec)
+			if err != nil {
+				return 0, err
+			}
+			if !h.Delta || h.Base != base || h.Seq != seq {
+				return 0, os.ErrNotExist
+			}
+			for {
+				e := new(shardEntry)
+				if err := dec.Decode(e); err != nil {
+					if err == io.EOF {
+						return 0, nil
+					}
+					return 0, err
+				}
+				merged[e.Key] = e
+			}
+		})
+		if errors.Is(err, os.ErrNotExist) {
+			return merged, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// LoadIncremental restores a chain written by SaveIncremental: the full
+// snapshot at path with its deltas merged on top. Entries that expired
+// since are skipped. It returns the number of restored entries
+func (c *RistrettoCache) LoadIncremental(path string) (int, error) {
+	n, err := restoreEntries(func(string) *RistrettoCache { return c }, func(set func(e *shardEntry) bool) (int, error) {
+		return loadIncremental(path, set)
+	})
+	if err == nil && c.config.PersistMetrics {
+		err = loadMetricsFile(path, c.LoadMetrics)
+	}
+	return n, err
+}
+
+// LoadIncremental restores a chain written by SaveIncremental into the
+// shards, see RistrettoCache.LoadIncremental
+func (sc *ShardedCacheV2) LoadIncremental(path string) (int, error) {
+	n, err := restoreEntries(sc.getShard, func(set func(e *shardEntry) bool) (int, error) {
+		return loadIncremental(path, set)
+	})
+	if err == nil && sc.persistMetrics {
+		err = loadMetricsFile(path, sc.LoadMetrics)
+	}
+	return n, err
+}
@@ -0,0 +1,101 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+const snapshotTestKeys = 20000
+
+func fillSnapshotCache(t *testing.T, set func(key string, value any) bool, wait func()) {
+	t.Helper()
+	for i := 0; i < snapshotTestKeys; i++ {
+		set(fmt.Sprintf("key-%d", i), i)
+		if i%500 == 0 {
+			wait()
+		}
+	}
+	wait()
+}
+
+func TestRistrettoSnapshotRestoresEveryEntry(t *testing.T) {
+	src, err := NewRistrettoCache(&Config{NumCounters: 1e6, MaxCost: 1 << 30, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	fillSnapshotCache(t, func(k string, v any) bool { return src.Set(k, v, 1) }, src.Wait)
+	want := src.Len()
+
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	if err := src.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := NewRistrettoCache(&Config{NumCounters: 1e6, MaxCost: 1 << 30, BufferItems: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	n, err := dst.LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != want || dst.Len() != want {
+		t.Fatalf("restored %d entries (Len %d), want %d", n, dst.Len(), want)
+	}
+}
+
+func TestShardedSnapshotRestoresEveryEntry(t *testing.T) {
+	src, err := NewShardedCacheV2(8, &Config{NumCounters: 1e6, MaxCost: 1 << 30, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	fillSnapshotCache(t, func(k string, v any) bool { return src.Set(k, v, 1) }, src.Wait)
+	want := src.Len()
+
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := NewShardedCacheV2(4, &Config{NumCounters: 1e6, MaxCost: 1 << 30, BufferItems: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	n, err := dst.LoadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != want || dst.Len() != want {
+		t.Fatalf("restored %d entries (Len %d), want %d", n, dst.Len(), want)
+	}
+}
+
+func TestSnapshotReportsUnappliedEntries(t *testing.T) {
+	src, err := NewRistrettoCache(&Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	src.Set("small", 1, 1)
+	src.Set("large", 2, 100)
+	src.Wait()
+
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := NewRistrettoCache(&Config{NumCounters: 1e4, MaxCost: 10, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	n, err := dst.LoadSnapshot(&buf)
+	if !errors.Is(err, ErrNotApplied) || n != 1 {
+		t.Fatalf("LoadSnapshot = %d, %v; want 1, ErrNotApplied", n, err)
+	}
+}
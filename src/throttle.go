@@ -0,0 +1,207 @@
+package src
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WriteLimit is a token bucket limiting the sets of one caller
+type WriteLimit struct {
+	// Rate is the sustained number of sets per second (0 means unlimited)
+	Rate float64
+	// Burst is the number of sets allowed at once (default max(1, Rate))
+	Burst int
+}
+
+// burst returns the bucket capacity
+func (l WriteLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	if l.Rate > 1 {
+		return l.Rate
+	}
+	return 1
+}
+
+// ThrottleStats reports the sets of one caller
+type ThrottleStats struct {
+	Allowed   int64 // sets let into the set buffer
+	Throttled int64 // sets rejected over the limit
+}
+
+// KeyPrefixCaller returns the part of key before the first ':', the default
+// Config.WriteCaller, so "billing:invoice:42" is written by "billing"
+func KeyPrefixCaller(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// callerBucket is the token bucket and counters of one caller
+type callerBucket struct {
+	mu     sync.Mutex
+	limit  WriteLimit
+	tokens float64
+	last   time.Time
+
+	allowed   atomic.Int64
+	throttled atomic.Int64
+}
+
+// take reports whether a token was available and consumes it
+func (b *callerBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit.Rate <= 0 {
+		return true
+	}
+	burst := b.limit.burst()
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// writeThrottle applies per-caller write limits before the set buffer, so a
+// component writing in a loop exhausts its own budget instead of filling the
+// buffer shared with every other writer. A ShardedCacheV2 shares one
+// throttle between its shards
+type writeThrottle struct {
+	callerOf func(key string) string
+	fallback WriteLimit
+
+	mu      sync.RWMutex
+	limits  map[string]WriteLimit
+	buckets map[string]*callerBucket
+}
+
+// newWriteThrottle returns the throttle configured by config, nil if no
+// write limit is set
+func newWriteThrottle(config *Config) *writeThrottle {
+	if config.WriteLimit.Rate <= 0 && len(config.WriteLimits) == 0 {
+		return nil
+	}
+	t := &writeThrottle{
+		callerOf: config.WriteCaller,
+		fallback: config.WriteLimit,
+		limits:   make(map[string]WriteLimit, len(config.WriteLimits)),
+		buckets:  make(map[string]*callerBucket),
+	}
+	if t.callerOf == nil {
+		t.callerOf = KeyPrefixCaller
+	}
+	for caller, limit := range config.WriteLimits {
+		t.limits[caller] = limit
+	}
+	return t
+}
+
+// bucket returns the bucket of caller, creating it full
+func (t *writeThrottle) bucket(caller string) *callerBucket {
+	t.mu.RLock()
+	b, ok := t.buckets[caller]
+	t.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b, ok = t.buckets[caller]; ok {
+		return b
+	}
+	limit, ok := t.limits[caller]
+	if !ok {
+		limit = t.fallback
+	}
+	b = &callerBucket{limit: limit, tokens: limit.burst(), last: time.Now()}
+	t.buckets[caller] = b
+	return b
+}
+
+// allow reports whether the caller writing key is within its limit
+func (t *writeThrottle) allow(key string) bool {
+	b := t.bucket(t.callerOf(key))
+	if b.take(time.Now()) {
+		b.allowed.Add(1)
+		return true
+	}
+	b.throttled.Add(1)
+	return false
+}
+
+// setLimit changes the limit of caller; its bucket starts full
+func (t *writeThrottle) setLimit(caller string, limit WriteLimit) {
+	t.mu.Lock()
+	t.limits[caller] = limit
+	b, ok := t.buckets[caller]
+	t.mu.Unlock()
+	if ok {
+		b.mu.Lock()
+		b.limit, b.tokens, b.last = limit, limit.burst(), time.Now()
+		b.mu.Unlock()
+	}
+}
+
+// stats returns the counters of every caller seen so far
+func (t *writeThrottle) stats() map[string]ThrottleStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	stats := make(map[string]ThrottleStats, len(t.buckets))
+	for caller, b := range t.buckets {
+		stats[caller] = ThrottleStats{Allowed: b.allowed.Load(), Throttled: b.throttled.Load()}
+	}
+	return stats
+}
+
+// throttled reports whether a set must be rejected by the write limits.
+// Internal writes (loads, refreshes, replication) are never throttled
+func (c *RistrettoCache) throttled(item *setItem) bool {
+	if c.throttle == nil || item.internal || c.throttle.allow(item.key) {
+		return false
+	}
+	c.metrics.setsThrottled.Add(1)
+	return true
+}
+
+// SetWriteLimit changes the write limit of caller at runtime. It does
+// nothing unless Config.WriteLimit or Config.WriteLimits enabled throttling
+func (c *RistrettoCache) SetWriteLimit(caller string, limit WriteLimit) {
+	if c.throttle != nil {
+		c.throttle.setLimit(caller, limit)
+	}
+}
+
+// ThrottleStats returns the allowed and throttled sets of each caller
+// (nil unless throttling is enabled)
+func (c *RistrettoCache) ThrottleStats() map[string]ThrottleStats {
+	if c.throttle == nil {
+		return nil
+	}
+	return c.throttle.stats()
+}
+
+// SetWriteLimit changes the write limit of caller on all shards
+func (sc *ShardedCacheV2) SetWriteLimit(caller string, limit WriteLimit) {
+	if sc.throttle != nil {
+		sc.throttle.setLimit(caller, limit)
+	}
+}
+
+// ThrottleStats returns the allowed and throttled sets of each caller
+func (sc *ShardedCacheV2) ThrottleStats() map[string]ThrottleStats {
+	if sc.throttle == nil {
+		return nil
+	}
+	return sc.throttle.stats()
+}
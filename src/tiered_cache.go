@@ -0,0 +1,198 @@
+package src
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTieredL1TTL bounds how long a value promoted from L2 is served from
+// L1 without checking L2 again
+const DefaultTieredL1TTL = time.Minute
+
+// WriteMode selects how TieredCache writes reach L2
+type WriteMode int
+
+const (
+	// WriteThrough writes L2 before L1 and returns the L2 error
+	WriteThrough WriteMode = iota
+	// WriteBack writes L1 and flushes to L2 in the background, see WriteBehind
+	WriteBack
+)
+
+// RemoteCache is the L2 of a TieredCache, typically a thin wrapper around a
+// Redis client: GET, SET with expiry and DEL
+type RemoteCache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+}
+
+// TieredCacheOptions configures a TieredCache
+type TieredCacheOptions struct {
+	// Mode selects write-through (default) or write-back
+	Mode WriteMode
+	// L1TTL is the TTL of values in L1 (default DefaultTieredL1TTL); a
+	// shorter TTL passed to Set wins
+	L1TTL time.Duration
+	// WriteBehind configures the queue of WriteBack mode
+	WriteBehind WriteBehindOptions
+}
+
+// TieredStats counts the reads of a TieredCache per tier
+type TieredStats struct {
+	L1Hits   int64 // served from L1
+	L2Hits   int64 // missed L1, served from L2 and promoted
+	Misses   int64 // missed both tiers
+	L2Errors int64 // L2 reads that failed
+}
+
+// L1Ratio returns the share of reads served from L1
+func (s TieredStats) L1Ratio() float64 {
+	return ratio(s.L1Hits, s.L1Hits+s.L2Hits+s.Misses+s.L2Errors)
+}
+
+// HitRatio returns the share of reads served from either tier
+func (s TieredStats) HitRatio() float64 {
+	return ratio(s.L1Hits+s.L2Hits, s.L1Hits+s.L2Hits+s.Misses+s.L2Errors)
+}
+
+func ratio(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// TieredCache layers an in-process cache (L1) over a remote cache (L2), a
+// near-cache in front of a shared fastcache or Redis node. Reads try L1,
+// then L2, promoting L2 hits into L1 for a shorter TTL. Values are bytes;
+// use a Codec for other types
+type TieredCache struct {
+	l1   Cache
+	l2   RemoteCache
+	opts TieredCacheOptions
+	wb   *WriteBehind // nil unless WriteBack
+
+	l1Hits   atomic.Int64
+	l2Hits   atomic.Int64
+	misses   atomic.Int64
+	l2Errors atomic.Int64
+}
+
+// NewTieredCache creates a TieredCache over l1 and l2
+func NewTieredCache(l1 Cache, l2 RemoteCache, opts TieredCacheOptions) *TieredCache {
+	if opts.L1TTL <= 0 {
+		opts.L1TTL = DefaultTieredL1TTL
+	}
+	tc := &TieredCache{l1: l1, l2: l2, opts: opts}
+	if opts.Mode == WriteBack {
+		tc.wb = NewWriteBehind(l1, remoteStore{l2}, opts.WriteBehind)
+	}
+	return tc
+}
+
+// Get returns the value of key from L1, or from L2 and promotes it into L1
+func (tc *TieredCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if v, found := tc.l1.Get(key); found {
+		if data, ok := v.([]byte); ok {
+			tc.l1Hits.Add(1)
+			return data, true, nil
+		}
+	}
+	data, found, err := tc.l2.Get(ctx, key)
+	if err != nil {
+		tc.l2Errors.Add(1)
+		return nil, false, err
+	}
+	if !found {
+		tc.misses.Add(1)
+		return nil, false, nil
+	}
+	tc.l2Hits.Add(1)
+	tc.l1.SetWithTTL(key, data, int64(len(data)), tc.opts.L1TTL)
+	return data, true, nil
+}
+
+// Stats returns the per-tier read counters
+func (tc *TieredCache) Stats() TieredStats {
+	return TieredStats{
+		L1Hits:   tc.l1Hits.Load(),
+		L2Hits:   tc.l2Hits.Load(),
+		Misses:   tc.misses.Load(),
+		L2Errors: tc.l2Errors.Load(),
+	}
+}
+
+// Set stores value in both tiers. ttl applies to L2 (0 means no expiration);
+// L1 keeps the value for at most L1TTL
+func (tc *TieredCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	l1ttl := tc.l1TTL(ttl)
+	if tc.wb != nil {
+		// The queued write carries the L2 TTL, L1 gets its own
+		return tc.wb.write(StoreWrite{Key: key, Value: value, TTL: ttl}, func() {
+			tc.l1.SetWithTTL(key, value, int64(len(value)), l1ttl)
+		})
+	}
+	if err := tc.l2.Set(ctx, key, value, ttl); err != nil {
+		// Do not keep a value L2 does not have
+		tc.l1.Del(key)
+		return err
+	}
+	tc.l1.SetWithTTL(key, value, int64(len(value)), l1ttl)
+	return nil
+}
+
+// Del deletes key from both tiers
+func (tc *TieredCache) Del(ctx context.Context, key string) error {
+	if tc.wb != nil {
+		return tc.wb.Del(key)
+	}
+	tc.l1.Del(key)
+	return tc.l2.Del(ctx, key)
+}
+
+// l1TTL returns the L1 TTL for a value stored with ttl
+func (tc *TieredCache) l1TTL(ttl time.Duration) time.Duration {
+	if ttl > 0 && ttl < tc.opts.L1TTL {
+		return ttl
+	}
+	return tc.opts.L1TTL
+}
+
+// Flush waits until queued write-back writes reached L2 (no-op in write-through mode)
+func (tc *TieredCache) Flush() {
+	if tc.wb != nil {
+		tc.wb.Flush()
+	}
+}
+
+// Close flushes queued write-back writes. It closes neither tier
+func (tc *TieredCache) Close() error {
+	if tc.wb != nil {
+		return tc.wb.Close()
+	}
+	return nil
+}
+
+// remoteStore adapts a RemoteCache to BackingStore for write-back mode
+type remoteStore struct {
+	remote RemoteCache
+}
+
+// Write applies the writes one by one, stopping at the first error
+func (s remoteStore) Write(ctx context.Context, batch []StoreWrite) error {
+	for _, w := range batch {
+		if w.Deleted {
+			if err := s.remote.Del(ctx, w.Key); err != nil {
+				return err
+			}
+			continue
+		}
+		// TieredCache only queues []byte values
+		if err := s.remote.Set(ctx, w.Key, w.Value.([]byte), w.TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
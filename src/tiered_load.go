@@ -0,0 +1,185 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Defaults of TieredLoaderConfig
+const (
+	// DefaultLoadBudget is the overall time a tiered load may take
+	DefaultLoadBudget = 100 * time.Millisecond
+	// DefaultL2Share is the share of the remaining budget given to the L2 tier
+	DefaultL2Share = 0.3
+)
+
+// ErrBudgetExhausted is returned by TieredLoader.Get when the budget ran out
+// before any tier produced a value and there is no stale value to fall back on
+var ErrBudgetExhausted = errors.New("load budget exhausted")
+
+// Value sources reported in LoadResult
+const (
+	SourceL1     = "l1"
+	SourceL2     = "l2"
+	SourceLoader = "loader"
+	SourceStale  = "stale"
+)
+
+// Tier is a slower cache level consulted between the local cache and the
+// loader, e.g. a disk cache or a peer. Get must return once ctx is done
+type Tier interface {
+	Get(ctx context.Context, key string) (value any, found bool, err error)
+}
+
+// TieredLoaderConfig configures a TieredLoader
+type TieredLoaderConfig struct {
+	// L2 is consulted on an L1 miss (skipped if nil)
+	L2 Tier
+	// Loader loads the value from the source of truth, returning its cost and TTL
+	Loader func(ctx context.Context, key string) (any, int64, time.Duration, error)
+	// Budget is the overall time a Get may take (default DefaultLoadBudget)
+	Budget time.Duration
+	// L2Share is the share of the remaining budget given to L2 (default DefaultL2Share);
+	// the loader gets the rest
+	L2Share float64
+	// L2TTL is the TTL of values promoted from L2 into L1 (0 means no expiration)
+	L2TTL time.Duration
+	// StaleFor keeps values this long past their TTL, to be served when the
+	// budget runs out before a fresh value is found (0 disables stale reads)
+	StaleFor time.Duration
+}
+
+// LoadResult is the value returned by TieredLoader.Get and where it came from
+type LoadResult struct {
+	Value  any
+	Source string // SourceL1, SourceL2, SourceLoader or SourceStale
+}
+
+// Stale reports whether the value is past its TTL
+func (r LoadResult) Stale() bool {
+	return r.Source == SourceStale
+}
+
+// tieredEntry is a value stored in L1 by a TieredLoader. The cache entry
+// lives StaleFor longer than the value is fresh
+type tieredEntry struct {
+	value      any
+	freshUntil int64 // unix nanoseconds, 0 if always fresh
+}
+
+// TieredLoader reads through L1, then L2, then the loader, each with a slice
+// of one latency budget. Keys it serves must only be written through it
+type TieredLoader struct {
+	cache  Cache
+	config TieredLoaderConfig
+}
+
+// NewTieredLoader creates a TieredLoader with cache as L1
+func NewTieredLoader(cache Cache, config TieredLoaderConfig) *TieredLoader {
+	if config.Budget <= 0 {
+		config.Budget = DefaultLoadBudget
+	}
+	if config.L2Share <= 0 || config.L2Share >= 1 {
+		config.L2Share = DefaultL2Share
+	}
+	return &TieredLoader{cache: cache, config: config}
+}
+
+// Get returns the value of key from the fastest tier that has it within the
+// budget. When the budget runs out, a stale L1 value is returned if there is
+// one, ErrBudgetExhausted otherwise. A loader that ignores its context and
+// returns after the budget still stores its value for later reads
+func (t *TieredLoader) Get(ctx context.Context, key string) (LoadResult, error) {
+	var stale *tieredEntry
+	if v, found := t.cache.Get(key); found {
+		if entry, ok := v.(*tieredEntry); ok {
+			if entry.freshUntil == 0 || time.Now().UnixNano() < entry.freshUntil {
+				return LoadResult{Value: entry.value, Source: SourceL1}, nil
+			}
+			stale = entry
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.config.Budget)
+	defer cancel()
+
+	if t.config.L2 != nil {
+		if value, found := t.getL2(ctx, key); found {
+			t.store(key, value, 0, t.config.L2TTL)
+			return LoadResult{Value: value, Source: SourceL2}, nil
+		}
+	}
+
+	if t.config.Loader != nil {
+		if value, err := t.load(ctx, key); err == nil {
+			return LoadResult{Value: value, Source: SourceLoader}, nil
+		} else if stale == nil && ctx.Err() == nil {
+			return LoadResult{}, err
+		}
+	}
+
+	if stale != nil {
+		return LoadResult{Value: stale.value, Source: SourceStale}, nil
+	}
+	return LoadResult{}, ErrBudgetExhausted
+}
+
+// getL2 reads key from L2 within its share of the remaining budget
+func (t *TieredLoader) getL2(ctx context.Context, key string) (any, bool) {
+	l2ctx, cancel := context.WithTimeout(ctx, t.slice(ctx, t.config.L2Share))
+	defer cancel()
+	value, found, err := t.config.L2.Get(l2ctx, key)
+	if err != nil || !found {
+		return nil, false
+	}
+	return value, true
+}
+
+// load runs the loader with the rest of the budget. The loader runs on its
+// own goroutine, so a loader that ignores ctx does not hold up Get
+func (t *TieredLoader) load(ctx context.Context, key string) (any, error) {
+	type loaded struct {
+		value any
+		err   error
+	}
+	done := make(chan loaded, 1)
+	go func() {
+		value, cost, ttl, err := t.config.Loader(ctx, key)
+		if err == nil {
+			t.store(key, value, cost, ttl)
+		}
+		done <- loaded{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// slice returns share of the time left until the deadline of ctx
+func (t *TieredLoader) slice(ctx context.Context, share float64) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Duration(float64(t.config.Budget) * share)
+	}
+	return time.Duration(float64(time.Until(deadline)) * share)
+}
+
+// Set stores value in L1 as fresh for ttl
+func (t *TieredLoader) Set(key string, value any, cost int64, ttl time.Duration) bool {
+	return t.store(key, value, cost, ttl)
+}
+
+// store writes value to L1, keeping it StaleFor past ttl
+func (t *TieredLoader) store(key string, value any, cost int64, ttl time.Duration) bool {
+	entry := &tieredEntry{value: value}
+	if ttl <= 0 {
+		return t.cache.Set(key, entry, cost)
+	}
+	entry.freshUntil = time.Now().Add(ttl).UnixNano()
+	return t.cache.SetWithTTL(key, entry, cost, ttl+t.config.StaleFor)
+}
@@ -0,0 +1,178 @@
+package src
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// DefaultWindowRatio is the default share of MaxCost given to the window segment
+const DefaultWindowRatio = 0.01
+
+// doorkeeperHashes is the number of bloom filter probes per key
+const doorkeeperHashes = 3
+
+// doorkeeper is a bloom filter in front of the frequency counters.
+// The first access of a key only sets its bits, so one-hit wonders never
+// take a counter; later accesses are counted. It is cleared whenever the
+// counters decay
+type doorkeeper struct {
+	mu   sync.RWMutex
+	bits []uint64
+}
+
+func newDoorkeeper(numCounters int64) *doorkeeper {
+	words := (numCounters + 63) / 64
+	if words < 1 {
+		words = 1
+	}
+	return &doorkeeper{bits: make([]uint64, words)}
+}
+
+// probes returns the bit positions of key, using double hashing
+func (d *doorkeeper) probes(key string) [doorkeeperHashes]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	n := uint64(len(d.bits)) * 64
+	var p [doorkeeperHashes]uint64
+	for i := range p {
+		p[i] = (h1 + uint64(i)*h2) % n
+	}
+	return p
+}
+
+// add sets the bits of key and reports whether they were all set already
+func (d *doorkeeper) add(key string) bool {
+	p := d.probes(key)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	present := true
+	for _, bit := range p {
+		mask := uint64(1) << (bit % 64)
+		if d.bits[bit/64]&mask == 0 {
+			present = false
+			d.bits[bit/64] |= mask
+		}
+	}
+	return present
+}
+
+// contains reports whether key may have been seen
+func (d *doorkeeper) contains(key string) bool {
+	p := d.probes(key)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, bit := range p {
+		if d.bits[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// reset clears the filter
+func (d *doorkeeper) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+}
+
+// recordAccess counts an access to key, passing it through the doorkeeper
+func (c *RistrettoCache) recordAccess(key string) {
+	if c.degraded() {
+		return
+	}
+	if c.door.add(key) {
+		c.freq.Increment(key)
+	}
+}
+
+// estimate returns the estimated access frequency of key
+func (c *RistrettoCache) estimate(key string) int64 {
+	freq := c.freq.Get(key)
+	if c.door.contains(key) {
+		freq++
+	}
+	return freq
+}
+
+// makeRoom evicts until an item of cost fits, using W-TinyLFU: the item
+// leaving the window competes with the main segment's victim (its least
+// recently used key, see victim) and the less frequent one is evicted.
+// With AdmissionAlways the victim is always evicted; with PolicyARC every
+// key is admitted and ARC picks the victims. A shared budget is enforced
+// afterwards, across all caches that share it
+func (c *RistrettoCache) makeRoom(cost int64) {
+	if c.budget != nil {
+		defer c.budget.makeRoom(cost)
+	}
+	// Degraded mode skips the sampling and evicts in LRU order
+	if c.config.Policy == PolicyARC || c.config.AdmissionPolicy == AdmissionOff || c.degraded() {
+		for c.cache.Cost()+cost > c.maxCost.Load() && c.cache.Len() > 0 {
+			c.evictOne()
+		}
+		return
+	}
+	if c.config.AdmissionPolicy == AdmissionAlways {
+		for c.cache.Cost()+cost > c.maxCost.Load() && c.cache.Len() > 0 {
+			if _, victim := c.sampleMinFrequency(c.config.SampleSize); victim != "" {
+				c.evictKey(victim)
+			} else {
+				c.evictOne()
+			}
+		}
+		return
+	}
+	for c.cache.Cost()+cost > c.maxCost.Load() && c.cache.Len() > 0 {
+		candidate := c.cache.windowCandidate(cost)
+		victim := c.victim()
+
+		switch {
+		case candidate == "" && victim == "":
+			c.evictOne()
+		case candidate == "":
+			c.evictKey(victim)
+		case victim == "":
+			c.evictKey(candidate)
+		case c.estimate(candidate) > c.estimate(victim):
+			c.evictKey(victim)
+			c.cache.promote(candidate)
+		default:
+			c.evictKey(candidate)
+		}
+	}
+}
+
+// admitOverflow moves the window overflow into the main segment. Once the
+// cache is above AdmissionThreshold of MaxCost, each key leaving the window
+// competes with the main segment's victim first, as in makeRoom, so a
+// threshold below 1 keeps infrequent keys out before the cache is full
+func (c *RistrettoCache) admitOverflow() {
+	if c.config.AdmissionPolicy != AdmissionTinyLFU || c.config.Policy == PolicyARC || c.degraded() ||
+		float64(c.cache.Cost()) <= float64(c.maxCost.Load())*c.config.AdmissionThreshold {
+		c.cache.promoteOverflow()
+		return
+	}
+	for {
+		candidate := c.cache.windowCandidate(0)
+		if candidate == "" {
+			return
+		}
+		victim := c.victim()
+		switch {
+		case victim == "" || c.estimate(candidate) > c.estimate(victim):
+			if victim != "" {
+				c.evictKey(victim)
+			}
+			c.cache.promote(candidate)
+		default:
+			c.evictKey(candidate)
+		}
+	}
+}
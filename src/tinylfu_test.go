@@ -0,0 +1,83 @@
+package src
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// replayZipf replays a Zipf-distributed read-through workload and returns
+// the hit ratio after a warm-up
+func replayZipf(ops int, get func(key string) bool, set func(key string)) float64 {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, 100_000)
+	hits, reads := 0, 0
+	for i := 0; i < ops; i++ {
+		key := strconv.FormatUint(zipf.Uint64(), 10)
+		found := get(key)
+		if !found {
+			set(key)
+		}
+		if i >= ops/4 {
+			reads++
+			if found {
+				hits++
+			}
+		}
+	}
+	return float64(hits) / float64(reads)
+}
+
+// zipfHitRatio returns the Zipf hit ratio of a W-TinyLFU cache of 1000
+// entries. With sampled, keys leaving the window compete with the least
+// frequent of SampleSize sampled keys, as the previous admission did,
+// instead of the probation tail
+func zipfHitRatio(t testing.TB, ops int, sampled bool) float64 {
+	t.Helper()
+	c, err := NewRistrettoCache(&Config{MaxCost: 1000, NumCounters: 100_000, BufferItems: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if sampled {
+		c.victim = c.sampledVictim
+	}
+	return replayZipf(ops,
+		func(key string) bool { _, ok := c.Get(key); return ok },
+		func(key string) { c.setSync(context.Background(), key, key, 1, 0) })
+}
+
+func zipfRatios(t testing.TB, ops int) (tail, sampled, lru float64) {
+	tail = zipfHitRatio(t, ops, false)
+	sampled = zipfHitRatio(t, ops, true)
+	l := NewLRUCache(1000)
+	lru = replayZipf(ops,
+		func(key string) bool { _, ok := l.Get(key); return ok },
+		func(key string) { l.Add(key, key, 1, 0) })
+	return tail, sampled, lru
+}
+
+func TestTinyLFUHitRatioZipf(t *testing.T) {
+	if testing.Short() {
+		t.Skip("replays 200k operations")
+	}
+	tail, sampled, lru := zipfRatios(t, 200_000)
+	t.Logf("hit ratio: probation tail %.4f, sampled victim %.4f, LRU %.4f", tail, sampled, lru)
+	if tail <= lru {
+		t.Fatalf("W-TinyLFU hit ratio %.4f is not above LRU %.4f", tail, lru)
+	}
+	// Sampling is random; allow for its run-to-run noise
+	if tail < sampled-0.001 {
+		t.Fatalf("probation tail hit ratio %.4f is below the sampled victim %.4f", tail, sampled)
+	}
+}
+
+func BenchmarkTinyLFUHitRatioZipf(b *testing.B) {
+	var tail, sampled, lru float64
+	for i := 0; i < b.N; i++ {
+		tail, sampled, lru = zipfRatios(b, 100_000)
+	}
+	b.ReportMetric(tail, "hit-ratio")
+	b.ReportMetric(sampled, "sampled-hit-ratio")
+	b.ReportMetric(lru, "lru-hit-ratio")
+}
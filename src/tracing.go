@@ -0,0 +1,145 @@
+package src
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer starts spans around cache operations. It mirrors the shape of an
+// OpenTelemetry tracer, so an adapter is a few lines:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string) (context.Context, src.Span) {
+//		ctx, span := o.t.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//
+// Only the *Context methods (GetContext, SetContext, DelContext,
+// SearchContext) create spans, so the plain methods stay free of overhead.
+// SetContext and DelContext attribute the events they record to Config.Audit
+// to the actor of ctx.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	End()
+}
+
+// Attribute is a span attribute.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span names and attribute keys used by the cache.
+const (
+	SpanGet    = "fastcache.Get"
+	SpanSet    = "fastcache.Set"
+	SpanDel    = "fastcache.Del"
+	SpanSearch = "fastcache.vector.Search"
+
+	AttrHit     = "cache.hit"
+	AttrCost    = "cache.cost"
+	AttrStored  = "cache.stored"
+	AttrShard   = "cache.shard"
+	AttrK       = "vector.k"
+	AttrResults = "vector.results"
+	AttrShards  = "vector.shards"
+	AttrError   = "error"
+)
+
+// GetContext is Get with a span started from ctx when a Tracer is configured.
+func (c *RistrettoCache) GetContext(ctx context.Context, key string) (any, bool) {
+	if c.config.Tracer == nil {
+		return c.Get(key)
+	}
+	_, span := c.config.Tracer.Start(ctx, SpanGet)
+	value, found := c.Get(key)
+	span.SetAttributes(Attribute{AttrHit, found})
+	span.End()
+	return value, found
+}
+
+// SetContext is SetWithTTL with a span started from ctx when a Tracer is configured.
+func (c *RistrettoCache) SetContext(ctx context.Context, key string, value any, cost int64, ttl time.Duration) bool {
+	if c.config.Tracer == nil {
+		return c.setWithTTL(ctx, key, value, cost, ttl)
+	}
+	_, span := c.config.Tracer.Start(ctx, SpanSet)
+	stored := c.setWithTTL(ctx, key, value, cost, ttl)
+	span.SetAttributes(Attribute{AttrCost, cost}, Attribute{AttrStored, stored})
+	span.End()
+	return stored
+}
+
+// DelContext is Del with a span started from ctx when a Tracer is configured.
+func (c *RistrettoCache) DelContext(ctx context.Context, key string) {
+	if c.config.Tracer == nil {
+		c.del(ctx, key)
+		return
+	}
+	_, span := c.config.Tracer.Start(ctx, SpanDel)
+	c.del(ctx, key)
+	span.End()
+}
+
+// GetContext is Get with a span started from ctx when a Tracer is configured.
+func (sc *ShardedCacheV2) GetContext(ctx context.Context, key string) (any, bool) {
+	if sc.tracer == nil {
+		return sc.Get(key)
+	}
+	_, span := sc.tracer.Start(ctx, SpanGet)
+	shard := sc.shardIndex(key)
+	value, found := sc.shards[shard].Get(key)
+	span.SetAttributes(Attribute{AttrHit, found}, Attribute{AttrShard, shard})
+	span.End()
+	return value, found
+}
+
+// SetContext is SetWithTTL with a span started from ctx when a Tracer is configured.
+func (sc *ShardedCacheV2) SetContext(ctx context.Context, key string, value any, cost int64, ttl time.Duration) bool {
+	if sc.tracer == nil {
+		return sc.setWithTTL(ctx, key, value, cost, ttl)
+	}
+	_, span := sc.tracer.Start(ctx, SpanSet)
+	stored := sc.setWithTTL(ctx, key, value, cost, ttl)
+	span.SetAttributes(Attribute{AttrCost, cost}, Attribute{AttrStored, stored}, Attribute{AttrShard, sc.shardIndex(key)})
+	span.End()
+	return stored
+}
+
+// DelContext is Del with a span started from ctx when a Tracer is configured.
+func (sc *ShardedCacheV2) DelContext(ctx context.Context, key string) {
+	if sc.tracer == nil {
+		sc.del(ctx, key)
+		return
+	}
+	_, span := sc.tracer.Start(ctx, SpanDel)
+	sc.del(ctx, key)
+	span.SetAttributes(Attribute{AttrShard, sc.shardIndex(key)})
+	span.End()
+}
+
+// SearchContext is Search with a span started from ctx when a Tracer is
+// configured.
+func (vc *VectorCache) SearchContext(ctx context.Context, query Vector, k int) ([]SearchResult, error) {
+	if vc.config.Tracer == nil {
+		return vc.Search(query, k)
+	}
+	_, span := vc.config.Tracer.Start(ctx, SpanSearch)
+	results, err := vc.Search(query, k)
+	span.SetAttributes(
+		Attribute{AttrK, k},
+		Attribute{AttrResults, len(results)},
+		Attribute{AttrShards, vc.ShardCount()},
+	)
+	if err != nil {
+		span.SetAttributes(Attribute{AttrError, err.Error()})
+	}
+	span.End()
+	return results, err
+}
@@ -0,0 +1,53 @@
+package src
+
+import "container/heap"
+
+// expiryHeap is a min-heap of items ordered by expiration, so expired items
+// can be found without scanning the cache. Items track their position in
+// heapIndex, stored off by one so that zero means not in the heap
+type expiryHeap []*CacheItem
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].Expiration < h[j].Expiration }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i + 1
+	h[j].heapIndex = j + 1
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*CacheItem)
+	item.heapIndex = len(*h) + 1
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.heapIndex = 0
+	*h = old[:n-1]
+	return item
+}
+
+// trackExpiration adds, moves or removes item in the expiration heap after
+// its expiration changed (caller must hold lock)
+func (c *LRUCache) trackExpiration(item *CacheItem) {
+	switch {
+	case item.Expiration > 0 && item.heapIndex > 0:
+		heap.Fix(&c.expiries, item.heapIndex-1)
+	case item.Expiration > 0:
+		heap.Push(&c.expiries, item)
+	default:
+		c.untrackExpiration(item)
+	}
+}
+
+// untrackExpiration removes item from the expiration heap (caller must hold lock)
+func (c *LRUCache) untrackExpiration(item *CacheItem) {
+	if item.heapIndex > 0 {
+		heap.Remove(&c.expiries, item.heapIndex-1)
+	}
+}
@@ -0,0 +1,109 @@
+package src
+
+import (
+	"fmt"
+	"time"
+)
+
+// Typed is a type-safe wrapper over RistrettoCache.
+// Keys are converted to strings: string keys are used as-is, other key types
+// are formatted with fmt.Sprint, so distinct keys must format differently.
+type Typed[K comparable, V any] struct {
+	cache *RistrettoCache
+}
+
+// NewTyped creates a typed cache with config
+func NewTyped[K comparable, V any](config *Config) (*Typed[K, V], error) {
+	cache, err := NewRistrettoCache(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Typed[K, V]{cache: cache}, nil
+}
+
+// WrapTyped wraps an existing cache.
+// Values of another type stored in the same cache are reported as misses.
+func WrapTyped[K comparable, V any](cache *RistrettoCache) *Typed[K, V] {
+	return &Typed[K, V]{cache: cache}
+}
+
+// typedKey converts a key to its cache key string
+func typedKey[K comparable](key K) string {
+	if s, ok := any(key).(string); ok {
+		return s
+	}
+	return fmt.Sprint(key)
+}
+
+// Cache returns the underlying cache
+func (t *Typed[K, V]) Cache() *RistrettoCache {
+	return t.cache
+}
+
+// Set sets a value
+func (t *Typed[K, V]) Set(key K, value V, cost int64) bool {
+	return t.cache.Set(typedKey(key), value, cost)
+}
+
+// SetWithTTL sets a value with TTL
+func (t *Typed[K, V]) SetWithTTL(key K, value V, cost int64, ttl time.Duration) bool {
+	return t.cache.SetWithTTL(typedKey(key), value, cost, ttl)
+}
+
+// Get gets a value
+func (t *Typed[K, V]) Get(key K) (V, bool) {
+	var zero V
+	value, found := t.cache.Get(typedKey(key))
+	if !found {
+		return zero, false
+	}
+	v, ok := value.(V)
+	if !ok {
+		return zero, false
+	}
+	return v, true
+}
+
+// GetWithTTL gets a value and remaining TTL
+func (t *Typed[K, V]) GetWithTTL(key K) (V, bool, time.Duration) {
+	var zero V
+	value, found, ttl := t.cache.GetWithTTL(typedKey(key))
+	if !found {
+		return zero, false, 0
+	}
+	v, ok := value.(V)
+	if !ok {
+		return zero, false, 0
+	}
+	return v, true, ttl
+}
+
+// Exists checks if a key exists
+func (t *Typed[K, V]) Exists(key K) bool {
+	return t.cache.Exists(typedKey(key))
+}
+
+// Del deletes a value
+func (t *Typed[K, V]) Del(key K) {
+	t.cache.Del(typedKey(key))
+}
+
+// Wait waits for all buffered writes to complete
+func (t *Typed[K, V]) Wait() {
+	t.cache.Wait()
+}
+
+// Len returns the number of items
+func (t *Typed[K, V]) Len() int {
+	return t.cache.Len()
+}
+
+// Clear clears the cache
+func (t *Typed[K, V]) Clear() {
+	t.cache.Clear()
+}
+
+// Close closes the cache
+func (t *Typed[K, V]) Close() error {
+	return t.cache.Close()
+}
@@ -28,6 +28,8 @@ type VectorItem struct {
 	Vector   Vector
 	Metadata map[string]any
 	Cost     int64 // Memory cost in bytes.
+
+	norm float32 // Precomputed L2 norm, 0 if not computed.
 }
 
 // SearchResult represents a search result from vector similarity search.
@@ -154,6 +156,121 @@ func IPDistance(v1, v2 Vector) float32 {
 	return float32(-sum) // Negative so larger inner products rank higher.
 }
 
+// dotProduct computes the dot product of two vectors of equal dimension.
+func dotProduct(v1, v2 Vector) float32 {
+	var sum float64 = 0
+	for i := 0; i < len(v1); i++ {
+		sum += float64(v1[i]) * float64(v2[i])
+	}
+	return float32(sum)
+}
+
+// vectorNorm computes the L2 norm of a vector.
+func vectorNorm(v Vector) float32 {
+	return float32(math.Sqrt(float64(dotProduct(v, v))))
+}
+
+// metricScore computes a search score from a dot product and the norms of
+// both vectors, so every metric can be derived from a single kernel.
+// Inner product scores are returned as positive values (higher is better).
+func metricScore(metric MetricType, dot, queryNorm, norm float32) float32 {
+	switch metric {
+	case MetricCosine:
+		if queryNorm == 0 || norm == 0 {
+			return 1.0
+		}
+		return 1.0 - dot/(queryNorm*norm)
+	case MetricIP:
+		return dot
+	default:
+		sq := float64(queryNorm)*float64(queryNorm) + float64(norm)*float64(norm) - 2*float64(dot)
+		if sq < 0 {
+			sq = 0
+		}
+		return float32(math.Sqrt(sq))
+	}
+}
+
+// distanceBlock is the number of vectors scored per DistanceBatch call by
+// the indexes.
+const distanceBlock = 256
+
+// DistanceBatch computes the distance between query and each of targets
+// with the metric, writing it to the same position of out, which must be at
+// least as long as targets. Results are identical to those of the
+// metric's DistanceFunc, including MaxFloat32 for dimension mismatches, but
+// per-query work such as the query norm is done once per call, and scoring
+// a contiguous block of vectors is what vectorized kernels need.
+func (m MetricType) DistanceBatch(query Vector, targets []Vector, out []float32) {
+	out = out[:len(targets)]
+	switch m {
+	case MetricCosine:
+		queryNorm := float64(0)
+		for _, x := range query {
+			queryNorm += float64(x) * float64(x)
+		}
+		for i, t := range targets {
+			if len(t) != len(query) {
+				out[i] = MaxFloat32
+				continue
+			}
+			dot := float64(0)
+			norm := float64(0)
+			for j, x := range t {
+				dot += float64(query[j]) * float64(x)
+				norm += float64(x) * float64(x)
+			}
+			if queryNorm == 0 || norm == 0 {
+				out[i] = 1.0
+				continue
+			}
+			out[i] = float32(1.0 - dot/(math.Sqrt(queryNorm)*math.Sqrt(norm)))
+		}
+	case MetricIP:
+		for i, t := range targets {
+			if len(t) != len(query) {
+				out[i] = MaxFloat32
+				continue
+			}
+			var sum float64 = 0
+			for j, x := range t {
+				sum += float64(query[j]) * float64(x)
+			}
+			out[i] = float32(-sum)
+		}
+	default:
+		for i, t := range targets {
+			if len(t) != len(query) {
+				out[i] = MaxFloat32
+				continue
+			}
+			var sum float64 = 0
+			for j, x := range t {
+				diff := float64(query[j]) - float64(x)
+				sum += diff * diff
+			}
+			out[i] = float32(math.Sqrt(sum))
+		}
+	}
+}
+
+// scoreItems sets the score of every item to its distance from query with
+// the metric, in blocks of distanceBlock vectors.
+func scoreItems(metric MetricType, query Vector, items []scoredItem) {
+	var targets [distanceBlock]Vector
+	var out [distanceBlock]float32
+	for start := 0; start < len(items); start += distanceBlock {
+		block := items[start:min(start+distanceBlock, len(items))]
+		for i := range block {
+			targets[i] = block[i].item.Vector
+		}
+		metric.DistanceBatch(query, targets[:len(block)], out[:len(block)])
+		for i := range block {
+			block[i].score = out[i]
+		}
+	}
+}
+
 // scoredItem is an internal type that pairs a vector item with its computed score.
 type scoredItem struct {
 	id    string
@@ -181,6 +298,9 @@ type FlatSearch struct {
 	items    map[string]*VectorItem
 	metric   MetricType
 	distance DistanceFunc
+
+	// norms enables precomputed vector norms for per-query metric selection.
+	norms bool
 }
 
 // NewFlatSearch creates a new FlatSearch instance with the specified distance metric.
@@ -197,14 +317,33 @@ func (f *FlatSearch) Add(id string, vector Vector, metadata map[string]any) erro
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	f.add(id, vector, metadata)
+	return nil
+}
+
+// AddBatch inserts vectors under a single lock acquisition.
+func (f *FlatSearch) AddBatch(items []VectorItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range items {
+		f.add(items[i].ID, items[i].Vector, items[i].Metadata)
+	}
+	return nil
+}
+
+// add inserts a vector (caller must hold the lock).
+func (f *FlatSearch) add(id string, vector Vector, metadata map[string]any) {
 	item := &VectorItem{
 		ID:       id,
 		Vector:   vector,
 		Metadata: metadata,
 		Cost:     int64(len(vector) * 4), // float32 occupies 4 bytes.
 	}
+	if f.norms {
+		item.norm = vectorNorm(vector)
+	}
 	f.items[id] = item
-	return nil
 }
 
 // Get retrieves a vector by its ID.
@@ -228,6 +367,18 @@ func (f *FlatSearch) Delete(id string) error {
 	return nil
 }
 
+// liveItems returns all vectors in the store.
+func (f *FlatSearch) liveItems() []*VectorItem {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	items := make([]*VectorItem, 0, len(f.items))
+	for _, item := range f.items {
+		items = append(items, item)
+	}
+	return items
+}
+
 // Search performs a brute-force search for the k nearest vectors to the query.
 func (f *FlatSearch) Search(query Vector, k int) ([]SearchResult, error) {
 	f.mu.RLock()
@@ -247,9 +398,9 @@ func (f *FlatSearch) Search(query Vector, k int) ([]SearchResult, error) {
 	// Compute distances for all vectors.
 	results := make([]scoredItem, 0, len(f.items))
 	for id, item := range f.items {
-		score := f.distance(query, item.Vector)
-		results = append(results, scoredItem{id: id, item: item, score: score})
+		results = append(results, scoredItem{id: id, item: item})
 	}
+	scoreItems(f.metric, query, results)
 
 	// Sort by score (ascending for distance metrics, descending for inner product).
 	if f.metric == MetricIP {
@@ -293,9 +444,9 @@ func (f *FlatSearch) SearchWithFilter(query Vector, k int, filter FilterFunc) ([
 		if filter != nil && !filter(item.Metadata) {
 			continue
 		}
-		score := f.distance(query, item.Vector)
-		filteredItems = append(filteredItems, scoredItem{id: id, item: item, score: score})
+		filteredItems = append(filteredItems, scoredItem{id: id, item: item})
 	}
+	scoreItems(f.metric, query, filteredItems)
 
 	if len(filteredItems) == 0 {
 		return []SearchResult{}, nil
@@ -326,6 +477,44 @@ func (f *FlatSearch) SearchWithFilter(query Vector, k int, filter FilterFunc) ([
 	return topK, nil
 }
 
+// searchWithMetric performs an exact search using the given metric instead
+// of the one the store was created with.
+func (f *FlatSearch) searchWithMetric(query Vector, k int, metric MetricType, filter FilterFunc) ([]SearchResult, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if k <= 0 {
+		k = 10
+	}
+
+	queryNorm := vectorNorm(query)
+	results := make([]SearchResult, 0, len(f.items))
+	for _, item := range f.items {
+		if len(item.Vector) != len(query) {
+			continue
+		}
+		if filter != nil && !filter(item.Metadata) {
+			continue
+		}
+		norm := item.norm
+		if norm == 0 {
+			norm = vectorNorm(item.Vector)
+		}
+		results = append(results, SearchResult{
+			ID:       item.ID,
+			Vector:   item.Vector,
+			Score:    metricScore(metric, dotProduct(query, item.Vector), queryNorm, norm),
+			Metadata: item.Metadata,
+		})
+	}
+
+	sortResults(results, metric)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
 // Len returns the number of vectors in the store.
 func (f *FlatSearch) Len() int {
 	f.mu.RLock()
@@ -340,18 +529,18 @@ func (f *FlatSearch) Clear() {
 	f.items = make(map[string]*VectorItem)
 }
 
-// quickSortAsc sorts scoredItems in ascending order by score.
+// quickSortAsc sorts scoredItems in ascending order by score, then by ID.
 func quickSortAsc(items []scoredItem, left, right int) {
 	if left >= right {
 		return
 	}
-	pivot := items[(left+right)/2].score
+	pivot := items[(left+right)/2]
 	i, j := left, right
 	for i <= j {
-		for i <= right && items[i].score < pivot {
+		for i <= right && rankedBefore(items[i].score, items[i].id, pivot.score, pivot.id, false) {
 			i++
 		}
-		for j >= left && items[j].score > pivot {
+		for j >= left && rankedBefore(pivot.score, pivot.id, items[j].score, items[j].id, false) {
 			j--
 		}
 		if i <= j {
@@ -368,19 +557,19 @@ func quickSortAsc(items []scoredItem, left, right int) {
 	}
 }
 
-// quickSortDesc sorts scoredItems in descending order by score.
+// quickSortDesc sorts scoredItems in descending order by score, then by ID.
 // This is used for inner product where higher values are better.
 func quickSortDesc(items []scoredItem, left, right int) {
 	if left >= right {
 		return
 	}
-	pivot := items[(left+right)/2].score
+	pivot := items[(left+right)/2]
 	i, j := left, right
 	for i <= j {
-		for i <= right && items[i].score > pivot {
+		for i <= right && rankedBefore(items[i].score, items[i].id, pivot.score, pivot.id, true) {
 			i++
 		}
-		for j >= left && items[j].score < pivot {
+		for j >= left && rankedBefore(pivot.score, pivot.id, items[j].score, items[j].id, true) {
 			j--
 		}
 		if i <= j {
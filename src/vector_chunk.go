@@ -0,0 +1,255 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultChunkSize is the default chunk length in characters.
+	DefaultChunkSize = 1000
+	// DefaultChunkOverlap is the default number of characters shared by
+	// consecutive chunks.
+	DefaultChunkOverlap = 200
+	// DefaultEmbedBatchSize is the default number of chunks per Embed call.
+	DefaultEmbedBatchSize = 32
+)
+
+// Metadata keys set on every chunk vector stored by AddDocument.
+const (
+	ChunkDocIDKey  = "doc_id"
+	ChunkIndexKey  = "chunk"
+	ChunkOffsetKey = "offset"
+	ChunkTextKey   = "text"
+)
+
+// Embedder turns texts into vectors, e.g. by calling an embedding model.
+// Embed returns one vector per text, in order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([]Vector, error)
+}
+
+// EmbedderFunc adapts a function to the Embedder interface.
+type EmbedderFunc func(ctx context.Context, texts []string) ([]Vector, error)
+
+// Embed calls f.
+func (f EmbedderFunc) Embed(ctx context.Context, texts []string) ([]Vector, error) {
+	return f(ctx, texts)
+}
+
+// Chunk is a piece of a document.
+type Chunk struct {
+	DocID  string
+	Index  int // Position of the chunk in the document.
+	Offset int // Byte offset of Text in the document.
+	Text   string
+}
+
+// ID returns the vector ID of the chunk: the document ID and chunk index
+// joined by '#'.
+func (c Chunk) ID() string {
+	return c.DocID + "#" + strconv.Itoa(c.Index)
+}
+
+// ChunkOptions configures ChunkText and AddDocument.
+type ChunkOptions struct {
+	// Size is the maximum chunk length in characters (DefaultChunkSize if 0).
+	Size int
+
+	// Overlap is the number of characters repeated at the start of the next
+	// chunk (DefaultChunkOverlap if 0, negative for none). It is capped at
+	// half of Size.
+	Overlap int
+
+	// BatchSize is the number of chunks embedded per Embed call
+	// (DefaultEmbedBatchSize if 0).
+	BatchSize int
+}
+
+func (o ChunkOptions) withDefaults() ChunkOptions {
+	if o.Size <= 0 {
+		o.Size = DefaultChunkSize
+	}
+	if o.Overlap == 0 {
+		o.Overlap = DefaultChunkOverlap
+	}
+	if o.Overlap < 0 {
+		o.Overlap = 0
+	}
+	if o.Overlap > o.Size/2 {
+		o.Overlap = o.Size / 2
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultEmbedBatchSize
+	}
+	return o
+}
+
+// ChunkText splits text into overlapping chunks of at most opts.Size
+// characters. Chunks end at whitespace when there is some in the second half
+// of the chunk, and the overlap starts at a word boundary, so words are not
+// cut in half.
+func ChunkText(docID, text string, opts ChunkOptions) []Chunk {
+	opts = opts.withDefaults()
+
+	// offsets[i] is the byte offset of rune i; offsets[n] is len(text).
+	offsets := make([]int, 0, utf8.RuneCountInString(text)+1)
+	runes := make([]rune, 0, cap(offsets))
+	for i, r := range text {
+		offsets = append(offsets, i)
+		runes = append(runes, r)
+	}
+	offsets = append(offsets, len(text))
+	n := len(runes)
+
+	var chunks []Chunk
+	for start := 0; start < n; {
+		end := start + opts.Size
+		if end >= n {
+			end = n
+		} else {
+			for j := end; j > start+opts.Size/2; j-- {
+				if unicode.IsSpace(runes[j-1]) {
+					end = j
+					break
+				}
+			}
+		}
+
+		chunks = append(chunks, Chunk{
+			DocID:  docID,
+			Index:  len(chunks),
+			Offset: offsets[start],
+			Text:   text[offsets[start]:offsets[end]],
+		})
+		if end == n {
+			break
+		}
+
+		next := end - opts.Overlap
+		for next > start && next < end && !unicode.IsSpace(runes[next-1]) {
+			next++
+		}
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// AddDocument splits text into chunks, embeds them with embedder in batches
+// and adds one vector per chunk under Chunk.ID. Every chunk carries a copy
+// of metadata plus its document ID, index, byte offset and text under the
+// Chunk*Key metadata keys. It returns the number of chunks added.
+func (vc *VectorCache) AddDocument(ctx context.Context, embedder Embedder, docID, text string, metadata map[string]any, opts ChunkOptions) (int, error) {
+	opts = opts.withDefaults()
+	chunks := ChunkText(docID, text, opts)
+
+	added := 0
+	for len(chunks) > 0 {
+		if err := ctx.Err(); err != nil {
+			return added, err
+		}
+		batch := chunks
+		if len(batch) > opts.BatchSize {
+			batch = batch[:opts.BatchSize]
+		}
+		chunks = chunks[len(batch):]
+
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.Text
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return added, err
+		}
+		if len(vectors) != len(batch) {
+			return added, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(batch))
+		}
+
+		for i, c := range batch {
+			meta := make(map[string]any, len(metadata)+4)
+			for k, v := range metadata {
+				meta[k] = v
+			}
+			meta[ChunkDocIDKey] = c.DocID
+			meta[ChunkIndexKey] = c.Index
+			meta[ChunkOffsetKey] = c.Offset
+			meta[ChunkTextKey] = c.Text
+			if err := vc.Add(c.ID(), vectors[i], meta); err != nil {
+				return added, err
+			}
+			added++
+		}
+	}
+	return added, nil
+}
+
+// isChunkOf reports whether id has the form of a chunk ID of docID.
+func isChunkOf(id, docID string) bool {
+	index, ok := strings.CutPrefix(id, docID+"#")
+	if !ok || index == "" {
+		return false
+	}
+	_, err := strconv.Atoi(index)
+	return err == nil
+}
+
+// DeleteDocument removes every chunk vector of docID added by AddDocument,
+// together with aliases of its chunks and aliases resolving to them. Shards
+// are scanned in parallel. It returns the number of vectors and aliases
+// removed.
+func (vc *VectorCache) DeleteDocument(docID string) int {
+	shards := []*VectorCache{vc}
+	if vc.shardCount > 1 {
+		shards = vc.shards
+	}
+
+	deleted := make([][]string, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(s *VectorCache, idx int) {
+			defer wg.Done()
+			lister, ok := s.currentIndex().(itemLister)
+			if !ok {
+				return
+			}
+			for _, item := range lister.liveItems() {
+				if item.Metadata[ChunkDocIDKey] != docID && !isChunkOf(item.ID, docID) {
+					continue
+				}
+				s.cache.Del("vec:" + item.ID)
+				s.indexDelete(item.ID)
+				deleted[idx] = append(deleted[idx], item.ID)
+			}
+		}(shard, i)
+	}
+	wg.Wait()
+
+	removed := make(map[string]struct{})
+	for _, ids := range deleted {
+		for _, id := range ids {
+			removed[id] = struct{}{}
+			if vc.routes != nil {
+				vc.routes.remove(id)
+			}
+		}
+	}
+
+	count := len(removed)
+	if vc.aliases != nil {
+		count += vc.aliases.removeIf(func(alias, target string) bool {
+			_, ok := removed[target]
+			return ok || isChunkOf(alias, docID)
+		})
+	}
+	return count
+}
@@ -0,0 +1,170 @@
+package src
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrTooFewVectors is returned when there are fewer stored vectors than clusters.
+var ErrTooFewVectors = errors.New("fewer vectors than clusters")
+
+// ClusterOptions configures mini-batch k-means.
+type ClusterOptions struct {
+	// Iterations is the number of mini-batch updates (default 100).
+	Iterations int
+
+	// BatchSize is the number of vectors sampled per iteration (default 1024).
+	BatchSize int
+
+	// Seed seeds centroid initialisation and batch sampling.
+	// Zero uses a time-based seed.
+	Seed int64
+}
+
+// ClusterResult holds the output of Cluster.
+type ClusterResult struct {
+	// Centroids are the cluster centres.
+	Centroids []Vector
+
+	// Assignments maps each vector ID to the index of its nearest centroid.
+	Assignments map[string]int
+}
+
+// indexedItems returns the live vectors of every shard's index.
+func (vc *VectorCache) indexedItems() []*VectorItem {
+	shards := []*VectorCache{vc}
+	if vc.shardCount > 1 {
+		shards = vc.shards
+	}
+
+	var items []*VectorItem
+	for _, s := range shards {
+		if lister, ok := s.currentIndex().(itemLister); ok {
+			items = append(items, lister.liveItems()...)
+		}
+	}
+	return items
+}
+
+// Cluster partitions the stored vectors into k clusters with mini-batch k-means.
+func (vc *VectorCache) Cluster(k int) (*ClusterResult, error) {
+	return vc.ClusterWithOptions(k, ClusterOptions{})
+}
+
+// ClusterWithOptions partitions the stored vectors into k clusters with
+// mini-batch k-means. Centroids are seeded with k-means++ and then updated
+// from random batches with a per-centroid learning rate. Vectors are assigned
+// with the store's distance metric; inner-product stores use L2, as the inner
+// product is not a distance.
+func (vc *VectorCache) ClusterWithOptions(k int, opts ClusterOptions) (*ClusterResult, error) {
+	items := vc.indexedItems()
+	if k <= 0 || len(items) < k {
+		return nil, &VectorError{Op: "cluster", Err: ErrTooFewVectors}
+	}
+	dim := len(items[0].Vector)
+	for _, item := range items {
+		if len(item.Vector) != dim {
+			return nil, &VectorError{Op: "cluster", Err: ErrDimensionMismatch}
+		}
+	}
+
+	if opts.Iterations <= 0 {
+		opts.Iterations = 100
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1024
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	distance := GetDistanceFunc(vc.config.Metric)
+	if vc.config.Metric == MetricIP {
+		distance = L2Distance
+	}
+
+	centroids := seedCentroids(items, k, distance, rng)
+
+	// Mini-batch updates: assign the whole batch first, then move each
+	// centroid towards its vectors with a rate of 1/count.
+	counts := make([]int, k)
+	batch := make([]*VectorItem, opts.BatchSize)
+	nearest := make([]int, opts.BatchSize)
+	for iter := 0; iter < opts.Iterations; iter++ {
+		for i := range batch {
+			batch[i] = items[rng.Intn(len(items))]
+			nearest[i] = nearestCentroid(centroids, batch[i].Vector, distance)
+		}
+		for i, item := range batch {
+			c := nearest[i]
+			counts[c]++
+			rate := 1 / float32(counts[c])
+			centroid := centroids[c]
+			for d, v := range item.Vector {
+				centroid[d] += rate * (v - centroid[d])
+			}
+		}
+	}
+
+	result := &ClusterResult{
+		Centroids:   centroids,
+		Assignments: make(map[string]int, len(items)),
+	}
+	for _, item := range items {
+		result.Assignments[item.ID] = nearestCentroid(centroids, item.Vector, distance)
+	}
+	return result, nil
+}
+
+// seedCentroids picks k initial centroids with k-means++: each next centroid
+// is sampled with probability proportional to its squared distance from the
+// nearest centroid chosen so far.
+func seedCentroids(items []*VectorItem, k int, distance DistanceFunc, rng *rand.Rand) []Vector {
+	centroids := make([]Vector, 0, k)
+	centroids = append(centroids, copyVector(items[rng.Intn(len(items))].Vector))
+
+	weights := make([]float64, len(items))
+	for len(centroids) < k {
+		var total float64
+		for i, item := range items {
+			d := float64(distance(item.Vector, centroids[nearestCentroid(centroids, item.Vector, distance)]))
+			weights[i] = d * d
+			total += weights[i]
+		}
+
+		next := rng.Intn(len(items))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, w := range weights {
+				target -= w
+				if target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, copyVector(items[next].Vector))
+	}
+	return centroids
+}
+
+// nearestCentroid returns the index of the centroid closest to v.
+func nearestCentroid(centroids []Vector, v Vector, distance DistanceFunc) int {
+	best := 0
+	bestDist := distance(v, centroids[0])
+	for i := 1; i < len(centroids); i++ {
+		if d := distance(v, centroids[i]); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// copyVector returns a copy of v.
+func copyVector(v Vector) Vector {
+	c := make(Vector, len(v))
+	copy(c, v)
+	return c
+}
@@ -0,0 +1,141 @@
+package src
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUnknownCollection is returned when a collection does not exist.
+	ErrUnknownCollection = errors.New("unknown collection")
+	// ErrCollectionExists is returned when creating a collection that already exists.
+	ErrCollectionExists = errors.New("collection already exists")
+)
+
+// CollectionConfig overrides the store defaults for one collection.
+// Zero fields inherit the default.
+type CollectionConfig struct {
+	// Metric overrides the distance metric.
+	Metric MetricType
+
+	// IndexType overrides the index type: "flat" or "hnsw".
+	IndexType string
+
+	// HNSW overrides the HNSW parameters.
+	HNSW *HNSWConfig
+
+	// Dimension fixes the vector length of the collection.
+	Dimension int
+}
+
+// VectorCollections manages named vector stores that share one memory
+// budget, so an application can keep several embedding types with their own
+// metric, index and dimension in one process. Each collection is a
+// VectorCache; when their vectors together exceed the budget, the collection
+// holding the most evicts.
+type VectorCollections struct {
+	mu          sync.RWMutex
+	config      *VectorStoreConfig
+	budget      *costBudget
+	collections map[string]*VectorCache
+}
+
+// NewVectorCollections creates an empty set of collections. config holds the
+// defaults of every collection and its MaxCost is the shared budget.
+func NewVectorCollections(config *VectorStoreConfig) *VectorCollections {
+	if config == nil {
+		defaultCfg := DefaultVectorStoreConfig()
+		config = &defaultCfg
+	}
+	return &VectorCollections{
+		config:      config,
+		budget:      newCostBudget(config.MaxCost),
+		collections: make(map[string]*VectorCache),
+	}
+}
+
+// Create creates a collection. A nil override uses the defaults.
+func (vcs *VectorCollections) Create(name string, override *CollectionConfig) (*VectorCache, error) {
+	config := *vcs.config
+	config.budget = vcs.budget
+	if override != nil {
+		if override.Metric != "" {
+			config.Metric = override.Metric
+		}
+		if override.IndexType != "" {
+			config.IndexType = override.IndexType
+		}
+		if override.HNSW != nil {
+			config.HNSW = *override.HNSW
+		}
+		if override.Dimension > 0 {
+			config.Dimension = override.Dimension
+		}
+	}
+
+	vcs.mu.Lock()
+	defer vcs.mu.Unlock()
+	if _, ok := vcs.collections[name]; ok {
+		return nil, ErrCollectionExists
+	}
+	store, err := NewVectorStore(&config)
+	if err != nil {
+		return nil, err
+	}
+	vcs.collections[name] = store
+	return store, nil
+}
+
+// Collection returns the store of a collection.
+func (vcs *VectorCollections) Collection(name string) (*VectorCache, bool) {
+	vcs.mu.RLock()
+	defer vcs.mu.RUnlock()
+	store, ok := vcs.collections[name]
+	return store, ok
+}
+
+// Names returns the collection names, sorted.
+func (vcs *VectorCollections) Names() []string {
+	vcs.mu.RLock()
+	defer vcs.mu.RUnlock()
+	names := make([]string, 0, len(vcs.collections))
+	for name := range vcs.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Drop closes a collection and releases its share of the budget.
+func (vcs *VectorCollections) Drop(name string) error {
+	vcs.mu.Lock()
+	store, ok := vcs.collections[name]
+	delete(vcs.collections, name)
+	vcs.mu.Unlock()
+	if !ok {
+		return ErrUnknownCollection
+	}
+	return store.Close()
+}
+
+// Cost returns the memory used by all collections.
+func (vcs *VectorCollections) Cost() int64 {
+	return vcs.budget.used()
+}
+
+// MaxCost returns the shared memory budget.
+func (vcs *VectorCollections) MaxCost() int64 {
+	return vcs.budget.max
+}
+
+// Close closes every collection.
+func (vcs *VectorCollections) Close() error {
+	vcs.mu.Lock()
+	defer vcs.mu.Unlock()
+	for name, store := range vcs.collections {
+		store.Close()
+		delete(vcs.collections, name)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package src
+
+import (
+	"errors"
+	"sync"
+)
+
+// DedupPolicy controls what Add does with a vector that is a near-duplicate
+// of one already stored under a different ID.
+type DedupPolicy int
+
+const (
+	// DedupOff stores near-duplicates as usual.
+	DedupOff DedupPolicy = iota
+	// DedupReject makes Add fail with ErrDuplicateVector.
+	DedupReject
+	// DedupMerge merges the incoming metadata into the existing vector.
+	DedupMerge
+	// DedupAlias stores nothing and makes the incoming ID resolve to the
+	// existing vector.
+	DedupAlias
+)
+
+// ErrDuplicateVector is returned by Add when DedupReject is set and a
+// near-duplicate vector is already stored.
+var ErrDuplicateVector = errors.New("duplicate vector")
+
+// DuplicateError reports the ID of the vector an insert duplicated.
+type DuplicateError struct {
+	ID       string // ID passed to Add.
+	Existing string // ID of the stored near-duplicate.
+}
+
+func (e *DuplicateError) Error() string {
+	return "vector " + e.ID + " duplicates " + e.Existing
+}
+
+// Unwrap returns ErrDuplicateVector.
+func (e *DuplicateError) Unwrap() error {
+	return ErrDuplicateVector
+}
+
+// aliasTable maps alias IDs to the ID of the vector they resolve to.
+type aliasTable struct {
+	mu      sync.RWMutex
+	targets map[string]string
+}
+
+func newAliasTable() *aliasTable {
+	return &aliasTable{targets: make(map[string]string)}
+}
+
+func (t *aliasTable) resolve(id string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	target, ok := t.targets[id]
+	return target, ok
+}
+
+func (t *aliasTable) set(alias, target string) {
+	t.mu.Lock()
+	t.targets[alias] = target
+	t.mu.Unlock()
+}
+
+func (t *aliasTable) remove(alias string) {
+	t.mu.Lock()
+	delete(t.targets, alias)
+	t.mu.Unlock()
+}
+
+// removeIf removes the aliases for which match returns true and returns
+// how many were removed.
+func (t *aliasTable) removeIf(match func(alias, target string) bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	removed := 0
+	for alias, target := range t.targets {
+		if match(alias, target) {
+			delete(t.targets, alias)
+			removed++
+		}
+	}
+	return removed
+}
+
+// findDuplicate returns the ID of a stored vector, other than id, whose
+// distance to vector is below DedupEpsilon. The collection metric is used,
+// except for inner product, which is not a distance; L2 is used instead.
+func (vc *VectorCache) findDuplicate(id string, vector Vector) (string, bool) {
+	metric := vc.config.Metric
+	if metric == MetricIP {
+		metric = MetricL2
+	}
+
+	// Ask for two candidates so that a stored copy of id itself does not
+	// hide a duplicate under another ID.
+	results, err := vc.searchShards(2, metric, func(s *VectorCache) ([]SearchResult, error) {
+		index := s.currentIndex()
+		if metric != vc.config.Metric {
+			if ms, ok := index.(metricSearcher); ok {
+				return ms.searchWithMetric(vector, 2, metric, nil)
+			}
+		}
+		return index.Search(vector, 2)
+	})
+	if err != nil {
+		return "", false
+	}
+
+	distance := GetDistanceFunc(metric)
+	for _, r := range results {
+		if r.ID != id && distance(vector, r.Vector) < vc.config.DedupEpsilon {
+			return r.ID, true
+		}
+	}
+	return "", false
+}
+
+// dedup applies the dedup policy to an incoming vector. It reports whether
+// the vector was handled and must not be stored.
+func (vc *VectorCache) dedup(id string, vector Vector, metadata map[string]any) (bool, error) {
+	existing, found := vc.findDuplicate(id, vector)
+	if !found {
+		return false, nil
+	}
+
+	switch vc.config.Dedup {
+	case DedupReject:
+		return true, &DuplicateError{ID: id, Existing: existing}
+	case DedupMerge:
+		item, ok := vc.getShard(existing).currentIndex().Get(existing)
+		if !ok {
+			return false, nil
+		}
+		merged := make(map[string]any, len(item.Metadata)+len(metadata))
+		for k, v := range item.Metadata {
+			merged[k] = v
+		}
+		for k, v := range metadata {
+			merged[k] = v
+		}
+		return true, vc.addToShard(vc.storeShardIndex(existing, merged), existing, item.Vector, merged)
+	case DedupAlias:
+		vc.aliases.set(id, existing)
+		return true, nil
+	}
+	return false, nil
+}
+
+// storeShardIndex returns the shard index for id added with metadata, 0 for
+// a non-sharded store. An ID in the routing table keeps its shard.
+func (vc *VectorCache) storeShardIndex(id string, metadata map[string]any) int {
+	if vc.shardCount <= 1 {
+		return 0
+	}
+	if vc.routes != nil {
+		if shard, ok := vc.routes.lookup(id); ok && shard < vc.shardCount {
+			return shard
+		}
+	}
+	return routeMetadata(vc.router, id, metadata, vc.shardCount)
+}
+
+// ResolveAlias returns the ID that alias resolves to under DedupAlias.
+func (vc *VectorCache) ResolveAlias(alias string) (string, bool) {
+	if vc.aliases == nil {
+		return "", false
+	}
+	return vc.aliases.resolve(alias)
+}
@@ -0,0 +1,118 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultEmbeddingCacheCost is the default memory limit of an embedding cache.
+const DefaultEmbeddingCacheCost = 64 << 20 // 64MB
+
+// EmbeddingCacheConfig configures a CachedEmbedder.
+type EmbeddingCacheConfig struct {
+	// MaxCost is the memory limit (DefaultEmbeddingCacheCost if 0).
+	MaxCost int64
+
+	// TTL is how long an embedding stays cached (0 means no expiration).
+	TTL time.Duration
+
+	// Namespace is prepended to cache keys, e.g. the embedding model name,
+	// so embedders of different models can share a key space safely.
+	Namespace string
+}
+
+// CachedEmbedder wraps an Embedder with a cache of text → vector results,
+// so repeated identical texts, typically search queries, skip the embedding
+// call. It is an Embedder itself and is safe for concurrent use.
+type CachedEmbedder struct {
+	embedder  Embedder
+	cache     *RistrettoCache
+	ttl       time.Duration
+	namespace string
+}
+
+// NewCachedEmbedder creates a caching wrapper around embedder.
+func NewCachedEmbedder(embedder Embedder, config EmbeddingCacheConfig) (*CachedEmbedder, error) {
+	if config.MaxCost <= 0 {
+		config.MaxCost = DefaultEmbeddingCacheCost
+	}
+	cache, err := NewRistrettoCache(&Config{
+		NumCounters: config.MaxCost / 256,
+		MaxCost:     config.MaxCost,
+		Metrics:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CachedEmbedder{
+		embedder:  embedder,
+		cache:     cache,
+		ttl:       config.TTL,
+		namespace: config.Namespace,
+	}, nil
+}
+
+// Embed returns the cached vectors of texts and embeds only the misses, in
+// one call to the wrapped embedder. Returned vectors are shared with the
+// cache and must not be modified.
+func (e *CachedEmbedder) Embed(ctx context.Context, texts []string) ([]Vector, error) {
+	vectors := make([]Vector, len(texts))
+	var missing []string
+	var missingAt []int
+	for i, text := range texts {
+		if v, ok := e.cache.Get(e.namespace + text); ok {
+			vectors[i] = v.(Vector)
+			continue
+		}
+		missing = append(missing, text)
+		missingAt = append(missingAt, i)
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := e.embedder.Embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(missing) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embedded), len(missing))
+	}
+	for j, v := range embedded {
+		cost := int64(len(v)*4) + int64(len(missing[j])) + 64
+		e.cache.SetWithTTL(e.namespace+missing[j], v, cost, e.ttl)
+		vectors[missingAt[j]] = v
+	}
+	return vectors, nil
+}
+
+// Metrics returns the hit and miss counts of the embedding cache, separate
+// from those of any vector store.
+func (e *CachedEmbedder) Metrics() *Metrics {
+	return e.cache.Metrics()
+}
+
+// Clear drops every cached embedding, e.g. after switching models.
+func (e *CachedEmbedder) Clear() {
+	e.cache.Clear()
+}
+
+// Close releases the cache.
+func (e *CachedEmbedder) Close() error {
+	return e.cache.Close()
+}
+
+// SearchText embeds query with embedder and searches for its k nearest
+// vectors. Pass a CachedEmbedder to skip the embedding call for repeated
+// queries.
+func (vc *VectorCache) SearchText(ctx context.Context, embedder Embedder, query string, k int) ([]SearchResult, error) {
+	vectors, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+	return vc.SearchContext(ctx, vectors[0], k)
+}
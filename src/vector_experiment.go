@@ -0,0 +1,331 @@
+package src
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxShadowSearches bounds the shadow searches running at once; queries
+// that would exceed it are not compared.
+const maxShadowSearches = 8
+
+// ErrInvalidFraction is returned for an experiment fraction outside [0, 1].
+var ErrInvalidFraction = errors.New("fraction must be between 0 and 1")
+
+// ExperimentConfig configures a SearchExperiment.
+type ExperimentConfig struct {
+	// Fraction is the share of Search traffic served by the candidate index.
+	Fraction float64
+
+	// CompareFraction is the share of queries also run on the other index in
+	// the background, to compare the two result lists. The control results
+	// are the reference, so with an exact control index (flat) the
+	// comparison measures the candidate's recall.
+	CompareFraction float64
+}
+
+// ArmStats are the metrics of one side of a SearchExperiment.
+type ArmStats struct {
+	Searches int64         // searches served or shadowed
+	Errors   int64         // searches that returned an error
+	Mean     time.Duration // mean search latency
+	P50      time.Duration // approximate median latency
+	P99      time.Duration // approximate 99th percentile latency
+}
+
+// ExperimentStats are the side-by-side metrics of a SearchExperiment.
+type ExperimentStats struct {
+	Control   ArmStats
+	Candidate ArmStats
+	Compared  int64   // queries run on both indexes
+	Recall    float64 // mean share of control results the candidate also returned
+}
+
+// latencyHistogram records latencies in power-of-two microsecond buckets.
+type latencyHistogram struct {
+	count   atomic.Int64
+	errors  atomic.Int64
+	total   atomic.Int64 // nanoseconds
+	buckets [40]atomic.Int64
+}
+
+func (h *latencyHistogram) record(d time.Duration, err error) {
+	h.count.Add(1)
+	if err != nil {
+		h.errors.Add(1)
+	}
+	h.total.Add(int64(d))
+	us := uint64(d / time.Microsecond)
+	b := bits.Len64(us)
+	if b >= len(h.buckets) {
+		b = len(h.buckets) - 1
+	}
+	h.buckets[b].Add(1)
+}
+
+// quantile returns the upper bound of the bucket holding quantile q.
+func (h *latencyHistogram) quantile(q float64, n int64) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(n)))
+	var seen int64
+	for b := range h.buckets {
+		seen += h.buckets[b].Load()
+		if seen >= rank {
+			if b == 0 {
+				return time.Microsecond
+			}
+			return time.Duration(uint64(1)<<b) * time.Microsecond
+		}
+	}
+	return time.Duration(uint64(1)<<(len(h.buckets)-1)) * time.Microsecond
+}
+
+func (h *latencyHistogram) reset() {
+	h.count.Store(0)
+	h.errors.Store(0)
+	h.total.Store(0)
+	for b := range h.buckets {
+		h.buckets[b].Store(0)
+	}
+}
+
+func (h *latencyHistogram) stats() ArmStats {
+	n := h.count.Load()
+	st := ArmStats{Searches: n, Errors: h.errors.Load()}
+	if n > 0 {
+		st.Mean = time.Duration(h.total.Load() / n)
+		st.P50 = h.quantile(0.5, n)
+		st.P99 = h.quantile(0.99, n)
+	}
+	return st
+}
+
+// SearchExperiment routes a share of Search traffic from a control index to
+// a candidate index, e.g. one with different HNSW parameters or another
+// index type, and records latency and recall side by side so the candidate
+// can be evaluated online before it becomes the default. Writes go to both
+// indexes; reads other than searches are served by the control. It
+// implements VectorStore.
+type SearchExperiment struct {
+	control   VectorStore
+	candidate VectorStore
+
+	mu  sync.RWMutex
+	cfg ExperimentConfig
+
+	controlLat   latencyHistogram
+	candidateLat latencyHistogram
+
+	recallMu  sync.Mutex
+	compared  int64
+	recallSum float64
+
+	shadow chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSearchExperiment creates an experiment between control and candidate.
+// The candidate must hold the same vectors as the control; populate it
+// before routing traffic to it, or add through the experiment.
+func NewSearchExperiment(control, candidate VectorStore, cfg ExperimentConfig) (*SearchExperiment, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &SearchExperiment{
+		control:   control,
+		candidate: candidate,
+		cfg:       cfg,
+		shadow:    make(chan struct{}, maxShadowSearches),
+	}, nil
+}
+
+func (cfg ExperimentConfig) validate() error {
+	if cfg.Fraction < 0 || cfg.Fraction > 1 || cfg.CompareFraction < 0 || cfg.CompareFraction > 1 {
+		return ErrInvalidFraction
+	}
+	return nil
+}
+
+// SetConfig changes the traffic split of a running experiment, e.g. to
+// ramp the candidate up or to roll it back.
+func (e *SearchExperiment) SetConfig(cfg ExperimentConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.cfg = cfg
+	e.mu.Unlock()
+	return nil
+}
+
+// Config returns the current traffic split.
+func (e *SearchExperiment) Config() ExperimentConfig {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cfg
+}
+
+// Control returns the control index.
+func (e *SearchExperiment) Control() VectorStore { return e.control }
+
+// Candidate returns the candidate index.
+func (e *SearchExperiment) Candidate() VectorStore { return e.candidate }
+
+// Search routes the query to the control or the candidate index.
+func (e *SearchExperiment) Search(query Vector, k int) ([]SearchResult, error) {
+	return e.search(func(s VectorStore) ([]SearchResult, error) { return s.Search(query, k) })
+}
+
+// SearchWithFilter routes the filtered query to the control or the candidate index.
+func (e *SearchExperiment) SearchWithFilter(query Vector, k int, filter FilterFunc) ([]SearchResult, error) {
+	return e.search(func(s VectorStore) ([]SearchResult, error) { return s.SearchWithFilter(query, k, filter) })
+}
+
+// search serves the query from the routed index and, for a share of
+// queries, runs it on the other index in the background to compare.
+func (e *SearchExperiment) search(run func(VectorStore) ([]SearchResult, error)) ([]SearchResult, error) {
+	cfg := e.Config()
+	toCandidate := rand.Float64() < cfg.Fraction
+
+	served, hist := e.control, &e.controlLat
+	if toCandidate {
+		served, hist = e.candidate, &e.candidateLat
+	}
+	start := time.Now()
+	results, err := run(served)
+	hist.record(time.Since(start), err)
+
+	if err == nil && rand.Float64() < cfg.CompareFraction {
+		e.compare(run, results, toCandidate)
+	}
+	return results, err
+}
+
+// compare runs the query on the index that did not serve it and records
+// the overlap of the two result lists. It is skipped when too many
+// comparisons are already running.
+func (e *SearchExperiment) compare(run func(VectorStore) ([]SearchResult, error), served []SearchResult, servedByCandidate bool) {
+	select {
+	case e.shadow <- struct{}{}:
+	default:
+		return
+	}
+	served = append([]SearchResult(nil), served...) // the caller owns the original
+	e.wg.Add(1)
+	go func() {
+		defer func() {
+			<-e.shadow
+			e.wg.Done()
+		}()
+		other, hist := e.candidate, &e.candidateLat
+		if servedByCandidate {
+			other, hist = e.control, &e.controlLat
+		}
+		start := time.Now()
+		results, err := run(other)
+		hist.record(time.Since(start), err)
+		if err != nil {
+			return
+		}
+		control, candidate := served, results
+		if servedByCandidate {
+			control, candidate = results, served
+		}
+		e.recordRecall(recallOf(control, candidate))
+	}()
+}
+
+func (e *SearchExperiment) recordRecall(r float64) {
+	e.recallMu.Lock()
+	e.recallSum += r
+	e.compared++
+	e.recallMu.Unlock()
+}
+
+// recallOf returns the share of control results found in candidate.
+func recallOf(control, candidate []SearchResult) float64 {
+	if len(control) == 0 {
+		return 1
+	}
+	found := make(map[string]struct{}, len(candidate))
+	for _, r := range candidate {
+		found[r.ID] = struct{}{}
+	}
+	hits := 0
+	for _, r := range control {
+		if _, ok := found[r.ID]; ok {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(control))
+}
+
+// Stats returns the side-by-side metrics of the experiment.
+func (e *SearchExperiment) Stats() ExperimentStats {
+	st := ExperimentStats{
+		Control:   e.controlLat.stats(),
+		Candidate: e.candidateLat.stats(),
+	}
+	e.recallMu.Lock()
+	st.Compared = e.compared
+	if e.compared > 0 {
+		st.Recall = e.recallSum / float64(e.compared)
+	}
+	e.recallMu.Unlock()
+	return st
+}
+
+// ResetStats clears the metrics, e.g. after changing the split.
+func (e *SearchExperiment) ResetStats() {
+	e.Wait()
+	e.controlLat.reset()
+	e.candidateLat.reset()
+	e.recallMu.Lock()
+	e.compared, e.recallSum = 0, 0
+	e.recallMu.Unlock()
+}
+
+// Wait blocks until the running comparisons finish.
+func (e *SearchExperiment) Wait() {
+	e.wg.Wait()
+}
+
+// Add adds the vector to both indexes.
+func (e *SearchExperiment) Add(id string, vector Vector, metadata map[string]any) error {
+	if err := e.control.Add(id, vector, metadata); err != nil {
+		return err
+	}
+	return e.candidate.Add(id, vector, metadata)
+}
+
+// Get returns the vector from the control index.
+func (e *SearchExperiment) Get(id string) (*VectorItem, bool) {
+	return e.control.Get(id)
+}
+
+// Delete deletes the vector from both indexes.
+func (e *SearchExperiment) Delete(id string) error {
+	err := e.control.Delete(id)
+	if cerr := e.candidate.Delete(id); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Len returns the number of vectors in the control index.
+func (e *SearchExperiment) Len() int {
+	return e.control.Len()
+}
+
+// Clear clears both indexes.
+func (e *SearchExperiment) Clear() {
+	e.control.Clear()
+	e.candidate.Clear()
+}
@@ -0,0 +1,278 @@
+package src
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultIngestBatchSize is the default number of vectors per batch sent by
+// streaming ingestion clients.
+const DefaultIngestBatchSize = 512
+
+// IngestResult is the reply sent once an ingestion stream has been applied.
+type IngestResult struct {
+	Added  int64  `json:"added"`
+	Failed int64  `json:"failed"`
+	Error  string `json:"error,omitempty"` // first error, if any
+}
+
+// VectorIngestServer accepts streaming bulk ingestion over TCP.
+//
+// A client sends one gzip-compressed stream per connection containing JSON
+// batches ([]ExportItem, one per line), then closes its write side. The
+// server decodes batches into a bounded queue that Workers goroutines drain
+// into the store in parallel; when the queue is full the server stops
+// reading, so TCP flow control slows the client down instead of buffering
+// without bound. After the stream ends the server replies with an
+// IngestResult as JSON.
+//
+// With a Policy, a client first sends a line "AUTH <token>" and the server
+// answers with an IngestResult, whose Error is set if the token lacks
+// PermWrite on Collection; the connection is then closed. gRPC clients send
+// the token as metadata instead, see package grpcserver.
+type VectorIngestServer struct {
+	// Workers is the number of goroutines adding vectors per connection
+	// (GOMAXPROCS if 0).
+	Workers int
+
+	// QueueSize is the number of decoded batches buffered per connection
+	// (2 * Workers if 0).
+	QueueSize int
+
+	// Policy authorizes connections, nil to allow all of them. Set it before
+	// serving.
+	Policy *AccessPolicy
+
+	// Collection is the scope checked against Policy, such as the name the
+	// store has in a VectorCollections; ScopeAll if empty.
+	Collection string
+
+	store *VectorCache
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewVectorIngestServer creates an ingestion server for store.
+func NewVectorIngestServer(store *VectorCache) *VectorIngestServer {
+	return &VectorIngestServer{
+		store: store,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *VectorIngestServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until Close is called.
+func (s *VectorIngestServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				conn.Close()
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				s.wg.Done()
+			}()
+			br := bufio.NewReader(conn)
+			enc := json.NewEncoder(conn)
+			if s.Policy != nil {
+				err := s.authorizeConn(br)
+				enc.Encode(IngestResult{Error: errorString(err)})
+				if err != nil {
+					return
+				}
+			}
+			enc.Encode(s.Ingest(br))
+		}()
+	}
+}
+
+// Authorize checks that token holds PermWrite on the server's Collection.
+func (s *VectorIngestServer) Authorize(token string) error {
+	scope := s.Collection
+	if scope == "" {
+		scope = ScopeAll
+	}
+	return s.Policy.Authorize(token, scope, PermWrite)
+}
+
+// authorizeConn reads the "AUTH <token>" line of a connection.
+func (s *VectorIngestServer) authorizeConn(br *bufio.Reader) error {
+	// ReadSlice is bounded by the reader's buffer
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		return fmt.Errorf("reading AUTH line: %w", err)
+	}
+	token, ok := strings.CutPrefix(strings.TrimRight(string(line), "\r\n"), "AUTH ")
+	if !ok {
+		return ErrUnauthenticated
+	}
+	return s.Authorize(token)
+}
+
+// errorString returns the text of err, or "" if it is nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Close stops the listener, closes open connections and waits for them to finish.
+func (s *VectorIngestServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// Ingest applies one compressed batch stream read from r.
+// It can also be used directly, e.g. to load a stream from a file.
+func (s *VectorIngestServer) Ingest(r io.Reader) IngestResult {
+	next, closeStream, err := ingestStreamReader(r)
+	if err != nil {
+		return IngestResult{Error: err.Error()}
+	}
+	defer closeStream()
+	return s.IngestBatches(next)
+}
+
+// IngestBatches applies the batches returned by next until it returns io.EOF
+// or another error, which ends the ingestion and is reported. Batches are
+// handed to Workers goroutines through a queue of QueueSize batches, and next
+// is not called while the queue is full, so a source reading from the
+// network applies backpressure. Package grpcserver uses it to serve
+// ingestion over gRPC.
+func (s *VectorIngestServer) IngestBatches(next func() ([]ExportItem, error)) IngestResult {
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	queueSize := s.QueueSize
+	if queueSize <= 0 {
+		queueSize = 2 * workers
+	}
+
+	var (
+		added, failed atomic.Int64
+		errOnce       sync.Once
+		firstErr      error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+	}
+
+	queue := make(chan []ExportItem, queueSize)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				for _, item := range batch {
+					if err := s.store.Add(item.ID, Vector(item.Vector), item.Metadata); err != nil {
+						failed.Add(1)
+						fail(err)
+						continue
+					}
+					added.Add(1)
+				}
+			}
+		}()
+	}
+
+	// Sending blocks while the queue is full, which applies backpressure.
+	for {
+		batch, err := next()
+		if err != nil {
+			if err != io.EOF {
+				fail(err)
+			}
+			break
+		}
+		if len(batch) > 0 {
+			queue <- batch
+		}
+	}
+	close(queue)
+	wg.Wait()
+	s.store.Wait()
+
+	result := IngestResult{Added: added.Load(), Failed: failed.Load()}
+	if firstErr != nil {
+		result.Error = firstErr.Error()
+	}
+	return result
+}
+
+// ingestStreamReader returns a function decoding the batches of a gzip
+// stream one at a time, and one closing the decompressor.
+func ingestStreamReader(r io.Reader) (func() ([]ExportItem, error), func() error, error) {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Stop at the end of the gzip member so the reply can follow on the same
+	// connection.
+	zr.Multistream(false)
+
+	dec := json.NewDecoder(zr)
+	next := func() ([]ExportItem, error) {
+		var batch []ExportItem
+		err := dec.Decode(&batch)
+		return batch, err
+	}
+	return next, zr.Close, nil
+}
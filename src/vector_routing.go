@@ -0,0 +1,120 @@
+package src
+
+import (
+	"io"
+	"sync"
+)
+
+// routingTable is an explicit ID → shard mapping for sharded vector stores.
+// Once an ID is assigned to a shard it stays there, even if the shard count
+// changes, as long as the shard still exists.
+type routingTable struct {
+	mu     sync.RWMutex
+	routes map[string]int
+}
+
+func newRoutingTable() *routingTable {
+	return &routingTable{routes: make(map[string]int)}
+}
+
+func (t *routingTable) lookup(id string) (int, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	shard, ok := t.routes[id]
+	return shard, ok
+}
+
+func (t *routingTable) assign(id string, shard int) {
+	t.mu.Lock()
+	t.routes[id] = shard
+	t.mu.Unlock()
+}
+
+func (t *routingTable) remove(id string) {
+	t.mu.Lock()
+	delete(t.routes, id)
+	t.mu.Unlock()
+}
+
+func (t *routingTable) snapshot() map[string]int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	routes := make(map[string]int, len(t.routes))
+	for id, shard := range t.routes {
+		routes[id] = shard
+	}
+	return routes
+}
+
+// shardIndex returns the shard index for id, consulting the routing table
+// first when persistent routing is enabled, then the router.
+func (vc *VectorCache) shardIndex(id string) int {
+	if vc.routes != nil {
+		if shard, ok := vc.routes.lookup(id); ok && shard < vc.shardCount {
+			return shard
+		}
+	}
+	return route(vc.router, id, vc.shardCount)
+}
+
+// RoutingTable returns a copy of the ID → shard mapping,
+// or nil if persistent routing is disabled.
+func (vc *VectorCache) RoutingTable() map[string]int {
+	if vc.routes == nil {
+		return nil
+	}
+	return vc.routes.snapshot()
+}
+
+// SetRoutingTable loads an ID → shard mapping, e.g. one saved alongside a
+// snapshot. Entries pointing at shards that no longer exist fall back to
+// hash routing. It enables persistent routing on a sharded store.
+func (vc *VectorCache) SetRoutingTable(routes map[string]int) {
+	if vc.shardCount <= 1 {
+		return
+	}
+	if vc.routes == nil {
+		vc.routes = newRoutingTable()
+	}
+	vc.routes.mu.Lock()
+	for id, shard := range routes {
+		vc.routes.routes[id] = shard
+	}
+	vc.routes.mu.Unlock()
+}
+
+// ShardIDs returns the IDs routed to the given shard.
+// It requires persistent routing and returns nil otherwise.
+func (vc *VectorCache) ShardIDs(shard int) []string {
+	if vc.routes == nil {
+		return nil
+	}
+	vc.routes.mu.RLock()
+	defer vc.routes.mu.RUnlock()
+
+	var ids []string
+	for id, s := range vc.routes.routes {
+		if s == shard {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// RestoreShard clears a single shard and reloads it from a stream written by
+// ExportShard, e.g. to rebuild a corrupted shard from its backup. With
+// persistent routing the restored IDs are pinned to this shard.
+func (vc *VectorCache) RestoreShard(shard int, r io.Reader) (int, error) {
+	s, err := vc.shardAt(shard)
+	if err != nil {
+		return 0, err
+	}
+
+	s.cache.Clear()
+	s.currentIndex().Clear()
+	s.order.reset()
+
+	n, err := vc.importShardStream(r, shard)
+	vc.Wait()
+	return n, err
+}
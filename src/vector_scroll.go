@@ -0,0 +1,128 @@
+package src
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// insertionOrder tracks the insertion sequence of the vectors in a shard.
+// Sequence numbers come from a counter shared by all shards, so the order is
+// global across a sharded store.
+type insertionOrder struct {
+	mu   sync.Mutex
+	seqs map[string]uint64
+	log  []orderEntry
+}
+
+// orderEntry is a single insertion in the order log.
+type orderEntry struct {
+	seq uint64
+	id  string
+}
+
+func newInsertionOrder() *insertionOrder {
+	return &insertionOrder{seqs: make(map[string]uint64)}
+}
+
+// add records an insertion of id, taking the next sequence number from counter.
+// Re-adding an existing ID moves it to the end of the order.
+func (o *insertionOrder) add(id string, counter *atomic.Uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	seq := counter.Add(1)
+	o.seqs[id] = seq
+	o.log = append(o.log, orderEntry{seq: seq, id: id})
+	o.compact()
+}
+
+// remove forgets id; its log entry is dropped on the next compaction.
+func (o *insertionOrder) remove(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.seqs, id)
+}
+
+// reset clears the order.
+func (o *insertionOrder) reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seqs = make(map[string]uint64)
+	o.log = nil
+}
+
+// compact drops stale log entries once they dominate the log (caller must hold lock).
+func (o *insertionOrder) compact() {
+	if len(o.log) < 1024 || len(o.log) < 2*len(o.seqs) {
+		return
+	}
+	live := o.log[:0]
+	for _, e := range o.log {
+		if o.seqs[e.id] == e.seq {
+			live = append(live, e)
+		}
+	}
+	o.log = live
+}
+
+// after returns up to limit live entries with a sequence greater than cursor.
+func (o *insertionOrder) after(cursor uint64, limit int) []orderEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	start := sort.Search(len(o.log), func(i int) bool {
+		return o.log[i].seq > cursor
+	})
+
+	var entries []orderEntry
+	for i := start; i < len(o.log) && len(entries) < limit; i++ {
+		e := o.log[i]
+		if o.seqs[e.id] == e.seq {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Scroll returns up to batchSize vectors in stable insertion order, starting
+// after cursor. Pass 0 to start from the beginning and the returned cursor to
+// continue; a returned cursor of 0 means the end has been reached.
+// Re-adding an existing ID moves it to the end of the order.
+func (vc *VectorCache) Scroll(cursor uint64, batchSize int) ([]*VectorItem, uint64) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	var entries []orderEntry
+	if vc.shardCount > 1 {
+		for _, shard := range vc.shards {
+			entries = append(entries, shard.order.after(cursor, batchSize)...)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].seq < entries[j].seq
+		})
+		if len(entries) > batchSize {
+			entries = entries[:batchSize]
+		}
+	} else {
+		entries = vc.order.after(cursor, batchSize)
+	}
+
+	if len(entries) == 0 {
+		return nil, 0
+	}
+
+	items := make([]*VectorItem, 0, len(entries))
+	for _, e := range entries {
+		if item, found := vc.getShard(e.id).currentIndex().Get(e.id); found {
+			items = append(items, item)
+		}
+	}
+
+	next := entries[len(entries)-1].seq
+	if len(entries) < batchSize {
+		next = 0
+	}
+	return items, next
+}
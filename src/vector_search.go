@@ -0,0 +1,189 @@
+package src
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// BoostFunc adjusts a search score based on the result's metadata,
+// e.g. a recency boost of score * f(age). The adjusted score is ranked in
+// the same direction as the metric: lower is better for L2 and cosine
+// distances, higher is better for inner product.
+type BoostFunc func(score float32, metadata map[string]any) float32
+
+// DefaultBoostCandidates is the default candidate multiplier for boosted searches.
+const DefaultBoostCandidates = 4
+
+// SearchOptions configures a single search.
+type SearchOptions struct {
+	// Filter restricts results by metadata.
+	Filter FilterFunc
+
+	// Boost adjusts scores before the final top-k selection.
+	Boost BoostFunc
+
+	// Candidates is the size of the candidate set the boost is evaluated on.
+	// Defaults to DefaultBoostCandidates * k.
+	Candidates int
+
+	// Metric overrides the collection metric for this query.
+	// Switching between cosine and inner product is cheap when the store
+	// was created with PrecomputeNorms.
+	Metric MetricType
+
+	// OmitVector leaves SearchResult.Vector nil, for callers that only need
+	// IDs, scores and metadata.
+	OmitVector bool
+
+	// Fields restricts SearchResult.Metadata to the given keys. Nil returns
+	// all metadata; OmitMetadata returns none.
+	Fields []string
+
+	// OmitMetadata leaves SearchResult.Metadata nil.
+	OmitMetadata bool
+}
+
+// metricSearcher is implemented by indexes that can score with a metric
+// chosen at query time.
+type metricSearcher interface {
+	searchWithMetric(query Vector, k int, metric MetricType, filter FilterFunc) ([]SearchResult, error)
+}
+
+// SearchWithOptions searches for vectors with per-query options.
+// When a boost function is set, a larger candidate set is retrieved, the
+// boost is applied to each candidate and the top k are selected from the
+// adjusted scores, so no second ranking pass is needed by the caller.
+func (vc *VectorCache) SearchWithOptions(query Vector, k int, opts SearchOptions) ([]SearchResult, error) {
+	if k <= 0 {
+		k = 10
+	}
+
+	fetch := k
+	if opts.Boost != nil {
+		fetch = opts.Candidates
+		if fetch < k {
+			fetch = k * DefaultBoostCandidates
+		}
+	}
+
+	metric := vc.config.Metric
+	if opts.Metric != "" {
+		metric = opts.Metric
+	}
+
+	var results []SearchResult
+	var err error
+	switch {
+	case metric != vc.config.Metric:
+		results, err = vc.searchShards(fetch, metric, func(s *VectorCache) ([]SearchResult, error) {
+			ms, ok := s.currentIndex().(metricSearcher)
+			if !ok {
+				return nil, fmt.Errorf("index does not support metric %q", metric)
+			}
+			return ms.searchWithMetric(query, fetch, metric, opts.Filter)
+		})
+		vc.touchResults(results)
+	case opts.Filter != nil:
+		results, err = vc.SearchWithFilter(query, fetch, opts.Filter)
+	default:
+		results, err = vc.Search(query, fetch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Boost != nil {
+		for i := range results {
+			results[i].Score = opts.Boost(results[i].Score, results[i].Metadata)
+		}
+		sortResults(results, metric)
+	}
+
+	if len(results) > k {
+		results = results[:k]
+	}
+	opts.project(results)
+	return results, nil
+}
+
+// project drops the result fields not requested by the options. Boosts and
+// filters have already seen the full metadata.
+func (opts SearchOptions) project(results []SearchResult) {
+	if !opts.OmitVector && !opts.OmitMetadata && opts.Fields == nil {
+		return
+	}
+	for i := range results {
+		r := &results[i]
+		if opts.OmitVector {
+			r.Vector = nil
+		}
+		switch {
+		case opts.OmitMetadata:
+			r.Metadata = nil
+		case opts.Fields != nil && r.Metadata != nil:
+			selected := make(map[string]any, len(opts.Fields))
+			for _, field := range opts.Fields {
+				if v, ok := r.Metadata[field]; ok {
+					selected[field] = v
+				}
+			}
+			r.Metadata = selected
+		}
+	}
+}
+
+// searchShards runs search on every shard in parallel and merges the
+// results into the top k for the given metric.
+func (vc *VectorCache) searchShards(k int, metric MetricType, search func(s *VectorCache) ([]SearchResult, error)) ([]SearchResult, error) {
+	if vc.shardCount <= 1 {
+		return search(vc)
+	}
+
+	perShard := make([][]SearchResult, vc.shardCount)
+	errs := make([]error, vc.shardCount)
+	var wg sync.WaitGroup
+	for i, shard := range vc.shards {
+		wg.Add(1)
+		go func(s *VectorCache, idx int) {
+			defer wg.Done()
+			perShard[idx], errs[idx] = search(s)
+		}(shard, i)
+	}
+	wg.Wait()
+
+	var allResults []SearchResult
+	for i, results := range perShard {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		allResults = append(allResults, results...)
+	}
+
+	sortResults(allResults, metric)
+	if len(allResults) > k {
+		allResults = allResults[:k]
+	}
+	return allResults, nil
+}
+
+// sortResults sorts search results best first for the given metric.
+// Equal scores are ordered by ID, so identical queries return identical pages.
+func sortResults(results []SearchResult, metric MetricType) {
+	higherBetter := metric == MetricIP // Higher inner product is better.
+	sort.Slice(results, func(i, j int) bool {
+		return rankedBefore(results[i].Score, results[i].ID, results[j].Score, results[j].ID, higherBetter)
+	})
+}
+
+// rankedBefore reports whether a result with score a and ID aID ranks before
+// one with score b and ID bID. Ties are broken by ascending ID.
+func rankedBefore(a float32, aID string, b float32, bID string, higherBetter bool) bool {
+	if a != b {
+		if higherBetter {
+			return a > b
+		}
+		return a < b
+	}
+	return aID < bID
+}
@@ -1,9 +1,11 @@
 package src
 
 import (
+	"context"
 	"encoding/json"
-	"hash/fnv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,6 +28,45 @@ type VectorStoreConfig struct {
 
 	// ShardCount is the number of shards.
 	ShardCount int
+
+	// PersistentRouting keeps an explicit ID → shard table instead of relying
+	// on the hash alone, so assignments survive shard-count changes. The table
+	// is saved with ExportToBytes snapshots.
+	PersistentRouting bool
+
+	// Router picks the shard of each ID (default HashRouter). A
+	// MetadataRouter places vectors by their metadata and enables the
+	// routing table, as PersistentRouting does.
+	Router Router
+
+	// RefreshTTLOnHit resets a vector's TTL whenever it appears in search
+	// results, so frequently retrieved vectors stay cached (sliding TTL).
+	RefreshTTLOnHit bool
+
+	// PrecomputeNorms stores the L2 norm of every vector at insert time so
+	// that searches can switch between cosine and inner product per query.
+	PrecomputeNorms bool
+
+	// Quantization stores flat index vectors as int8 codes.
+	// QuantizationInt8Asymmetric compares them with the full-precision query.
+	Quantization QuantizationMode
+
+	// Dedup sets how Add handles a vector within DedupEpsilon of a vector
+	// already stored under another ID. DedupOff disables the check.
+	Dedup DedupPolicy
+
+	// DedupEpsilon is the distance below which two vectors are duplicates.
+	DedupEpsilon float32
+
+	// Tracer starts a span in SearchContext. nil disables tracing.
+	Tracer Tracer
+
+	// Dimension, if positive, makes Add and BatchAdd reject vectors of any
+	// other length with ErrDimensionMismatch.
+	Dimension int
+
+	// budget is a MaxCost shared with other stores, set by VectorCollections.
+	budget *costBudget
 }
 
 // DefaultVectorStoreConfig returns the default configuration.
@@ -57,6 +98,29 @@ type VectorCache struct {
 	// itemCollector collects all vectors for index rebuilding.
 	itemCollector func() []*VectorItem
 
+	// order tracks insertion order for Scroll; seq is the sequence counter
+	// shared by all shards and lives on the top-level store.
+	order *insertionOrder
+	seq   atomic.Uint64
+
+	// routes is the explicit ID → shard table, nil unless PersistentRouting is
+	// set or router is a MetadataRouter.
+	routes *routingTable
+
+	// router picks the shard of IDs missing from routes.
+	router Router
+
+	// aliases maps IDs to the stored vector they duplicate, nil unless Dedup is DedupAlias.
+	aliases *aliasTable
+
+	// rebuild records writes while a shadow index is being built.
+	rebuild *rebuildLog
+
+	// hnsw holds the HNSW parameters of the live index, which rebuilds
+	// change; config.HNSW only seeds it.
+	hnsw HNSWConfig
+
+	// mu guards index, rebuild and hnsw.
 	mu sync.RWMutex
 }
 
@@ -75,26 +139,35 @@ func NewVectorStore(config *VectorStoreConfig) (*VectorCache, error) {
 	// Single shard.
 	vc := &VectorCache{
 		config: config,
+		order:  newInsertionOrder(),
+		hnsw:   config.HNSW,
+	}
+	if config.Dedup == DedupAlias {
+		vc.aliases = newAliasTable()
 	}
 
 	// Create FastCache.
+	// Vectors that expire or are evicted from the cache are removed from the index.
 	cacheConfig := &Config{
 		MaxCost: config.MaxCost,
 		TTL:     config.TTL,
+		OnEvict: func(key string, value any, cost int64) {
+			if item, ok := value.(*VectorItemWithIndex); ok && item.Item != nil {
+				vc.indexDelete(item.Item.ID)
+			}
+		},
 	}
 	cache, err := NewRistrettoCache(cacheConfig)
 	if err != nil {
 		return nil, err
 	}
 	vc.cache = cache
+	if config.budget != nil {
+		config.budget.join(cache)
+	}
 
 	// Create index.
-	switch config.IndexType {
-	case "hnsw":
-		vc.index = NewHNSW(config.HNSW, config.Metric)
-	default:
-		vc.index = NewFlatSearch(config.Metric)
-	}
+	vc.index = vc.newIndex(config.HNSW)
 
 	return vc, nil
 }
@@ -106,12 +179,12 @@ func newShardedVectorStore(config *VectorStoreConfig) (*VectorCache, error) {
 		shardCount = 1
 	}
 
-	// Per-shard configuration.
-	shardConfig := *config
-	shardConfig.ShardCount = 1
-
 	shards := make([]*VectorCache, shardCount)
 	for i := 0; i < shardCount; i++ {
+		// Per-shard configuration. Each shard gets its own copy with its
+		// share of MaxCost.
+		shardConfig := *config
+		shardConfig.ShardCount = 1
 		// Allocate memory for each shard.
 		shardConfig.MaxCost = config.MaxCost / int64(shardCount)
 		store, err := NewVectorStore(&shardConfig)
@@ -125,36 +198,96 @@ func newShardedVectorStore(config *VectorStoreConfig) (*VectorCache, error) {
 		shards[i] = store
 	}
 
-	return &VectorCache{
+	vc := &VectorCache{
 		config:    config,
 		shards:    shards,
 		shardCount: shardCount,
-	}, nil
+		router:    config.Router,
+		hnsw:      config.HNSW,
+	}
+	if vc.router == nil {
+		vc.router = HashRouter{}
+	}
+	_, byMetadata := vc.router.(MetadataRouter)
+	if config.PersistentRouting || byMetadata {
+		vc.routes = newRoutingTable()
+	}
+	if config.Dedup == DedupAlias {
+		vc.aliases = newAliasTable()
+	}
+	return vc, nil
 }
 
 // getShard returns the shard for the given ID.
 func (vc *VectorCache) getShard(id string) *VectorCache {
 	if vc.shardCount > 1 {
-		h := fnv.New32a()
-		h.Write([]byte(id))
-		shardIdx := int(h.Sum32()) % vc.shardCount
-		return vc.shards[shardIdx]
+		return vc.shards[vc.shardIndex(id)]
 	}
 	return vc
 }
 
 // Add adds a vector.
 func (vc *VectorCache) Add(id string, vector Vector, metadata map[string]any) error {
-	shard := vc.getShard(id)
+	if err := vc.checkDimension(vector); err != nil {
+		return err
+	}
+	if vc.config.Dedup != DedupOff {
+		if handled, err := vc.dedup(id, vector, metadata); handled {
+			return err
+		}
+	}
+	if vc.aliases != nil {
+		vc.aliases.remove(id)
+	}
+	return vc.addToShard(vc.storeShardIndex(id, metadata), id, vector, metadata)
+}
+
+// checkDimension rejects a vector whose length is not the configured dimension.
+func (vc *VectorCache) checkDimension(vector Vector) error {
+	if vc.config.Dimension > 0 && len(vector) != vc.config.Dimension {
+		return &VectorError{Op: "add", Err: ErrDimensionMismatch}
+	}
+	return nil
+}
+
+// addToShard adds a vector to the shard with the given index.
+func (vc *VectorCache) addToShard(idx int, id string, vector Vector, metadata map[string]any) error {
+	shard := vc
+	if vc.shardCount > 1 {
+		shard = vc.shards[idx]
+		if vc.routes != nil {
+			vc.routes.assign(id, idx)
+		}
+	}
+
+	shard.store(id, vector, metadata)
 
+	// Add to index.
+	if err := shard.indexAdd(id, vector, metadata); err != nil {
+		return err
+	}
+	shard.order.add(id, &vc.seq)
+	return nil
+}
+
+// store stores a vector in the shard's cache, without indexing it.
+func (vc *VectorCache) store(id string, vector Vector, metadata map[string]any) {
+	storeKey, item, cost := vectorEntry(id, vector, metadata)
+	if vc.config.TTL > 0 {
+		vc.cache.SetWithTTL(storeKey, item, cost, vc.config.TTL)
+	} else {
+		vc.cache.Set(storeKey, item, cost)
+	}
+}
+
+// vectorEntry returns the cache key, value and cost a vector is stored under.
+func vectorEntry(id string, vector Vector, metadata map[string]any) (string, *VectorItemWithIndex, int64) {
 	// Calculate cost.
 	cost := int64(len(vector)*4) + 64 // float32 * 4 bytes + base overhead
 	if metadata != nil {
 		cost += 128 // Estimate metadata.
 	}
 
-	// Store in cache.
-	storeKey := "vec:" + id
 	item := &VectorItemWithIndex{
 		Item: &VectorItem{
 			ID:       id,
@@ -163,10 +296,7 @@ func (vc *VectorCache) Add(id string, vector Vector, metadata map[string]any) er
 			Cost:     cost,
 		},
 	}
-	shard.cache.Set(storeKey, item, cost)
-
-	// Add to index.
-	return shard.index.Add(id, vector, metadata)
+	return "vec:" + id, item, cost
 }
 
 // Get retrieves a vector.
@@ -176,6 +306,9 @@ func (vc *VectorCache) Get(id string) (*VectorItem, bool) {
 
 	val, found := shard.cache.Get(storeKey)
 	if !found {
+		if target, ok := vc.ResolveAlias(id); ok {
+			return vc.Get(target)
+		}
 		return nil, false
 	}
 
@@ -195,18 +328,41 @@ func (vc *VectorCache) Delete(id string) error {
 	storeKey := "vec:" + id
 	shard.cache.Del(storeKey)
 
+	if vc.routes != nil {
+		vc.routes.remove(id)
+	}
+	if vc.aliases != nil {
+		vc.aliases.remove(id)
+	}
+
 	// Delete from index.
-	return shard.index.Delete(id)
+	return shard.indexDelete(id)
 }
 
 // Search searches for vectors.
 func (vc *VectorCache) Search(query Vector, k int) ([]SearchResult, error) {
 	// For sharded stores, search all shards and merge results.
 	if vc.shardCount > 1 {
-		return vc.shardedSearch(query, k)
+		results, err := vc.shardedSearch(query, k)
+		vc.touchResults(results)
+		return results, err
 	}
 
-	return vc.index.Search(query, k)
+	results, err := vc.currentIndex().Search(query, k)
+	vc.touchResults(results)
+	return results, err
+}
+
+// touchResults refreshes the TTL of every vector in results when
+// RefreshTTLOnHit is enabled.
+func (vc *VectorCache) touchResults(results []SearchResult) {
+	if !vc.config.RefreshTTLOnHit || vc.config.TTL <= 0 {
+		return
+	}
+	expiration := time.Now().UnixNano() + int64(vc.config.TTL)
+	for _, r := range results {
+		vc.getShard(r.ID).cache.cache.SetExpiration("vec:"+r.ID, expiration)
+	}
 }
 
 // shardedSearch searches across all shards.
@@ -224,7 +380,7 @@ func (vc *VectorCache) shardedSearch(query Vector, k int) ([]SearchResult, error
 		wg.Add(1)
 		go func(s *VectorCache, idx int) {
 			defer wg.Done()
-			results, err := s.index.Search(query, k*2) // Search more results per shard.
+			results, err := s.currentIndex().Search(query, k*2) // Search more results per shard.
 			if err == nil && len(results) > 0 {
 				resultsChan <- resultWithShard{results: results, shard: idx}
 			}
@@ -248,25 +404,7 @@ func (vc *VectorCache) shardedSearch(query Vector, k int) ([]SearchResult, error
 	}
 
 	// Sort by score.
-	if vc.config.Metric == MetricIP {
-		// Higher inner product is better.
-		for i := 0; i < len(allResults)-1; i++ {
-			for j := i + 1; j < len(allResults); j++ {
-				if allResults[i].Score < allResults[j].Score {
-					allResults[i], allResults[j] = allResults[j], allResults[i]
-				}
-			}
-		}
-	} else {
-		// Smaller distance is better.
-		for i := 0; i < len(allResults)-1; i++ {
-			for j := i + 1; j < len(allResults); j++ {
-				if allResults[i].Score > allResults[j].Score {
-					allResults[i], allResults[j] = allResults[j], allResults[i]
-				}
-			}
-		}
-	}
+	sortResults(allResults, vc.config.Metric)
 
 	// Get Top-K.
 	if len(allResults) > k {
@@ -280,10 +418,14 @@ func (vc *VectorCache) shardedSearch(query Vector, k int) ([]SearchResult, error
 func (vc *VectorCache) SearchWithFilter(query Vector, k int, filter FilterFunc) ([]SearchResult, error) {
 	// For sharded stores, search all shards and merge results.
 	if vc.shardCount > 1 {
-		return vc.shardedSearchWithFilter(query, k, filter)
+		results, err := vc.shardedSearchWithFilter(query, k, filter)
+		vc.touchResults(results)
+		return results, err
 	}
 
-	return vc.index.SearchWithFilter(query, k, filter)
+	results, err := vc.currentIndex().SearchWithFilter(query, k, filter)
+	vc.touchResults(results)
+	return results, err
 }
 
 // shardedSearchWithFilter searches across all shards with filtering.
@@ -301,7 +443,7 @@ func (vc *VectorCache) shardedSearchWithFilter(query Vector, k int, filter Filte
 		wg.Add(1)
 		go func(s *VectorCache, idx int) {
 			defer wg.Done()
-			results, err := s.index.SearchWithFilter(query, k*2, filter)
+			results, err := s.currentIndex().SearchWithFilter(query, k*2, filter)
 			if err == nil && len(results) > 0 {
 				resultsChan <- resultWithShard{results: results, shard: idx}
 			}
@@ -324,23 +466,7 @@ func (vc *VectorCache) shardedSearchWithFilter(query Vector, k int, filter Filte
 	}
 
 	// Sort and get Top-K.
-	if vc.config.Metric == MetricIP {
-		for i := 0; i < len(allResults)-1; i++ {
-			for j := i + 1; j < len(allResults); j++ {
-				if allResults[i].Score < allResults[j].Score {
-					allResults[i], allResults[j] = allResults[j], allResults[i]
-				}
-			}
-		}
-	} else {
-		for i := 0; i < len(allResults)-1; i++ {
-			for j := i + 1; j < len(allResults); j++ {
-				if allResults[i].Score > allResults[j].Score {
-					allResults[i], allResults[j] = allResults[j], allResults[i]
-				}
-			}
-		}
-	}
+	sortResults(allResults, vc.config.Metric)
 
 	if len(allResults) > k {
 		allResults = allResults[:k]
@@ -354,11 +480,11 @@ func (vc *VectorCache) Len() int {
 	if vc.shardCount > 1 {
 		total := 0
 		for _, shard := range vc.shards {
-			total += shard.index.Len()
+			total += shard.currentIndex().Len()
 		}
 		return total
 	}
-	return vc.index.Len()
+	return vc.currentIndex().Len()
 }
 
 // Cost returns the current cost.
@@ -373,17 +499,31 @@ func (vc *VectorCache) Cost() int64 {
 	return vc.cache.Cost()
 }
 
+// caches returns the caches holding the vectors of every shard.
+func (vc *VectorCache) caches() []*RistrettoCache {
+	if vc.shardCount > 1 {
+		caches := make([]*RistrettoCache, len(vc.shards))
+		for i, shard := range vc.shards {
+			caches[i] = shard.cache
+		}
+		return caches
+	}
+	return []*RistrettoCache{vc.cache}
+}
+
 // Clear clears all data.
 func (vc *VectorCache) Clear() {
 	if vc.shardCount > 1 {
 		for _, shard := range vc.shards {
 			shard.cache.Clear()
-			shard.index.Clear()
+			shard.currentIndex().Clear()
+			shard.order.reset()
 		}
 		return
 	}
 	vc.cache.Clear()
-	vc.index.Clear()
+	vc.currentIndex().Clear()
+	vc.order.reset()
 }
 
 // Wait waits for all async writes to complete.
@@ -403,7 +543,7 @@ func (vc *VectorCache) Wait() {
 func (vc *VectorCache) Close() error {
 	if vc.shardCount > 1 {
 		for _, shard := range vc.shards {
-			shard.cache.Close()
+			shard.Close()
 		}
 		return nil
 	}
@@ -411,12 +551,56 @@ func (vc *VectorCache) Close() error {
 }
 
 // BatchAdd adds multiple vectors in batch.
+// Each shard's index is updated with a single AddBatch call when the index
+// supports it. With duplicate detection enabled, vectors are added one by one.
 func (vc *VectorCache) BatchAdd(items []VectorItem) error {
 	for _, item := range items {
-		if err := vc.Add(item.ID, item.Vector, item.Metadata); err != nil {
+		if err := vc.checkDimension(item.Vector); err != nil {
 			return err
 		}
 	}
+	if vc.config.Dedup != DedupOff {
+		for _, item := range items {
+			if err := vc.Add(item.ID, item.Vector, item.Metadata); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if vc.shardCount <= 1 {
+		return vc.addBatchToShard(vc, items)
+	}
+	groups := make([][]VectorItem, vc.shardCount)
+	for _, item := range items {
+		idx := vc.storeShardIndex(item.ID, item.Metadata)
+		if vc.routes != nil {
+			vc.routes.assign(item.ID, idx)
+		}
+		groups[idx] = append(groups[idx], item)
+	}
+	for idx, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		if err := vc.addBatchToShard(vc.shards[idx], group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBatchToShard stores and indexes items in shard.
+func (vc *VectorCache) addBatchToShard(shard *VectorCache, items []VectorItem) error {
+	for _, item := range items {
+		shard.store(item.ID, item.Vector, item.Metadata)
+	}
+	if err := shard.indexAddBatch(items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		shard.order.add(item.ID, &vc.seq)
+	}
 	return nil
 }
 
@@ -445,34 +629,17 @@ func (vc *VectorCache) BatchDelete(ids []string) int {
 // BuildIndex rebuilds the index from storage.
 // It rebuilds the index from storage, useful when the index is corrupted or needs optimization.
 func (vc *VectorCache) BuildIndex() error {
-	if vc.shardCount > 1 {
-		for _, shard := range vc.shards {
-			if err := shard.rebuildIndexFromCache(); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-
-	return vc.rebuildIndexFromCache()
+	return vc.BuildIndexWithProgress(context.Background(), nil)
 }
 
-// rebuildIndexFromCache rebuilds the index from cache.
-func (vc *VectorCache) rebuildIndexFromCache() error {
-	// Clear current index.
-	vc.index.Clear()
-
-	// Get all stored vectors.
-	items := vc.collectAllItems()
-
-	// Add to index one by one.
-	for _, item := range items {
-		if err := vc.index.Add(item.ID, item.Vector, item.Metadata); err != nil {
-			return err
-		}
-	}
-
-	return nil
+// BuildIndexWithProgress rebuilds the index from storage, reporting progress
+// (items done, total, rate and ETA) to onProgress. Use ProgressChan to
+// receive updates on a channel. Cancelling ctx aborts the build and leaves
+// the current index in place.
+func (vc *VectorCache) BuildIndexWithProgress(ctx context.Context, onProgress func(IndexProgress)) error {
+	return vc.rebuildAll(ctx, RebuildOptions{OnProgress: onProgress}, func(s *VectorCache, _ VectorStore) []*VectorItem {
+		return s.collectAllItems()
+	})
 }
 
 // collectAllItems collects all vectors from the cache.
@@ -486,42 +653,52 @@ func (vc *VectorCache) collectAllItems() []*VectorItem {
 		return items
 	}
 
-	// Since FastCache does not provide a traversal interface,
-	// we maintain an internal vector list for index rebuilding.
-	// Simplified handling: returns an empty list, users need to maintain the vector list themselves.
-	// In actual usage, a list can be updated simultaneously when adding.
-
+	// Walk the cache; vectors are stored under "vec:" keys.
+	vc.cache.ForEach(func(key string, value any, _ int64, _ int64) bool {
+		if !strings.HasPrefix(key, "vec:") {
+			return true
+		}
+		if stored, ok := value.(*VectorItemWithIndex); ok && stored.Item != nil {
+			items = append(items, stored.Item)
+		}
+		return true
+	})
 	return items
 }
 
 // OptimizeIndex optimizes the index.
-// For HNSW, connection edges can be readjusted.
+// For HNSW, the graph is rebuilt from the current index's vectors with the
+// configured parameters while the old graph keeps serving searches.
 func (vc *VectorCache) OptimizeIndex() error {
-	// For FlatSearch, sorting is already optimal.
-	// For HNSW, the graph structure can be rebuilt.
+	return vc.OptimizeIndexWithConfig(vc.hnswConfig())
+}
 
+// OptimizeIndexWithConfig rebuilds the HNSW index with new parameters.
+// The new graph is warm-started from the existing index rather than
+// re-read from the cache, and replaces it once complete.
+func (vc *VectorCache) OptimizeIndexWithConfig(config HNSWConfig) error {
 	if vc.shardCount > 1 {
 		for _, shard := range vc.shards {
-			if err := shard.rebuildIndexFromCache(); err != nil {
+			if err := shard.OptimizeIndexWithConfig(config); err != nil {
 				return err
 			}
 		}
+		vc.mu.Lock()
+		vc.hnsw = config
+		vc.mu.Unlock()
 		return nil
 	}
 
-	// Check index type.
-	switch vc.config.IndexType {
-	case "hnsw":
-		// Rebuild HNSW index for optimization.
-		return vc.rebuildIndexFromCache()
-	default:
-		// FlatSearch does not require optimization.
+	// FlatSearch does not require optimization.
+	if vc.config.IndexType != "hnsw" {
 		return nil
 	}
+	return vc.RebuildIndex(context.Background(), RebuildOptions{HNSW: &config})
 }
 
 // SetItemCollector sets the vector collector.
-// Users can provide a function to collect all vectors for index rebuilding.
+// Users can provide a function to collect all vectors for index rebuilding,
+// instead of walking the cache.
 func (vc *VectorCache) SetItemCollector(collector func() []*VectorItem) {
 	if vc.shardCount > 1 {
 		for _, shard := range vc.shards {
@@ -532,7 +709,8 @@ func (vc *VectorCache) SetItemCollector(collector func() []*VectorItem) {
 	vc.itemCollector = collector
 }
 
-// GetAllItems returns all vectors (requires setting a collector first).
+// GetAllItems returns all vectors, from the collector if one is set and from
+// the cache otherwise.
 func (vc *VectorCache) GetAllItems() []*VectorItem {
 	if vc.itemCollector != nil {
 		return vc.itemCollector()
@@ -552,12 +730,21 @@ func (vc *VectorCache) Export() []*VectorItem {
 // Import imports vector data.
 // It imports data from a vector list.
 func (vc *VectorCache) Import(items []*VectorItem) error {
-	for _, item := range items {
+	return vc.ImportWithProgress(items, nil)
+}
+
+// ImportWithProgress imports data from a vector list, reporting progress
+// (items done, total, rate and ETA) to onProgress.
+func (vc *VectorCache) ImportWithProgress(items []*VectorItem, onProgress func(IndexProgress)) error {
+	tracker := newProgressTracker(len(items), onProgress)
+	for i, item := range items {
 		if err := vc.Add(item.ID, item.Vector, item.Metadata); err != nil {
 			return err
 		}
+		tracker.update(i + 1)
 	}
 	vc.Wait()
+	tracker.finish(len(items))
 	return nil
 }
 
@@ -566,6 +753,7 @@ type ExportData struct {
 	Metric    MetricType    `json:"metric"`
 	IndexType string        `json:"index_type"`
 	Items     []ExportItem  `json:"items"`
+	Routes    map[string]int `json:"routes,omitempty"` // ID → shard table, if persistent routing is enabled.
 }
 
 // ExportItem is an item for export.
@@ -592,6 +780,7 @@ func (vc *VectorCache) ExportToBytes() ([]byte, error) {
 		Metric:    vc.config.Metric,
 		IndexType: vc.config.IndexType,
 		Items:     exportItems,
+		Routes:    vc.RoutingTable(),
 	}
 
 	return json.Marshal(data)
@@ -609,6 +798,11 @@ func (vc *VectorCache) ImportFromBytes(data []byte) error {
 		// Warning: metric does not match.
 	}
 
+	// Restore shard assignments before routing the vectors.
+	if vc.routes != nil && exportData.Routes != nil {
+		vc.SetRoutingTable(exportData.Routes)
+	}
+
 	// Import vectors.
 	for _, item := range exportData.Items {
 		vec := Vector(item.Vector)
@@ -621,23 +815,62 @@ func (vc *VectorCache) ImportFromBytes(data []byte) error {
 	return nil
 }
 
+// IndexMemory describes the memory held by an index.
+type IndexMemory struct {
+	LiveBytes      int64 // Vectors, IDs and metadata of live vectors.
+	Tombstones     int   // Deleted nodes still present in the graph.
+	TombstoneBytes int64 // Memory still held by deleted nodes.
+}
+
+// memoryReporter is implemented by indexes that keep deleted nodes around.
+type memoryReporter interface {
+	Memory() IndexMemory
+}
+
+// indexMemory returns the memory held by the indexes of all shards.
+func (vc *VectorCache) indexMemory() IndexMemory {
+	if vc.shardCount > 1 {
+		var total IndexMemory
+		for _, shard := range vc.shards {
+			m := shard.indexMemory()
+			total.LiveBytes += m.LiveBytes
+			total.Tombstones += m.Tombstones
+			total.TombstoneBytes += m.TombstoneBytes
+		}
+		return total
+	}
+	if r, ok := vc.currentIndex().(memoryReporter); ok {
+		return r.Memory()
+	}
+	return IndexMemory{}
+}
+
 // GetStats returns statistics.
+// Deleted HNSW nodes no longer count toward len; the memory they still hold
+// until the index is rebuilt is reported as tombstoneBytes.
 func (vc *VectorCache) GetStats() map[string]interface{} {
+	mem := vc.indexMemory()
 	stats := map[string]interface{}{
-		"len":          vc.Len(),
-		"cost":         vc.Cost(),
-		"maxCost":      vc.config.MaxCost,
-		"shardCount":   vc.shardCount,
-		"indexType":    vc.config.IndexType,
-		"metric":       vc.config.Metric,
+		"len":            vc.Len(),
+		"cost":           vc.Cost(),
+		"maxCost":        vc.config.MaxCost,
+		"shardCount":     vc.shardCount,
+		"indexType":      vc.config.IndexType,
+		"metric":         vc.config.Metric,
+		"indexBytes":     mem.LiveBytes,
+		"tombstones":     mem.Tombstones,
+		"tombstoneBytes": mem.TombstoneBytes,
 	}
 
 	if vc.shardCount > 1 {
 		shardStats := make([]map[string]interface{}, vc.shardCount)
 		for i, shard := range vc.shards {
+			shardMem := shard.indexMemory()
 			shardStats[i] = map[string]interface{}{
-				"len":   shard.index.Len(),
-				"cost":  shard.cache.Cost(),
+				"len":            shard.currentIndex().Len(),
+				"cost":           shard.cache.Cost(),
+				"tombstones":     shardMem.Tombstones,
+				"tombstoneBytes": shardMem.TombstoneBytes,
 			}
 		}
 		stats["shards"] = shardStats
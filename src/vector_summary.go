@@ -0,0 +1,73 @@
+package src
+
+import "errors"
+
+// ErrNoVectors is returned when no stored vector matches a summary query.
+var ErrNoVectors = errors.New("no matching vectors")
+
+// VectorSummary describes a set of vectors.
+type VectorSummary struct {
+	// Count is the number of vectors summarised.
+	Count int
+
+	// Mean is the per-dimension mean (the centroid).
+	Mean Vector
+
+	// Variance is the per-dimension population variance.
+	Variance Vector
+}
+
+// Centroid returns the mean vector of the stored vectors matching filter.
+// A nil filter matches every vector.
+func (vc *VectorCache) Centroid(filter FilterFunc) (Vector, error) {
+	summary, err := vc.Stats(filter)
+	if err != nil {
+		return nil, err
+	}
+	return summary.Mean, nil
+}
+
+// Stats returns the mean and per-dimension variance of the stored vectors
+// matching filter, e.g. to detect drift between embedding model versions by
+// comparing the summaries of two subsets. A nil filter matches every vector.
+func (vc *VectorCache) Stats(filter FilterFunc) (*VectorSummary, error) {
+	var (
+		count int
+		mean  []float64
+		m2    []float64
+	)
+
+	// Welford's online algorithm, accumulated in float64.
+	for _, item := range vc.indexedItems() {
+		if filter != nil && !filter(item.Metadata) {
+			continue
+		}
+		if mean == nil {
+			mean = make([]float64, len(item.Vector))
+			m2 = make([]float64, len(item.Vector))
+		} else if len(item.Vector) != len(mean) {
+			return nil, &VectorError{Op: "stats", Err: ErrDimensionMismatch}
+		}
+
+		count++
+		for d, v := range item.Vector {
+			delta := float64(v) - mean[d]
+			mean[d] += delta / float64(count)
+			m2[d] += delta * (float64(v) - mean[d])
+		}
+	}
+	if count == 0 {
+		return nil, &VectorError{Op: "stats", Err: ErrNoVectors}
+	}
+
+	summary := &VectorSummary{
+		Count:    count,
+		Mean:     make(Vector, len(mean)),
+		Variance: make(Vector, len(mean)),
+	}
+	for d := range mean {
+		summary.Mean[d] = float32(mean[d])
+		summary.Variance[d] = float32(m2[d] / float64(count))
+	}
+	return summary, nil
+}
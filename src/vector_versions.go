@@ -0,0 +1,268 @@
+package src
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUnknownVersion is returned when a model version has no index.
+	ErrUnknownVersion = errors.New("unknown model version")
+	// ErrVersionExists is returned when adding a model version that already has an index.
+	ErrVersionExists = errors.New("model version already exists")
+)
+
+// VersionedResult is a search result tagged with the model version whose
+// index produced it.
+type VersionedResult struct {
+	SearchResult
+	Version string
+}
+
+// modelIndex is the store and merge weight of a single model version.
+type modelIndex struct {
+	store  *VectorCache
+	weight float32
+}
+
+// VersionedVectorStore keeps one vector store per embedding model version, so
+// vectors from a new model can be indexed next to the old ones during a
+// migration. Searches fan out across versions and merge the results by
+// weighted score; Cutover drops every version but the new one.
+type VersionedVectorStore struct {
+	mu       sync.RWMutex
+	config   *VectorStoreConfig
+	versions map[string]*modelIndex
+	current  string
+}
+
+// NewVersionedVectorStore creates a versioned store serving the given model version.
+func NewVersionedVectorStore(config *VectorStoreConfig, version string) (*VersionedVectorStore, error) {
+	if config == nil {
+		defaultCfg := DefaultVectorStoreConfig()
+		config = &defaultCfg
+	}
+	s := &VersionedVectorStore{
+		config:   config,
+		versions: make(map[string]*modelIndex),
+	}
+	if err := s.AddVersion(version, nil); err != nil {
+		return nil, err
+	}
+	s.current = version
+	return s, nil
+}
+
+// AddVersion starts a migration by creating an index for a new model version.
+// A nil config uses the store's configuration; a different one is needed when
+// the new model's dimensions or metric differ.
+func (s *VersionedVectorStore) AddVersion(version string, config *VectorStoreConfig) error {
+	if config == nil {
+		cfg := *s.config
+		config = &cfg
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.versions[version]; ok {
+		return ErrVersionExists
+	}
+	store, err := NewVectorStore(config)
+	if err != nil {
+		return err
+	}
+	s.versions[version] = &modelIndex{store: store, weight: 1}
+	return nil
+}
+
+// Version returns the store of a model version.
+func (s *VersionedVectorStore) Version(version string) (*VectorCache, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mi, ok := s.versions[version]
+	if !ok {
+		return nil, false
+	}
+	return mi.store, true
+}
+
+// Versions returns the indexed model versions, sorted.
+func (s *VersionedVectorStore) Versions() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := make([]string, 0, len(s.versions))
+	for v := range s.versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Current returns the serving model version.
+func (s *VersionedVectorStore) Current() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// SetWeight sets the weight of a version's scores when merging results.
+// A weight of 0 excludes the version from searches.
+func (s *VersionedVectorStore) SetWeight(version string, weight float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mi, ok := s.versions[version]
+	if !ok {
+		return ErrUnknownVersion
+	}
+	mi.weight = weight
+	return nil
+}
+
+// Add adds a vector embedded with the given model version.
+func (s *VersionedVectorStore) Add(version, id string, vector Vector, metadata map[string]any) error {
+	store, ok := s.Version(version)
+	if !ok {
+		return ErrUnknownVersion
+	}
+	return store.Add(id, vector, metadata)
+}
+
+// Get retrieves a vector and the model version it was embedded with,
+// preferring the serving version.
+func (s *VersionedVectorStore) Get(id string) (*VectorItem, string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if item, ok := s.versions[s.current].store.Get(id); ok {
+		return item, s.current, true
+	}
+	for version, mi := range s.versions {
+		if version == s.current {
+			continue
+		}
+		if item, ok := mi.store.Get(id); ok {
+			return item, version, true
+		}
+	}
+	return nil, "", false
+}
+
+// Delete removes a vector from every version.
+func (s *VersionedVectorStore) Delete(id string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, mi := range s.versions {
+		mi.store.Delete(id)
+	}
+}
+
+// Search fans out across model versions and merges the results. queries maps
+// each version to the query embedded with that model; versions without a
+// query are skipped. Scores are weighted per version (multiplied for inner
+// product, divided for distances) and an ID found in several versions is
+// returned once, with its best weighted score.
+func (s *VersionedVectorStore) Search(queries map[string]Vector, k int) ([]VersionedResult, error) {
+	if k <= 0 {
+		k = 10
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type versionSearch struct {
+		version string
+		mi      *modelIndex
+		results []SearchResult
+		err     error
+	}
+	var searches []*versionSearch
+	for version := range queries {
+		mi, ok := s.versions[version]
+		if !ok {
+			return nil, ErrUnknownVersion
+		}
+		if mi.weight <= 0 {
+			continue
+		}
+		searches = append(searches, &versionSearch{version: version, mi: mi})
+	}
+
+	var wg sync.WaitGroup
+	for _, vs := range searches {
+		wg.Add(1)
+		go func(vs *versionSearch) {
+			defer wg.Done()
+			vs.results, vs.err = vs.mi.store.Search(queries[vs.version], k)
+		}(vs)
+	}
+	wg.Wait()
+
+	higherBetter := s.config.Metric == MetricIP
+	best := make(map[string]VersionedResult)
+	for _, vs := range searches {
+		if vs.err != nil {
+			return nil, vs.err
+		}
+		for _, r := range vs.results {
+			if higherBetter {
+				r.Score *= vs.mi.weight
+			} else {
+				r.Score /= vs.mi.weight
+			}
+			prev, seen := best[r.ID]
+			if !seen || (higherBetter && r.Score > prev.Score) || (!higherBetter && r.Score < prev.Score) {
+				best[r.ID] = VersionedResult{SearchResult: r, Version: vs.version}
+			}
+		}
+	}
+
+	merged := make([]VersionedResult, 0, len(best))
+	for _, r := range best {
+		merged = append(merged, r)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Score != merged[j].Score {
+			if higherBetter {
+				return merged[i].Score > merged[j].Score
+			}
+			return merged[i].Score < merged[j].Score
+		}
+		return merged[i].ID < merged[j].ID
+	})
+	if len(merged) > k {
+		merged = merged[:k]
+	}
+	return merged, nil
+}
+
+// Cutover completes a migration: version becomes the serving version and the
+// indexes of all other versions are closed and dropped.
+func (s *VersionedVectorStore) Cutover(version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mi, ok := s.versions[version]
+	if !ok {
+		return ErrUnknownVersion
+	}
+	for v, old := range s.versions {
+		if v != version {
+			old.store.Close()
+			delete(s.versions, v)
+		}
+	}
+	mi.weight = 1
+	s.current = version
+	return nil
+}
+
+// Close closes the stores of all versions.
+func (s *VersionedVectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mi := range s.versions {
+		mi.store.Close()
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package src
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+)
+
+// warmBatchSize is how many entries WarmUp applies per trip to a write goroutine
+const warmBatchSize = 256
+
+// WarmEntry is an entry loaded by WarmUp
+type WarmEntry struct {
+	Key   string
+	Value any
+	Cost  int64         // 0 uses Config.Cost or 1
+	TTL   time.Duration // 0 means no expiration
+}
+
+// WarmSource produces the entries of a WarmUp by calling emit for each of
+// them. A user iterator is any such function; an error stops the warm-up
+type WarmSource func(emit func(WarmEntry)) error
+
+// WarmFromSnapshot reads entries written by SaveSnapshot from r. Entries
+// that expired since the snapshot are skipped
+func WarmFromSnapshot(r io.Reader) WarmSource {
+	return func(emit func(WarmEntry)) error {
+		dec := gob.NewDecoder(r)
+		if err := readSnapshotHeader(dec); err != nil {
+			return err
+		}
+		_, err := readEntries(dec, false, func(e *shardEntry) bool {
+			var ttl time.Duration
+			if e.Expiration > 0 {
+				ttl = time.Duration(e.Expiration - time.Now().UnixNano())
+				if ttl <= 0 {
+					return false
+				}
+			}
+			emit(WarmEntry{Key: e.Key, Value: e.Value, Cost: e.Cost, TTL: ttl})
+			return true
+		})
+		return err
+	}
+}
+
+// WarmFromFile reads a snapshot written by SaveToFile
+func WarmFromFile(path string) WarmSource {
+	return func(emit func(WarmEntry)) error {
+		_, err := loadFile(path, func(r io.Reader) (int, error) {
+			return 0, WarmFromSnapshot(r)(emit)
+		})
+		return err
+	}
+}
+
+// WarmFromLoader loads keys with loader, e.g. the hot keys of the previous
+// run. The first failing load stops the warm-up
+func WarmFromLoader(keys []string, loader func(key string) (any, int64, error)) WarmSource {
+	return func(emit func(WarmEntry)) error {
+		for _, key := range keys {
+			value, cost, err := loader(key)
+			if err != nil {
+				return fmt.Errorf("warm up %q: %w", key, err)
+			}
+			emit(WarmEntry{Key: key, Value: value, Cost: cost})
+		}
+		return nil
+	}
+}
+
+// warmer batches warm entries per shard and applies each batch on the
+// shard's write goroutine
+type warmer struct {
+	shard   func(key string) *RistrettoCache
+	batches map[*RistrettoCache][]*setItem
+	loaded  int
+	err     error
+
+	// stored, if set, is called with each item a batch stored, after the
+	// batch was applied and off the write goroutine
+	stored func(item *setItem)
+}
+
+func newWarmer(shard func(key string) *RistrettoCache) *warmer {
+	return &warmer{shard: shard, batches: make(map[*RistrettoCache][]*setItem)}
+}
+
+// add queues an entry, applying its shard's batch once it is full
+func (w *warmer) add(e WarmEntry) {
+	if w.err != nil {
+		return
+	}
+	item := &setItem{key: e.Key, value: e.Value, cost: e.Cost, internal: true}
+	if e.TTL > 0 {
+		item.expiration = time.Now().Add(e.TTL).UnixNano()
+	}
+	w.addItem(item)
+}
+
+// addItem queues an item, applying its shard's batch once it is full
+func (w *warmer) addItem(item *setItem) {
+	if w.err != nil {
+		return
+	}
+	c := w.shard(item.key)
+	w.batches[c] = append(w.batches[c], item)
+	if len(w.batches[c]) >= warmBatchSize {
+		w.apply(c)
+	}
+}
+
+// apply writes the batch of c on its write goroutine, after the sets
+// buffered before it. Unlike Set, nothing is dropped when the buffer is full
+func (w *warmer) apply(c *RistrettoCache) {
+	batch := w.batches[c]
+	delete(w.batches, c)
+	if len(batch) == 0 || w.err != nil {
+		return
+	}
+	var stored []*setItem
+	err := c.applySync(batch[0].key, func() {
+		for _, item := range batch {
+			if c.storeWarm(item) {
+				stored = append(stored, item)
+			}
+		}
+	})
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.loaded += len(stored)
+	if w.stored != nil {
+		for _, item := range stored {
+			w.stored(item)
+		}
+	}
+}
+
+// flush applies the remaining batches
+func (w *warmer) flush() error {
+	for c := range w.batches {
+		w.apply(c)
+	}
+	return w.err
+}
+
+// run loads source and returns the number of stored entries
+func (w *warmer) run(source WarmSource) (int, error) {
+	err := source(w.add)
+	if ferr := w.flush(); err == nil {
+		err = ferr
+	}
+	return w.loaded, err
+}
+
+// storeWarm stores a warm entry unless it exceeds MaxCost (write goroutine only)
+func (c *RistrettoCache) storeWarm(item *setItem) bool {
+	item.cost = c.itemCost(item.value, item.cost)
+	if item.cost > c.maxCost.Load() {
+		c.metrics.setsRejected.Add(1)
+		return false
+	}
+	return c.store(item)
+}
+
+// WarmUp bulk-loads the entries of source, e.g. WarmFromFile or a user
+// iterator, and returns how many were stored. Entries are written in
+// batches on the write goroutine instead of through the set buffer, so none
+// are dropped and the cache is warm when WarmUp returns. Call it before the
+// cache starts serving; write limits and invalidation are not applied
+func (c *RistrettoCache) WarmUp(source WarmSource) (int, error) {
+	return newWarmer(func(string) *RistrettoCache { return c }).run(source)
+}
+
+// WarmUp bulk-loads the entries of source into their shards, see
+// RistrettoCache.WarmUp
+func (sc *ShardedCacheV2) WarmUp(source WarmSource) (int, error) {
+	return newWarmer(sc.getShard).run(source)
+}
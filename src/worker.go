@@ -0,0 +1,60 @@
+package src
+
+import (
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCloseTimeout is how long Close waits for background workers by default
+const DefaultCloseTimeout = 5 * time.Second
+
+// ErrWorkersStuck is returned by Close when background workers do not stop
+// within Config.CloseTimeout, e.g. because a callback blocks
+var ErrWorkersStuck = errors.New("cache workers did not stop")
+
+// goWorker runs fn on a goroutine tracked by wg. A panic in fn is logged and
+// fn is started again, so one bad callback does not stop the worker for good;
+// restarts are counted in restarts
+func goWorker(wg *sync.WaitGroup, name string, restarts *atomic.Int64, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !runRecovered(name, fn) {
+			restarts.Add(1)
+		}
+	}()
+}
+
+// runRecovered runs fn and reports whether it returned without panicking
+func runRecovered(name string, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("fastcache: %s panicked, restarting: %v\n%s", name, r, debug.Stack())
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+// waitTimeout waits for wg and reports whether it finished within timeout
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,269 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Write-behind defaults
+const (
+	DefaultWriteBehindQueue    = 4096
+	DefaultWriteBehindBatch    = 256
+	DefaultWriteBehindInterval = 100 * time.Millisecond
+	DefaultWriteBehindRetries  = 3
+	DefaultWriteBehindBackoff  = 50 * time.Millisecond
+)
+
+var (
+	// ErrWriteQueueFull is returned when the write-behind queue has no room;
+	// the write is applied neither to the cache nor to the store
+	ErrWriteQueueFull = errors.New("write-behind queue full")
+	// ErrWriteBehindClosed is returned by writes after Close
+	ErrWriteBehindClosed = errors.New("write-behind closed")
+)
+
+// StoreWrite is a write to a BackingStore: a set, or a delete if Deleted is true
+type StoreWrite struct {
+	Key     string
+	Value   any
+	TTL     time.Duration // TTL passed to SetWithTTL, 0 for Set
+	Deleted bool
+}
+
+// BackingStore is the system of record behind a cache in write-behind mode
+type BackingStore interface {
+	// Write applies a batch of writes in order. It is retried on error, so
+	// it must be idempotent
+	Write(ctx context.Context, batch []StoreWrite) error
+}
+
+// WriteBehindOptions configures a WriteBehind
+type WriteBehindOptions struct {
+	// QueueSize bounds the writes waiting to be flushed (default DefaultWriteBehindQueue)
+	QueueSize int
+	// BatchSize is the largest batch passed to the store (default DefaultWriteBehindBatch)
+	BatchSize int
+	// FlushInterval is how long a partial batch waits (default DefaultWriteBehindInterval)
+	FlushInterval time.Duration
+	// MaxRetries is how often a failed batch is retried (default DefaultWriteBehindRetries)
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for each one (default DefaultWriteBehindBackoff)
+	RetryBackoff time.Duration
+	// OnError is called with a batch that still failed after MaxRetries
+	OnError func(batch []StoreWrite, err error)
+}
+
+// WriteBehind writes to a cache and acknowledges from memory, then flushes
+// the writes to a BackingStore in batches from a bounded queue
+type WriteBehind struct {
+	cache Cache
+	store BackingStore
+	opts  WriteBehindOptions
+
+	mu      sync.RWMutex // guards closed against sends on queue
+	closed  bool
+	queue   chan StoreWrite
+	flushCh chan chan struct{}
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+
+	flushed  atomic.Int64
+	failed   atomic.Int64
+	restarts atomic.Int64
+}
+
+// NewWriteBehind creates a WriteBehind in front of store and starts its flusher
+func NewWriteBehind(cache Cache, store BackingStore, opts WriteBehindOptions) *WriteBehind {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultWriteBehindQueue
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultWriteBehindBatch
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultWriteBehindInterval
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = DefaultWriteBehindRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultWriteBehindBackoff
+	}
+
+	wb := &WriteBehind{
+		cache:   cache,
+		store:   store,
+		opts:    opts,
+		queue:   make(chan StoreWrite, opts.QueueSize),
+		flushCh: make(chan chan struct{}),
+		stopCh:  make(chan struct{}),
+	}
+	goWorker(&wb.wg, "writeBehind", &wb.restarts, wb.run)
+	return wb
+}
+
+// Set writes value to the cache and queues it for the store
+func (wb *WriteBehind) Set(key string, value any, cost int64) error {
+	return wb.write(StoreWrite{Key: key, Value: value}, func() { wb.cache.Set(key, value, cost) })
+}
+
+// SetWithTTL is Set with a TTL for the cached value; the TTL is passed on
+// to the store, which may ignore it
+func (wb *WriteBehind) SetWithTTL(key string, value any, cost int64, ttl time.Duration) error {
+	return wb.write(StoreWrite{Key: key, Value: value, TTL: ttl}, func() { wb.cache.SetWithTTL(key, value, cost, ttl) })
+}
+
+// Del deletes key from the cache and queues the delete for the store
+func (wb *WriteBehind) Del(key string) error {
+	return wb.write(StoreWrite{Key: key, Deleted: true}, func() { wb.cache.Del(key) })
+}
+
+// write queues w and applies it to the cache once it is queued
+func (wb *WriteBehind) write(w StoreWrite, apply func()) error {
+	wb.mu.RLock()
+	defer wb.mu.RUnlock()
+	if wb.closed {
+		return ErrWriteBehindClosed
+	}
+	select {
+	case wb.queue <- w:
+		apply()
+		return nil
+	default:
+		return ErrWriteQueueFull
+	}
+}
+
+// Pending returns the number of writes waiting to be flushed
+func (wb *WriteBehind) Pending() int {
+	return len(wb.queue)
+}
+
+// Flushed returns the number of writes the store accepted
+func (wb *WriteBehind) Flushed() int64 {
+	return wb.flushed.Load()
+}
+
+// Failed returns the number of writes dropped after MaxRetries
+func (wb *WriteBehind) Failed() int64 {
+	return wb.failed.Load()
+}
+
+// Flush writes everything queued so far to the store and waits for it
+func (wb *WriteBehind) Flush() {
+	done := make(chan struct{})
+	select {
+	case wb.flushCh <- done:
+		<-done
+	case <-wb.stopCh:
+	}
+}
+
+// Close flushes the queue and stops the flusher. It does not close the cache
+func (wb *WriteBehind) Close() error {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return nil
+	}
+	wb.closed = true
+	wb.mu.Unlock()
+
+	close(wb.stopCh)
+	wb.wg.Wait()
+	return nil
+}
+
+// run collects queued writes into batches and flushes them when a batch is
+// full, the interval passes, Flush is called or the WriteBehind closes
+func (wb *WriteBehind) run() {
+	ticker := time.NewTicker(wb.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]StoreWrite, 0, wb.opts.BatchSize)
+	for {
+		select {
+		case w := <-wb.queue:
+			batch = append(batch, w)
+			if len(batch) >= wb.opts.BatchSize {
+				batch = wb.flush(batch)
+			}
+		case <-ticker.C:
+			batch = wb.flush(batch)
+		case done := <-wb.flushCh:
+			batch = wb.drain(batch)
+			close(done)
+		case <-wb.stopCh:
+			wb.drain(batch)
+			return
+		}
+	}
+}
+
+// drain flushes batch and everything queued
+func (wb *WriteBehind) drain(batch []StoreWrite) []StoreWrite {
+	for {
+		select {
+		case w := <-wb.queue:
+			batch = append(batch, w)
+			if len(batch) >= wb.opts.BatchSize {
+				batch = wb.flush(batch)
+			}
+		default:
+			return wb.flush(batch)
+		}
+	}
+}
+
+// flush writes batch to the store, retrying with backoff, and returns the
+// emptied batch
+func (wb *WriteBehind) flush(batch []StoreWrite) []StoreWrite {
+	if len(batch) == 0 {
+		return batch
+	}
+	batch = coalesceWrites(batch)
+
+	var err error
+	backoff := wb.opts.RetryBackoff
+	for attempt := 0; attempt <= wb.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = wb.store.Write(context.Background(), batch); err == nil {
+			wb.flushed.Add(int64(len(batch)))
+			return batch[:0]
+		}
+	}
+
+	wb.failed.Add(int64(len(batch)))
+	if wb.opts.OnError != nil {
+		failed := make([]StoreWrite, len(batch))
+		copy(failed, batch)
+		wb.opts.OnError(failed, err)
+	}
+	return batch[:0]
+}
+
+// coalesceWrites keeps only the last write of each key, in the order of
+// those last writes
+func coalesceWrites(batch []StoreWrite) []StoreWrite {
+	last := make(map[string]int, len(batch))
+	for i, w := range batch {
+		last[w.Key] = i
+	}
+	if len(last) == len(batch) {
+		return batch
+	}
+	n := 0
+	for i, w := range batch {
+		if last[w.Key] == i {
+			batch[n] = w
+			n++
+		}
+	}
+	return batch[:n]
+}